@@ -0,0 +1,496 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bridge implements an opt-in listener that translates Graphite
+// plaintext and StatsD metrics into Prometheus series, replacing separate
+// bridge daemons running alongside Prometheus.
+package bridge
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+)
+
+const (
+	// graphiteCommitBatch is the number of Graphite samples appended before
+	// the appender is committed, bounding how long samples stay invisible.
+	graphiteCommitBatch = 500
+)
+
+var (
+	ingestedSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "prometheus",
+		Subsystem: "bridge",
+		Name:      "ingested_samples_total",
+		Help:      "Number of samples ingested by the bridge receiver.",
+	}, []string{"protocol"})
+	droppedSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "prometheus",
+		Subsystem: "bridge",
+		Name:      "dropped_samples_total",
+		Help:      "Number of bridge samples dropped because they could not be parsed or translated.",
+	}, []string{"protocol"})
+
+	invalidMetricCharRE = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+	captureRefRE        = regexp.MustCompile(`\$(\d+)`)
+)
+
+func init() {
+	prometheus.MustRegister(ingestedSamples, droppedSamples)
+}
+
+// Bridge listens for Graphite plaintext writes on TCP and StatsD metrics on
+// UDP and appends the translated series to the given appendable. Graphite
+// samples are appended as they arrive; StatsD events are aggregated and
+// flushed as cumulative series on every flush interval.
+type Bridge struct {
+	logger        log.Logger
+	appendable    storage.Appendable
+	graphiteAddr  string
+	statsdAddr    string
+	flushInterval time.Duration
+
+	mtx      sync.Mutex
+	mappings []config.BridgeMapping
+	statsd   map[string]*statsdMetric
+
+	graphiteLn net.Listener
+	statsdConn net.PacketConn
+	quit       chan struct{}
+	wg         sync.WaitGroup
+}
+
+type statsdKind int
+
+const (
+	statsdCounter statsdKind = iota
+	statsdGauge
+	statsdTimer
+)
+
+// statsdMetric accumulates StatsD events of one series between flushes.
+// Counter and timer accumulations survive flushes so they are exposed as
+// cumulative series.
+type statsdMetric struct {
+	kind  statsdKind
+	lset  labels.Labels // Includes the metric name, timers get suffixes at flush.
+	sum   float64
+	count float64
+	value float64
+}
+
+// New returns a Bridge listening on the given addresses. An empty address
+// disables the respective protocol.
+func New(logger log.Logger, appendable storage.Appendable, graphiteAddr, statsdAddr string, flushInterval time.Duration) *Bridge {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &Bridge{
+		logger:        logger,
+		appendable:    appendable,
+		graphiteAddr:  graphiteAddr,
+		statsdAddr:    statsdAddr,
+		flushInterval: flushInterval,
+		statsd:        map[string]*statsdMetric{},
+		quit:          make(chan struct{}),
+	}
+}
+
+// ApplyConfig updates the mapping rules from the configuration.
+func (b *Bridge) ApplyConfig(cfg *config.Config) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.mappings = cfg.BridgeConfig.Mappings
+	return nil
+}
+
+// Run opens the configured listeners and blocks until Stop is called.
+func (b *Bridge) Run() error {
+	if b.graphiteAddr != "" {
+		ln, err := net.Listen("tcp", b.graphiteAddr)
+		if err != nil {
+			return errors.Wrap(err, "listen for Graphite")
+		}
+		b.graphiteLn = ln
+		level.Info(b.logger).Log("msg", "Listening for Graphite plaintext", "address", ln.Addr())
+		b.wg.Add(1)
+		go b.acceptGraphite(ln)
+	}
+	if b.statsdAddr != "" {
+		pc, err := net.ListenPacket("udp", b.statsdAddr)
+		if err != nil {
+			return errors.Wrap(err, "listen for StatsD")
+		}
+		b.statsdConn = pc
+		level.Info(b.logger).Log("msg", "Listening for StatsD", "address", pc.LocalAddr())
+		b.wg.Add(2)
+		go b.readStatsd(pc)
+		go b.flushLoop()
+	}
+	<-b.quit
+	b.wg.Wait()
+	return nil
+}
+
+// Stop closes the listeners and unblocks Run.
+func (b *Bridge) Stop() {
+	close(b.quit)
+	if b.graphiteLn != nil {
+		b.graphiteLn.Close()
+	}
+	if b.statsdConn != nil {
+		b.statsdConn.Close()
+	}
+}
+
+func (b *Bridge) acceptGraphite(ln net.Listener) {
+	defer b.wg.Done()
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-b.quit:
+				return
+			default:
+				level.Warn(b.logger).Log("msg", "Error accepting Graphite connection", "err", err)
+				continue
+			}
+		}
+		b.wg.Add(1)
+		go b.serveGraphite(c)
+	}
+}
+
+func (b *Bridge) serveGraphite(c net.Conn) {
+	defer b.wg.Done()
+	defer c.Close()
+
+	app := b.appendable.Appender(context.Background())
+	pending := 0
+	commit := func() {
+		if err := app.Commit(); err != nil {
+			level.Warn(b.logger).Log("msg", "Error committing Graphite samples", "err", err)
+		}
+		app = b.appendable.Appender(context.Background())
+		pending = 0
+	}
+
+	sc := bufio.NewScanner(c)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if err := b.appendGraphiteLine(app, line); err != nil {
+			droppedSamples.WithLabelValues("graphite").Inc()
+			level.Debug(b.logger).Log("msg", "Dropping Graphite line", "line", line, "err", err)
+			continue
+		}
+		ingestedSamples.WithLabelValues("graphite").Inc()
+		if pending++; pending >= graphiteCommitBatch {
+			commit()
+		}
+	}
+	commit()
+}
+
+// appendGraphiteLine parses "<path> <value> [<timestamp>]", with optional
+// ";tag=value" tags appended to the path.
+func (b *Bridge) appendGraphiteLine(app storage.Appender, line string) error {
+	fields := strings.Fields(line)
+	if len(fields) != 2 && len(fields) != 3 {
+		return errors.Errorf("expected 2 or 3 fields, got %d", len(fields))
+	}
+	v, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return errors.Wrap(err, "invalid value")
+	}
+	t := time.Now().UnixNano() / int64(time.Millisecond)
+	if len(fields) == 3 {
+		sec, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return errors.Wrap(err, "invalid timestamp")
+		}
+		t = int64(sec * 1000)
+	}
+
+	path := fields[0]
+	var tags []labels.Label
+	if i := strings.Index(path, ";"); i >= 0 {
+		for _, tag := range strings.Split(path[i+1:], ";") {
+			kv := strings.SplitN(tag, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return errors.Errorf("invalid tag %q", tag)
+			}
+			tags = append(tags, labels.Label{Name: invalidMetricCharRE.ReplaceAllString(kv[0], "_"), Value: kv[1]})
+		}
+		path = path[:i]
+	}
+
+	lset, err := b.translate(path, tags)
+	if err != nil {
+		return err
+	}
+	_, err = app.Add(lset, t, v)
+	return err
+}
+
+// translate resolves a dotted metric path through the configured mapping
+// rules. Unmatched paths keep their full path as the metric name with
+// unsupported characters replaced.
+func (b *Bridge) translate(path string, extra []labels.Label) (labels.Labels, error) {
+	b.mtx.Lock()
+	mappings := b.mappings
+	b.mtx.Unlock()
+
+	parts := strings.Split(path, ".")
+	for _, m := range mappings {
+		captures, ok := matchMapping(m.Match, parts)
+		if !ok {
+			continue
+		}
+		lb := map[string]string{model.MetricNameLabel: substituteCaptures(m.Name, captures)}
+		for k, v := range m.Labels {
+			lb[k] = substituteCaptures(v, captures)
+		}
+		return buildLabels(lb, extra)
+	}
+	name := invalidMetricCharRE.ReplaceAllString(path, "_")
+	return buildLabels(map[string]string{model.MetricNameLabel: name}, extra)
+}
+
+// matchMapping matches the dotted pattern against the path components. Each
+// "*" component matches exactly one path component and captures it.
+func matchMapping(pattern string, parts []string) ([]string, bool) {
+	pparts := strings.Split(pattern, ".")
+	if len(pparts) != len(parts) {
+		return nil, false
+	}
+	var captures []string
+	for i, pp := range pparts {
+		switch pp {
+		case "*":
+			captures = append(captures, parts[i])
+		case parts[i]:
+		default:
+			return nil, false
+		}
+	}
+	return captures, true
+}
+
+// substituteCaptures replaces $1..$n references with the captured path
+// components.
+func substituteCaptures(s string, captures []string) string {
+	return captureRefRE.ReplaceAllStringFunc(s, func(ref string) string {
+		i, err := strconv.Atoi(ref[1:])
+		if err != nil || i < 1 || i > len(captures) {
+			return ref
+		}
+		return captures[i-1]
+	})
+}
+
+func buildLabels(m map[string]string, extra []labels.Label) (labels.Labels, error) {
+	for _, l := range extra {
+		if l.Name != model.MetricNameLabel {
+			m[l.Name] = l.Value
+		}
+	}
+	lset := make(labels.Labels, 0, len(m))
+	for k, v := range m {
+		lset = append(lset, labels.Label{Name: k, Value: v})
+	}
+	sort.Sort(lset)
+	if !model.IsValidMetricName(model.LabelValue(lset.Get(model.MetricNameLabel))) {
+		return nil, errors.Errorf("invalid metric name %q", lset.Get(model.MetricNameLabel))
+	}
+	for _, l := range lset {
+		if !model.LabelName(l.Name).IsValid() {
+			return nil, errors.Errorf("invalid label name %q", l.Name)
+		}
+	}
+	return lset, nil
+}
+
+func (b *Bridge) readStatsd(pc net.PacketConn) {
+	defer b.wg.Done()
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-b.quit:
+				return
+			default:
+				level.Warn(b.logger).Log("msg", "Error reading StatsD packet", "err", err)
+				continue
+			}
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			if err := b.handleStatsdLine(line); err != nil {
+				droppedSamples.WithLabelValues("statsd").Inc()
+				level.Debug(b.logger).Log("msg", "Dropping StatsD line", "line", line, "err", err)
+				continue
+			}
+			ingestedSamples.WithLabelValues("statsd").Inc()
+		}
+	}
+}
+
+// handleStatsdLine aggregates a "<name>:<value>|<type>[|@<rate>]" event.
+func (b *Bridge) handleStatsdLine(line string) error {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return errors.New("missing value")
+	}
+	name := line[:i]
+	parts := strings.Split(line[i+1:], "|")
+	if len(parts) < 2 {
+		return errors.New("missing type")
+	}
+	raw := parts[0]
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return errors.Wrap(err, "invalid value")
+	}
+	rate := 1.0
+	if len(parts) > 2 && strings.HasPrefix(parts[2], "@") {
+		if rate, err = strconv.ParseFloat(parts[2][1:], 64); err != nil || rate <= 0 || rate > 1 {
+			return errors.Errorf("invalid sample rate %q", parts[2])
+		}
+	}
+
+	var kind statsdKind
+	switch parts[1] {
+	case "c":
+		kind = statsdCounter
+	case "g":
+		kind = statsdGauge
+	case "ms":
+		kind = statsdTimer
+	default:
+		return errors.Errorf("unsupported type %q", parts[1])
+	}
+
+	lset, err := b.translate(name, nil)
+	if err != nil {
+		return err
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	key := strconv.Itoa(int(kind)) + lset.String()
+	m, ok := b.statsd[key]
+	if !ok {
+		m = &statsdMetric{kind: kind, lset: lset}
+		b.statsd[key] = m
+	}
+	switch kind {
+	case statsdCounter:
+		m.sum += v / rate
+	case statsdGauge:
+		// Gauges prefixed with an explicit sign are deltas.
+		if raw[0] == '+' || raw[0] == '-' {
+			m.value += v
+		} else {
+			m.value = v
+		}
+	case statsdTimer:
+		// Timers arrive in milliseconds and are exposed in seconds.
+		m.sum += v / 1000 / rate
+		m.count += 1 / rate
+	}
+	return nil
+}
+
+func (b *Bridge) flushLoop() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.flushStatsd()
+		case <-b.quit:
+			b.flushStatsd()
+			return
+		}
+	}
+}
+
+// flushStatsd appends the current StatsD aggregates as cumulative series.
+func (b *Bridge) flushStatsd() {
+	b.mtx.Lock()
+	metrics := make([]*statsdMetric, 0, len(b.statsd))
+	for _, m := range b.statsd {
+		metrics = append(metrics, &statsdMetric{kind: m.kind, lset: m.lset, sum: m.sum, count: m.count, value: m.value})
+	}
+	b.mtx.Unlock()
+	if len(metrics) == 0 {
+		return
+	}
+
+	app := b.appendable.Appender(context.Background())
+	t := time.Now().UnixNano() / int64(time.Millisecond)
+	var err error
+	for _, m := range metrics {
+		switch m.kind {
+		case statsdCounter:
+			_, err = app.Add(m.lset, t, m.sum)
+		case statsdGauge:
+			_, err = app.Add(m.lset, t, m.value)
+		case statsdTimer:
+			if _, err = app.Add(suffixedLabels(m.lset, "_sum"), t, m.sum); err != nil {
+				break
+			}
+			_, err = app.Add(suffixedLabels(m.lset, "_count"), t, m.count)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		app.Rollback()
+		level.Warn(b.logger).Log("msg", "Error appending StatsD samples", "err", err)
+		return
+	}
+	if err := app.Commit(); err != nil {
+		level.Warn(b.logger).Log("msg", "Error committing StatsD samples", "err", err)
+	}
+}
+
+func suffixedLabels(lset labels.Labels, suffix string) labels.Labels {
+	return labels.NewBuilder(lset).Set(model.MetricNameLabel, lset.Get(model.MetricNameLabel)+suffix).Labels()
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bridge
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+)
+
+type testSample struct {
+	lset labels.Labels
+	t    int64
+	v    float64
+}
+
+type testAppendable struct {
+	mtx     sync.Mutex
+	samples []testSample
+}
+
+func (a *testAppendable) Appender(_ context.Context) storage.Appender { return a }
+
+func (a *testAppendable) Add(l labels.Labels, t int64, v float64) (uint64, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.samples = append(a.samples, testSample{lset: l, t: t, v: v})
+	return 0, nil
+}
+
+func (a *testAppendable) AddFast(ref uint64, t int64, v float64) error { return nil }
+func (a *testAppendable) Commit() error                                { return nil }
+func (a *testAppendable) Rollback() error                              { return nil }
+
+func (a *testAppendable) byName(name string) []testSample {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	var out []testSample
+	for _, s := range a.samples {
+		if s.lset.Get(labels.MetricName) == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func newTestBridge(t *testing.T, app storage.Appendable) *Bridge {
+	b := New(nil, app, "", "", time.Hour)
+	require.NoError(t, b.ApplyConfig(&config.Config{
+		BridgeConfig: config.BridgeConfig{
+			Mappings: []config.BridgeMapping{
+				{
+					Match:  "servers.*.cpu.*",
+					Name:   "cpu_usage",
+					Labels: map[string]string{"host": "$1", "mode": "$2"},
+				},
+			},
+		},
+	}))
+	return b
+}
+
+func TestBridgeTranslate(t *testing.T) {
+	b := newTestBridge(t, &testAppendable{})
+
+	lset, err := b.translate("servers.web01.cpu.idle", nil)
+	require.NoError(t, err)
+	require.Equal(t, labels.FromStrings(
+		labels.MetricName, "cpu_usage", "host", "web01", "mode", "idle",
+	), lset)
+
+	// Unmatched paths keep the full path as the metric name.
+	lset, err = b.translate("unmatched.metric-path", nil)
+	require.NoError(t, err)
+	require.Equal(t, labels.FromStrings(labels.MetricName, "unmatched_metric_path"), lset)
+}
+
+func TestBridgeGraphiteLines(t *testing.T) {
+	app := &testAppendable{}
+	b := newTestBridge(t, app)
+
+	require.NoError(t, b.appendGraphiteLine(app, "servers.web01.cpu.idle 98.5 1600000000"))
+	require.NoError(t, b.appendGraphiteLine(app, "queue.depth;queue=billing 7 1600000000"))
+	require.Error(t, b.appendGraphiteLine(app, "not a valid line at all"))
+
+	cpu := app.byName("cpu_usage")
+	require.Equal(t, 1, len(cpu))
+	require.Equal(t, 98.5, cpu[0].v)
+	require.Equal(t, int64(1600000000000), cpu[0].t)
+	require.Equal(t, "web01", cpu[0].lset.Get("host"))
+
+	// Graphite tags become labels.
+	depth := app.byName("queue_depth")
+	require.Equal(t, 1, len(depth))
+	require.Equal(t, "billing", depth[0].lset.Get("queue"))
+}
+
+func TestBridgeStatsdAggregation(t *testing.T) {
+	app := &testAppendable{}
+	b := newTestBridge(t, app)
+
+	require.NoError(t, b.handleStatsdLine("requests:1|c"))
+	require.NoError(t, b.handleStatsdLine("requests:1|c|@0.5"))
+	require.NoError(t, b.handleStatsdLine("queue_depth:7|g"))
+	require.NoError(t, b.handleStatsdLine("queue_depth:-2|g"))
+	require.NoError(t, b.handleStatsdLine("latency:250|ms"))
+	require.NoError(t, b.handleStatsdLine("latency:750|ms"))
+	require.Error(t, b.handleStatsdLine("bogus"))
+	require.Error(t, b.handleStatsdLine("histo:1|h"))
+
+	b.flushStatsd()
+
+	// Counters accumulate across events, scaled by the sample rate.
+	require.Equal(t, 3.0, app.byName("requests")[0].v)
+	// Sign-prefixed gauge values are deltas.
+	require.Equal(t, 5.0, app.byName("queue_depth")[0].v)
+	// Timers are exposed as cumulative seconds with an event count.
+	require.Equal(t, 1.0, app.byName("latency_sum")[0].v)
+	require.Equal(t, 2.0, app.byName("latency_count")[0].v)
+
+	// Counters stay cumulative across flushes.
+	require.NoError(t, b.handleStatsdLine("requests:2|c"))
+	b.flushStatsd()
+	samples := app.byName("requests")
+	require.Equal(t, 5.0, samples[len(samples)-1].v)
+}
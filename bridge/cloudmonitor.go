@@ -0,0 +1,272 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/pkg/alibaba"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// cloudMonitorStatistics are the aggregate fields a CloudMonitor datapoint
+// may carry; each present field becomes its own series.
+var cloudMonitorStatistics = []string{"Average", "Minimum", "Maximum", "Sum", "Value"}
+
+// CloudMonitor periodically pulls the configured metrics from the Alibaba
+// Cloud CloudMonitor DescribeMetricList API and appends them as series, so
+// SLB or RDS infrastructure metrics end up next to regular exporter metrics.
+// The endpoint is taken from the ALIBABA_CLOUD_CMS_ENDPOINT environment
+// variable (e.g. https://metrics.cn-hangzhou.aliyuncs.com) and the
+// credentials from the same variables as the OSS block uploader.
+type CloudMonitor struct {
+	logger     log.Logger
+	appendable storage.Appendable
+	client     *http.Client
+
+	mtx sync.Mutex
+	cfg config.CloudMonitorConfig
+	// lastSeen tracks the newest committed timestamp per series so datapoints
+	// returned by consecutive pulls are not ingested twice.
+	lastSeen map[string]int64
+
+	quit chan struct{}
+}
+
+// NewCloudMonitor returns a CloudMonitor bridge appending to app. The metrics
+// to pull are supplied through ApplyConfig.
+func NewCloudMonitor(logger log.Logger, app storage.Appendable) *CloudMonitor {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &CloudMonitor{
+		logger:     logger,
+		appendable: app,
+		client:     &http.Client{Timeout: 30 * time.Second},
+		lastSeen:   map[string]int64{},
+		quit:       make(chan struct{}),
+	}
+}
+
+// ApplyConfig updates the pulled metrics from the configuration.
+func (c *CloudMonitor) ApplyConfig(cfg *config.Config) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.cfg = cfg.BridgeConfig.CloudMonitor
+	return nil
+}
+
+// Run pulls the configured metrics on every interval until Stop is called.
+func (c *CloudMonitor) Run() error {
+	for {
+		c.mtx.Lock()
+		interval := time.Duration(c.cfg.Interval)
+		c.mtx.Unlock()
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		select {
+		case <-time.After(interval):
+			c.poll(context.Background())
+		case <-c.quit:
+			return nil
+		}
+	}
+}
+
+// Stop terminates Run.
+func (c *CloudMonitor) Stop() {
+	close(c.quit)
+}
+
+// poll pulls every configured target once and appends the new datapoints.
+func (c *CloudMonitor) poll(ctx context.Context) {
+	c.mtx.Lock()
+	targets := c.cfg.Targets
+	c.mtx.Unlock()
+
+	for _, t := range targets {
+		if err := c.pollTarget(ctx, t); err != nil {
+			droppedSamples.WithLabelValues("cloudmonitor").Inc()
+			level.Warn(c.logger).Log(
+				"msg", "Error pulling CloudMonitor metric",
+				"namespace", t.Namespace, "metric", t.MetricName, "err", err,
+			)
+		}
+	}
+}
+
+func (c *CloudMonitor) pollTarget(ctx context.Context, t config.CloudMonitorTarget) error {
+	datapoints, err := c.fetchDatapoints(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	app := c.appendable.Appender(ctx)
+	appended := 0
+	// The new high-water marks only move into lastSeen once the batch has
+	// been committed; on append or commit errors the whole batch is
+	// retried on the next poll instead of being lost.
+	pending := map[string]int64{}
+	for _, dp := range datapoints {
+		ts, ok := dp["timestamp"].(float64)
+		if !ok {
+			continue
+		}
+		for _, stat := range cloudMonitorStatistics {
+			v, ok := dp[stat].(float64)
+			if !ok {
+				continue
+			}
+			lset := cloudMonitorLabels(t, dp, stat)
+			key := lset.String()
+			c.mtx.Lock()
+			seen := c.lastSeen[key] >= int64(ts)
+			c.mtx.Unlock()
+			if seen || pending[key] >= int64(ts) {
+				continue
+			}
+			if _, err := app.Add(lset, int64(ts), v); err != nil {
+				app.Rollback()
+				return err
+			}
+			pending[key] = int64(ts)
+			appended++
+		}
+	}
+	if appended == 0 {
+		app.Rollback()
+		return nil
+	}
+	if err := app.Commit(); err != nil {
+		return err
+	}
+	c.mtx.Lock()
+	for key, ts := range pending {
+		if ts > c.lastSeen[key] {
+			c.lastSeen[key] = ts
+		}
+	}
+	c.mtx.Unlock()
+	ingestedSamples.WithLabelValues("cloudmonitor").Add(float64(appended))
+	return nil
+}
+
+// fetchDatapoints queries DescribeMetricList for the target, following
+// NextToken continuations.
+func (c *CloudMonitor) fetchDatapoints(ctx context.Context, t config.CloudMonitorTarget) ([]map[string]interface{}, error) {
+	endpoint := os.Getenv("ALIBABA_CLOUD_CMS_ENDPOINT")
+	if endpoint == "" {
+		return nil, errors.New("ALIBABA_CLOUD_CMS_ENDPOINT is not set")
+	}
+
+	params := map[string]string{
+		"Namespace":  t.Namespace,
+		"MetricName": t.MetricName,
+		"Length":     "1000",
+	}
+	if t.Period > 0 {
+		params["Period"] = strconv.Itoa(t.Period)
+	}
+	if len(t.Dimensions) > 0 {
+		b, err := json.Marshal([]map[string]string{t.Dimensions})
+		if err != nil {
+			return nil, err
+		}
+		params["Dimensions"] = string(b)
+	}
+
+	var datapoints []map[string]interface{}
+	// Bound the number of continuations so a misbehaving endpoint cannot
+	// stall the poll loop indefinitely.
+	for page := 0; page < 10; page++ {
+		query, err := alibaba.SignedRPCQuery("DescribeMetricList", "2019-01-01", params)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest("GET", endpoint+"/?"+query, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		var body struct {
+			Success    bool   `json:"Success"`
+			Code       string `json:"Code"`
+			Message    string `json:"Message"`
+			Datapoints string `json:"Datapoints"`
+			NextToken  string `json:"NextToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK || !body.Success {
+			return nil, errors.Errorf("unexpected status %s: %s %s", resp.Status, body.Code, body.Message)
+		}
+		if body.Datapoints != "" {
+			var pts []map[string]interface{}
+			if err := json.Unmarshal([]byte(body.Datapoints), &pts); err != nil {
+				return nil, errors.Wrap(err, "parsing datapoints")
+			}
+			datapoints = append(datapoints, pts...)
+		}
+		if body.NextToken == "" {
+			return datapoints, nil
+		}
+		params["NextToken"] = body.NextToken
+	}
+	return datapoints, nil
+}
+
+// cloudMonitorLabels builds the series labels for one datapoint statistic.
+// String-valued datapoint fields are the dimensions (instanceId and friends)
+// and become labels.
+func cloudMonitorLabels(t config.CloudMonitorTarget, dp map[string]interface{}, stat string) labels.Labels {
+	name := "cloudmonitor_" + cloudMonitorName(t.Namespace) + "_" + cloudMonitorName(t.MetricName) + "_" + strings.ToLower(stat)
+	lset := labels.Labels{{Name: model.MetricNameLabel, Value: name}}
+	for k, v := range dp {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		lset = append(lset, labels.Label{Name: invalidMetricCharRE.ReplaceAllString(k, "_"), Value: s})
+	}
+	sort.Sort(lset)
+	return lset
+}
+
+// cloudMonitorName lowercases a CloudMonitor identifier and replaces the
+// characters a metric name cannot contain.
+func cloudMonitorName(s string) string {
+	return invalidMetricCharRE.ReplaceAllString(strings.ToLower(s), "_")
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bridge
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/storage"
+)
+
+func TestCloudMonitorPoll(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		require.Equal(t, "DescribeMetricList", q.Get("Action"))
+		require.Equal(t, "acs_slb_dashboard", q.Get("Namespace"))
+		require.Equal(t, "TrafficRXNew", q.Get("MetricName"))
+		require.Equal(t, "test-key", q.Get("AccessKeyId"))
+		require.NotEmpty(t, q.Get("Signature"))
+		if q.Get("NextToken") == "" {
+			w.Write([]byte(`{"Success":true,"NextToken":"page2","Datapoints":"[{\"timestamp\":1600000060000,\"instanceId\":\"lb-1\",\"Average\":10,\"Maximum\":20}]"}`))
+			return
+		}
+		w.Write([]byte(`{"Success":true,"Datapoints":"[{\"timestamp\":1600000120000,\"instanceId\":\"lb-1\",\"Average\":30,\"Maximum\":40}]"}`))
+	}))
+	defer srv.Close()
+
+	os.Setenv("ALIBABA_CLOUD_CMS_ENDPOINT", srv.URL)
+	os.Setenv("ALIBABA_CLOUD_ACCESS_KEY_ID", "test-key")
+	os.Setenv("ALIBABA_CLOUD_ACCESS_KEY_SECRET", "test-secret")
+	defer os.Unsetenv("ALIBABA_CLOUD_CMS_ENDPOINT")
+	defer os.Unsetenv("ALIBABA_CLOUD_ACCESS_KEY_ID")
+	defer os.Unsetenv("ALIBABA_CLOUD_ACCESS_KEY_SECRET")
+
+	app := &testAppendable{}
+	c := NewCloudMonitor(nil, app)
+	require.NoError(t, c.ApplyConfig(&config.Config{
+		BridgeConfig: config.BridgeConfig{
+			CloudMonitor: config.CloudMonitorConfig{
+				Targets: []config.CloudMonitorTarget{
+					{Namespace: "acs_slb_dashboard", MetricName: "TrafficRXNew"},
+				},
+			},
+		},
+	}))
+
+	c.poll(context.Background())
+
+	// Both pages and both statistics come through, with the dimension as a
+	// label.
+	avg := app.byName("cloudmonitor_acs_slb_dashboard_trafficrxnew_average")
+	require.Equal(t, 2, len(avg))
+	require.Equal(t, int64(1600000060000), avg[0].t)
+	require.Equal(t, 10.0, avg[0].v)
+	require.Equal(t, "lb-1", avg[0].lset.Get("instanceId"))
+	require.Equal(t, 30.0, avg[1].v)
+
+	max := app.byName("cloudmonitor_acs_slb_dashboard_trafficrxnew_maximum")
+	require.Equal(t, 2, len(max))
+
+	// A second poll returning the same datapoints appends nothing new.
+	c.poll(context.Background())
+	require.Equal(t, 2, len(app.byName("cloudmonitor_acs_slb_dashboard_trafficrxnew_average")))
+
+	// A failed commit does not advance the dedup state; the whole batch is
+	// retried on the next poll.
+	failing := &failingCommitAppendable{}
+	c = NewCloudMonitor(nil, failing)
+	require.NoError(t, c.ApplyConfig(&config.Config{
+		BridgeConfig: config.BridgeConfig{
+			CloudMonitor: config.CloudMonitorConfig{
+				Targets: []config.CloudMonitorTarget{
+					{Namespace: "acs_slb_dashboard", MetricName: "TrafficRXNew"},
+				},
+			},
+		},
+	}))
+	failing.failNext = true
+	c.poll(context.Background())
+	c.poll(context.Background())
+	avg = failing.byName("cloudmonitor_acs_slb_dashboard_trafficrxnew_average")
+	require.Equal(t, 4, len(avg))
+	require.Equal(t, avg[:2], avg[2:])
+}
+
+// failingCommitAppendable fails the next commit to exercise the retry path.
+type failingCommitAppendable struct {
+	testAppendable
+	failNext bool
+}
+
+func (a *failingCommitAppendable) Appender(_ context.Context) storage.Appender { return a }
+
+func (a *failingCommitAppendable) Commit() error {
+	if a.failNext {
+		a.failNext = false
+		return errors.New("commit failed")
+	}
+	return nil
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"math/bits"
 	"net"
@@ -39,6 +40,7 @@ import (
 	"github.com/go-kit/kit/log/level"
 	conntrack "github.com/mwitkow/go-conntrack"
 	"github.com/oklog/run"
+	"github.com/oklog/ulid"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -53,6 +55,7 @@ import (
 	klog "k8s.io/klog"
 	klogv2 "k8s.io/klog/v2"
 
+	"github.com/prometheus/prometheus/bridge"
 	"github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/discovery"
 	_ "github.com/prometheus/prometheus/discovery/install" // Register service discovery implementations.
@@ -62,9 +65,11 @@ import (
 	"github.com/prometheus/prometheus/pkg/relabel"
 	prom_runtime "github.com/prometheus/prometheus/pkg/runtime"
 	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/rules"
 	"github.com/prometheus/prometheus/scrape"
 	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/storage/oss"
 	"github.com/prometheus/prometheus/storage/remote"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/util/strutil"
@@ -107,7 +112,8 @@ func main() {
 	)
 
 	cfg := struct {
-		configFile string
+		configFile         string
+		autoReloadInterval model.Duration
 
 		localStoragePath    string
 		notifier            notifier.Options
@@ -122,12 +128,28 @@ func main() {
 		queryTimeout        model.Duration
 		queryConcurrency    int
 		queryMaxSamples     int
+		querySplitInterval  model.Duration
+		sdUpdateInterval    model.Duration
+		scrapeReloadItv     model.Duration
 		RemoteFlushDeadline model.Duration
+		remoteReadFailover  bool
+		oss                 oss.Options
 
-		prometheusURL   string
-		corsRegexString string
+		bridgeGraphiteAddr string
+		bridgeStatsdAddr   string
+		bridgeStatsdFlush  model.Duration
+		bridgeCloudMonitor bool
 
-		promlogConfig promlog.Config
+		prometheusURL      string
+		corsRegexString    string
+		lifecycleTokenFile string
+
+		compactHeadOnShutdown bool
+
+		featureList []string
+
+		promlogConfig      promlog.Config
+		componentLogLevels map[string]string
 	}{
 		notifier: notifier.Options{
 			Registerer: prometheus.DefaultRegisterer,
@@ -148,9 +170,15 @@ func main() {
 	a.Flag("config.file", "Prometheus configuration file path.").
 		Default("prometheus.yml").StringVar(&cfg.configFile)
 
+	a.Flag("config.auto-reload-interval", "How often to poll the configuration file and the rule files it references for changes, reloading automatically when they change. The new configuration is validated first and kept out on failure, like on SIGHUP. 0 disables automatic reloading.").
+		Default("0").SetValue(&cfg.autoReloadInterval)
+
 	a.Flag("web.listen-address", "Address to listen on for UI, API, and telemetry.").
 		Default("0.0.0.0:9090").StringVar(&cfg.web.ListenAddress)
 
+	a.Flag("web.config.file", "Path to configuration file that can enable TLS and basic authentication for the HTTP server.").
+		PlaceHolder("<file>").StringVar(&cfg.web.WebConfigFile)
+
 	a.Flag("web.read-timeout",
 		"Maximum duration before timing out read of the request, and closing idle connections.").
 		Default("5m").SetValue(&cfg.webTimeout)
@@ -172,9 +200,30 @@ func main() {
 	a.Flag("web.enable-lifecycle", "Enable shutdown and reload via HTTP request.").
 		Default("false").BoolVar(&cfg.web.EnableLifecycle)
 
+	a.Flag("web.lifecycle-token-file", "Path to a file containing a bearer token that requests to the lifecycle endpoints (/-/reload, /-/quit) must present in the Authorization header. Empty means no token is required.").
+		Default("").PlaceHolder("<path>").StringVar(&cfg.lifecycleTokenFile)
+
 	a.Flag("web.enable-admin-api", "Enable API endpoints for admin control actions.").
 		Default("false").BoolVar(&cfg.web.EnableAdminAPI)
 
+	a.Flag("web.enable-otlp-receiver", "Enable API endpoint accepting OTLP metrics write requests.").
+		Default("false").BoolVar(&cfg.web.EnableOTLPReceiver)
+
+	a.Flag("web.enable-influx-receiver", "Enable API endpoint accepting InfluxDB line protocol write requests.").
+		Default("false").BoolVar(&cfg.web.EnableInfluxReceiver)
+
+	a.Flag("bridge.graphite-listen-address", "TCP address to listen on for Graphite plaintext writes. Empty disables the listener.").
+		Default("").StringVar(&cfg.bridgeGraphiteAddr)
+
+	a.Flag("bridge.statsd-listen-address", "UDP address to listen on for StatsD metrics. Empty disables the listener.").
+		Default("").StringVar(&cfg.bridgeStatsdAddr)
+
+	a.Flag("bridge.statsd-flush-interval", "How often aggregated StatsD metrics are flushed to storage.").
+		Default("10s").SetValue(&cfg.bridgeStatsdFlush)
+
+	a.Flag("bridge.enable-cloudmonitor", "Enable pulling the CloudMonitor metrics configured in the bridge section.").
+		Default("false").BoolVar(&cfg.bridgeCloudMonitor)
+
 	a.Flag("web.console.templates", "Path to the console template directory, available at /consoles.").
 		Default("consoles").StringVar(&cfg.web.ConsoleTemplatesPath)
 
@@ -190,17 +239,37 @@ func main() {
 	a.Flag("storage.tsdb.path", "Base path for metrics storage.").
 		Default("data/").StringVar(&cfg.localStoragePath)
 
-	a.Flag("storage.tsdb.min-block-duration", "Minimum duration of a data block before being persisted. For use in testing.").
-		Hidden().Default("2h").SetValue(&cfg.tsdb.MinBlockDuration)
+	a.Flag("storage.tsdb.min-block-duration", "Minimum duration of a data block before being persisted. Shorter blocks reduce compaction write amplification on short-retention nodes at the cost of more blocks on disk.").
+		Default("2h").SetValue(&cfg.tsdb.MinBlockDuration)
 
 	a.Flag("storage.tsdb.max-block-duration",
-		"Maximum duration compacted blocks may span. For use in testing. (Defaults to 10% of the retention period.)").
-		Hidden().PlaceHolder("<duration>").SetValue(&cfg.tsdb.MaxBlockDuration)
+		"Maximum duration compacted blocks may span. (Defaults to 10% of the retention period.)").
+		PlaceHolder("<duration>").SetValue(&cfg.tsdb.MaxBlockDuration)
+
+	a.Flag("storage.tsdb.head-chunk-range",
+		"Time range covered by a single in-memory head chunk before a new one is cut. (Defaults to the minimum block duration.)").
+		PlaceHolder("<duration>").SetValue(&cfg.tsdb.HeadChunkRange)
 
 	a.Flag("storage.tsdb.wal-segment-size",
 		"Size at which to split the tsdb WAL segment files. Example: 100MB").
 		Hidden().PlaceHolder("<bytes>").BytesVar(&cfg.tsdb.WALSegmentSize)
 
+	a.Flag("storage.tsdb.head-chunks-write-queue-size",
+		"Size of the queue through which head chunks are written to the disk to be m-mapped, 0 disables the queue completely. Experimental.").
+		Hidden().Default("0").IntVar(&cfg.tsdb.HeadChunksWriteQueueSize)
+
+	a.Flag("storage.tsdb.head-churn-labels",
+		"Comma separated label names by which head series churn metrics are additionally broken down, e.g. 'job'. Empty disables the breakdown. Use with care, high-cardinality label names inflate the metric output.").
+		Default("").StringVar(&cfg.tsdb.HeadChurnLabels)
+
+	a.Flag("storage.tsdb.head-gc-pause",
+		"Time the head garbage collection sleeps between batches of postings deletions so scrapes can proceed, at the cost of a longer overall GC. 0 disables the pacing. Experimental.").
+		Hidden().Default("0s").SetValue(&cfg.tsdb.HeadGCPause)
+
+	a.Flag("storage.tsdb.postings-cache-size",
+		"Maximum size of the cache for expanded postings lists of persisted blocks, speeding up repeated queries with the same selectors. Units supported: B, KB, MB, GB, TB, PB, EB. 0 disables the cache. Experimental.").
+		Hidden().Default("0").BytesVar(&cfg.tsdb.PostingsCacheSize)
+
 	a.Flag("storage.tsdb.retention", "[DEPRECATED] How long to retain samples in storage. This flag has been deprecated, use \"storage.tsdb.retention.time\" instead.").
 		SetValue(&oldFlagRetentionDuration)
 
@@ -213,12 +282,33 @@ func main() {
 	a.Flag("storage.tsdb.no-lockfile", "Do not create lockfile in data directory.").
 		Default("false").BoolVar(&cfg.tsdb.NoLockfile)
 
-	a.Flag("storage.tsdb.allow-overlapping-blocks", "[EXPERIMENTAL] Allow overlapping blocks, which in turn enables vertical compaction and vertical query merge.").
+	a.Flag("storage.tsdb.compact-head-on-shutdown", "Compact the head block into a persisted block on shutdown so all ingested data is flushed out of the WAL, e.g. before planned instance termination.").
+		Default("false").BoolVar(&cfg.compactHeadOnShutdown)
+
+	a.Flag("storage.tsdb.allow-overlapping-blocks", "Allow overlapping blocks, which in turn enables vertical compaction and vertical query merge. Needed to ingest backfilled blocks or blocks copied from other servers.").
 		Default("false").BoolVar(&cfg.tsdb.AllowOverlappingBlocks)
 
 	a.Flag("storage.tsdb.wal-compression", "Compress the tsdb WAL.").
 		Default("true").BoolVar(&cfg.tsdb.WALCompression)
 
+	a.Flag("storage.tsdb.downsample-after", "[EXPERIMENTAL] Generate 5m and 1h downsampled versions of blocks whose data is entirely older than this at compaction time. Queries over long ranges automatically read the downsampled data. 0 disables downsampling.").
+		Default("0").SetValue(&cfg.tsdb.DownsampleAfter)
+
+	a.Flag("storage.oss.endpoint", "Alibaba Cloud OSS endpoint of the region the bucket lives in, e.g. \"oss-cn-hangzhou.aliyuncs.com\". Credentials are read from the ALIBABA_CLOUD_ACCESS_KEY_ID and ALIBABA_CLOUD_ACCESS_KEY_SECRET environment variables.").
+		Default("").StringVar(&cfg.oss.Endpoint)
+
+	a.Flag("storage.oss.bucket", "OSS bucket to upload finished TSDB blocks to. Uploading is disabled if empty.").
+		Default("").StringVar(&cfg.oss.Bucket)
+
+	a.Flag("storage.oss.prefix", "Prefix prepended to the object keys of blocks uploaded to OSS.").
+		Default("").StringVar(&cfg.oss.Prefix)
+
+	a.Flag("storage.oss.sync-interval", "How often the local blocks are compared against the OSS bucket contents.").
+		Default("5m").DurationVar(&cfg.oss.SyncInterval)
+
+	a.Flag("storage.oss.delete-local", "Delete the local copy of a block once it has been uploaded to OSS. Deletion happens during the next TSDB compaction cycle.").
+		Default("false").BoolVar(&cfg.oss.DeleteLocal)
+
 	a.Flag("storage.remote.flush-deadline", "How long to wait flushing sample on shutdown or config reload.").
 		Default("1m").PlaceHolder("<duration>").SetValue(&cfg.RemoteFlushDeadline)
 
@@ -228,6 +318,9 @@ func main() {
 	a.Flag("storage.remote.read-concurrent-limit", "Maximum number of concurrent remote read calls. 0 means no limit.").
 		Default("10").IntVar(&cfg.web.RemoteReadConcurrencyLimit)
 
+	a.Flag("storage.remote.read-failover", "Serve queries from the configured remote read endpoints when the local storage fails to answer them, instead of failing the query. The local error is returned as a warning.").
+		Default("false").BoolVar(&cfg.remoteReadFailover)
+
 	a.Flag("storage.remote.read-max-bytes-in-frame", "Maximum number of bytes in a single frame for streaming remote read response types before marshalling. Note that client might have limit on frame size as well. 1MB as recommended by protobuf by default.").
 		Default("1048576").IntVar(&cfg.web.RemoteReadBytesInFrame)
 
@@ -240,9 +333,21 @@ func main() {
 	a.Flag("rules.alert.resend-delay", "Minimum amount of time to wait before resending an alert to Alertmanager.").
 		Default("1m").SetValue(&cfg.resendDelay)
 
+	a.Flag("rules.managed-directory", "Directory holding rule files managed through the admin API. Rule files in it are loaded in addition to the configured rule_files. Requires --web.enable-admin-api for the endpoints to be served.").
+		PlaceHolder("<path>").StringVar(&cfg.web.ManagedRulesDir)
+
 	a.Flag("scrape.adjust-timestamps", "Adjust scrape timestamps by up to 2ms to align them to the intended schedule. See https://github.com/prometheus/prometheus/issues/7846 for more context. Experimental. This flag will be removed in a future release.").
 		Hidden().Default("true").BoolVar(&scrape.AlignScrapeTimestamps)
 
+	a.Flag("scrape.report-extra-metrics", "Report the additional scrape_timeout_seconds and scrape_sample_limit synthetic series for every scrape.").
+		Default("false").BoolVar(&scrape.ReportExtraMetrics)
+
+	a.Flag("scrape.reload-interval", "Interval at which target set updates from service discovery are coalesced into scrape pool reloads.").
+		Hidden().Default("5s").SetValue(&cfg.scrapeReloadItv)
+
+	a.Flag("discovery.update-interval", "Interval at which buffered service discovery updates are coalesced and sent to their consumers.").
+		Hidden().Default("5s").SetValue(&cfg.sdUpdateInterval)
+
 	a.Flag("alertmanager.notification-queue-capacity", "The capacity of the queue for pending Alertmanager notifications.").
 		Default("10000").IntVar(&cfg.notifier.QueueCapacity)
 
@@ -261,8 +366,32 @@ func main() {
 	a.Flag("query.max-samples", "Maximum number of samples a single query can load into memory. Note that queries will fail if they try to load more samples than this into memory, so this also limits the number of samples a query can return.").
 		Default("50000000").IntVar(&cfg.queryMaxSamples)
 
+	a.Flag("query.max-series-per-step", "Maximum number of series a single API query selector may return at each evaluation step. Queries that would return more series fail. A request may lower the limit with its max_series parameter. 0 means no limit.").
+		Default("0").IntVar(&cfg.web.MaxSeriesPerQuery)
+
+	a.Flag("query.client-rate-limit", "Maximum number of requests per second a single client may send to the query API endpoints, keyed by basic auth user name or remote address. 0 means no limit.").
+		Default("0").Float64Var(&cfg.web.QueryClientRateLimit)
+
+	a.Flag("query.client-max-concurrency", "Maximum number of query API requests a single client may have in flight. 0 means no limit.").
+		Default("0").IntVar(&cfg.web.QueryClientMaxConcurrency)
+
+	a.Flag("query.range-split-interval", "Time range above which API range queries are split into sequentially evaluated sub-range queries of at most this interval, bounding the memory a single long range query can hold at once. 0 disables splitting.").
+		Default("0s").SetValue(&cfg.querySplitInterval)
+
+	a.Flag("tenancy.label", "Label name identifying the tenant a series belongs to. When set, the OTLP receiver requires the tenant header on write requests and enforces the label on ingested series, and API read requests carrying the header are restricted to that tenant. Empty disables tenancy.").
+		Default("").StringVar(&cfg.web.TenantLabel)
+
+	a.Flag("tenancy.header", "HTTP header carrying the tenant name on API and OTLP receiver requests.").
+		Default("X-Prometheus-Tenant").StringVar(&cfg.web.TenantHeader)
+
+	a.Flag("enable-feature", "Comma separated feature names to enable. Currently supported: 'created-timestamp-zero-ingestion', 'scrape-config-fallback', 'expand-static-config-env', 'promql-experimental-functions'.").
+		Default("").StringsVar(&cfg.featureList)
+
 	promlogflag.AddFlags(a, &cfg.promlogConfig)
 
+	a.Flag("log.component-level", "Override the log level for a single component, e.g. 'tsdb=debug'. Repeat the flag for multiple components.").
+		PlaceHolder("<component>=<level>").StringMapVar(&cfg.componentLogLevels)
+
 	_, err := a.Parse(os.Args[1:])
 	if err != nil {
 		fmt.Fprintln(os.Stderr, errors.Wrapf(err, "Error parsing commandline arguments"))
@@ -270,7 +399,58 @@ func main() {
 		os.Exit(2)
 	}
 
-	logger := promlog.New(&cfg.promlogConfig)
+	// Build the logger by hand instead of using promlog.New so that the level
+	// filter can be adjusted at runtime through the /-/loglevel endpoint.
+	var baseLogger log.Logger
+	if cfg.promlogConfig.Format != nil && cfg.promlogConfig.Format.String() == "json" {
+		baseLogger = log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+	} else {
+		baseLogger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+	}
+	logLevel, err := logging.NewDynamicLevel(baseLogger, cfg.promlogConfig.Level.String())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errors.Wrapf(err, "initialize logger"))
+		os.Exit(2)
+	}
+	for component, lvl := range cfg.componentLogLevels {
+		if err := logLevel.SetComponentLevel(component, lvl); err != nil {
+			fmt.Fprintln(os.Stderr, errors.Wrapf(err, "parse --log.component-level for component %q", component))
+			os.Exit(2)
+		}
+	}
+	logger := log.With(
+		logLevel,
+		"ts", log.TimestampFormat(func() time.Time { return time.Now().UTC() }, "2006-01-02T15:04:05.000Z07:00"),
+		"caller", log.DefaultCaller,
+	)
+	cfg.web.DynamicLogLevel = logLevel
+
+	var (
+		ingestCTZero         bool
+		scrapeConfigFallback bool
+		expandStaticEnv      bool
+	)
+	for _, f := range cfg.featureList {
+		for _, o := range strings.Split(f, ",") {
+			switch o {
+			case "created-timestamp-zero-ingestion":
+				ingestCTZero = true
+				level.Info(logger).Log("msg", "Experimental created timestamp zero ingestion enabled.")
+			case "scrape-config-fallback":
+				scrapeConfigFallback = true
+				level.Info(logger).Log("msg", "Experimental scrape config fallback on reload errors enabled.")
+			case "expand-static-config-env":
+				expandStaticEnv = true
+				level.Info(logger).Log("msg", "Experimental environment variable expansion in static_configs enabled.")
+			case "promql-experimental-functions":
+				parser.EnableExperimentalFunctions = true
+				level.Info(logger).Log("msg", "Experimental PromQL functions enabled.")
+			case "":
+			default:
+				level.Warn(logger).Log("msg", "Unknown option for --enable-feature", "option", o)
+			}
+		}
+	}
 
 	cfg.web.ExternalURL, err = computeExternalURL(cfg.prometheusURL, cfg.web.ListenAddress)
 	if err != nil {
@@ -284,6 +464,15 @@ func main() {
 		os.Exit(2)
 	}
 
+	if cfg.lifecycleTokenFile != "" {
+		token, err := ioutil.ReadFile(cfg.lifecycleTokenFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, errors.Wrapf(err, "read lifecycle token file %q", cfg.lifecycleTokenFile))
+			os.Exit(2)
+		}
+		cfg.web.LifecycleToken = strings.TrimSpace(string(token))
+	}
+
 	// Throw error for invalid config before starting other components.
 	if _, err := config.LoadFile(cfg.configFile); err != nil {
 		level.Error(logger).Log("msg", fmt.Sprintf("Error loading config (--config.file=%s)", cfg.configFile), "err", err)
@@ -348,6 +537,21 @@ func main() {
 		}
 	}
 
+	{ // Block duration settings.
+		if cfg.tsdb.MinBlockDuration <= 0 {
+			fmt.Fprintln(os.Stderr, "--storage.tsdb.min-block-duration must be greater than zero")
+			os.Exit(2)
+		}
+		if cfg.tsdb.MinBlockDuration > cfg.tsdb.MaxBlockDuration {
+			fmt.Fprintln(os.Stderr, "--storage.tsdb.min-block-duration must not be larger than --storage.tsdb.max-block-duration")
+			os.Exit(2)
+		}
+		if cfg.tsdb.HeadChunkRange > cfg.tsdb.MinBlockDuration {
+			fmt.Fprintln(os.Stderr, "--storage.tsdb.head-chunk-range must not be larger than --storage.tsdb.min-block-duration")
+			os.Exit(2)
+		}
+	}
+
 	noStepSubqueryInterval := &safePromQLNoStepSubqueryInterval{}
 	noStepSubqueryInterval.Set(config.DefaultGlobalConfig.EvaluationInterval)
 
@@ -368,11 +572,34 @@ func main() {
 	level.Info(logger).Log("vm_limits", prom_runtime.VMLimits())
 
 	var (
-		localStorage  = &readyStorage{}
+		localStorage  = &readyStorage{stats: tsdb.NewHeadStats()}
 		scraper       = &readyScrapeManager{}
 		remoteStorage = remote.NewStorage(log.With(logger, "component", "remote"), prometheus.DefaultRegisterer, localStorage.StartTime, cfg.localStoragePath, time.Duration(cfg.RemoteFlushDeadline), scraper)
 		fanoutStorage = storage.NewFanout(logger, localStorage, remoteStorage)
 	)
+	if cfg.remoteReadFailover {
+		fanoutStorage = storage.NewFailoverFanout(logger, localStorage, remoteStorage)
+	}
+
+	var bridgeReceiver *bridge.Bridge
+	if cfg.bridgeGraphiteAddr != "" || cfg.bridgeStatsdAddr != "" {
+		bridgeReceiver = bridge.New(log.With(logger, "component", "bridge"), fanoutStorage, cfg.bridgeGraphiteAddr, cfg.bridgeStatsdAddr, time.Duration(cfg.bridgeStatsdFlush))
+	}
+
+	var cloudMonitorBridge *bridge.CloudMonitor
+	if cfg.bridgeCloudMonitor {
+		cloudMonitorBridge = bridge.NewCloudMonitor(log.With(logger, "component", "cloudmonitor"), fanoutStorage)
+	}
+
+	var ossUploader *oss.Uploader
+	if cfg.oss.Bucket != "" {
+		var err error
+		ossUploader, err = oss.NewUploader(log.With(logger, "component", "oss"), cfg.localStoragePath, cfg.oss)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error creating OSS block uploader", "err", err)
+			os.Exit(2)
+		}
+	}
 
 	var (
 		ctxWeb, cancelWeb = context.WithCancel(context.Background())
@@ -381,10 +608,10 @@ func main() {
 		notifierManager = notifier.NewManager(&cfg.notifier, log.With(logger, "component", "notifier"))
 
 		ctxScrape, cancelScrape = context.WithCancel(context.Background())
-		discoveryManagerScrape  = discovery.NewManager(ctxScrape, log.With(logger, "component", "discovery manager scrape"), discovery.Name("scrape"))
+		discoveryManagerScrape  = discovery.NewManager(ctxScrape, log.With(logger, "component", "discovery manager scrape"), discovery.Name("scrape"), discovery.UpdateInterval(time.Duration(cfg.sdUpdateInterval)))
 
 		ctxNotify, cancelNotify = context.WithCancel(context.Background())
-		discoveryManagerNotify  = discovery.NewManager(ctxNotify, log.With(logger, "component", "discovery manager notify"), discovery.Name("notify"))
+		discoveryManagerNotify  = discovery.NewManager(ctxNotify, log.With(logger, "component", "discovery manager notify"), discovery.Name("notify"), discovery.UpdateInterval(time.Duration(cfg.sdUpdateInterval)))
 
 		scrapeManager = scrape.NewManager(log.With(logger, "component", "scrape manager"), fanoutStorage)
 
@@ -415,6 +642,8 @@ func main() {
 		})
 	)
 
+	scrapeManager.IngestCreatedTimestamps(ingestCTZero)
+	scrapeManager.SetReloadInterval(time.Duration(cfg.scrapeReloadItv))
 	scraper.Set(scrapeManager)
 
 	cfg.web.Context = ctxWeb
@@ -427,7 +656,10 @@ func main() {
 	cfg.web.ScrapeManager = scrapeManager
 	cfg.web.RuleManager = ruleManager
 	cfg.web.Notifier = notifierManager
+	cfg.web.SDManagerScrape = discoveryManagerScrape
+	cfg.web.SDManagerNotify = discoveryManagerNotify
 	cfg.web.LookbackDelta = time.Duration(cfg.lookbackDelta)
+	cfg.web.RangeQuerySplitInterval = time.Duration(cfg.querySplitInterval)
 
 	cfg.web.Version = &web.PrometheusVersion{
 		Version:   version.Version,
@@ -458,6 +690,16 @@ func main() {
 		conntrack.DialWithTracing(),
 	)
 
+	// The rules reloader closure shadows cfg with the loaded configuration,
+	// so take the managed rules directory from the flags here.
+	managedRulesDir := cfg.web.ManagedRulesDir
+	if managedRulesDir != "" {
+		if err := os.MkdirAll(managedRulesDir, 0777); err != nil {
+			level.Error(logger).Log("msg", "Error creating managed rules directory", "err", err)
+			os.Exit(1)
+		}
+	}
+
 	reloaders := []reloader{
 		{
 			name:     "remote_storage",
@@ -494,6 +736,22 @@ func main() {
 				}
 				return discoveryManagerScrape.ApplyConfig(c)
 			},
+		}, {
+			name: "bridge",
+			reloader: func(cfg *config.Config) error {
+				if bridgeReceiver == nil {
+					return nil
+				}
+				return bridgeReceiver.ApplyConfig(cfg)
+			},
+		}, {
+			name: "cloudmonitor",
+			reloader: func(cfg *config.Config) error {
+				if cloudMonitorBridge == nil {
+					return nil
+				}
+				return cloudMonitorBridge.ApplyConfig(cfg)
+			},
 		}, {
 			name:     "notify",
 			reloader: notifierManager.ApplyConfig,
@@ -511,7 +769,11 @@ func main() {
 			reloader: func(cfg *config.Config) error {
 				// Get all rule files matching the configuration paths.
 				var files []string
-				for _, pat := range cfg.RuleFiles {
+				pats := cfg.RuleFiles
+				if managedRulesDir != "" {
+					pats = append(pats[:len(pats):len(pats)], filepath.Join(managedRulesDir, "*.yaml"))
+				}
+				for _, pat := range pats {
 					fs, err := filepath.Glob(pat)
 					if err != nil {
 						// The only error can be a bad pattern.
@@ -633,6 +895,41 @@ func main() {
 			},
 		)
 	}
+	if bridgeReceiver != nil {
+		// Graphite and StatsD bridge receiver.
+		g.Add(
+			func() error {
+				// Wait until the mapping rules are loaded before accepting
+				// writes.
+				<-reloadReady.C
+
+				err := bridgeReceiver.Run()
+				level.Info(logger).Log("msg", "Bridge receiver stopped")
+				return err
+			},
+			func(err error) {
+				level.Info(logger).Log("msg", "Stopping bridge receiver...")
+				bridgeReceiver.Stop()
+			},
+		)
+	}
+	if cloudMonitorBridge != nil {
+		// CloudMonitor bridge.
+		g.Add(
+			func() error {
+				// Wait until the targets are loaded before pulling.
+				<-reloadReady.C
+
+				err := cloudMonitorBridge.Run()
+				level.Info(logger).Log("msg", "CloudMonitor bridge stopped")
+				return err
+			},
+			func(err error) {
+				level.Info(logger).Log("msg", "Stopping CloudMonitor bridge...")
+				cloudMonitorBridge.Stop()
+			},
+		)
+	}
 	{
 		// Reload handler.
 
@@ -645,18 +942,53 @@ func main() {
 			func() error {
 				<-reloadReady.C
 
+				var (
+					autoReloadC <-chan time.Time
+					checksum    string
+				)
+				if cfg.autoReloadInterval > 0 {
+					ticker := time.NewTicker(time.Duration(cfg.autoReloadInterval))
+					defer ticker.Stop()
+					autoReloadC = ticker.C
+
+					var err error
+					if checksum, err = config.GenerateChecksum(cfg.configFile); err != nil {
+						level.Warn(logger).Log("msg", "Error generating checksum of configuration files for automatic reloading", "err", err)
+					}
+				}
+
 				for {
 					select {
 					case <-hup:
-						if err := reloadConfig(cfg.configFile, logger, noStepSubqueryInterval, reloaders...); err != nil {
+						if err := reloadConfig(cfg.configFile, scrapeConfigFallback, expandStaticEnv, logger, noStepSubqueryInterval, reloaders...); err != nil {
 							level.Error(logger).Log("msg", "Error reloading config", "err", err)
+						} else if cfg.autoReloadInterval > 0 {
+							checksum, _ = config.GenerateChecksum(cfg.configFile)
 						}
 					case rc := <-webHandler.Reload():
-						if err := reloadConfig(cfg.configFile, logger, noStepSubqueryInterval, reloaders...); err != nil {
+						if err := reloadConfig(cfg.configFile, scrapeConfigFallback, expandStaticEnv, logger, noStepSubqueryInterval, reloaders...); err != nil {
 							level.Error(logger).Log("msg", "Error reloading config", "err", err)
 							rc <- err
 						} else {
 							rc <- nil
+							checksum, _ = config.GenerateChecksum(cfg.configFile)
+						}
+					case <-autoReloadC:
+						current, err := config.GenerateChecksum(cfg.configFile)
+						if err != nil {
+							level.Error(logger).Log("msg", "Error generating checksum of configuration files for automatic reloading", "err", err)
+							continue
+						}
+						if current == checksum {
+							continue
+						}
+						level.Info(logger).Log("msg", "Configuration file change detected, reloading the configuration")
+						if err := reloadConfig(cfg.configFile, scrapeConfigFallback, expandStaticEnv, logger, noStepSubqueryInterval, reloaders...); err != nil {
+							// Keep the old configuration and checksum, so that
+							// the reload is retried once the files change again.
+							level.Error(logger).Log("msg", "Error reloading config", "err", err)
+						} else {
+							checksum = current
 						}
 					case <-cancel:
 						return nil
@@ -684,7 +1016,7 @@ func main() {
 					return nil
 				}
 
-				if err := reloadConfig(cfg.configFile, logger, noStepSubqueryInterval, reloaders...); err != nil {
+				if err := reloadConfig(cfg.configFile, scrapeConfigFallback, expandStaticEnv, logger, noStepSubqueryInterval, reloaders...); err != nil {
 					return errors.Wrapf(err, "error loading config from %q", cfg.configFile)
 				}
 
@@ -716,6 +1048,18 @@ func main() {
 	{
 		// TSDB.
 		opts := cfg.tsdb.ToTSDBOptions()
+		opts.HeadStats = localStorage.stats
+		if ossUploader != nil {
+			// The DB is not open yet, so the default deletion policy is
+			// resolved lazily through the ready storage.
+			opts.BlocksToDelete = ossUploader.BlocksToDelete(func(blocks []*tsdb.Block) map[ulid.ULID]struct{} {
+				db := localStorage.get()
+				if db == nil {
+					return map[ulid.ULID]struct{}{}
+				}
+				return tsdb.DefaultBlocksToDelete(db)(blocks)
+			})
+		}
 		cancel := make(chan struct{})
 		g.Add(
 			func() error {
@@ -761,6 +1105,12 @@ func main() {
 				return nil
 			},
 			func(err error) {
+				if cfg.compactHeadOnShutdown {
+					level.Info(logger).Log("msg", "Compacting head block before shutdown...")
+					if err := localStorage.CompactHead(); err != nil {
+						level.Error(logger).Log("msg", "Error compacting head block on shutdown", "err", err)
+					}
+				}
 				if err := fanoutStorage.Close(); err != nil {
 					level.Error(logger).Log("msg", "Error stopping storage", "err", err)
 				}
@@ -768,6 +1118,19 @@ func main() {
 			},
 		)
 	}
+	if ossUploader != nil {
+		// OSS block uploader.
+		g.Add(
+			func() error {
+				<-dbOpen
+				ossUploader.Run()
+				return nil
+			},
+			func(err error) {
+				ossUploader.Stop()
+			},
+		)
+	}
 	{
 		// Web handler.
 		g.Add(
@@ -865,7 +1228,15 @@ type reloader struct {
 	reloader func(*config.Config) error
 }
 
-func reloadConfig(filename string, logger log.Logger, noStepSuqueryInterval *safePromQLNoStepSubqueryInterval, rls ...reloader) (err error) {
+// lastGoodConfig holds the most recently applied configuration so that
+// reloads with the scrape-config-fallback feature can keep the previous
+// version of individual broken scrape jobs.
+var (
+	lastGoodConfigMtx sync.Mutex
+	lastGoodConfig    *config.Config
+)
+
+func reloadConfig(filename string, scrapeFallback, expandStaticEnv bool, logger log.Logger, noStepSuqueryInterval *safePromQLNoStepSubqueryInterval, rls ...reloader) (err error) {
 	start := time.Now()
 	timings := []interface{}{}
 	level.Info(logger).Log("msg", "Loading configuration file", "filename", filename)
@@ -879,11 +1250,28 @@ func reloadConfig(filename string, logger log.Logger, noStepSuqueryInterval *saf
 		}
 	}()
 
-	conf, err := config.LoadFile(filename)
+	lastGoodConfigMtx.Lock()
+	prev := lastGoodConfig
+	lastGoodConfigMtx.Unlock()
+
+	var conf *config.Config
+	if scrapeFallback && prev != nil {
+		var replaced []string
+		conf, replaced, err = config.LoadFileWithFallback(filename, prev)
+		for _, job := range replaced {
+			level.Error(logger).Log("msg", "Scrape config failed to parse, keeping its last valid version", "job", job)
+		}
+	} else {
+		conf, err = config.LoadFile(filename)
+	}
 	if err != nil {
 		return errors.Wrapf(err, "couldn't load configuration (--config.file=%q)", filename)
 	}
 
+	if expandStaticEnv {
+		conf.ExpandStaticConfigEnvVars()
+	}
+
 	failed := false
 	for _, rl := range rls {
 		rstart := time.Now()
@@ -897,6 +1285,10 @@ func reloadConfig(filename string, logger log.Logger, noStepSuqueryInterval *saf
 		return errors.Errorf("one or more errors occurred while applying the new configuration (--config.file=%q)", filename)
 	}
 
+	lastGoodConfigMtx.Lock()
+	lastGoodConfig = conf
+	lastGoodConfigMtx.Unlock()
+
 	noStepSuqueryInterval.Set(conf.GlobalConfig.EvaluationInterval)
 	l := []interface{}{"msg", "Completed loading of configuration file", "filename", filename, "totalDuration", time.Since(start)}
 	level.Info(logger).Log(append(l, timings...)...)
@@ -986,6 +1378,14 @@ type readyStorage struct {
 	mtx             sync.RWMutex
 	db              *tsdb.DB
 	startTimeMargin int64
+	stats           *tsdb.HeadStats
+}
+
+// WALReplayStatus implements the api_v1.TSDBAdminStats interface. The stats
+// object is shared with the head, so progress is visible while the WAL is
+// still being replayed.
+func (s *readyStorage) WALReplayStatus() (tsdb.WALReplayStatus, error) {
+	return s.stats.WALReplayStatus.GetWALReplayStatus(), nil
 }
 
 // Set the storage.
@@ -1074,6 +1474,19 @@ func (s *readyStorage) CleanTombstones() error {
 	return tsdb.ErrNotReady
 }
 
+// CompactHead implements the api_v1.TSDBAdminStats interface.
+func (s *readyStorage) CompactHead() error {
+	if x := s.get(); x != nil {
+		head := x.Head()
+		if head.MinTime() > head.MaxTime() {
+			// Nothing has been appended to the head yet.
+			return nil
+		}
+		return x.CompactHead(tsdb.NewRangeHead(head, head.MinTime(), head.MaxTime()))
+	}
+	return tsdb.ErrNotReady
+}
+
 // Delete implements the api_v1.TSDBAdminStats and api_v2.TSDBAdmin interfaces.
 func (s *readyStorage) Delete(mint, maxt int64, ms ...*labels.Matcher) error {
 	if x := s.get(); x != nil {
@@ -1098,6 +1511,19 @@ func (s *readyStorage) Stats(statsByLabelName string) (*tsdb.Stats, error) {
 	return nil, tsdb.ErrNotReady
 }
 
+// BlockMetas implements the api_v1.TSDBAdminStats interface.
+func (s *readyStorage) BlockMetas() ([]tsdb.BlockMeta, error) {
+	if x := s.get(); x != nil {
+		blocks := x.Blocks()
+		metas := make([]tsdb.BlockMeta, 0, len(blocks))
+		for _, b := range blocks {
+			metas = append(metas, b.Meta())
+		}
+		return metas, nil
+	}
+	return nil, tsdb.ErrNotReady
+}
+
 // ErrNotReady is returned if the underlying scrape manager is not ready yet.
 var ErrNotReady = errors.New("Scrape manager not ready")
 
@@ -1130,28 +1556,44 @@ func (rm *readyScrapeManager) Get() (*scrape.Manager, error) {
 // tsdbOptions is tsdb.Option version with defined units.
 // This is required as tsdb.Option fields are unit agnostic (time).
 type tsdbOptions struct {
-	WALSegmentSize         units.Base2Bytes
-	RetentionDuration      model.Duration
-	MaxBytes               units.Base2Bytes
-	NoLockfile             bool
-	AllowOverlappingBlocks bool
-	WALCompression         bool
-	StripeSize             int
-	MinBlockDuration       model.Duration
-	MaxBlockDuration       model.Duration
+	WALSegmentSize           units.Base2Bytes
+	RetentionDuration        model.Duration
+	MaxBytes                 units.Base2Bytes
+	HeadChunksWriteQueueSize int
+	HeadChurnLabels          string
+	HeadGCPause              model.Duration
+	PostingsCacheSize        units.Base2Bytes
+	NoLockfile               bool
+	AllowOverlappingBlocks   bool
+	WALCompression           bool
+	StripeSize               int
+	MinBlockDuration         model.Duration
+	MaxBlockDuration         model.Duration
+	HeadChunkRange           model.Duration
+	DownsampleAfter          model.Duration
 }
 
 func (opts tsdbOptions) ToTSDBOptions() tsdb.Options {
+	var churnLabels []string
+	if opts.HeadChurnLabels != "" {
+		churnLabels = strings.Split(opts.HeadChurnLabels, ",")
+	}
 	return tsdb.Options{
-		WALSegmentSize:         int(opts.WALSegmentSize),
-		RetentionDuration:      int64(time.Duration(opts.RetentionDuration) / time.Millisecond),
-		MaxBytes:               int64(opts.MaxBytes),
-		NoLockfile:             opts.NoLockfile,
-		AllowOverlappingBlocks: opts.AllowOverlappingBlocks,
-		WALCompression:         opts.WALCompression,
-		StripeSize:             opts.StripeSize,
-		MinBlockDuration:       int64(time.Duration(opts.MinBlockDuration) / time.Millisecond),
-		MaxBlockDuration:       int64(time.Duration(opts.MaxBlockDuration) / time.Millisecond),
+		WALSegmentSize:           int(opts.WALSegmentSize),
+		RetentionDuration:        int64(time.Duration(opts.RetentionDuration) / time.Millisecond),
+		MaxBytes:                 int64(opts.MaxBytes),
+		HeadChunksWriteQueueSize: opts.HeadChunksWriteQueueSize,
+		HeadChurnLabels:          churnLabels,
+		HeadGCPause:              time.Duration(opts.HeadGCPause),
+		PostingsCacheSize:        int64(opts.PostingsCacheSize),
+		NoLockfile:               opts.NoLockfile,
+		AllowOverlappingBlocks:   opts.AllowOverlappingBlocks,
+		WALCompression:           opts.WALCompression,
+		StripeSize:               opts.StripeSize,
+		MinBlockDuration:         int64(time.Duration(opts.MinBlockDuration) / time.Millisecond),
+		MaxBlockDuration:         int64(time.Duration(opts.MaxBlockDuration) / time.Millisecond),
+		HeadChunkRange:           int64(time.Duration(opts.HeadChunkRange) / time.Millisecond),
+		DownsampleAfter:          int64(time.Duration(opts.DownsampleAfter) / time.Millisecond),
 	}
 }
 
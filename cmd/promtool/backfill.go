@@ -47,7 +47,7 @@ func (p *OpenMetricsParser) Next() (textparse.Entry, error) {
 		line := p.s.Bytes()
 		line = append(line, '\n')
 
-		p.Parser = textparse.New(line, string(expfmt.FmtOpenMetrics))
+		p.Parser = textparse.New(line, string(expfmt.FmtOpenMetrics), false)
 		if et, err := p.Parser.Next(); err != io.EOF {
 			return et, err
 		}
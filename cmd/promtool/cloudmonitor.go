@@ -0,0 +1,266 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+)
+
+// cloudMonitorAlarm is a single alarm rule as exported by the CloudMonitor
+// DescribeMetricRuleList API.
+type cloudMonitorAlarm struct {
+	RuleID      string                  `json:"RuleId"`
+	RuleName    string                  `json:"RuleName"`
+	Namespace   string                  `json:"Namespace"`
+	MetricName  string                  `json:"MetricName"`
+	Period      string                  `json:"Period"`
+	EnableState bool                    `json:"EnableState"`
+	Escalations cloudMonitorEscalations `json:"Escalations"`
+}
+
+type cloudMonitorEscalations struct {
+	Critical *cloudMonitorEscalation `json:"Critical,omitempty"`
+	Warn     *cloudMonitorEscalation `json:"Warn,omitempty"`
+	Info     *cloudMonitorEscalation `json:"Info,omitempty"`
+}
+
+type cloudMonitorEscalation struct {
+	Statistics         string `json:"Statistics"`
+	ComparisonOperator string `json:"ComparisonOperator"`
+	Threshold          string `json:"Threshold"`
+	Times              int    `json:"Times"`
+}
+
+// cloudMonitorMapping maps CloudMonitor metrics, keyed by
+// "<namespace>/<metric_name>", to equivalent PromQL expressions. Alarms whose
+// metric has no mapping are reported and skipped.
+type cloudMonitorMapping struct {
+	Mappings map[string]string `yaml:"mappings"`
+}
+
+// cloudMonitorOperators translates CloudMonitor comparison operators into
+// their PromQL counterparts. Operators comparing against historical values
+// (e.g. GreaterThanYesterday) have no direct equivalent and are skipped.
+var cloudMonitorOperators = map[string]string{
+	"GreaterThanThreshold":          ">",
+	"GreaterThanOrEqualToThreshold": ">=",
+	"LessThanThreshold":             "<",
+	"LessThanOrEqualToThreshold":    "<=",
+	"NotEqualToThreshold":           "!=",
+	"EqualToThreshold":              "==",
+}
+
+// MigrateCloudMonitor converts exported CloudMonitor alarm rules into a
+// Prometheus rule file. It returns 0 if all enabled alarms were converted,
+// 1 if some had to be skipped and 2 on hard errors.
+func MigrateCloudMonitor(inputFile, mappingFile, outputFile string) int {
+	mapping, err := loadCloudMonitorMapping(mappingFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  FAILED: %s\n", err)
+		return 2
+	}
+	alarms, err := loadCloudMonitorAlarms(inputFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  FAILED: %s\n", err)
+		return 2
+	}
+
+	rules, skipped := convertCloudMonitorAlarms(alarms, mapping)
+	for _, s := range skipped {
+		fmt.Fprintln(os.Stderr, "  SKIPPED:", s)
+	}
+	if len(rules) == 0 {
+		fmt.Fprintln(os.Stderr, "  FAILED: no alarms could be converted")
+		return 2
+	}
+
+	out := struct {
+		Groups []struct {
+			Name  string         `yaml:"name"`
+			Rules []rulefmt.Rule `yaml:"rules"`
+		} `yaml:"groups"`
+	}{}
+	out.Groups = append(out.Groups, struct {
+		Name  string         `yaml:"name"`
+		Rules []rulefmt.Rule `yaml:"rules"`
+	}{Name: "cloudmonitor", Rules: rules})
+
+	b, err := yaml.Marshal(out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  FAILED: %s\n", err)
+		return 2
+	}
+	// Make sure the generated file passes the same validation as
+	// "promtool check rules" before handing it to the user.
+	if _, errs := rulefmt.Parse(b); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "  FAILED: generated rules invalid: %s\n", err)
+		}
+		return 2
+	}
+
+	if outputFile == "" {
+		fmt.Print(string(b))
+	} else if err := ioutil.WriteFile(outputFile, b, 0666); err != nil {
+		fmt.Fprintf(os.Stderr, "  FAILED: %s\n", err)
+		return 2
+	}
+
+	fmt.Fprintf(os.Stderr, "Converted %d alerting rules, skipped %d alarms\n", len(rules), len(skipped))
+	if len(skipped) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// loadCloudMonitorAlarms reads an alarm export, accepting either a plain JSON
+// array of alarms or a full DescribeMetricRuleList response.
+func loadCloudMonitorAlarms(f string) ([]cloudMonitorAlarm, error) {
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	var alarms []cloudMonitorAlarm
+	if err := json.Unmarshal(b, &alarms); err == nil {
+		return alarms, nil
+	}
+	var resp struct {
+		Alarms struct {
+			Alarm []cloudMonitorAlarm `json:"Alarm"`
+		} `json:"Alarms"`
+	}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", f)
+	}
+	if len(resp.Alarms.Alarm) == 0 {
+		return nil, errors.Errorf("no alarms found in %s", f)
+	}
+	return resp.Alarms.Alarm, nil
+}
+
+func loadCloudMonitorMapping(f string) (*cloudMonitorMapping, error) {
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	m := &cloudMonitorMapping{}
+	if err := yaml.UnmarshalStrict(b, m); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", f)
+	}
+	return m, nil
+}
+
+// convertCloudMonitorAlarms builds alerting rules for every enabled alarm
+// with a mapped metric. It returns the rules together with human-readable
+// reasons for every alarm that could not be converted.
+func convertCloudMonitorAlarms(alarms []cloudMonitorAlarm, mapping *cloudMonitorMapping) ([]rulefmt.Rule, []string) {
+	var (
+		rules   []rulefmt.Rule
+		skipped []string
+	)
+	for _, a := range alarms {
+		if !a.EnableState {
+			skipped = append(skipped, fmt.Sprintf("alarm %q (%s): disabled", a.RuleName, a.RuleID))
+			continue
+		}
+		key := a.Namespace + "/" + a.MetricName
+		expr, ok := mapping.Mappings[key]
+		if !ok {
+			skipped = append(skipped, fmt.Sprintf("alarm %q (%s): no mapping for metric %q", a.RuleName, a.RuleID, key))
+			continue
+		}
+
+		levels := []struct {
+			severity   string
+			escalation *cloudMonitorEscalation
+		}{
+			{"critical", a.Escalations.Critical},
+			{"warning", a.Escalations.Warn},
+			{"info", a.Escalations.Info},
+		}
+		converted := false
+		for _, l := range levels {
+			if l.escalation == nil {
+				continue
+			}
+			r, err := convertCloudMonitorEscalation(a, expr, l.severity, l.escalation)
+			if err != nil {
+				skipped = append(skipped, fmt.Sprintf("alarm %q (%s): %s", a.RuleName, a.RuleID, err))
+				continue
+			}
+			rules = append(rules, r)
+			converted = true
+		}
+		if !converted {
+			skipped = append(skipped, fmt.Sprintf("alarm %q (%s): no convertible escalations", a.RuleName, a.RuleID))
+		}
+	}
+	return rules, skipped
+}
+
+func convertCloudMonitorEscalation(a cloudMonitorAlarm, expr, severity string, e *cloudMonitorEscalation) (rulefmt.Rule, error) {
+	op, ok := cloudMonitorOperators[e.ComparisonOperator]
+	if !ok {
+		return rulefmt.Rule{}, errors.Errorf("unsupported comparison operator %q", e.ComparisonOperator)
+	}
+	if _, err := strconv.ParseFloat(e.Threshold, 64); err != nil {
+		return rulefmt.Rule{}, errors.Errorf("invalid threshold %q", e.Threshold)
+	}
+
+	// CloudMonitor fires after the threshold has been exceeded for a number
+	// of consecutive evaluation periods; express the same delay as "for".
+	var holdFor model.Duration
+	if period, err := strconv.Atoi(a.Period); err == nil && e.Times > 1 {
+		holdFor = model.Duration(time.Duration(e.Times*period) * time.Second)
+	}
+
+	return rulefmt.Rule{
+		Alert: cloudMonitorAlertName(a.RuleName, severity),
+		Expr:  fmt.Sprintf("%s %s %s", expr, op, e.Threshold),
+		For:   holdFor,
+		Labels: map[string]string{
+			"severity": severity,
+		},
+		Annotations: map[string]string{
+			"summary":              fmt.Sprintf("CloudMonitor alarm %q (%s %s %s)", a.RuleName, e.Statistics, e.ComparisonOperator, e.Threshold),
+			"cloudmonitor_rule_id": a.RuleID,
+		},
+	}, nil
+}
+
+// cloudMonitorAlertName derives a valid alert name from a CloudMonitor rule
+// name, which may contain arbitrary characters.
+func cloudMonitorAlertName(name, severity string) string {
+	b := []byte(name)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			b[i] = '_'
+		}
+	}
+	return string(b) + "_" + severity
+}
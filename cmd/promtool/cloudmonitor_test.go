@@ -0,0 +1,71 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertCloudMonitorAlarms(t *testing.T) {
+	alarms, err := loadCloudMonitorAlarms("testdata/cloudmonitor-alarms.json")
+	require.NoError(t, err)
+	require.Len(t, alarms, 4)
+
+	mapping, err := loadCloudMonitorMapping("testdata/cloudmonitor-mapping.yml")
+	require.NoError(t, err)
+
+	rules, skipped := convertCloudMonitorAlarms(alarms, mapping)
+	require.Len(t, rules, 3)
+
+	// The CPU alarm has two escalation levels, converted to two alerts.
+	require.Equal(t, "ECS_cpu_high_critical", rules[0].Alert)
+	require.Equal(t, `100 * (1 - avg by (instance) (rate(node_cpu_seconds_total{mode="idle"}[5m]))) > 90`, rules[0].Expr)
+	require.Equal(t, model.Duration(3*time.Minute), rules[0].For)
+	require.Equal(t, "critical", rules[0].Labels["severity"])
+	require.Equal(t, "cpu-rule-1", rules[0].Annotations["cloudmonitor_rule_id"])
+
+	require.Equal(t, "ECS_cpu_high_warning", rules[1].Alert)
+	require.Equal(t, "warning", rules[1].Labels["severity"])
+
+	// A single evaluation period does not need a "for" clause.
+	require.Equal(t, "ECS_memory_low_critical", rules[2].Alert)
+	require.Equal(t, model.Duration(0), rules[2].For)
+
+	// The RDS alarm has no mapping and the last alarm is disabled.
+	require.Len(t, skipped, 2)
+	require.Contains(t, skipped[0], `no mapping for metric "acs_rds_dashboard/ConnectionUsage"`)
+	require.Contains(t, skipped[1], "disabled")
+}
+
+func TestConvertCloudMonitorEscalation(t *testing.T) {
+	alarm := cloudMonitorAlarm{RuleName: "test", Period: "60"}
+
+	_, err := convertCloudMonitorEscalation(alarm, "up", "critical", &cloudMonitorEscalation{
+		ComparisonOperator: "GreaterThanYesterday",
+		Threshold:          "10",
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported comparison operator")
+
+	_, err = convertCloudMonitorEscalation(alarm, "up", "critical", &cloudMonitorEscalation{
+		ComparisonOperator: "GreaterThanThreshold",
+		Threshold:          "not-a-number",
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid threshold")
+}
@@ -0,0 +1,175 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/discovery"
+)
+
+// ConfigDiff compares two configuration files and prints their semantic
+// differences, section by section rather than line by line. It returns 0 if
+// the configurations are equivalent, 1 if they differ and 2 if either file
+// fails to load.
+func ConfigDiff(oldFile, newFile string) int {
+	oldCfg, err := config.LoadFile(oldFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  FAILED: %s: %s\n", oldFile, err)
+		return 2
+	}
+	newCfg, err := config.LoadFile(newFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  FAILED: %s: %s\n", newFile, err)
+		return 2
+	}
+
+	fmt.Printf("Comparing %s and %s\n\n", oldFile, newFile)
+	if !diffConfigs(os.Stdout, oldCfg, newCfg) {
+		fmt.Println("No differences found")
+		return 0
+	}
+	return 1
+}
+
+// diffConfigs writes the differences between the two configurations to w and
+// reports whether any were found.
+func diffConfigs(w io.Writer, oldCfg, newCfg *config.Config) bool {
+	changed := false
+
+	sections := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"global", oldCfg.GlobalConfig, newCfg.GlobalConfig},
+		{"rule_files", oldCfg.RuleFiles, newCfg.RuleFiles},
+		{"alerting", oldCfg.AlertingConfig, newCfg.AlertingConfig},
+		{"remote_write", oldCfg.RemoteWriteConfigs, newCfg.RemoteWriteConfigs},
+		{"remote_read", oldCfg.RemoteReadConfigs, newCfg.RemoteReadConfigs},
+	}
+	for _, s := range sections {
+		if o, n := yamlString(s.old), yamlString(s.new); o != n {
+			changed = true
+			printSectionDiff(w, "", s.name, o, n)
+		}
+	}
+
+	oldJobs := map[string]*config.ScrapeConfig{}
+	for _, scfg := range oldCfg.ScrapeConfigs {
+		oldJobs[scfg.JobName] = scfg
+	}
+	newJobs := map[string]*config.ScrapeConfig{}
+	for _, scfg := range newCfg.ScrapeConfigs {
+		newJobs[scfg.JobName] = scfg
+	}
+
+	for _, scfg := range oldCfg.ScrapeConfigs {
+		if _, ok := newJobs[scfg.JobName]; !ok {
+			changed = true
+			fmt.Fprintf(w, "Job %q removed\n\n", scfg.JobName)
+		}
+	}
+	for _, scfg := range newCfg.ScrapeConfigs {
+		old, ok := oldJobs[scfg.JobName]
+		if !ok {
+			changed = true
+			fmt.Fprintf(w, "Job %q added\n\n", scfg.JobName)
+			continue
+		}
+		if diffJob(w, old, scfg) {
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// diffJob compares two scrape configurations for the same job and reports
+// whether they differ. Service discovery, relabeling and the remaining scrape
+// settings are compared separately so a review of a large config can focus on
+// what actually changed.
+func diffJob(w io.Writer, oldJob, newJob *config.ScrapeConfig) bool {
+	parts := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"service discovery", &sdConfigs{oldJob.ServiceDiscoveryConfigs}, &sdConfigs{newJob.ServiceDiscoveryConfigs}},
+		{"relabel_configs", oldJob.RelabelConfigs, newJob.RelabelConfigs},
+		{"metric_relabel_configs", oldJob.MetricRelabelConfigs, newJob.MetricRelabelConfigs},
+		{"scrape settings", scrapeSettings(oldJob), scrapeSettings(newJob)},
+	}
+
+	changed := false
+	for _, p := range parts {
+		if o, n := yamlString(p.old), yamlString(p.new); o != n {
+			if !changed {
+				changed = true
+				fmt.Fprintf(w, "Job %q changed:\n", newJob.JobName)
+			}
+			printSectionDiff(w, "  ", p.name, o, n)
+		}
+	}
+	return changed
+}
+
+// sdConfigs makes a job's service discovery configurations marshalable on
+// their own; discovery.Configs can only be marshaled inlined into a struct.
+type sdConfigs struct {
+	Configs discovery.Configs `yaml:"-"`
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (c *sdConfigs) MarshalYAML() (interface{}, error) {
+	return discovery.MarshalYAMLWithInlineConfigs(c)
+}
+
+// scrapeSettings returns a copy of the scrape configuration with the parts
+// that are diffed separately removed.
+func scrapeSettings(scfg *config.ScrapeConfig) *config.ScrapeConfig {
+	c := *scfg
+	c.ServiceDiscoveryConfigs = nil
+	c.RelabelConfigs = nil
+	c.MetricRelabelConfigs = nil
+	return &c
+}
+
+func printSectionDiff(w io.Writer, indent, name, old, new string) {
+	fmt.Fprintf(w, "%s%s changed:\n", indent, name)
+	fmt.Fprintf(w, "%s  old:\n%s", indent, indentLines(old, indent+"    "))
+	fmt.Fprintf(w, "%s  new:\n%s\n", indent, indentLines(new, indent+"    "))
+}
+
+func yamlString(v interface{}) string {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("<error marshaling: %s>", err)
+	}
+	return string(b)
+}
+
+func indentLines(s, indent string) string {
+	var b strings.Builder
+	for _, l := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+		b.WriteString(indent)
+		b.WriteString(l)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/config"
+)
+
+func TestConfigDiff(t *testing.T) {
+	oldCfg, err := config.LoadFile("testdata/config-diff-old.yml")
+	require.NoError(t, err)
+	newCfg, err := config.LoadFile("testdata/config-diff-new.yml")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.True(t, diffConfigs(&buf, oldCfg, newCfg))
+
+	out := buf.String()
+	require.Contains(t, out, "global changed:")
+	require.Contains(t, out, `Job "legacy" removed`)
+	require.Contains(t, out, `Job "cadvisor" added`)
+	require.Contains(t, out, `Job "node" changed:`)
+	require.Contains(t, out, "relabel_configs changed:")
+	// The unchanged job does not show up.
+	require.NotContains(t, out, `Job "prometheus"`)
+
+	buf.Reset()
+	require.False(t, diffConfigs(&buf, oldCfg, oldCfg))
+	require.Equal(t, "", buf.String())
+}
@@ -44,6 +44,7 @@ import (
 	_ "github.com/prometheus/prometheus/discovery/install" // Register service discovery implementations.
 	"github.com/prometheus/prometheus/discovery/kubernetes"
 	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/prometheus/promql/parser"
 )
 
 func main() {
@@ -67,6 +68,17 @@ func main() {
 
 	checkMetricsCmd := checkCmd.Command("metrics", checkMetricsUsage)
 
+	configCmd := app.Command("config", "Configuration file commands.")
+	configDiffCmd := configCmd.Command("diff", "Show semantic differences between two config files.")
+	configDiffOldFile := configDiffCmd.Arg(
+		"old-config-file",
+		"The old config file.",
+	).Required().ExistingFile()
+	configDiffNewFile := configDiffCmd.Arg(
+		"new-config-file",
+		"The new config file.",
+	).Required().ExistingFile()
+
 	queryCmd := app.Command("query", "Run query against a Prometheus server.")
 	queryCmdFmt := queryCmd.Flag("format", "Output format of the query.").Short('o').Default("promql").Enum("promql", "json")
 
@@ -96,6 +108,11 @@ func main() {
 	debugMetricsServer := debugMetricsCmd.Arg("server", "Prometheus server to get metrics from.").Required().String()
 	debugAllCmd := debugCmd.Command("all", "Fetch all debug information.")
 	debugAllServer := debugAllCmd.Arg("server", "Prometheus server to get all debug information from.").Required().String()
+	debugSDCmd := debugCmd.Command("sd", "Run the service discovery of a scrape job once and print the discovered targets.")
+	debugSDJob := debugSDCmd.Flag("job", "Scrape job to run service discovery for.").Required().String()
+	debugSDOutput := debugSDCmd.Flag("output", "Output format of the discovered targets.").Default("file_sd").Enum("file_sd")
+	debugSDTimeout := debugSDCmd.Flag("timeout", "How long to run service discovery before printing the results.").Default("10s").Duration()
+	debugSDConfigFile := debugSDCmd.Arg("config-file", "The Prometheus config file.").Required().ExistingFile()
 
 	queryLabelsCmd := queryCmd.Command("labels", "Run labels query.")
 	queryLabelsServer := queryLabelsCmd.Arg("server", "Prometheus server to query.").Required().URL()
@@ -103,6 +120,10 @@ func main() {
 	queryLabelsBegin := queryLabelsCmd.Flag("start", "Start time (RFC3339 or Unix timestamp).").String()
 	queryLabelsEnd := queryLabelsCmd.Flag("end", "End time (RFC3339 or Unix timestamp).").String()
 
+	promqlCmd := app.Command("promql", "PromQL formatting and editing.")
+	promqlFormatCmd := promqlCmd.Command("format", "Format PromQL query to the canonical representation.")
+	promqlFormatExpr := promqlFormatCmd.Arg("query", "PromQL query.").Required().String()
+
 	testCmd := app.Command("test", "Unit testing.")
 	testRulesCmd := testCmd.Command("rules", "Unit tests for rules.")
 	testRulesFiles := testRulesCmd.Arg(
@@ -110,6 +131,17 @@ func main() {
 		"The unit test file.",
 	).Required().ExistingFiles()
 
+	testRelabelCmd := testCmd.Command("relabel", "Replay the relabel rules of a scrape job against a set of discovered labels.")
+	testRelabelConfigFile := testRelabelCmd.Flag("config", "The Prometheus config file.").Required().ExistingFile()
+	testRelabelJob := testRelabelCmd.Flag("job", "Scrape job whose relabel rules to apply.").Required().String()
+	testRelabelLabels := testRelabelCmd.Flag("labels", "Comma separated name=value pairs of discovered labels, e.g. '__address__=10.0.0.1:9100,__meta_ecs_tag_team=core'. May be repeated.").Required().Strings()
+
+	migrateCmd := app.Command("migrate", "Convert alerting rules from other monitoring systems.")
+	migrateCloudMonitorCmd := migrateCmd.Command("cloudmonitor", "Convert exported CloudMonitor alarm rules into a Prometheus rule file.")
+	migrateCloudMonitorInput := migrateCloudMonitorCmd.Arg("alarm-file", "JSON file with exported alarm rules (a DescribeMetricRuleList response or a plain array of alarms).").Required().ExistingFile()
+	migrateCloudMonitorMapping := migrateCloudMonitorCmd.Flag("mapping", "YAML file mapping CloudMonitor metrics ('<namespace>/<metric_name>') to PromQL expressions.").Required().ExistingFile()
+	migrateCloudMonitorOutput := migrateCloudMonitorCmd.Flag("output", "Write the rule file here instead of standard output.").String()
+
 	defaultDBPath := "data/"
 	tsdbCmd := app.Command("tsdb", "Run tsdb commands.")
 
@@ -159,6 +191,9 @@ func main() {
 	case checkMetricsCmd.FullCommand():
 		os.Exit(CheckMetrics())
 
+	case configDiffCmd.FullCommand():
+		os.Exit(ConfigDiff(*configDiffOldFile, *configDiffNewFile))
+
 	case queryInstantCmd.FullCommand():
 		os.Exit(QueryInstant(*queryInstantServer, *queryInstantExpr, *queryInstantTime, p))
 
@@ -177,12 +212,24 @@ func main() {
 	case debugAllCmd.FullCommand():
 		os.Exit(debugAll(*debugAllServer))
 
+	case debugSDCmd.FullCommand():
+		os.Exit(DebugSD(*debugSDConfigFile, *debugSDJob, *debugSDOutput, *debugSDTimeout))
+
 	case queryLabelsCmd.FullCommand():
 		os.Exit(QueryLabels(*queryLabelsServer, *queryLabelsName, *queryLabelsBegin, *queryLabelsEnd, p))
 
+	case promqlFormatCmd.FullCommand():
+		os.Exit(checkErr(formatPromQL(*promqlFormatExpr)))
+
 	case testRulesCmd.FullCommand():
 		os.Exit(RulesUnitTest(*testRulesFiles...))
 
+	case testRelabelCmd.FullCommand():
+		os.Exit(TestRelabel(*testRelabelConfigFile, *testRelabelJob, *testRelabelLabels))
+
+	case migrateCloudMonitorCmd.FullCommand():
+		os.Exit(MigrateCloudMonitor(*migrateCloudMonitorInput, *migrateCloudMonitorMapping, *migrateCloudMonitorOutput))
+
 	case tsdbBenchWriteCmd.FullCommand():
 		os.Exit(checkErr(benchmarkWrite(*benchWriteOutPath, *benchSamplesFile, *benchWriteNumMetrics)))
 
@@ -771,3 +818,14 @@ func (j *jsonPrinter) printLabelValues(v model.LabelValues) {
 	//nolint:errcheck
 	json.NewEncoder(os.Stdout).Encode(v)
 }
+
+// formatPromQL parses the given query and prints it back in its canonical
+// form, so that equivalent expressions can be compared reliably.
+func formatPromQL(query string) error {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return err
+	}
+	fmt.Println(expr.String())
+	return nil
+}
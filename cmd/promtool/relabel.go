@@ -0,0 +1,132 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/relabel"
+)
+
+// TestRelabel replays the relabel rules of a single scrape job against the
+// given discovered labels and prints the effect of every rule, so relabel
+// configs can be iterated on without deploying them.
+func TestRelabel(configFile, job string, lsets []string) int {
+	cfg, err := config.LoadFile(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  FAILED: %s: %s\n", configFile, err)
+		return 2
+	}
+
+	var scfg *config.ScrapeConfig
+	for _, c := range cfg.ScrapeConfigs {
+		if c.JobName == job {
+			scfg = c
+			break
+		}
+	}
+	if scfg == nil {
+		fmt.Fprintf(os.Stderr, "  FAILED: job %q not found in %s\n", job, configFile)
+		return 2
+	}
+
+	lset, err := parseRelabelLabels(lsets)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "  FAILED:", err)
+		return 2
+	}
+
+	// Mimic target creation in the scrape manager: the scrape job defaults
+	// and query parameters are part of the pre-relabel label set.
+	lb := labels.NewBuilder(lset)
+	for _, l := range []labels.Label{
+		{Name: model.JobLabel, Value: scfg.JobName},
+		{Name: model.MetricsPathLabel, Value: scfg.MetricsPath},
+		{Name: model.SchemeLabel, Value: scfg.Scheme},
+	} {
+		if lset.Get(l.Name) == "" {
+			lb.Set(l.Name, l.Value)
+		}
+	}
+	for k, v := range scfg.Params {
+		if len(v) > 0 {
+			lb.Set(model.ParamLabelPrefix+k, v[0])
+		}
+	}
+	lset = lb.Labels()
+
+	fmt.Println("Discovered labels:")
+	printRelabelLabels(lset)
+
+	for i, rc := range scfg.RelabelConfigs {
+		rule, err := yaml.Marshal(rc)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "  FAILED:", err)
+			return 2
+		}
+		fmt.Printf("\nRule %d:\n", i+1)
+		for _, line := range strings.Split(strings.TrimSpace(string(rule)), "\n") {
+			fmt.Println("  " + line)
+		}
+		out := relabel.Process(lset, rc)
+		if out == nil {
+			fmt.Println("Result: target dropped")
+			return 0
+		}
+		switch {
+		case labels.Equal(out, lset):
+			fmt.Println("Result: unchanged")
+		default:
+			fmt.Println("Result:")
+			printRelabelLabels(out)
+		}
+		lset = out
+	}
+
+	fmt.Println("\nFinal labels:")
+	printRelabelLabels(lset)
+	return 0
+}
+
+// parseRelabelLabels parses comma separated name=value pairs into a label
+// set. Multiple arguments are combined, so the flag may be repeated.
+func parseRelabelLabels(lsets []string) (labels.Labels, error) {
+	var lset labels.Labels
+	for _, s := range lsets {
+		for _, pair := range strings.Split(s, ",") {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return nil, errors.Errorf("invalid label pair %q, expected name=value", pair)
+			}
+			lset = append(lset, labels.Label{Name: parts[0], Value: strings.Trim(parts[1], `"`)})
+		}
+	}
+	sort.Sort(lset)
+	return lset, nil
+}
+
+func printRelabelLabels(lset labels.Labels) {
+	for _, l := range lset {
+		fmt.Printf("  %s=%q\n", l.Name, l.Value)
+	}
+}
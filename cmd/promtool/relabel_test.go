@@ -0,0 +1,40 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+func TestParseRelabelLabels(t *testing.T) {
+	lset, err := parseRelabelLabels([]string{
+		`__address__=10.0.0.1:9100,__meta_ecs_tag_team="core"`,
+		"__meta_ecs_instance_name=web-1",
+	})
+	require.NoError(t, err)
+	require.Equal(t, labels.FromStrings(
+		"__address__", "10.0.0.1:9100",
+		"__meta_ecs_tag_team", "core",
+		"__meta_ecs_instance_name", "web-1",
+	), lset)
+
+	_, err = parseRelabelLabels([]string{"no-value"})
+	require.Error(t, err)
+	_, err = parseRelabelLabels([]string{"=value"})
+	require.Error(t, err)
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/discovery"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+)
+
+// DebugSD runs the service discovery of a single scrape job once and prints
+// the discovered targets. Discovery runs until the timeout expires, so slowly
+// converging mechanisms get a chance to report all their targets.
+func DebugSD(configFile, job, output string, timeout time.Duration) int {
+	cfg, err := config.LoadFile(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  FAILED: %s: %s\n", configFile, err)
+		return 2
+	}
+
+	var scfg *config.ScrapeConfig
+	for _, c := range cfg.ScrapeConfigs {
+		if c.JobName == job {
+			scfg = c
+			break
+		}
+	}
+	if scfg == nil {
+		fmt.Fprintf(os.Stderr, "  FAILED: job %q not found in %s\n", job, configFile)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	logger := log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+	manager := discovery.NewManager(ctx, logger)
+	go func() {
+		if err := manager.Run(); err != nil && err != context.Canceled {
+			fmt.Fprintln(os.Stderr, "  FAILED:", err)
+		}
+	}()
+	if err := manager.ApplyConfig(map[string]discovery.Configs{scfg.JobName: scfg.ServiceDiscoveryConfigs}); err != nil {
+		fmt.Fprintln(os.Stderr, "  FAILED:", err)
+		return 2
+	}
+
+	var groups []*targetgroup.Group
+	for {
+		select {
+		case tsets := <-manager.SyncCh():
+			groups = tsets[scfg.JobName]
+		case <-ctx.Done():
+			return printSDTargets(groups, output)
+		}
+	}
+}
+
+func printSDTargets(groups []*targetgroup.Group, output string) int {
+	switch output {
+	case "file_sd":
+		b, err := json.MarshalIndent(fileSDFormat(groups), "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "  FAILED:", err)
+			return 2
+		}
+		fmt.Println(string(b))
+	}
+	return 0
+}
+
+// fileSDGroup is one entry of a file_sd file.
+type fileSDGroup struct {
+	Targets []string       `json:"targets"`
+	Labels  model.LabelSet `json:"labels,omitempty"`
+}
+
+// fileSDFormat converts discovered target groups into file_sd entries.
+// Targets sharing the same label set end up in one entry, so the common case
+// of a group whose targets differ only in their address stays compact.
+func fileSDFormat(groups []*targetgroup.Group) []fileSDGroup {
+	var (
+		order   []model.Fingerprint
+		entries = map[model.Fingerprint]*fileSDGroup{}
+	)
+	for _, g := range groups {
+		for _, t := range g.Targets {
+			lset := g.Labels.Merge(t)
+			addr := string(lset[model.AddressLabel])
+			delete(lset, model.AddressLabel)
+
+			fp := lset.Fingerprint()
+			e, ok := entries[fp]
+			if !ok {
+				e = &fileSDGroup{Labels: lset}
+				entries[fp] = e
+				order = append(order, fp)
+			}
+			e.Targets = append(e.Targets, addr)
+		}
+	}
+	out := make([]fileSDGroup, 0, len(order))
+	for _, fp := range order {
+		out = append(out, *entries[fp])
+	}
+	return out
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+)
+
+func TestFileSDFormat(t *testing.T) {
+	groups := []*targetgroup.Group{
+		{
+			Targets: []model.LabelSet{
+				{model.AddressLabel: "one:9090"},
+				{model.AddressLabel: "two:9090"},
+				{model.AddressLabel: "three:9090", "rack": "a"},
+			},
+			Labels: model.LabelSet{"env": "prod"},
+		},
+		{
+			Targets: []model.LabelSet{
+				{model.AddressLabel: "four:9090"},
+			},
+		},
+	}
+
+	require.Equal(t, []fileSDGroup{
+		{
+			Targets: []string{"one:9090", "two:9090"},
+			Labels:  model.LabelSet{"env": "prod"},
+		},
+		{
+			Targets: []string{"three:9090"},
+			Labels:  model.LabelSet{"env": "prod", "rack": "a"},
+		},
+		{
+			Targets: []string{"four:9090"},
+			Labels:  model.LabelSet{},
+		},
+	}, fileSDFormat(groups))
+}
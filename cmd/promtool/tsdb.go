@@ -361,12 +361,12 @@ func printBlocks(blocks []tsdb.BlockReader, humanReadable bool) {
 	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 	defer tw.Flush()
 
-	fmt.Fprintln(tw, "BLOCK ULID\tMIN TIME\tMAX TIME\tDURATION\tNUM SAMPLES\tNUM CHUNKS\tNUM SERIES\tSIZE")
+	fmt.Fprintln(tw, "BLOCK ULID\tMIN TIME\tMAX TIME\tDURATION\tNUM SAMPLES\tNUM CHUNKS\tNUM SERIES\tSIZE\tLABELS")
 	for _, b := range blocks {
 		meta := b.Meta()
 
 		fmt.Fprintf(tw,
-			"%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			"%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
 			meta.ULID,
 			getFormatedTime(meta.MinTime, humanReadable),
 			getFormatedTime(meta.MaxTime, humanReadable),
@@ -375,10 +375,20 @@ func printBlocks(blocks []tsdb.BlockReader, humanReadable bool) {
 			meta.Stats.NumChunks,
 			meta.Stats.NumSeries,
 			getFormatedBytes(b.Size(), humanReadable),
+			getFormatedLabels(meta.Labels),
 		)
 	}
 }
 
+// getFormatedLabels renders the metadata labels of a block, e.g. the source
+// it was backfilled from, in a stable order.
+func getFormatedLabels(m map[string]string) string {
+	if len(m) == 0 {
+		return ""
+	}
+	return labels.FromMap(m).String()
+}
+
 func getFormatedTime(timestamp int64, humanReadable bool) string {
 	if humanReadable {
 		return time.Unix(timestamp/1000, 0).UTC().String()
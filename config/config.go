@@ -14,14 +14,19 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
@@ -29,7 +34,9 @@ import (
 
 	"github.com/prometheus/prometheus/discovery"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/namematcher"
 	"github.com/prometheus/prometheus/pkg/relabel"
+	"github.com/prometheus/prometheus/pkg/secrets"
 )
 
 var (
@@ -62,9 +69,135 @@ func LoadFile(filename string) (*Config, error) {
 		return nil, errors.Wrapf(err, "parsing YAML file %s", filename)
 	}
 	cfg.SetDirectory(filepath.Dir(filename))
+	if err := cfg.loadScrapeConfigFiles(); err != nil {
+		return nil, err
+	}
+	if err := secrets.Resolve(context.Background(), cfg); err != nil {
+		return nil, errors.Wrapf(err, "resolving secrets in %s", filename)
+	}
 	return cfg, nil
 }
 
+// scrapeConfigFile is the format of the files referenced by
+// scrape_config_files; each holds a list of scrape configs of its own.
+type scrapeConfigFile struct {
+	ScrapeConfigs []*ScrapeConfig `yaml:"scrape_configs"`
+}
+
+// loadScrapeConfigFiles reads scrape configs from all files matching the
+// scrape_config_files patterns and appends them to ScrapeConfigs. Every
+// fragment is validated on its own so errors name the file they came from.
+func (c *Config) loadScrapeConfigFiles() error {
+	jobNames := map[string]struct{}{}
+	for _, scfg := range c.ScrapeConfigs {
+		jobNames[scfg.JobName] = struct{}{}
+	}
+	for _, pat := range c.ScrapeConfigFiles {
+		fs, err := filepath.Glob(pat)
+		if err != nil {
+			// The only error can be a bad pattern.
+			return errors.Wrapf(err, "error retrieving scrape config files for %q", pat)
+		}
+		for _, fn := range fs {
+			content, err := ioutil.ReadFile(fn)
+			if err != nil {
+				return errors.Wrapf(err, "reading scrape config file %s", fn)
+			}
+			var sc scrapeConfigFile
+			if err := yaml.UnmarshalStrict(content, &sc); err != nil {
+				return errors.Wrapf(err, "parsing scrape config file %s", fn)
+			}
+			for _, scfg := range sc.ScrapeConfigs {
+				if err := c.applyScrapeDefaults(scfg); err != nil {
+					return errors.Wrapf(err, "parsing scrape config file %s", fn)
+				}
+				if _, ok := jobNames[scfg.JobName]; ok {
+					return errors.Errorf("found multiple scrape configs with job name %q in %s", scfg.JobName, fn)
+				}
+				jobNames[scfg.JobName] = struct{}{}
+				scfg.SetDirectory(filepath.Dir(fn))
+				c.ScrapeConfigs = append(c.ScrapeConfigs, scfg)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadFileWithFallback is like LoadFile, except that scrape configs failing
+// to parse are replaced by their version from the previous config instead of
+// failing the whole load. The job names of the replaced configs are returned
+// so callers can surface them. Errors outside the scrape configs, and broken
+// jobs without a previous version, still fail the load as a whole.
+func LoadFileWithFallback(filename string, prev *Config) (*Config, []string, error) {
+	cfg, loadErr := LoadFile(filename)
+	if loadErr == nil || prev == nil {
+		return cfg, nil, loadErr
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, loadErr
+	}
+	// Pull the scrape configs out of the document so that each job can be
+	// parsed on its own.
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, nil, loadErr
+	}
+	rawJobs, _ := doc["scrape_configs"].([]interface{})
+
+	var (
+		kept     []interface{}
+		fallback []*ScrapeConfig
+		replaced []string
+	)
+	for _, rawJob := range rawJobs {
+		jb, err := yaml.Marshal(rawJob)
+		if err != nil {
+			return nil, nil, loadErr
+		}
+		var sc ScrapeConfig
+		if err := yaml.UnmarshalStrict(jb, &sc); err == nil {
+			kept = append(kept, rawJob)
+			continue
+		}
+		var jobName string
+		if m, ok := rawJob.(map[interface{}]interface{}); ok {
+			jobName, _ = m["job_name"].(string)
+		}
+		var prevJob *ScrapeConfig
+		for _, pj := range prev.ScrapeConfigs {
+			if pj.JobName == jobName {
+				prevJob = pj
+				break
+			}
+		}
+		if prevJob == nil {
+			// A job that never had a valid version cannot be salvaged.
+			return nil, nil, loadErr
+		}
+		fallback = append(fallback, prevJob)
+		replaced = append(replaced, jobName)
+	}
+	if len(replaced) == 0 {
+		// The failure is outside the scrape configs.
+		return nil, nil, loadErr
+	}
+
+	doc["scrape_configs"] = kept
+	stripped, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, nil, loadErr
+	}
+	cfg, err = Load(string(stripped))
+	if err != nil {
+		return nil, nil, loadErr
+	}
+	cfg.SetDirectory(filepath.Dir(filename))
+	cfg.ScrapeConfigs = append(cfg.ScrapeConfigs, fallback...)
+	return cfg, replaced, nil
+}
+
 // The defaults applied before parsing the respective config sections.
 var (
 	// DefaultConfig is the default top-level configuration.
@@ -93,7 +226,7 @@ var (
 	DefaultAlertmanagerConfig = AlertmanagerConfig{
 		Scheme:     "http",
 		Timeout:    model.Duration(10 * time.Second),
-		APIVersion: AlertmanagerAPIVersionV1,
+		APIVersion: AlertmanagerAPIVersionAuto,
 	}
 
 	// DefaultRemoteWriteConfig is the default remote write configuration.
@@ -131,18 +264,24 @@ var (
 	// DefaultRemoteReadConfig is the default remote read configuration.
 	DefaultRemoteReadConfig = RemoteReadConfig{
 		RemoteTimeout: model.Duration(1 * time.Minute),
+		CacheTTL:      model.Duration(5 * time.Minute),
 	}
 )
 
 // Config is the top-level configuration for Prometheus's config files.
 type Config struct {
-	GlobalConfig   GlobalConfig    `yaml:"global"`
-	AlertingConfig AlertingConfig  `yaml:"alerting,omitempty"`
-	RuleFiles      []string        `yaml:"rule_files,omitempty"`
-	ScrapeConfigs  []*ScrapeConfig `yaml:"scrape_configs,omitempty"`
+	GlobalConfig         GlobalConfig          `yaml:"global"`
+	AlertingConfig       AlertingConfig        `yaml:"alerting,omitempty"`
+	RuleFiles            []string              `yaml:"rule_files,omitempty"`
+	ScrapeConfigDefaults *ScrapeConfigDefaults `yaml:"scrape_config_defaults,omitempty"`
+	ScrapeConfigFiles    []string              `yaml:"scrape_config_files,omitempty"`
+	ScrapeConfigs        []*ScrapeConfig       `yaml:"scrape_configs,omitempty"`
 
 	RemoteWriteConfigs []*RemoteWriteConfig `yaml:"remote_write,omitempty"`
 	RemoteReadConfigs  []*RemoteReadConfig  `yaml:"remote_read,omitempty"`
+	OTLPConfig         OTLPConfig           `yaml:"otlp,omitempty"`
+	InfluxConfig       InfluxConfig         `yaml:"influx,omitempty"`
+	BridgeConfig       BridgeConfig         `yaml:"bridge,omitempty"`
 }
 
 // SetDirectory joins any relative file paths with dir.
@@ -152,6 +291,12 @@ func (c *Config) SetDirectory(dir string) {
 	for i, file := range c.RuleFiles {
 		c.RuleFiles[i] = config.JoinDir(dir, file)
 	}
+	for i, file := range c.ScrapeConfigFiles {
+		c.ScrapeConfigFiles[i] = config.JoinDir(dir, file)
+	}
+	if c.ScrapeConfigDefaults != nil {
+		c.ScrapeConfigDefaults.HTTPClientConfig.SetDirectory(dir)
+	}
 	for _, c := range c.ScrapeConfigs {
 		c.SetDirectory(dir)
 	}
@@ -171,6 +316,46 @@ func (c Config) String() string {
 	return string(b)
 }
 
+var envVarRE = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// ExpandStaticConfigEnvVars replaces ${VAR} references in the targets and
+// label values of all static_configs with the value of the environment
+// variable, or the empty string if it is unset. It is enabled with
+// --enable-feature=expand-static-config-env.
+func (c *Config) ExpandStaticConfigEnvVars() {
+	for _, scfg := range c.ScrapeConfigs {
+		expandStaticConfigs(scfg.ServiceDiscoveryConfigs)
+	}
+	for _, amcfg := range c.AlertingConfig.AlertmanagerConfigs {
+		expandStaticConfigs(amcfg.ServiceDiscoveryConfigs)
+	}
+}
+
+func expandStaticConfigs(cfgs discovery.Configs) {
+	for _, cfg := range cfgs {
+		static, ok := cfg.(discovery.StaticConfig)
+		if !ok {
+			continue
+		}
+		for _, g := range static {
+			for name, value := range g.Labels {
+				g.Labels[name] = expandEnvVars(value)
+			}
+			for _, t := range g.Targets {
+				for name, value := range t {
+					t[name] = expandEnvVars(value)
+				}
+			}
+		}
+	}
+}
+
+func expandEnvVars(v model.LabelValue) model.LabelValue {
+	return model.LabelValue(envVarRE.ReplaceAllStringFunc(string(v), func(ref string) string {
+		return os.Getenv(strings.TrimSuffix(strings.TrimPrefix(ref, "${"), "}"))
+	}))
+}
+
 // UnmarshalYAML implements the yaml.Unmarshaler interface.
 func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	*c = DefaultConfig
@@ -196,23 +381,8 @@ func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	// Do global overrides and validate unique names.
 	jobNames := map[string]struct{}{}
 	for _, scfg := range c.ScrapeConfigs {
-		if scfg == nil {
-			return errors.New("empty or null scrape config section")
-		}
-		// First set the correct scrape interval, then check that the timeout
-		// (inferred or explicit) is not greater than that.
-		if scfg.ScrapeInterval == 0 {
-			scfg.ScrapeInterval = c.GlobalConfig.ScrapeInterval
-		}
-		if scfg.ScrapeTimeout > scfg.ScrapeInterval {
-			return errors.Errorf("scrape timeout greater than scrape interval for scrape config with job name %q", scfg.JobName)
-		}
-		if scfg.ScrapeTimeout == 0 {
-			if c.GlobalConfig.ScrapeTimeout > scfg.ScrapeInterval {
-				scfg.ScrapeTimeout = scfg.ScrapeInterval
-			} else {
-				scfg.ScrapeTimeout = c.GlobalConfig.ScrapeTimeout
-			}
+		if err := c.applyScrapeDefaults(scfg); err != nil {
+			return err
 		}
 
 		if _, ok := jobNames[scfg.JobName]; ok {
@@ -315,6 +485,91 @@ func (c *GlobalConfig) isZero() bool {
 		c.QueryLogFile == ""
 }
 
+// Supported values for ScrapeConfig.MetricNameValidationScheme. An empty
+// value is equivalent to the legacy scheme.
+const (
+	LegacyValidationConfig = "legacy"
+	UTF8ValidationConfig   = "utf8"
+)
+
+// Supported values for ScrapeConfig.HonorDuplicateSamples. An empty value is
+// equivalent to "first".
+const (
+	DuplicateSamplesFirst = "first"
+	DuplicateSamplesLast  = "last"
+	DuplicateSamplesFail  = "fail"
+)
+
+// applyScrapeDefaults fills a scrape config with the settings from the
+// scrape_config_defaults block and the global config and checks that its
+// timeout does not exceed its interval.
+func (c *Config) applyScrapeDefaults(scfg *ScrapeConfig) error {
+	if scfg == nil {
+		return errors.New("empty or null scrape config section")
+	}
+	// Apply the scrape config defaults before the global ones, so a job
+	// inherits from the defaults block first and the global config last.
+	if d := c.ScrapeConfigDefaults; d != nil {
+		if scfg.ScrapeInterval == 0 {
+			scfg.ScrapeInterval = d.ScrapeInterval
+		}
+		if scfg.ScrapeTimeout == 0 {
+			scfg.ScrapeTimeout = d.ScrapeTimeout
+		}
+		// Default relabel snippets run before the job's own rules so the
+		// job can override their results.
+		if len(d.RelabelConfigs) > 0 {
+			scfg.RelabelConfigs = append(append([]*relabel.Config{}, d.RelabelConfigs...), scfg.RelabelConfigs...)
+		}
+		if len(d.MetricRelabelConfigs) > 0 {
+			scfg.MetricRelabelConfigs = append(append([]*relabel.Config{}, d.MetricRelabelConfigs...), scfg.MetricRelabelConfigs...)
+		}
+		// HTTP client settings are inherited as a whole when the job does
+		// not configure any of its own.
+		if reflect.DeepEqual(scfg.HTTPClientConfig, config.HTTPClientConfig{}) {
+			scfg.HTTPClientConfig = d.HTTPClientConfig
+		}
+	}
+	// First set the correct scrape interval, then check that the timeout
+	// (inferred or explicit) is not greater than that.
+	if scfg.ScrapeInterval == 0 {
+		scfg.ScrapeInterval = c.GlobalConfig.ScrapeInterval
+	}
+	if scfg.ScrapeTimeout > scfg.ScrapeInterval {
+		return errors.Errorf("scrape timeout greater than scrape interval for scrape config with job name %q", scfg.JobName)
+	}
+	if scfg.ScrapeTimeout == 0 {
+		if c.GlobalConfig.ScrapeTimeout > scfg.ScrapeInterval {
+			scfg.ScrapeTimeout = scfg.ScrapeInterval
+		} else {
+			scfg.ScrapeTimeout = c.GlobalConfig.ScrapeTimeout
+		}
+	}
+	return nil
+}
+
+// ScrapeConfigDefaults holds settings every scrape config inherits unless it
+// sets its own. Relabel snippets are prepended to a job's own rules so the
+// job can override their results; all other settings are only applied when
+// the job leaves them unset.
+type ScrapeConfigDefaults struct {
+	ScrapeInterval       model.Duration          `yaml:"scrape_interval,omitempty"`
+	ScrapeTimeout        model.Duration          `yaml:"scrape_timeout,omitempty"`
+	HTTPClientConfig     config.HTTPClientConfig `yaml:",inline"`
+	RelabelConfigs       []*relabel.Config       `yaml:"relabel_configs,omitempty"`
+	MetricRelabelConfigs []*relabel.Config       `yaml:"metric_relabel_configs,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *ScrapeConfigDefaults) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = ScrapeConfigDefaults{}
+	type plain ScrapeConfigDefaults
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	return c.HTTPClientConfig.Validate()
+}
+
 // ScrapeConfig configures a scraping unit for Prometheus.
 type ScrapeConfig struct {
 	// The job name to which the job label is set by default.
@@ -325,6 +580,11 @@ type ScrapeConfig struct {
 	HonorTimestamps bool `yaml:"honor_timestamps"`
 	// A set of query parameters with which the target is scraped.
 	Params url.Values `yaml:"params,omitempty"`
+	// A set of query parameters whose values are taken from target labels.
+	// The labels are resolved before relabeling, so discovery meta labels
+	// may be referenced. A parameter set here overrides a static parameter
+	// of the same name in Params.
+	ParamsFromLabels map[string]string `yaml:"params_from_labels,omitempty"`
 	// How frequently to scrape the targets of this scrape config.
 	ScrapeInterval model.Duration `yaml:"scrape_interval,omitempty"`
 	// The timeout for scraping targets of this config.
@@ -333,11 +593,55 @@ type ScrapeConfig struct {
 	MetricsPath string `yaml:"metrics_path,omitempty"`
 	// The URL scheme with which to fetch metrics from targets.
 	Scheme string `yaml:"scheme,omitempty"`
+	// Probe each target over https first and fall back to http if the TLS
+	// handshake fails, caching the outcome per target. Useful for fleets
+	// where only some exporters have TLS enabled.
+	SchemeAutodetect bool `yaml:"scheme_autodetect,omitempty"`
 	// More than this many samples post metric-relabeling will cause the scrape to fail.
 	SampleLimit uint `yaml:"sample_limit,omitempty"`
 	// More than this many targets after the target relabeling will cause the
 	// scrapes to fail.
 	TargetLimit uint `yaml:"target_limit,omitempty"`
+	// A response whose decompressed size exceeds this limit will cause the
+	// scrape to fail. 0 means no limit.
+	DecompressionSizeLimit ByteSize `yaml:"decompression_size_limit,omitempty"`
+	// A set of static HTTP headers to send with every scrape request, e.g.
+	// for gateways in front of the targets that require them.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// The validation scheme for metric and label names exposed by targets of
+	// this scrape config. The default "legacy" scheme rejects names outside
+	// the classic character set; "utf8" additionally accepts double-quoted
+	// names containing arbitrary UTF-8 characters.
+	MetricNameValidationScheme string `yaml:"metric_name_validation_scheme,omitempty"`
+	// File shared between HA replicas to coordinate which replica scrapes
+	// each target of this job. Disabled if empty.
+	HALeaseFile string `yaml:"ha_lease_file,omitempty"`
+	// Name identifying this replica in the lease file. Defaults to the
+	// hostname.
+	HAReplicaName string `yaml:"ha_replica_name,omitempty"`
+	// More than this many entries in a target's scrape cache will force a
+	// cache flush after the next scrape. 0 means only the built-in growth
+	// heuristic limits the cache.
+	CacheMaxEntries uint `yaml:"cache_max_entries,omitempty"`
+	// Scrape caches are flushed at least this often regardless of scrape
+	// outcome, bounding the age of cached state. Disabled if zero.
+	CacheFlushInterval model.Duration `yaml:"cache_flush_interval,omitempty"`
+	// StaleAfter delays the staleness marker for a series that disappears
+	// from a target's scrapes until it has been absent for this long,
+	// instead of marking it stale at the next scrape. When set, series with
+	// explicit timestamps are tracked for staleness as well. 0 keeps the
+	// default behavior.
+	StaleAfter model.Duration `yaml:"stale_after,omitempty"`
+	// How to handle a series appearing more than once in one scrape: "first"
+	// keeps the first sample, "last" keeps the last sample and "fail" rejects
+	// the whole scrape.
+	HonorDuplicateSamples string `yaml:"honor_duplicate_samples,omitempty"`
+	// ExternalLabels are merged onto the samples of this job at scrape time,
+	// without overriding labels already present. As they end up stored on
+	// the series, they take precedence over a global external label of the
+	// same name wherever those are attached, e.g. for jobs scraping
+	// resources in another region than the server's own region label.
+	ExternalLabels labels.Labels `yaml:"external_labels,omitempty"`
 
 	// We cannot do proper Go type embedding below as the parser will then parse
 	// values arbitrarily into the overflow maps of further-down types.
@@ -349,12 +653,21 @@ type ScrapeConfig struct {
 	RelabelConfigs []*relabel.Config `yaml:"relabel_configs,omitempty"`
 	// List of metric relabel configurations.
 	MetricRelabelConfigs []*relabel.Config `yaml:"metric_relabel_configs,omitempty"`
+	// MetricNameAllowlist, if non-empty, keeps only samples whose metric
+	// name matches one of the patterns. A pattern is a literal name,
+	// optionally containing "*" wildcards. Evaluated before
+	// metric_relabel_configs.
+	MetricNameAllowlist []string `yaml:"metric_name_allowlist,omitempty"`
+	// MetricNameDenylist drops samples whose metric name matches one of the
+	// patterns. Evaluated before metric_relabel_configs.
+	MetricNameDenylist []string `yaml:"metric_name_denylist,omitempty"`
 }
 
 // SetDirectory joins any relative file paths with dir.
 func (c *ScrapeConfig) SetDirectory(dir string) {
 	c.ServiceDiscoveryConfigs.SetDirectory(dir)
 	c.HTTPClientConfig.SetDirectory(dir)
+	c.HALeaseFile = config.JoinDir(dir, c.HALeaseFile)
 }
 
 // UnmarshalYAML implements the yaml.Unmarshaler interface.
@@ -381,6 +694,52 @@ func (c *ScrapeConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		}
 	}
 
+	for name := range c.Headers {
+		switch http.CanonicalHeaderKey(name) {
+		case "":
+			return errors.New("empty header name in scrape config")
+		case "Authorization", "Host", "User-Agent":
+			return errors.Errorf("setting the %q header is not allowed in scrape config", name)
+		}
+	}
+
+	for param, name := range c.ParamsFromLabels {
+		if param == "" {
+			return errors.New("empty parameter name in params_from_labels")
+		}
+		if !model.LabelName(name).IsValid() {
+			return errors.Errorf("invalid label name %q in params_from_labels", name)
+		}
+	}
+
+	for _, l := range c.ExternalLabels {
+		if !model.LabelName(l.Name).IsValid() {
+			return errors.Errorf("%q is not a valid label name in external_labels", l.Name)
+		}
+		if !model.LabelValue(l.Value).IsValid() {
+			return errors.Errorf("%q is not a valid label value in external_labels", l.Value)
+		}
+	}
+
+	if _, err := namematcher.New(c.MetricNameAllowlist); err != nil {
+		return errors.Wrap(err, "invalid metric_name_allowlist")
+	}
+	if _, err := namematcher.New(c.MetricNameDenylist); err != nil {
+		return errors.Wrap(err, "invalid metric_name_denylist")
+	}
+
+	switch c.MetricNameValidationScheme {
+	case "", LegacyValidationConfig, UTF8ValidationConfig:
+	default:
+		return errors.Errorf("unknown metric name validation scheme %q", c.MetricNameValidationScheme)
+	}
+
+	switch c.HonorDuplicateSamples {
+	case "", DuplicateSamplesFirst, DuplicateSamplesLast, DuplicateSamplesFail:
+	default:
+		return errors.Errorf("unknown duplicate sample handling %q", c.HonorDuplicateSamples)
+	}
+
 	for _, rlcfg := range c.RelabelConfigs {
 		if rlcfg == nil {
 			return errors.New("empty or null target relabeling rule in scrape config")
@@ -404,6 +763,10 @@ func (c *ScrapeConfig) MarshalYAML() (interface{}, error) {
 type AlertingConfig struct {
 	AlertRelabelConfigs []*relabel.Config   `yaml:"alert_relabel_configs,omitempty"`
 	AlertmanagerConfigs AlertmanagerConfigs `yaml:"alertmanagers,omitempty"`
+	// NotificationQueueCapacity overrides the capacity of the pending
+	// notifications queue. If zero, the value of the
+	// --alertmanager.notification-queue-capacity flag is used.
+	NotificationQueueCapacity int `yaml:"notification_queue_capacity,omitempty"`
 }
 
 // SetDirectory joins any relative file paths with dir.
@@ -428,6 +791,9 @@ func (c *AlertingConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 			return errors.New("empty or null alert relabeling rule")
 		}
 	}
+	if c.NotificationQueueCapacity < 0 {
+		return errors.New("notification queue capacity must not be negative")
+	}
 	return nil
 }
 
@@ -471,10 +837,13 @@ const (
 	// AlertmanagerAPIVersionV2 represents
 	// github.com/prometheus/alertmanager/api/v2.
 	AlertmanagerAPIVersionV2 AlertmanagerAPIVersion = "v2"
+	// AlertmanagerAPIVersionAuto probes every Alertmanager for API v2
+	// support and falls back to v1 for those that do not serve it.
+	AlertmanagerAPIVersionAuto AlertmanagerAPIVersion = "auto"
 )
 
 var SupportedAlertmanagerAPIVersions = []AlertmanagerAPIVersion{
-	AlertmanagerAPIVersionV1, AlertmanagerAPIVersionV2,
+	AlertmanagerAPIVersionV1, AlertmanagerAPIVersionV2, AlertmanagerAPIVersionAuto,
 }
 
 // AlertmanagerConfig configures how Alertmanagers can be discovered and communicated with.
@@ -559,6 +928,14 @@ func checkStaticTargets(configs discovery.Configs) error {
 
 // CheckTargetAddress checks if target address is valid.
 func CheckTargetAddress(address model.LabelValue) error {
+	// Targets may be scraped over a unix domain socket, given as an
+	// absolute socket path.
+	if strings.HasPrefix(string(address), "unix://") {
+		if !strings.HasPrefix(string(address), "unix:///") {
+			return errors.Errorf("%q is not an absolute unix socket path", address)
+		}
+		return nil
+	}
 	// For now check for a URL, we may want to expand this later.
 	if strings.Contains(string(address), "/") {
 		return errors.Errorf("%q is not a valid hostname", address)
@@ -567,11 +944,26 @@ func CheckTargetAddress(address model.LabelValue) error {
 }
 
 // RemoteWriteConfig is the configuration for writing to remote storage.
+// Supported values for RemoteWriteConfig.ProtobufMessage.
+const (
+	RemoteWriteProtoMsgV1 = "prometheus.WriteRequest"
+	RemoteWriteProtoMsgV2 = "io.prometheus.write.v2.Request"
+)
+
 type RemoteWriteConfig struct {
-	URL                 *config.URL       `yaml:"url"`
+	URL *config.URL `yaml:"url"`
+	// FailoverURLs are standby endpoints for URL. Samples go to a single
+	// endpoint at a time, failing over in order, and move back to URL once it
+	// accepts writes again.
+	FailoverURLs        []*config.URL     `yaml:"failover_urls,omitempty"`
 	RemoteTimeout       model.Duration    `yaml:"remote_timeout,omitempty"`
 	WriteRelabelConfigs []*relabel.Config `yaml:"write_relabel_configs,omitempty"`
 	Name                string            `yaml:"name,omitempty"`
+	// The protobuf message to use when writing to the endpoint. The Remote
+	// Write 2.0 message "io.prometheus.write.v2.Request" interns all strings
+	// in a symbol table, roughly halving the size of a typical request.
+	// Endpoints rejecting it make the sender fall back to the 1.0 message.
+	ProtobufMessage string `yaml:"protobuf_message,omitempty"`
 
 	// We cannot do proper Go type embedding below as the parser will then parse
 	// values arbitrarily into the overflow maps of further-down types.
@@ -583,6 +975,7 @@ type RemoteWriteConfig struct {
 // SetDirectory joins any relative file paths with dir.
 func (c *RemoteWriteConfig) SetDirectory(dir string) {
 	c.HTTPClientConfig.SetDirectory(dir)
+	c.QueueConfig.DeadLetterFile = config.JoinDir(dir, c.QueueConfig.DeadLetterFile)
 }
 
 // UnmarshalYAML implements the yaml.Unmarshaler interface.
@@ -595,12 +988,24 @@ func (c *RemoteWriteConfig) UnmarshalYAML(unmarshal func(interface{}) error) err
 	if c.URL == nil {
 		return errors.New("url for remote_write is empty")
 	}
+	for _, u := range c.FailoverURLs {
+		if u == nil {
+			return errors.New("empty or null failover URL in remote write config")
+		}
+	}
 	for _, rlcfg := range c.WriteRelabelConfigs {
 		if rlcfg == nil {
 			return errors.New("empty or null relabeling rule in remote write config")
 		}
 	}
 
+	switch c.ProtobufMessage {
+	case "", RemoteWriteProtoMsgV1, RemoteWriteProtoMsgV2:
+	default:
+		return errors.Errorf("unknown remote write protobuf message %q, supported: %q, %q",
+			c.ProtobufMessage, RemoteWriteProtoMsgV1, RemoteWriteProtoMsgV2)
+	}
+
 	// The UnmarshalYAML method of HTTPClientConfig is not being called because it's not a pointer.
 	// We cannot make it a pointer as the parser panics for inlined pointer structs.
 	// Thus we just do its validation here.
@@ -629,6 +1034,16 @@ type QueueConfig struct {
 	// On recoverable errors, backoff exponentially.
 	MinBackoff model.Duration `yaml:"min_backoff,omitempty"`
 	MaxBackoff model.Duration `yaml:"max_backoff,omitempty"`
+
+	// File to which a sample of batches rejected with non-recoverable errors
+	// is appended for later inspection. Disabled if empty.
+	DeadLetterFile string `yaml:"dead_letter_file,omitempty"`
+
+	// Maximum WAL size attributable to this queue's backlog. When the unread
+	// WAL behind the queue grows past this size, the oldest pending samples
+	// are dropped instead of filling the disk during a long remote store
+	// outage. 0 disables the limit.
+	MaxBacklogSize units.Base2Bytes `yaml:"max_backlog_size,omitempty"`
 }
 
 // MetadataConfig is the configuration for sending metadata to remote
@@ -646,6 +1061,16 @@ type RemoteReadConfig struct {
 	RemoteTimeout model.Duration `yaml:"remote_timeout,omitempty"`
 	ReadRecent    bool           `yaml:"read_recent,omitempty"`
 	Name          string         `yaml:"name,omitempty"`
+	// CacheSize bounds the number of read results kept in an in-memory LRU
+	// cache. 0 disables result caching.
+	CacheSize int `yaml:"cache_size,omitempty"`
+	// CacheTTL bounds how long a cached read result may be reused.
+	CacheTTL model.Duration `yaml:"cache_ttl,omitempty"`
+	// ReplicaLabels are label names identifying HA replicas among the remote
+	// read endpoints. They are dropped from read results and series that
+	// become identical are deduplicated, filling gaps of one replica with
+	// data from another. The labels of all remote read configs are combined.
+	ReplicaLabels []string `yaml:"replica_labels,omitempty"`
 
 	// We cannot do proper Go type embedding below as the parser will then parse
 	// values arbitrarily into the overflow maps of further-down types.
@@ -671,8 +1096,197 @@ func (c *RemoteReadConfig) UnmarshalYAML(unmarshal func(interface{}) error) erro
 	if c.URL == nil {
 		return errors.New("url for remote_read is empty")
 	}
+	if c.CacheSize < 0 {
+		return errors.New("remote read cache size must not be negative")
+	}
+	for _, l := range c.ReplicaLabels {
+		if !model.LabelName(l).IsValid() {
+			return errors.Errorf("%q is not a valid replica label name", l)
+		}
+	}
 	// The UnmarshalYAML method of HTTPClientConfig is not being called because it's not a pointer.
 	// We cannot make it a pointer as the parser panics for inlined pointer structs.
 	// Thus we just do its validation here.
 	return c.HTTPClientConfig.Validate()
 }
+
+// ByteSize is a byte size that is parsed from strings such as "512KB" in
+// configuration files.
+type ByteSize int64
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+	if str == "" {
+		*s = 0
+		return nil
+	}
+	v, err := units.ParseBase2Bytes(str)
+	if err != nil {
+		return err
+	}
+	*s = ByteSize(v)
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (s ByteSize) MarshalYAML() (interface{}, error) {
+	if s == 0 {
+		return nil, nil
+	}
+	return units.Base2Bytes(s).String(), nil
+}
+
+// OTLPConfig is the configuration for the OTLP metrics receiver.
+type OTLPConfig struct {
+	// PromoteResourceAttributes is the list of OTLP resource attributes that
+	// are converted to labels on every ingested series.
+	PromoteResourceAttributes []string `yaml:"promote_resource_attributes,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *OTLPConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain OTLPConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	seen := map[string]struct{}{}
+	for _, attr := range c.PromoteResourceAttributes {
+		if attr == "" {
+			return errors.New("empty promoted OTLP resource attribute")
+		}
+		if _, ok := seen[attr]; ok {
+			return errors.Errorf("duplicated promoted OTLP resource attribute %q", attr)
+		}
+		seen[attr] = struct{}{}
+	}
+	return nil
+}
+
+// InfluxConfig is the configuration for the InfluxDB line protocol receiver.
+type InfluxConfig struct {
+	// MeasurementFieldSeparator joins the measurement and field names into
+	// the metric name. Defaults to "_".
+	MeasurementFieldSeparator string `yaml:"measurement_field_separator,omitempty"`
+	// Mappings override the metric name for specific measurement and field
+	// combinations.
+	Mappings []InfluxMapping `yaml:"mappings,omitempty"`
+}
+
+// InfluxMapping maps an Influx measurement, and optionally one of its
+// fields, to a metric name.
+type InfluxMapping struct {
+	Measurement string `yaml:"measurement"`
+	// Field is the field the mapping applies to. If empty, the mapping
+	// applies to every field of the measurement and the field name is still
+	// appended to the metric name.
+	Field string `yaml:"field,omitempty"`
+	Name  string `yaml:"name"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *InfluxConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain InfluxConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	type key struct{ measurement, field string }
+	seen := map[key]struct{}{}
+	for _, m := range c.Mappings {
+		if m.Measurement == "" {
+			return errors.New("influx mapping without measurement")
+		}
+		if m.Name == "" {
+			return errors.Errorf("influx mapping for measurement %q without name", m.Measurement)
+		}
+		if !model.IsValidMetricName(model.LabelValue(m.Name)) {
+			return errors.Errorf("%q is not a valid metric name in influx mapping", m.Name)
+		}
+		k := key{m.Measurement, m.Field}
+		if _, ok := seen[k]; ok {
+			return errors.Errorf("duplicated influx mapping for measurement %q field %q", m.Measurement, m.Field)
+		}
+		seen[k] = struct{}{}
+	}
+	return nil
+}
+
+// BridgeConfig is the configuration for the Graphite and StatsD bridge
+// receiver and the CloudMonitor bridge.
+type BridgeConfig struct {
+	Mappings     []BridgeMapping    `yaml:"mappings,omitempty"`
+	CloudMonitor CloudMonitorConfig `yaml:"cloudmonitor,omitempty"`
+}
+
+// BridgeMapping translates a dotted Graphite or StatsD metric path into a
+// metric name and labels. Every "*" component of the pattern matches exactly
+// one path component and can be referenced as $1..$n in the name and label
+// values. Rules are tried in order; unmatched paths keep the full path as
+// the metric name.
+type BridgeMapping struct {
+	Match  string            `yaml:"match"`
+	Name   string            `yaml:"name"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+// CloudMonitorConfig configures the CloudMonitor bridge, which periodically
+// pulls the configured metrics from the Alibaba Cloud CloudMonitor API and
+// appends them as series.
+type CloudMonitorConfig struct {
+	// Interval is how often the configured metrics are pulled.
+	Interval model.Duration       `yaml:"interval,omitempty"`
+	Targets  []CloudMonitorTarget `yaml:"targets,omitempty"`
+}
+
+// CloudMonitorTarget selects one CloudMonitor metric to pull. Dimensions
+// optionally restrict the pull to matching instances; without them all
+// instances reporting the metric are ingested.
+type CloudMonitorTarget struct {
+	Namespace  string `yaml:"namespace"`
+	MetricName string `yaml:"metric_name"`
+	// Period is the datapoint aggregation period in seconds.
+	Period     int               `yaml:"period,omitempty"`
+	Dimensions map[string]string `yaml:"dimensions,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *CloudMonitorConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain CloudMonitorConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Interval == 0 {
+		c.Interval = model.Duration(1 * time.Minute)
+	}
+	for _, t := range c.Targets {
+		if t.Namespace == "" || t.MetricName == "" {
+			return errors.New("cloudmonitor target without namespace or metric_name")
+		}
+	}
+	return nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *BridgeConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain BridgeConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	for _, m := range c.Mappings {
+		if m.Match == "" {
+			return errors.New("bridge mapping without match pattern")
+		}
+		if m.Name == "" {
+			return errors.Errorf("bridge mapping for %q without name", m.Match)
+		}
+		for k := range m.Labels {
+			if !model.LabelName(k).IsValid() {
+				return errors.Errorf("%q is not a valid label name in bridge mapping for %q", k, m.Match)
+			}
+		}
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/url"
+	"os"
 	"path/filepath"
 	"regexp"
 	"testing"
@@ -111,6 +112,7 @@ var expectedConf = &Config{
 			RemoteTimeout: model.Duration(1 * time.Minute),
 			ReadRecent:    true,
 			Name:          "default",
+			CacheTTL:      model.Duration(5 * time.Minute),
 		},
 		{
 			URL:              mustParseURL("http://remote3/read"),
@@ -118,6 +120,7 @@ var expectedConf = &Config{
 			ReadRecent:       false,
 			Name:             "read_special",
 			RequiredMatchers: model.LabelSet{"job": "special"},
+			CacheTTL:         model.Duration(5 * time.Minute),
 			HTTPClientConfig: config.HTTPClientConfig{
 				TLSConfig: config.TLSConfig{
 					CertFile: filepath.FromSlash("testdata/valid_cert_file"),
@@ -702,7 +705,7 @@ var expectedConf = &Config{
 			{
 				Scheme:     "https",
 				Timeout:    model.Duration(10 * time.Second),
-				APIVersion: AlertmanagerAPIVersionV1,
+				APIVersion: AlertmanagerAPIVersionAuto,
 				ServiceDiscoveryConfigs: discovery.Configs{
 					discovery.StaticConfig{
 						{
@@ -744,6 +747,66 @@ func TestLoadConfig(t *testing.T) {
 	require.Equal(t, expectedConf, c)
 }
 
+func TestExpandStaticConfigEnvVars(t *testing.T) {
+	c, err := Load(`
+scrape_configs:
+- job_name: node
+  static_configs:
+  - targets: ['${NODE_IP}:9100']
+    labels:
+      instance_id: '${NODE_INSTANCE_ID}'
+      region: cn-hangzhou
+      team: '${NODE_TEAM}'
+`)
+	require.NoError(t, err)
+
+	os.Setenv("NODE_IP", "10.0.0.1")
+	os.Setenv("NODE_INSTANCE_ID", "i-abc")
+	os.Unsetenv("NODE_TEAM")
+	defer os.Unsetenv("NODE_IP")
+	defer os.Unsetenv("NODE_INSTANCE_ID")
+
+	c.ExpandStaticConfigEnvVars()
+
+	static := c.ScrapeConfigs[0].ServiceDiscoveryConfigs[0].(discovery.StaticConfig)
+	require.Equal(t, model.LabelValue("10.0.0.1:9100"), static[0].Targets[0][model.AddressLabel])
+	require.Equal(t, model.LabelValue("i-abc"), static[0].Labels["instance_id"])
+	require.Equal(t, model.LabelValue("cn-hangzhou"), static[0].Labels["region"])
+	// Unset variables expand to the empty string.
+	require.Equal(t, model.LabelValue(""), static[0].Labels["team"])
+}
+
+func TestLoadFileWithFallback(t *testing.T) {
+	prev, err := LoadFile("testdata/scrape_fallback.good.yml")
+	require.NoError(t, err)
+
+	c, replaced, err := LoadFileWithFallback("testdata/scrape_fallback.bad.yml", prev)
+	require.NoError(t, err)
+	require.Equal(t, []string{"broken"}, replaced)
+	require.Equal(t, 2, len(c.ScrapeConfigs))
+
+	// The valid job picks up its new version.
+	require.Equal(t, "ok", c.ScrapeConfigs[0].JobName)
+	require.Equal(t, "/probe", c.ScrapeConfigs[0].MetricsPath)
+
+	// The broken job keeps its previous version.
+	require.Equal(t, prev.ScrapeConfigs[1], c.ScrapeConfigs[1])
+
+	// A valid file loads as with LoadFile.
+	c, replaced, err = LoadFileWithFallback("testdata/scrape_fallback.good.yml", prev)
+	require.NoError(t, err)
+	require.Nil(t, replaced)
+	require.Equal(t, 2, len(c.ScrapeConfigs))
+
+	// Without a previous config there is nothing to fall back to.
+	_, _, err = LoadFileWithFallback("testdata/scrape_fallback.bad.yml", nil)
+	require.Error(t, err)
+
+	// Errors outside the scrape configs still fail the load.
+	_, _, err = LoadFileWithFallback("testdata/labelname.bad.yml", prev)
+	require.Error(t, err)
+}
+
 func TestScrapeIntervalLarger(t *testing.T) {
 	c, err := LoadFile("testdata/scrape_interval_larger.good.yml")
 	require.NoError(t, err)
@@ -808,6 +871,15 @@ var expectedErrors = []struct {
 	}, {
 		filename: "scrape_interval.bad.yml",
 		errMsg:   `scrape timeout greater than scrape interval`,
+	}, {
+		filename: "scrape_config_headers_reserved.bad.yml",
+		errMsg:   `setting the "authorization" header is not allowed in scrape config`,
+	}, {
+		filename: "scrape_config_validation_scheme.bad.yml",
+		errMsg:   `unknown metric name validation scheme "utf-8"`,
+	}, {
+		filename: "scrape_config_duplicate_samples.bad.yml",
+		errMsg:   `unknown duplicate sample handling "newest"`,
 	}, {
 		filename: "labelname.bad.yml",
 		errMsg:   `"not$allowed" is not a valid label name`,
@@ -1050,6 +1122,68 @@ func TestBadStaticConfigsYML(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestScrapeConfigFiles(t *testing.T) {
+	c, err := LoadFile("testdata/scrape_config_files.good.yml")
+	require.NoError(t, err)
+
+	require.Equal(t, 3, len(c.ScrapeConfigs))
+	require.Equal(t, "main", c.ScrapeConfigs[0].JobName)
+	require.Equal(t, "team-a", c.ScrapeConfigs[1].JobName)
+	require.Equal(t, "team-b", c.ScrapeConfigs[2].JobName)
+
+	// Global defaults apply to jobs from included files as well.
+	require.Equal(t, model.Duration(30*time.Second), c.ScrapeConfigs[1].ScrapeInterval)
+	require.Equal(t, model.Duration(15*time.Second), c.ScrapeConfigs[2].ScrapeInterval)
+
+	_, err = LoadFile("testdata/scrape_config_files_duplicate.bad.yml")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `found multiple scrape configs with job name "team-a"`)
+}
+
+func TestScrapeConfigDefaults(t *testing.T) {
+	c, err := Load(`
+scrape_config_defaults:
+  scrape_interval: 30s
+  scrape_timeout: 25s
+  basic_auth:
+    username: user
+    password: pass
+  relabel_configs:
+    - source_labels: [__address__]
+      target_label: common
+scrape_configs:
+  - job_name: inheriting
+  - job_name: overriding
+    scrape_interval: 1m
+    scrape_timeout: 30s
+    bearer_token: mysecret
+    relabel_configs:
+      - source_labels: [__address__]
+        target_label: own
+`)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(c.ScrapeConfigs))
+
+	inheriting := c.ScrapeConfigs[0]
+	require.Equal(t, model.Duration(30*time.Second), inheriting.ScrapeInterval)
+	require.Equal(t, model.Duration(25*time.Second), inheriting.ScrapeTimeout)
+	require.NotNil(t, inheriting.HTTPClientConfig.BasicAuth)
+	require.Equal(t, "user", inheriting.HTTPClientConfig.BasicAuth.Username)
+	require.Equal(t, 1, len(inheriting.RelabelConfigs))
+	require.Equal(t, "common", inheriting.RelabelConfigs[0].TargetLabel)
+
+	overriding := c.ScrapeConfigs[1]
+	require.Equal(t, model.Duration(time.Minute), overriding.ScrapeInterval)
+	require.Equal(t, model.Duration(30*time.Second), overriding.ScrapeTimeout)
+	// The job brings its own HTTP client settings, so nothing is inherited.
+	require.Nil(t, overriding.HTTPClientConfig.BasicAuth)
+	require.Equal(t, config.Secret("mysecret"), overriding.HTTPClientConfig.BearerToken)
+	// Default relabel snippets run before the job's own rules.
+	require.Equal(t, 2, len(overriding.RelabelConfigs))
+	require.Equal(t, "common", overriding.RelabelConfigs[0].TargetLabel)
+	require.Equal(t, "own", overriding.RelabelConfigs[1].TargetLabel)
+}
+
 func TestEmptyConfig(t *testing.T) {
 	c, err := Load("")
 	require.NoError(t, err)
@@ -0,0 +1,68 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	common_config "github.com/prometheus/common/config"
+)
+
+// GenerateChecksum hashes the given configuration file together with all rule
+// files it references, so that a change to any of them can be detected for
+// automatic reloading. The configuration is not validated here; only enough
+// of it is parsed to find the referenced files.
+func GenerateChecksum(yamlFilePath string) (string, error) {
+	hash := sha256.New()
+
+	yamlContent, err := ioutil.ReadFile(yamlFilePath)
+	if err != nil {
+		return "", errors.Wrap(err, "error reading configuration file")
+	}
+	if _, err := hash.Write(yamlContent); err != nil {
+		return "", errors.Wrap(err, "error hashing configuration file")
+	}
+
+	var cfg struct {
+		RuleFiles []string `yaml:"rule_files"`
+	}
+	if err := yaml.Unmarshal(yamlContent, &cfg); err != nil {
+		return "", errors.Wrap(err, "error parsing configuration file")
+	}
+
+	dir := filepath.Dir(yamlFilePath)
+	for _, pattern := range cfg.RuleFiles {
+		fs, err := filepath.Glob(common_config.JoinDir(dir, pattern))
+		if err != nil {
+			return "", errors.Wrapf(err, "error retrieving rule files for %s", pattern)
+		}
+		for _, file := range fs {
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				return "", errors.Wrapf(err, "error reading rule file %s", file)
+			}
+			if _, err := hash.Write(append([]byte(file), content...)); err != nil {
+				return "", errors.Wrapf(err, "error hashing rule file %s", file)
+			}
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
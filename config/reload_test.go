@@ -0,0 +1,84 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checksum")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "prometheus.yml")
+	ruleFile := filepath.Join(dir, "rules.yml")
+
+	writeFile := func(path, content string) {
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0666))
+	}
+
+	writeFile(configFile, `
+global:
+  scrape_interval: 15s
+rule_files:
+- rules.yml
+`)
+	writeFile(ruleFile, `
+groups:
+- name: example
+  rules:
+  - record: job:up:sum
+    expr: sum by(job) (up)
+`)
+
+	original, err := GenerateChecksum(configFile)
+	require.NoError(t, err)
+
+	// The checksum is stable as long as nothing changes.
+	same, err := GenerateChecksum(configFile)
+	require.NoError(t, err)
+	require.Equal(t, original, same)
+
+	// A change to a referenced rule file changes the checksum.
+	writeFile(ruleFile, `
+groups:
+- name: example
+  rules:
+  - record: job:up:count
+    expr: count by(job) (up)
+`)
+	changed, err := GenerateChecksum(configFile)
+	require.NoError(t, err)
+	require.NotEqual(t, original, changed)
+
+	// So does a change to the configuration file itself.
+	writeFile(configFile, `
+global:
+  scrape_interval: 30s
+rule_files:
+- rules.yml
+`)
+	changedAgain, err := GenerateChecksum(configFile)
+	require.NoError(t, err)
+	require.NotEqual(t, changed, changedAgain)
+
+	_, err = GenerateChecksum(filepath.Join(dir, "does-not-exist.yml"))
+	require.Error(t, err)
+}
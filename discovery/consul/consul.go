@@ -60,6 +60,10 @@ const (
 	servicePortLabel = model.MetaLabelPrefix + "consul_service_port"
 	// datacenterLabel is the name of the label containing the datacenter ID.
 	datacenterLabel = model.MetaLabelPrefix + "consul_dc"
+	// namespaceLabel is the name of the label containing the namespace (Consul Enterprise).
+	namespaceLabel = model.MetaLabelPrefix + "consul_namespace"
+	// partitionLabel is the name of the label containing the admin partition (Consul Enterprise).
+	partitionLabel = model.MetaLabelPrefix + "consul_partition"
 	// taggedAddressesLabel is the prefix for the labels mapping to a target's tagged addresses.
 	taggedAddressesLabel = model.MetaLabelPrefix + "consul_tagged_address_"
 	// serviceIDLabel is the name of the label containing the service ID.
@@ -108,9 +112,13 @@ func init() {
 
 // SDConfig is the configuration for Consul service discovery.
 type SDConfig struct {
-	Server       string        `yaml:"server,omitempty"`
-	Token        config.Secret `yaml:"token,omitempty"`
-	Datacenter   string        `yaml:"datacenter,omitempty"`
+	Server     string        `yaml:"server,omitempty"`
+	Token      config.Secret `yaml:"token,omitempty"`
+	Datacenter string        `yaml:"datacenter,omitempty"`
+	// Namespace only works with Consul Enterprise.
+	Namespace string `yaml:"namespace,omitempty"`
+	// Partition only works with Consul Enterprise.
+	Partition    string        `yaml:"partition,omitempty"`
 	TagSeparator string        `yaml:"tag_separator,omitempty"`
 	Scheme       string        `yaml:"scheme,omitempty"`
 	Username     string        `yaml:"username,omitempty"`
@@ -169,6 +177,8 @@ func (c *SDConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 type Discovery struct {
 	client           *consul.Client
 	clientDatacenter string
+	namespace        string
+	partition        string
 	tagSeparator     string
 	watchedServices  []string // Set of services which will be discovered.
 	watchedTags      []string // Tags used to filter instances of a service.
@@ -197,8 +207,14 @@ func NewDiscovery(conf *SDConfig, logger log.Logger) (*Discovery, error) {
 			conntrack.DialWithName("consul_sd"),
 		),
 	}
+	var rt http.RoundTripper = transport
+	if conf.Partition != "" {
+		// The vendored Consul client has no native support for admin
+		// partitions, so the partition is added to every request here.
+		rt = &partitionRoundTripper{partition: conf.Partition, next: transport}
+	}
 	wrapper := &http.Client{
-		Transport: transport,
+		Transport: rt,
 		Timeout:   time.Duration(watchTimeout) + 15*time.Second,
 	}
 
@@ -206,6 +222,7 @@ func NewDiscovery(conf *SDConfig, logger log.Logger) (*Discovery, error) {
 		Address:    conf.Server,
 		Scheme:     conf.Scheme,
 		Datacenter: conf.Datacenter,
+		Namespace:  conf.Namespace,
 		Token:      string(conf.Token),
 		HttpAuth: &consul.HttpBasicAuth{
 			Username: conf.Username,
@@ -219,6 +236,8 @@ func NewDiscovery(conf *SDConfig, logger log.Logger) (*Discovery, error) {
 	}
 	cd := &Discovery{
 		client:           client,
+		namespace:        conf.Namespace,
+		partition:        conf.Partition,
 		tagSeparator:     conf.TagSeparator,
 		watchedServices:  conf.Services,
 		watchedTags:      conf.ServiceTags,
@@ -232,6 +251,21 @@ func NewDiscovery(conf *SDConfig, logger log.Logger) (*Discovery, error) {
 	return cd, nil
 }
 
+// partitionRoundTripper sets the Consul Enterprise admin partition on every
+// request sent through it.
+type partitionRoundTripper struct {
+	partition string
+	next      http.RoundTripper
+}
+
+func (p *partitionRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	q := req.URL.Query()
+	q.Set("partition", p.partition)
+	req.URL.RawQuery = q.Encode()
+	return p.next.RoundTrip(req)
+}
+
 // shouldWatch returns whether the service of the given name should be watched.
 func (d *Discovery) shouldWatch(name string, tags []string) bool {
 	return d.shouldWatchFromName(name) && d.shouldWatchFromTags(tags)
@@ -441,15 +475,23 @@ type consulService struct {
 
 // Start watching a service.
 func (d *Discovery) watchService(ctx context.Context, ch chan<- []*targetgroup.Group, name string) {
+	groupLabels := model.LabelSet{
+		serviceLabel:    model.LabelValue(name),
+		datacenterLabel: model.LabelValue(d.clientDatacenter),
+	}
+	if d.namespace != "" {
+		groupLabels[namespaceLabel] = model.LabelValue(d.namespace)
+	}
+	if d.partition != "" {
+		groupLabels[partitionLabel] = model.LabelValue(d.partition)
+	}
+
 	srv := &consulService{
-		discovery: d,
-		client:    d.client,
-		name:      name,
-		tags:      d.watchedTags,
-		labels: model.LabelSet{
-			serviceLabel:    model.LabelValue(name),
-			datacenterLabel: model.LabelValue(d.clientDatacenter),
-		},
+		discovery:    d,
+		client:       d.client,
+		name:         name,
+		tags:         d.watchedTags,
+		labels:       groupLabels,
 		tagSeparator: d.tagSeparator,
 		logger:       d.logger,
 	}
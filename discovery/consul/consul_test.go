@@ -228,6 +228,10 @@ func newServer(t *testing.T) (*httptest.Server, *SDConfig) {
 		switch r.URL.String() {
 		case "/v1/agent/self":
 			response = AgentAnswer
+		case "/v1/agent/self?ns=ns1&partition=part1":
+			response = AgentAnswer
+		case "/v1/health/service/test?ns=ns1&partition=part1&wait=120000ms":
+			response = ServiceTestAnswer
 		case "/v1/health/service/test?node-meta=rack_name%3A2304&stale=&tag=tag1&wait=120000ms":
 			response = ServiceTestAnswer
 		case "/v1/health/service/test?wait=120000ms":
@@ -337,6 +341,31 @@ func TestAllOptions(t *testing.T) {
 	<-ch
 }
 
+// Watch the test service in a Consul Enterprise namespace and partition.
+func TestNamespacePartition(t *testing.T) {
+	stub, config := newServer(t)
+	defer stub.Close()
+
+	config.Services = []string{"test"}
+	config.Namespace = "ns1"
+	config.Partition = "part1"
+
+	d := newDiscovery(t, config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan []*targetgroup.Group)
+	go func() {
+		d.Run(ctx, ch)
+		close(ch)
+	}()
+	tg := <-ch
+	checkOneTarget(t, tg)
+	require.Equal(t, "ns1", string(tg[0].Labels["__meta_consul_namespace"]))
+	require.Equal(t, "part1", string(tg[0].Labels["__meta_consul_partition"]))
+	cancel()
+	<-ch
+}
+
 func TestGetDatacenterShouldReturnError(t *testing.T) {
 	for _, tc := range []struct {
 		handler    func(http.ResponseWriter, *http.Request)
@@ -36,10 +36,17 @@ import (
 const (
 	resolvConf = "/etc/resolv.conf"
 
-	dnsNameLabel            = model.MetaLabelPrefix + "dns_name"
-	dnsSrvRecordPrefix      = model.MetaLabelPrefix + "dns_srv_record_"
-	dnsSrvRecordTargetLabel = dnsSrvRecordPrefix + "target"
-	dnsSrvRecordPortLabel   = dnsSrvRecordPrefix + "port"
+	dnsNameLabel               = model.MetaLabelPrefix + "dns_name"
+	dnsSrvRecordPrefix         = model.MetaLabelPrefix + "dns_srv_record_"
+	dnsSrvRecordTargetLabel    = dnsSrvRecordPrefix + "target"
+	dnsSrvRecordPortLabel      = dnsSrvRecordPrefix + "port"
+	dnsSrvRecordPriorityLabel  = dnsSrvRecordPrefix + "priority"
+	dnsSrvRecordWeightLabel    = dnsSrvRecordPrefix + "weight"
+	dnsMxRecordPrefix          = model.MetaLabelPrefix + "dns_mx_record_"
+	dnsMxRecordTargetLabel     = dnsMxRecordPrefix + "target"
+	dnsMxRecordPreferenceLabel = dnsMxRecordPrefix + "preference"
+	dnsNsRecordPrefix          = model.MetaLabelPrefix + "dns_ns_record_"
+	dnsNsRecordTargetLabel     = dnsNsRecordPrefix + "target"
 
 	// Constants for instrumentation.
 	namespace = "prometheus"
@@ -101,7 +108,7 @@ func (c *SDConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	}
 	switch strings.ToUpper(c.Type) {
 	case "SRV":
-	case "A", "AAAA":
+	case "A", "AAAA", "MX", "NS":
 		if c.Port == 0 {
 			return errors.New("a port is required in DNS-SD configs for all record types except SRV")
 		}
@@ -135,6 +142,10 @@ func NewDiscovery(conf SDConfig, logger log.Logger) *Discovery {
 		qtype = dns.TypeA
 	case "AAAA":
 		qtype = dns.TypeAAAA
+	case "MX":
+		qtype = dns.TypeMX
+	case "NS":
+		qtype = dns.TypeNS
 	case "SRV":
 		qtype = dns.TypeSRV
 	}
@@ -196,30 +207,58 @@ func (d *Discovery) refreshOne(ctx context.Context, name string, ch chan<- *targ
 	}
 
 	for _, record := range response.Answer {
-		var target, dnsSrvRecordTarget, dnsSrvRecordPort model.LabelValue
+		var (
+			target                                   model.LabelValue
+			dnsSrvRecordTarget, dnsSrvRecordPort     model.LabelValue
+			dnsSrvRecordPriority, dnsSrvRecordWeight model.LabelValue
+			dnsMxRecordTarget, dnsMxRecordPreference model.LabelValue
+			dnsNsRecordTarget                        model.LabelValue
+		)
 
 		switch addr := record.(type) {
 		case *dns.SRV:
 			dnsSrvRecordTarget = model.LabelValue(addr.Target)
 			dnsSrvRecordPort = model.LabelValue(fmt.Sprintf("%d", addr.Port))
+			dnsSrvRecordPriority = model.LabelValue(fmt.Sprintf("%d", addr.Priority))
+			dnsSrvRecordWeight = model.LabelValue(fmt.Sprintf("%d", addr.Weight))
 
 			// Remove the final dot from rooted DNS names to make them look more usual.
 			addr.Target = strings.TrimRight(addr.Target, ".")
 
 			target = hostPort(addr.Target, int(addr.Port))
+		case *dns.MX:
+			dnsMxRecordTarget = model.LabelValue(addr.Mx)
+			dnsMxRecordPreference = model.LabelValue(fmt.Sprintf("%d", addr.Preference))
+
+			// Remove the final dot from rooted DNS names to make them look more usual.
+			addr.Mx = strings.TrimRight(addr.Mx, ".")
+
+			target = hostPort(addr.Mx, d.port)
+		case *dns.NS:
+			dnsNsRecordTarget = model.LabelValue(addr.Ns)
+
+			// Remove the final dot from rooted DNS names to make them look more usual.
+			addr.Ns = strings.TrimRight(addr.Ns, ".")
+
+			target = hostPort(addr.Ns, d.port)
 		case *dns.A:
 			target = hostPort(addr.A.String(), d.port)
 		case *dns.AAAA:
 			target = hostPort(addr.AAAA.String(), d.port)
 		default:
-			level.Warn(d.logger).Log("msg", "Invalid SRV record", "record", record)
+			level.Warn(d.logger).Log("msg", "Invalid record", "record", record)
 			continue
 		}
 		tg.Targets = append(tg.Targets, model.LabelSet{
-			model.AddressLabel:      target,
-			dnsNameLabel:            model.LabelValue(name),
-			dnsSrvRecordTargetLabel: dnsSrvRecordTarget,
-			dnsSrvRecordPortLabel:   dnsSrvRecordPort,
+			model.AddressLabel:         target,
+			dnsNameLabel:               model.LabelValue(name),
+			dnsSrvRecordTargetLabel:    dnsSrvRecordTarget,
+			dnsSrvRecordPortLabel:      dnsSrvRecordPort,
+			dnsSrvRecordPriorityLabel:  dnsSrvRecordPriority,
+			dnsSrvRecordWeightLabel:    dnsSrvRecordWeight,
+			dnsMxRecordTargetLabel:     dnsMxRecordTarget,
+			dnsMxRecordPreferenceLabel: dnsMxRecordPreference,
+			dnsNsRecordTargetLabel:     dnsNsRecordTarget,
 		})
 	}
 
@@ -238,22 +277,22 @@ func (d *Discovery) refreshOne(ctx context.Context, name string, ch chan<- *targ
 //
 // There are three possible outcomes:
 //
-// 1. One of the permutations of the given name is recognized as
-//    "valid" by the DNS, in which case we consider ourselves "done"
-//    and that answer is returned.  Note that, due to the way the DNS
-//    handles "name has resource records, but none of the specified type",
-//    the answer received may have an empty set of results.
+//  1. One of the permutations of the given name is recognized as
+//     "valid" by the DNS, in which case we consider ourselves "done"
+//     and that answer is returned.  Note that, due to the way the DNS
+//     handles "name has resource records, but none of the specified type",
+//     the answer received may have an empty set of results.
 //
-// 2.  All of the permutations of the given name are responded to by one of
-//    the servers in the "nameservers" list with the answer "that name does
-//    not exist" (NXDOMAIN).  In that case, it can be considered
-//    pseudo-authoritative that there are no records for that name.
+//  2. All of the permutations of the given name are responded to by one of
+//     the servers in the "nameservers" list with the answer "that name does
+//     not exist" (NXDOMAIN).  In that case, it can be considered
+//     pseudo-authoritative that there are no records for that name.
 //
-// 3.  One or more of the names was responded to by all servers with some
-//    sort of error indication.  In that case, we can't know if, in fact,
-//    there are records for the name or not, so whatever state the
-//    configuration is in, we should keep it that way until we know for
-//    sure (by, presumably, all the names getting answers in the future).
+//  3. One or more of the names was responded to by all servers with some
+//     sort of error indication.  In that case, we can't know if, in fact,
+//     there are records for the name or not, so whatever state the
+//     configuration is in, we should keep it that way until we know for
+//     sure (by, presumably, all the names getting answers in the future).
 //
 // Outcomes 1 and 2 are indicated by a valid response message (possibly an
 // empty one) and no error.  Outcome 3 is indicated by an error return.  The
@@ -299,11 +338,11 @@ func lookupWithSearchPath(name string, qtype uint16, logger log.Logger) (*dns.Ms
 //
 // A "viable answer" is one which indicates either:
 //
-// 1. "yes, I know that name, and here are its records of the requested type"
-//    (RCODE==SUCCESS, ANCOUNT > 0);
-// 2. "yes, I know that name, but it has no records of the requested type"
-//    (RCODE==SUCCESS, ANCOUNT==0); or
-// 3. "I know that name doesn't exist" (RCODE==NXDOMAIN).
+//  1. "yes, I know that name, and here are its records of the requested type"
+//     (RCODE==SUCCESS, ANCOUNT > 0);
+//  2. "yes, I know that name, but it has no records of the requested type"
+//     (RCODE==SUCCESS, ANCOUNT==0); or
+//  3. "I know that name doesn't exist" (RCODE==NXDOMAIN).
 //
 // A non-viable answer is "anything else", which encompasses both various
 // system-level problems (like network timeouts) and also
@@ -76,10 +76,15 @@ func TestDNS(t *testing.T) {
 					Source: "web.example.com.",
 					Targets: []model.LabelSet{
 						{
-							"__address__":                  "192.0.2.2:80",
-							"__meta_dns_name":              "web.example.com.",
-							"__meta_dns_srv_record_target": "",
-							"__meta_dns_srv_record_port":   "",
+							"__address__":                     "192.0.2.2:80",
+							"__meta_dns_name":                 "web.example.com.",
+							"__meta_dns_srv_record_target":    "",
+							"__meta_dns_srv_record_port":      "",
+							"__meta_dns_srv_record_priority":  "",
+							"__meta_dns_srv_record_weight":    "",
+							"__meta_dns_mx_record_target":     "",
+							"__meta_dns_mx_record_preference": "",
+							"__meta_dns_ns_record_target":     "",
 						},
 					},
 				},
@@ -106,10 +111,15 @@ func TestDNS(t *testing.T) {
 					Source: "web.example.com.",
 					Targets: []model.LabelSet{
 						{
-							"__address__":                  "[::1]:80",
-							"__meta_dns_name":              "web.example.com.",
-							"__meta_dns_srv_record_target": "",
-							"__meta_dns_srv_record_port":   "",
+							"__address__":                     "[::1]:80",
+							"__meta_dns_name":                 "web.example.com.",
+							"__meta_dns_srv_record_target":    "",
+							"__meta_dns_srv_record_port":      "",
+							"__meta_dns_srv_record_priority":  "",
+							"__meta_dns_srv_record_weight":    "",
+							"__meta_dns_mx_record_target":     "",
+							"__meta_dns_mx_record_preference": "",
+							"__meta_dns_ns_record_target":     "",
 						},
 					},
 				},
@@ -125,8 +135,8 @@ func TestDNS(t *testing.T) {
 			lookup: func(name string, qtype uint16, logger log.Logger) (*dns.Msg, error) {
 				return &dns.Msg{
 						Answer: []dns.RR{
-							&dns.SRV{Port: 3306, Target: "db1.example.com."},
-							&dns.SRV{Port: 3306, Target: "db2.example.com."},
+							&dns.SRV{Priority: 1, Weight: 10, Port: 3306, Target: "db1.example.com."},
+							&dns.SRV{Priority: 2, Weight: 20, Port: 3306, Target: "db2.example.com."},
 						},
 					},
 					nil
@@ -136,16 +146,26 @@ func TestDNS(t *testing.T) {
 					Source: "_mysql._tcp.db.example.com.",
 					Targets: []model.LabelSet{
 						{
-							"__address__":                  "db1.example.com:3306",
-							"__meta_dns_name":              "_mysql._tcp.db.example.com.",
-							"__meta_dns_srv_record_target": "db1.example.com.",
-							"__meta_dns_srv_record_port":   "3306",
+							"__address__":                     "db1.example.com:3306",
+							"__meta_dns_name":                 "_mysql._tcp.db.example.com.",
+							"__meta_dns_srv_record_target":    "db1.example.com.",
+							"__meta_dns_srv_record_port":      "3306",
+							"__meta_dns_srv_record_priority":  "1",
+							"__meta_dns_srv_record_weight":    "10",
+							"__meta_dns_mx_record_target":     "",
+							"__meta_dns_mx_record_preference": "",
+							"__meta_dns_ns_record_target":     "",
 						},
 						{
-							"__address__":                  "db2.example.com:3306",
-							"__meta_dns_name":              "_mysql._tcp.db.example.com.",
-							"__meta_dns_srv_record_target": "db2.example.com.",
-							"__meta_dns_srv_record_port":   "3306",
+							"__address__":                     "db2.example.com:3306",
+							"__meta_dns_name":                 "_mysql._tcp.db.example.com.",
+							"__meta_dns_srv_record_target":    "db2.example.com.",
+							"__meta_dns_srv_record_port":      "3306",
+							"__meta_dns_srv_record_priority":  "2",
+							"__meta_dns_srv_record_weight":    "20",
+							"__meta_dns_mx_record_target":     "",
+							"__meta_dns_mx_record_preference": "",
+							"__meta_dns_ns_record_target":     "",
 						},
 					},
 				},
@@ -160,7 +180,7 @@ func TestDNS(t *testing.T) {
 			lookup: func(name string, qtype uint16, logger log.Logger) (*dns.Msg, error) {
 				return &dns.Msg{
 						Answer: []dns.RR{
-							&dns.SRV{Port: 3306, Target: "db1.example.com."},
+							&dns.SRV{Priority: 1, Weight: 10, Port: 3306, Target: "db1.example.com."},
 							&dns.TXT{Txt: []string{"this should be discarded"}},
 						},
 					},
@@ -171,10 +191,97 @@ func TestDNS(t *testing.T) {
 					Source: "_mysql._tcp.db.example.com.",
 					Targets: []model.LabelSet{
 						{
-							"__address__":                  "db1.example.com:3306",
-							"__meta_dns_name":              "_mysql._tcp.db.example.com.",
-							"__meta_dns_srv_record_target": "db1.example.com.",
-							"__meta_dns_srv_record_port":   "3306",
+							"__address__":                     "db1.example.com:3306",
+							"__meta_dns_name":                 "_mysql._tcp.db.example.com.",
+							"__meta_dns_srv_record_target":    "db1.example.com.",
+							"__meta_dns_srv_record_port":      "3306",
+							"__meta_dns_srv_record_priority":  "1",
+							"__meta_dns_srv_record_weight":    "10",
+							"__meta_dns_mx_record_target":     "",
+							"__meta_dns_mx_record_preference": "",
+							"__meta_dns_ns_record_target":     "",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "MX record query",
+			config: SDConfig{
+				Names:           []string{"example.com."},
+				Type:            "MX",
+				Port:            25,
+				RefreshInterval: model.Duration(time.Minute),
+			},
+			lookup: func(name string, qtype uint16, logger log.Logger) (*dns.Msg, error) {
+				return &dns.Msg{
+						Answer: []dns.RR{
+							&dns.MX{Preference: 0, Mx: "smtp1.example.com."},
+							&dns.MX{Preference: 10, Mx: "smtp2.example.com."},
+						},
+					},
+					nil
+			},
+			expected: []*targetgroup.Group{
+				{
+					Source: "example.com.",
+					Targets: []model.LabelSet{
+						{
+							"__address__":                     "smtp1.example.com:25",
+							"__meta_dns_name":                 "example.com.",
+							"__meta_dns_srv_record_target":    "",
+							"__meta_dns_srv_record_port":      "",
+							"__meta_dns_srv_record_priority":  "",
+							"__meta_dns_srv_record_weight":    "",
+							"__meta_dns_mx_record_target":     "smtp1.example.com.",
+							"__meta_dns_mx_record_preference": "0",
+							"__meta_dns_ns_record_target":     "",
+						},
+						{
+							"__address__":                     "smtp2.example.com:25",
+							"__meta_dns_name":                 "example.com.",
+							"__meta_dns_srv_record_target":    "",
+							"__meta_dns_srv_record_port":      "",
+							"__meta_dns_srv_record_priority":  "",
+							"__meta_dns_srv_record_weight":    "",
+							"__meta_dns_mx_record_target":     "smtp2.example.com.",
+							"__meta_dns_mx_record_preference": "10",
+							"__meta_dns_ns_record_target":     "",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "NS record query",
+			config: SDConfig{
+				Names:           []string{"example.com."},
+				Type:            "NS",
+				Port:            53,
+				RefreshInterval: model.Duration(time.Minute),
+			},
+			lookup: func(name string, qtype uint16, logger log.Logger) (*dns.Msg, error) {
+				return &dns.Msg{
+						Answer: []dns.RR{
+							&dns.NS{Ns: "ns1.example.com."},
+						},
+					},
+					nil
+			},
+			expected: []*targetgroup.Group{
+				{
+					Source: "example.com.",
+					Targets: []model.LabelSet{
+						{
+							"__address__":                     "ns1.example.com:53",
+							"__meta_dns_name":                 "example.com.",
+							"__meta_dns_srv_record_target":    "",
+							"__meta_dns_srv_record_port":      "",
+							"__meta_dns_srv_record_priority":  "",
+							"__meta_dns_srv_record_weight":    "",
+							"__meta_dns_mx_record_target":     "",
+							"__meta_dns_mx_record_preference": "",
+							"__meta_dns_ns_record_target":     "ns1.example.com.",
 						},
 					},
 				},
@@ -257,6 +364,32 @@ func TestSDConfigUnmarshalYAML(t *testing.T) {
 			},
 			expectErr: false,
 		},
+		{
+			name: "valid mx",
+			input: SDConfig{
+				Names: []string{"a.example.com", "b.example.com"},
+				Type:  "MX",
+				Port:  25,
+			},
+			expectErr: false,
+		},
+		{
+			name: "valid ns",
+			input: SDConfig{
+				Names: []string{"a.example.com", "b.example.com"},
+				Type:  "NS",
+				Port:  53,
+			},
+			expectErr: false,
+		},
+		{
+			name: "invalid mx without port",
+			input: SDConfig{
+				Names: []string{"a.example.com", "b.example.com"},
+				Type:  "MX",
+			},
+			expectErr: true,
+		},
 		{
 			name: "invalid a without port",
 			input: SDConfig{
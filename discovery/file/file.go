@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -39,7 +40,7 @@ import (
 )
 
 var (
-	patFileSDName = regexp.MustCompile(`^[^*]*(\*[^/]*)?\.(json|yml|yaml|JSON|YML|YAML)$`)
+	patFileSDName = regexp.MustCompile(`^[^*]*(\*\*/)*[^/]*(\*[^/]*)?\.(json|yml|yaml|JSON|YML|YAML)$`)
 
 	// DefaultSDConfig is the default file SD configuration.
 	DefaultSDConfig = SDConfig{
@@ -93,6 +94,10 @@ func (c *SDConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 const fileSDFilepathLabel = model.MetaLabelPrefix + "filepath"
 
+// debounceDelay is how long to wait after a watch event before refreshing, so
+// that bursts of file changes are coalesced into one refresh.
+const debounceDelay = 250 * time.Millisecond
+
 // TimestampCollector is a Custom Collector for Timestamps of the files.
 type TimestampCollector struct {
 	Description *prometheus.Desc
@@ -211,7 +216,7 @@ func NewDiscovery(conf *SDConfig, logger log.Logger) *Discovery {
 func (d *Discovery) listFiles() []string {
 	var paths []string
 	for _, p := range d.paths {
-		files, err := filepath.Glob(p)
+		files, err := globFiles(p)
 		if err != nil {
 			level.Error(d.logger).Log("msg", "Error expanding glob", "glob", p, "err", err)
 			continue
@@ -221,6 +226,66 @@ func (d *Discovery) listFiles() []string {
 	return paths
 }
 
+// globFiles expands the given pattern into matching file names. In addition to
+// the filepath.Glob syntax, a ** path segment matches any number of
+// directories, allowing patterns like conf.d/**/*.yml.
+func globFiles(pattern string) ([]string, error) {
+	i := strings.Index(pattern, "**")
+	if i < 0 {
+		return filepath.Glob(pattern)
+	}
+	root := filepath.Dir(pattern[:i] + "x")
+	var matches []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		ok, err := matchRecursive(pattern, path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return matches, err
+}
+
+// matchRecursive reports whether name matches pattern, where a ** segment in
+// the pattern matches any number of path segments.
+func matchRecursive(pattern, name string) (bool, error) {
+	return matchSegments(
+		strings.Split(filepath.ToSlash(pattern), "/"),
+		strings.Split(filepath.ToSlash(name), "/"),
+	)
+}
+
+func matchSegments(pattern, name []string) (bool, error) {
+	if len(pattern) == 0 {
+		return len(name) == 0, nil
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			ok, err := matchSegments(pattern[1:], name[i:])
+			if ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+	if len(name) == 0 {
+		return false, nil
+	}
+	if ok, err := path.Match(pattern[0], name[0]); !ok || err != nil {
+		return ok, err
+	}
+	return matchSegments(pattern[1:], name[1:])
+}
+
 // watchFiles sets watches on all full paths or directories that were configured for
 // this file discovery.
 func (d *Discovery) watchFiles() {
@@ -228,6 +293,12 @@ func (d *Discovery) watchFiles() {
 		panic("no watcher configured")
 	}
 	for _, p := range d.paths {
+		if i := strings.Index(p, "**"); i > -1 {
+			// Recursive patterns need a watch on every directory below the
+			// fixed part of the pattern.
+			d.watchRecursive(filepath.Dir(p[:i] + "x"))
+			continue
+		}
 		if idx := strings.LastIndex(p, "/"); idx > -1 {
 			p = p[:idx]
 		} else {
@@ -239,6 +310,22 @@ func (d *Discovery) watchFiles() {
 	}
 }
 
+// watchRecursive adds watches for the given directory and all directories below it.
+func (d *Discovery) watchRecursive(root string) {
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if err := d.watcher.Add(path); err != nil {
+			level.Error(d.logger).Log("msg", "Error adding file watch", "path", path, "err", err)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		level.Error(d.logger).Log("msg", "Error walking watched directory", "path", root, "err", err)
+	}
+}
+
 // Run implements the Discoverer interface.
 func (d *Discovery) Run(ctx context.Context, ch chan<- []*targetgroup.Group) {
 	watcher, err := fsnotify.NewWatcher()
@@ -254,6 +341,15 @@ func (d *Discovery) Run(ctx context.Context, ch chan<- []*targetgroup.Group) {
 	ticker := time.NewTicker(d.interval)
 	defer ticker.Stop()
 
+	// Config management tools often rewrite many files in quick succession.
+	// Debounce watch events so a burst of changes results in a single refresh.
+	debounce := time.NewTimer(0)
+	if !debounce.Stop() {
+		<-debounce.C
+	}
+	defer debounce.Stop()
+	refreshPending := false
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -273,6 +369,13 @@ func (d *Discovery) Run(ctx context.Context, ch chan<- []*targetgroup.Group) {
 			// different combinations of operations. For all practical purposes
 			// this is inaccurate.
 			// The most reliable solution is to reload everything if anything happens.
+			if !refreshPending {
+				debounce.Reset(debounceDelay)
+				refreshPending = true
+			}
+
+		case <-debounce.C:
+			refreshPending = false
 			d.refresh(ctx, ch)
 
 		case <-ticker.C:
@@ -480,3 +480,40 @@ func TestRemoveFile(t *testing.T) {
 			}},
 	)
 }
+
+func TestGlobFilesRecursive(t *testing.T) {
+	t.Parallel()
+
+	tmpDir, err := ioutil.TempDir("", "prometheus-file-sd-glob")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	for _, f := range []string{
+		"teams/a/targets.yml",
+		"teams/a/sub/targets.yml",
+		"teams/b/targets.json",
+		"teams/ignored.txt",
+	} {
+		p := filepath.Join(tmpDir, f)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, ioutil.WriteFile(p, []byte("[]"), 0o644))
+	}
+
+	matches, err := globFiles(filepath.Join(tmpDir, "teams", "**", "*.yml"))
+	require.NoError(t, err)
+	sort.Strings(matches)
+	require.Equal(t, []string{
+		filepath.Join(tmpDir, "teams", "a", "sub", "targets.yml"),
+		filepath.Join(tmpDir, "teams", "a", "targets.yml"),
+	}, matches)
+
+	// Patterns without ** keep plain glob semantics.
+	matches, err = globFiles(filepath.Join(tmpDir, "teams", "*", "*.json"))
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(tmpDir, "teams", "b", "targets.json")}, matches)
+
+	// A non-existent root is not an error, only an empty result.
+	matches, err = globFiles(filepath.Join(tmpDir, "missing", "**", "*.yml"))
+	require.NoError(t, err)
+	require.Empty(t, matches)
+}
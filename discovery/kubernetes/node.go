@@ -17,6 +17,7 @@ import (
 	"context"
 	"net"
 	"strconv"
+	"strings"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -149,18 +150,28 @@ func nodeSourceFromName(name string) string {
 
 const (
 	nodeNameLabel               = metaLabelPrefix + "node_name"
+	nodeProviderIDLabel         = metaLabelPrefix + "node_provider_id"
 	nodeLabelPrefix             = metaLabelPrefix + "node_label_"
 	nodeLabelPresentPrefix      = metaLabelPrefix + "node_labelpresent_"
 	nodeAnnotationPrefix        = metaLabelPrefix + "node_annotation_"
 	nodeAnnotationPresentPrefix = metaLabelPrefix + "node_annotationpresent_"
 	nodeAddressPrefix           = metaLabelPrefix + "node_address_"
+
+	nodeAlibabaRegionIDLabel   = metaLabelPrefix + "node_alibaba_region_id"
+	nodeAlibabaZoneIDLabel     = metaLabelPrefix + "node_alibaba_zone_id"
+	nodeAlibabaInstanceIDLabel = metaLabelPrefix + "node_alibaba_instance_id"
+
+	alicloudProviderPrefix = "alicloud://"
 )
 
 func nodeLabels(n *apiv1.Node) model.LabelSet {
 	// Each label and annotation will create two key-value pairs in the map.
-	ls := make(model.LabelSet, 2*(len(n.Labels)+len(n.Annotations))+1)
+	ls := make(model.LabelSet, 2*(len(n.Labels)+len(n.Annotations))+2)
 
 	ls[nodeNameLabel] = lv(n.Name)
+	if n.Spec.ProviderID != "" {
+		ls[nodeProviderIDLabel] = lv(n.Spec.ProviderID)
+	}
 
 	for k, v := range n.Labels {
 		ln := strutil.SanitizeLabelName(k)
@@ -173,6 +184,39 @@ func nodeLabels(n *apiv1.Node) model.LabelSet {
 		ls[model.LabelName(nodeAnnotationPrefix+ln)] = lv(v)
 		ls[model.LabelName(nodeAnnotationPresentPrefix+ln)] = presentValue
 	}
+
+	for k, v := range alibabaNodeLabels(n) {
+		ls[k] = v
+	}
+	return ls
+}
+
+// alibabaNodeLabels derives Alibaba Cloud specific meta labels from the
+// provider ID the alicloud cloud provider assigns to nodes, which has the
+// form alicloud://<region-id>.<instance-id>. The zone is taken from the
+// well-known topology labels. The labels allow joining node targets with
+// targets discovered from the ECS API.
+func alibabaNodeLabels(n *apiv1.Node) model.LabelSet {
+	providerID := n.Spec.ProviderID
+	if !strings.HasPrefix(providerID, alicloudProviderPrefix) {
+		return nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(providerID, alicloudProviderPrefix), ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil
+	}
+
+	ls := model.LabelSet{
+		nodeAlibabaRegionIDLabel:   lv(parts[0]),
+		nodeAlibabaInstanceIDLabel: lv(parts[1]),
+	}
+	zone, ok := n.Labels["topology.kubernetes.io/zone"]
+	if !ok {
+		zone = n.Labels["failure-domain.beta.kubernetes.io/zone"]
+	}
+	if zone != "" {
+		ls[nodeAlibabaZoneIDLabel] = lv(zone)
+	}
 	return ls
 }
 
@@ -89,6 +89,46 @@ func TestNodeDiscoveryBeforeStart(t *testing.T) {
 	}.Run(t)
 }
 
+func TestNodeDiscoveryAlibabaProviderID(t *testing.T) {
+	n, c := makeDiscovery(RoleNode, NamespaceDiscovery{})
+
+	k8sDiscoveryTest{
+		discovery: n,
+		beforeRun: func() {
+			obj := makeNode(
+				"test",
+				"1.2.3.4",
+				map[string]string{"topology.kubernetes.io/zone": "cn-hangzhou-h"},
+				map[string]string{},
+			)
+			obj.Spec.ProviderID = "alicloud://cn-hangzhou.i-bp1e0vz6nhhr7eq1wnfq"
+			c.CoreV1().Nodes().Create(context.Background(), obj, metav1.CreateOptions{})
+		},
+		expectedMaxItems: 1,
+		expectedRes: map[string]*targetgroup.Group{
+			"node/test": {
+				Targets: []model.LabelSet{
+					{
+						"__address__": "1.2.3.4:10250",
+						"instance":    "test",
+						"__meta_kubernetes_node_address_InternalIP": "1.2.3.4",
+					},
+				},
+				Labels: model.LabelSet{
+					"__meta_kubernetes_node_name":                                     "test",
+					"__meta_kubernetes_node_provider_id":                              "alicloud://cn-hangzhou.i-bp1e0vz6nhhr7eq1wnfq",
+					"__meta_kubernetes_node_label_topology_kubernetes_io_zone":        "cn-hangzhou-h",
+					"__meta_kubernetes_node_labelpresent_topology_kubernetes_io_zone": "true",
+					"__meta_kubernetes_node_alibaba_region_id":                        "cn-hangzhou",
+					"__meta_kubernetes_node_alibaba_zone_id":                          "cn-hangzhou-h",
+					"__meta_kubernetes_node_alibaba_instance_id":                      "i-bp1e0vz6nhhr7eq1wnfq",
+				},
+				Source: "node/test",
+			},
+		},
+	}.Run(t)
+}
+
 func TestNodeDiscoveryAdd(t *testing.T) {
 	n, c := makeDiscovery(RoleNode, NamespaceDiscovery{})
 
@@ -17,6 +17,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sort"
 	"sync"
 	"time"
 
@@ -24,6 +25,7 @@ import (
 	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/prometheus/prometheus/discovery/refresh"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
 )
 
@@ -63,10 +65,25 @@ var (
 		},
 		[]string{"name"},
 	)
+	providerTargets = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "prometheus_sd_provider_targets",
+			Help: "Current number of targets discovered by the given SD provider.",
+		},
+		[]string{"name", "provider"},
+	)
+	updateDelay = prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Name:       "prometheus_sd_update_delay_seconds",
+			Help:       "Time from receiving an update from an SD provider until it is sent to the consumers.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		},
+		[]string{"name"},
+	)
 )
 
 func init() {
-	prometheus.MustRegister(failedConfigs, discoveredTargets, receivedUpdates, delayedUpdates, sentUpdates)
+	prometheus.MustRegister(failedConfigs, discoveredTargets, receivedUpdates, delayedUpdates, sentUpdates, providerTargets, updateDelay)
 }
 
 type poolKey struct {
@@ -111,6 +128,17 @@ func Name(n string) func(*Manager) {
 	}
 }
 
+// UpdateInterval sets the interval at which buffered provider updates are
+// coalesced and sent to the consumers. Shorter intervals propagate large
+// discovery churn faster at the cost of more frequent scrape pool syncs.
+func UpdateInterval(d time.Duration) func(*Manager) {
+	return func(m *Manager) {
+		m.mtx.Lock()
+		defer m.mtx.Unlock()
+		m.updatert = d
+	}
+}
+
 // Manager maintains a set of discovery providers and sends each update to a map channel.
 // Targets are grouped by the target set name.
 type Manager struct {
@@ -134,6 +162,10 @@ type Manager struct {
 
 	// The triggerSend channel signals to the manager that new updates have been received from providers.
 	triggerSend chan struct{}
+
+	// pendingSince is the time the oldest not yet forwarded provider update
+	// was received. It is zero when no update is pending.
+	pendingSince time.Time
 }
 
 // Run starts the background processing
@@ -160,6 +192,7 @@ func (m *Manager) ApplyConfig(cfg map[string]Configs) error {
 		if _, ok := cfg[pk.setName]; !ok {
 			discoveredTargets.DeleteLabelValues(m.name, pk.setName)
 		}
+		providerTargets.DeleteLabelValues(m.name, pk.provider)
 	}
 	m.cancelDiscoverers()
 	m.targets = make(map[poolKey]map[string]*targetgroup.Group)
@@ -218,6 +251,12 @@ func (m *Manager) updater(ctx context.Context, p *provider, updates chan []*targ
 				m.updateGroup(poolKey{setName: s, provider: p.name}, tgs)
 			}
 
+			m.mtx.Lock()
+			if m.pendingSince.IsZero() {
+				m.pendingSince = time.Now()
+			}
+			m.mtx.Unlock()
+
 			select {
 			case m.triggerSend <- struct{}{}:
 			default:
@@ -240,6 +279,12 @@ func (m *Manager) sender() {
 				sentUpdates.WithLabelValues(m.name).Inc()
 				select {
 				case m.syncCh <- m.allGroups():
+					m.mtx.Lock()
+					if !m.pendingSince.IsZero() {
+						updateDelay.WithLabelValues(m.name).Observe(time.Since(m.pendingSince).Seconds())
+						m.pendingSince = time.Time{}
+					}
+					m.mtx.Unlock()
 				default:
 					delayedUpdates.WithLabelValues(m.name).Inc()
 					level.Debug(m.logger).Log("msg", "Discovery receiver's channel was full so will retry the next cycle")
@@ -279,6 +324,7 @@ func (m *Manager) allGroups() map[string][]*targetgroup.Group {
 	defer m.mtx.RUnlock()
 
 	tSets := map[string][]*targetgroup.Group{}
+	perProvider := map[string]int{}
 	for pkey, tsets := range m.targets {
 		var n int
 		for _, tg := range tsets {
@@ -288,10 +334,66 @@ func (m *Manager) allGroups() map[string][]*targetgroup.Group {
 			n += len(tg.Targets)
 		}
 		discoveredTargets.WithLabelValues(m.name, pkey.setName).Set(float64(n))
+		perProvider[pkey.provider] += n
+	}
+	for prov, n := range perProvider {
+		providerTargets.WithLabelValues(m.name, prov).Set(float64(n))
 	}
 	return tSets
 }
 
+// ProviderStatus describes the current state of one SD provider of a Manager.
+type ProviderStatus struct {
+	// Name is the provider identifier, e.g. "ecs/0".
+	Name string
+	// Configs are the names of the configurations subscribed to the provider.
+	Configs []string
+	// Targets is the current number of targets discovered by the provider.
+	Targets int
+	// Refresh is the outcome of the provider's most recent refresh, or nil
+	// for providers that are not based on periodic refreshes.
+	Refresh *refresh.Status
+}
+
+// statusReporter is implemented by Discoverers that track the outcome of
+// their most recent refresh, such as the ones built on discovery/refresh.
+type statusReporter interface {
+	Status() refresh.Status
+}
+
+// ProviderStatuses returns the current status of every SD provider, sorted by
+// provider name. It is safe to call while the manager is running.
+func (m *Manager) ProviderStatuses() []ProviderStatus {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	statuses := make([]ProviderStatus, 0, len(m.providers))
+	for _, p := range m.providers {
+		s := ProviderStatus{
+			Name:    p.name,
+			Configs: p.subs,
+		}
+		// All subscribers of a provider hold the same groups, so counting
+		// the targets of any single pool key suffices.
+		for pk, tsets := range m.targets {
+			if pk.provider != p.name {
+				continue
+			}
+			for _, tg := range tsets {
+				s.Targets += len(tg.Targets)
+			}
+			break
+		}
+		if sr, ok := p.d.(statusReporter); ok {
+			status := sr.Status()
+			s.Refresh = &status
+		}
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
 // registerProviders returns a number of failed SD config.
 func (m *Manager) registerProviders(cfgs Configs, setName string) int {
 	var (
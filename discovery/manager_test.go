@@ -862,6 +862,35 @@ func TestIdenticalConfigurationsAreCoalesced(t *testing.T) {
 	}
 }
 
+func TestProviderStatuses(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	discoveryManager := NewManager(ctx, nil)
+	discoveryManager.updatert = 100 * time.Millisecond
+	go discoveryManager.Run()
+
+	c := map[string]Configs{
+		"prometheus": {
+			staticConfig("foo:9090", "bar:9090"),
+		},
+		"prometheus2": {
+			staticConfig("foo:9090", "bar:9090"),
+		},
+	}
+	discoveryManager.ApplyConfig(c)
+	<-discoveryManager.SyncCh()
+
+	statuses := discoveryManager.ProviderStatuses()
+	require.Equal(t, 1, len(statuses))
+	require.Equal(t, "static/0", statuses[0].Name)
+	require.ElementsMatch(t, []string{"prometheus", "prometheus2"}, statuses[0].Configs)
+	// Coalesced subscribers share the provider's targets, they are not
+	// counted twice.
+	require.Equal(t, 2, statuses[0].Targets)
+	// Static providers do not refresh.
+	require.Nil(t, statuses[0].Refresh)
+}
+
 func TestApplyConfigDoesNotModifyStaticTargets(t *testing.T) {
 	originalConfig := Configs{
 		staticConfig("foo:9090", "bar:9090", "baz:9090"),
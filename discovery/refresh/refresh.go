@@ -15,6 +15,7 @@ package refresh
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -46,6 +47,18 @@ func init() {
 	prometheus.MustRegister(duration, failuresCount)
 }
 
+// Status describes the outcome of the most recent refresh of a Discovery.
+type Status struct {
+	// LastRefresh is the time the last refresh attempt finished. It is zero
+	// until the first refresh has completed.
+	LastRefresh time.Time
+	// LastDuration is how long the last refresh attempt took.
+	LastDuration time.Duration
+	// LastError is the error returned by the last refresh attempt, or nil if
+	// it succeeded.
+	LastError error
+}
+
 // Discovery implements the Discoverer interface.
 type Discovery struct {
 	logger   log.Logger
@@ -54,6 +67,9 @@ type Discovery struct {
 
 	failures prometheus.Counter
 	duration prometheus.Observer
+
+	statusMtx sync.Mutex
+	status    Status
 }
 
 // NewDiscovery returns a Discoverer function that calls a refresh() function at every interval.
@@ -111,12 +127,30 @@ func (d *Discovery) Run(ctx context.Context, ch chan<- []*targetgroup.Group) {
 	}
 }
 
+// Status returns the outcome of the most recent refresh. It is safe to call
+// concurrently with Run.
+func (d *Discovery) Status() Status {
+	d.statusMtx.Lock()
+	defer d.statusMtx.Unlock()
+	return d.status
+}
+
 func (d *Discovery) refresh(ctx context.Context) ([]*targetgroup.Group, error) {
 	now := time.Now()
-	defer d.duration.Observe(time.Since(now).Seconds())
 	tgs, err := d.refreshf(ctx)
+	took := time.Since(now)
+	d.duration.Observe(took.Seconds())
 	if err != nil {
 		d.failures.Inc()
 	}
+
+	d.statusMtx.Lock()
+	d.status = Status{
+		LastRefresh:  time.Now(),
+		LastDuration: took,
+		LastError:    err,
+	}
+	d.statusMtx.Unlock()
+
 	return tgs, err
 }
@@ -15,15 +15,19 @@ package zookeeper
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	config_util "github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 	"github.com/samuel/go-zookeeper/zk"
 
@@ -42,23 +46,58 @@ var (
 	DefaultNerveSDConfig = NerveSDConfig{
 		Timeout: model.Duration(10 * time.Second),
 	}
+
+	connectionsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "prometheus",
+		Subsystem: "sd_zookeeper",
+		Name:      "connections",
+		Help:      "The current number of shared ZooKeeper connections.",
+	})
+	sessionEventsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "prometheus",
+		Subsystem: "sd_zookeeper",
+		Name:      "session_events_total",
+		Help:      "The total number of ZooKeeper session events, by session state.",
+	}, []string{"state"})
 )
 
 func init() {
 	discovery.RegisterConfig(&ServersetSDConfig{})
 	discovery.RegisterConfig(&NerveSDConfig{})
+	prometheus.MustRegister(connectionsGauge, sessionEventsCounter)
+}
+
+// AuthConfig is authentication added to the ZooKeeper session after
+// connecting, e.g. scheme "digest" with credentials "user:password".
+type AuthConfig struct {
+	Scheme      string             `yaml:"scheme,omitempty"`
+	Credentials config_util.Secret `yaml:"credentials,omitempty"`
+}
+
+func (a *AuthConfig) validate() error {
+	if (a.Scheme == "") != (a.Credentials == "") {
+		return errors.New("auth must set both scheme and credentials")
+	}
+	return nil
 }
 
 // ServersetSDConfig is the configuration for Twitter serversets in Zookeeper based discovery.
 type ServersetSDConfig struct {
-	Servers []string       `yaml:"servers"`
-	Paths   []string       `yaml:"paths"`
-	Timeout model.Duration `yaml:"timeout,omitempty"`
+	Servers   []string              `yaml:"servers"`
+	Paths     []string              `yaml:"paths"`
+	Timeout   model.Duration        `yaml:"timeout,omitempty"`
+	TLSConfig config_util.TLSConfig `yaml:"tls_config,omitempty"`
+	Auth      AuthConfig            `yaml:"auth,omitempty"`
 }
 
 // Name returns the name of the Config.
 func (*ServersetSDConfig) Name() string { return "serverset" }
 
+// SetDirectory joins any relative file paths with dir.
+func (c *ServersetSDConfig) SetDirectory(dir string) {
+	c.TLSConfig.SetDirectory(dir)
+}
+
 // NewDiscoverer returns a Discoverer for the Config.
 func (c *ServersetSDConfig) NewDiscoverer(opts discovery.DiscovererOptions) (discovery.Discoverer, error) {
 	return NewServersetDiscovery(c, opts.Logger)
@@ -83,19 +122,26 @@ func (c *ServersetSDConfig) UnmarshalYAML(unmarshal func(interface{}) error) err
 			return errors.Errorf("serverset SD config paths must begin with '/': %s", path)
 		}
 	}
-	return nil
+	return errors.Wrap(c.Auth.validate(), "serverset SD config")
 }
 
 // NerveSDConfig is the configuration for AirBnB's Nerve in Zookeeper based discovery.
 type NerveSDConfig struct {
-	Servers []string       `yaml:"servers"`
-	Paths   []string       `yaml:"paths"`
-	Timeout model.Duration `yaml:"timeout,omitempty"`
+	Servers   []string              `yaml:"servers"`
+	Paths     []string              `yaml:"paths"`
+	Timeout   model.Duration        `yaml:"timeout,omitempty"`
+	TLSConfig config_util.TLSConfig `yaml:"tls_config,omitempty"`
+	Auth      AuthConfig            `yaml:"auth,omitempty"`
 }
 
 // Name returns the name of the Config.
 func (*NerveSDConfig) Name() string { return "nerve" }
 
+// SetDirectory joins any relative file paths with dir.
+func (c *NerveSDConfig) SetDirectory(dir string) {
+	c.TLSConfig.SetDirectory(dir)
+}
+
 // NewDiscoverer returns a Discoverer for the Config.
 func (c *NerveSDConfig) NewDiscoverer(opts discovery.DiscovererOptions) (discovery.Discoverer, error) {
 	return NewNerveDiscovery(c, opts.Logger)
@@ -120,13 +166,118 @@ func (c *NerveSDConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 			return errors.Errorf("nerve SD config paths must begin with '/': %s", path)
 		}
 	}
-	return nil
+	return errors.Wrap(c.Auth.validate(), "nerve SD config")
+}
+
+// pool shares ZooKeeper connections between all discoverers pointing at the
+// same ensemble with the same settings, so that many serverset and nerve
+// sections do not multiply sessions on the ensemble.
+var pool = connPool{conns: map[string]*pooledConn{}}
+
+type connPool struct {
+	mtx   sync.Mutex
+	conns map[string]*pooledConn
+}
+
+type pooledConn struct {
+	conn *zk.Conn
+	key  string
+	refs int
+}
+
+func (p *connPool) get(srvs []string, timeout time.Duration, tlsConfig config_util.TLSConfig, auth AuthConfig, logger log.Logger) (*pooledConn, error) {
+	key := fmt.Sprintf("%s\x00%s\x00%+v\x00%s\x00%s", strings.Join(srvs, ","), timeout, tlsConfig, auth.Scheme, auth.Credentials)
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if pc, ok := p.conns[key]; ok {
+		pc.refs++
+		return pc, nil
+	}
+	conn, err := connect(srvs, timeout, tlsConfig, auth, logger)
+	if err != nil {
+		return nil, err
+	}
+	pc := &pooledConn{conn: conn, key: key, refs: 1}
+	p.conns[key] = pc
+	connectionsGauge.Inc()
+	return pc, nil
+}
+
+func (p *connPool) put(pc *pooledConn) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	pc.refs--
+	if pc.refs == 0 {
+		delete(p.conns, pc.key)
+		pc.conn.Close()
+		connectionsGauge.Dec()
+	}
+}
+
+// connect establishes a ZooKeeper session, TLS-secured if a tls_config was
+// given and authenticated if an auth scheme was given.
+func connect(srvs []string, timeout time.Duration, tlsConfig config_util.TLSConfig, auth AuthConfig, logger log.Logger) (*zk.Conn, error) {
+	logOpt := zk.WithLogger(treecache.NewZookeeperLogger(logger))
+	eventOpt := zk.WithEventCallback(func(ev zk.Event) {
+		if ev.Type == zk.EventSession {
+			sessionEventsCounter.WithLabelValues(ev.State.String()).Inc()
+		}
+	})
+
+	var (
+		conn *zk.Conn
+		err  error
+	)
+	if tlsConfig != (config_util.TLSConfig{}) {
+		tlsc, cerr := config_util.NewTLSConfig(&tlsConfig)
+		if cerr != nil {
+			return nil, cerr
+		}
+		dialer := func(network, addr string, timeout time.Duration) (net.Conn, error) {
+			nc, err := net.DialTimeout(network, addr, timeout)
+			if err != nil {
+				return nil, err
+			}
+			cfg := tlsc.Clone()
+			if cfg.ServerName == "" {
+				host, _, err := net.SplitHostPort(addr)
+				if err != nil {
+					nc.Close()
+					return nil, err
+				}
+				cfg.ServerName = host
+			}
+			tc := tls.Client(nc, cfg)
+			if err := tc.Handshake(); err != nil {
+				nc.Close()
+				return nil, err
+			}
+			return tc, nil
+		}
+		conn, _, err = zk.Connect(srvs, timeout, logOpt, eventOpt, zk.WithDialer(dialer))
+	} else {
+		conn, _, err = zk.Connect(srvs, timeout, logOpt, eventOpt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if auth.Scheme != "" {
+		if err := conn.AddAuth(auth.Scheme, []byte(auth.Credentials)); err != nil {
+			conn.Close()
+			return nil, errors.Wrap(err, "zookeeper auth")
+		}
+	}
+	return conn, nil
 }
 
 // Discovery implements the Discoverer interface for discovering
 // targets from Zookeeper.
 type Discovery struct {
-	conn *zk.Conn
+	conn   *zk.Conn
+	pooled *pooledConn
 
 	sources map[string]*targetgroup.Group
 
@@ -140,12 +291,12 @@ type Discovery struct {
 
 // NewNerveDiscovery returns a new Discovery for the given Nerve config.
 func NewNerveDiscovery(conf *NerveSDConfig, logger log.Logger) (*Discovery, error) {
-	return NewDiscovery(conf.Servers, time.Duration(conf.Timeout), conf.Paths, logger, parseNerveMember)
+	return NewDiscovery(conf.Servers, time.Duration(conf.Timeout), conf.Paths, conf.TLSConfig, conf.Auth, logger, parseNerveMember)
 }
 
 // NewServersetDiscovery returns a new Discovery for the given serverset config.
 func NewServersetDiscovery(conf *ServersetSDConfig, logger log.Logger) (*Discovery, error) {
-	return NewDiscovery(conf.Servers, time.Duration(conf.Timeout), conf.Paths, logger, parseServersetMember)
+	return NewDiscovery(conf.Servers, time.Duration(conf.Timeout), conf.Paths, conf.TLSConfig, conf.Auth, logger, parseServersetMember)
 }
 
 // NewDiscovery returns a new discovery along Zookeeper parses with
@@ -154,6 +305,8 @@ func NewDiscovery(
 	srvs []string,
 	timeout time.Duration,
 	paths []string,
+	tlsConfig config_util.TLSConfig,
+	auth AuthConfig,
 	logger log.Logger,
 	pf func(data []byte, path string) (model.LabelSet, error),
 ) (*Discovery, error) {
@@ -161,17 +314,14 @@ func NewDiscovery(
 		logger = log.NewNopLogger()
 	}
 
-	conn, _, err := zk.Connect(
-		srvs, timeout,
-		func(c *zk.Conn) {
-			c.SetLogger(treecache.NewZookeeperLogger(logger))
-		})
+	pooled, err := pool.get(srvs, timeout, tlsConfig, auth, logger)
 	if err != nil {
 		return nil, err
 	}
 	updates := make(chan treecache.ZookeeperTreeCacheEvent)
 	sd := &Discovery{
-		conn:    conn,
+		conn:    pooled.conn,
+		pooled:  pooled,
 		updates: updates,
 		sources: map[string]*targetgroup.Group{},
 		parse:   pf,
@@ -180,7 +330,7 @@ func NewDiscovery(
 	for _, path := range paths {
 		pathUpdate := make(chan treecache.ZookeeperTreeCacheEvent)
 		sd.pathUpdates = append(sd.pathUpdates, pathUpdate)
-		sd.treeCaches = append(sd.treeCaches, treecache.NewZookeeperTreeCache(conn, path, pathUpdate, logger))
+		sd.treeCaches = append(sd.treeCaches, treecache.NewZookeeperTreeCache(sd.conn, path, pathUpdate, logger))
 	}
 	return sd, nil
 }
@@ -196,7 +346,8 @@ func (d *Discovery) Run(ctx context.Context, ch chan<- []*targetgroup.Group) {
 			for range pathUpdate {
 			}
 		}
-		d.conn.Close()
+		// The connection is shared, the pool closes it with the last user.
+		pool.put(d.pooled)
 	}()
 
 	for _, pathUpdate := range d.pathUpdates {
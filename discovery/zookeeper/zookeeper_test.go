@@ -17,8 +17,10 @@ import (
 	"testing"
 	"time"
 
+	config_util "github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 	"go.uber.org/goleak"
+	"gopkg.in/yaml.v2"
 )
 
 func TestMain(m *testing.M) {
@@ -29,9 +31,34 @@ func TestNewDiscoveryError(t *testing.T) {
 	_, err := NewDiscovery(
 		[]string{"unreachable.test"},
 		time.Second, []string{"/"},
+		config_util.TLSConfig{}, AuthConfig{},
 		nil,
 		func(data []byte, path string) (model.LabelSet, error) { return nil, nil })
 	if err == nil {
 		t.Fatalf("expected error, got nil")
 	}
 }
+
+func TestAuthConfigValidation(t *testing.T) {
+	var cfg ServersetSDConfig
+	err := yaml.Unmarshal([]byte(`
+servers: ['zk.test:2181']
+paths: ['/services']
+auth:
+  scheme: digest
+`), &cfg)
+	if err == nil {
+		t.Fatalf("expected error for auth scheme without credentials, got nil")
+	}
+
+	err = yaml.Unmarshal([]byte(`
+servers: ['zk.test:2181']
+paths: ['/services']
+auth:
+  scheme: digest
+  credentials: 'user:password'
+`), &cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
@@ -138,6 +138,7 @@ type alertMetrics struct {
 	errors                  *prometheus.CounterVec
 	sent                    *prometheus.CounterVec
 	dropped                 prometheus.Counter
+	droppedPerAlertmanager  *prometheus.CounterVec
 	queueLength             prometheus.GaugeFunc
 	queueCapacity           prometheus.Gauge
 	alertmanagersDiscovered prometheus.GaugeFunc
@@ -176,6 +177,14 @@ func newAlertMetrics(r prometheus.Registerer, queueCap int, queueLen, alertmanag
 			Name:      "dropped_total",
 			Help:      "Total number of alerts dropped due to errors when sending to Alertmanager.",
 		}),
+		droppedPerAlertmanager: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "alertmanager_dropped_total",
+			Help:      "Total number of alerts dropped due to errors when sending to a specific Alertmanager.",
+		},
+			[]string{alertmanagerLabel},
+		),
 		queueLength: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: subsystem,
@@ -202,6 +211,7 @@ func newAlertMetrics(r prometheus.Registerer, queueCap int, queueLen, alertmanag
 			m.errors,
 			m.sent,
 			m.dropped,
+			m.droppedPerAlertmanager,
 			m.queueLength,
 			m.queueCapacity,
 			m.alertmanagersDiscovered,
@@ -259,6 +269,11 @@ func (n *Manager) ApplyConfig(conf *config.Config) error {
 	n.opts.ExternalLabels = conf.GlobalConfig.ExternalLabels
 	n.opts.RelabelConfigs = conf.AlertingConfig.AlertRelabelConfigs
 
+	if c := conf.AlertingConfig.NotificationQueueCapacity; c > 0 {
+		n.opts.QueueCapacity = c
+		n.metrics.queueCapacity.Set(float64(c))
+	}
+
 	amSets := make(map[string]*alertmanagerSet)
 
 	for k, cfg := range conf.AlertingConfig.AlertmanagerConfigs.ToMap() {
@@ -505,6 +520,29 @@ func (n *Manager) sendAll(alerts ...*Alert) bool {
 
 				payload = v2Payload
 			}
+		case config.AlertmanagerAPIVersionAuto:
+			{
+				// Negotiation may fall back to v1 per Alertmanager while the
+				// goroutines below are running, so both payloads are needed.
+				if v2Payload == nil {
+					openAPIAlerts := alertsToOpenAPIAlerts(alerts)
+
+					v2Payload, err = json.Marshal(openAPIAlerts)
+					if err != nil {
+						level.Error(n.logger).Log("msg", "Encoding alerts for Alertmanager API v2 failed", "err", err)
+						ams.mtx.RUnlock()
+						return false
+					}
+				}
+				if v1Payload == nil {
+					v1Payload, err = json.Marshal(alerts)
+					if err != nil {
+						level.Error(n.logger).Log("msg", "Encoding alerts for Alertmanager API v1 failed", "err", err)
+						ams.mtx.RUnlock()
+						return false
+					}
+				}
+			}
 		default:
 			{
 				level.Error(n.logger).Log(
@@ -522,18 +560,42 @@ func (n *Manager) sendAll(alerts ...*Alert) bool {
 			ctx, cancel := context.WithTimeout(n.ctx, time.Duration(ams.cfg.Timeout))
 			defer cancel()
 
-			go func(client *http.Client, url string) {
-				if err := n.sendOne(ctx, client, url, payload); err != nil {
-					level.Error(n.logger).Log("alertmanager", url, "count", len(alerts), "msg", "Error sending alert", "err", err)
-					n.metrics.errors.WithLabelValues(url).Inc()
+			var (
+				key             = am.url().String()
+				url             = key
+				fallbackURL     string
+				fallbackPayload []byte
+			)
+			if ams.cfg.APIVersion == config.AlertmanagerAPIVersionAuto {
+				if ams.apiVersion(key) == config.AlertmanagerAPIVersionV1 {
+					url, payload = v1URL(am.url()), v1Payload
+				} else {
+					payload = v2Payload
+					fallbackURL, fallbackPayload = v1URL(am.url()), v1Payload
+				}
+			}
+
+			go func(s *alertmanagerSet, client *http.Client, key, url, fallbackURL string, payload, fallbackPayload []byte) {
+				err := n.sendOne(ctx, client, url, payload)
+				if err != nil && fallbackURL != "" {
+					if he, ok := err.(*alertmanagerHTTPError); ok && (he.statusCode == http.StatusNotFound || he.statusCode == http.StatusMethodNotAllowed) {
+						level.Info(n.logger).Log("msg", "Alertmanager does not serve API v2, falling back to v1", "alertmanager", key)
+						s.setAPIVersion(key, config.AlertmanagerAPIVersionV1)
+						err = n.sendOne(ctx, client, fallbackURL, fallbackPayload)
+					}
+				}
+				if err != nil {
+					level.Error(n.logger).Log("alertmanager", key, "count", len(alerts), "msg", "Error sending alert", "err", err)
+					n.metrics.errors.WithLabelValues(key).Inc()
+					n.metrics.droppedPerAlertmanager.WithLabelValues(key).Add(float64(len(alerts)))
 				} else {
 					numSuccess.Inc()
 				}
-				n.metrics.latency.WithLabelValues(url).Observe(time.Since(begin).Seconds())
-				n.metrics.sent.WithLabelValues(url).Add(float64(len(alerts)))
+				n.metrics.latency.WithLabelValues(key).Observe(time.Since(begin).Seconds())
+				n.metrics.sent.WithLabelValues(key).Add(float64(len(alerts)))
 
 				wg.Done()
-			}(ams.client, am.url().String())
+			}(ams, ams.client, key, url, fallbackURL, payload, fallbackPayload)
 		}
 
 		ams.mtx.RUnlock()
@@ -590,12 +652,24 @@ func (n *Manager) sendOne(ctx context.Context, c *http.Client, url string, b []b
 
 	// Any HTTP status 2xx is OK.
 	if resp.StatusCode/100 != 2 {
-		return errors.Errorf("bad response status %s", resp.Status)
+		return &alertmanagerHTTPError{statusCode: resp.StatusCode, status: resp.Status}
 	}
 
 	return nil
 }
 
+// alertmanagerHTTPError is returned by sendOne for non-2xx responses. It
+// keeps the status code so callers can distinguish a missing API version
+// from other failures.
+type alertmanagerHTTPError struct {
+	statusCode int
+	status     string
+}
+
+func (e *alertmanagerHTTPError) Error() string {
+	return fmt.Sprintf("bad response status %s", e.status)
+}
+
 // Stop shuts down the notification handler.
 func (n *Manager) Stop() {
 	level.Info(n.logger).Log("msg", "Stopping notification manager...")
@@ -631,6 +705,11 @@ type alertmanagerSet struct {
 	ams        []alertmanager
 	droppedAms []alertmanager
 	logger     log.Logger
+
+	// versionMtx guards amVersions, which caches the negotiated API version
+	// per Alertmanager URL when api_version is set to "auto".
+	versionMtx sync.Mutex
+	amVersions map[string]config.AlertmanagerAPIVersion
 }
 
 func newAlertmanagerSet(cfg *config.AlertmanagerConfig, logger log.Logger, metrics *alertMetrics) (*alertmanagerSet, error) {
@@ -639,14 +718,35 @@ func newAlertmanagerSet(cfg *config.AlertmanagerConfig, logger log.Logger, metri
 		return nil, err
 	}
 	s := &alertmanagerSet{
-		client:  client,
-		cfg:     cfg,
-		logger:  logger,
-		metrics: metrics,
+		client:     client,
+		cfg:        cfg,
+		logger:     logger,
+		metrics:    metrics,
+		amVersions: map[string]config.AlertmanagerAPIVersion{},
 	}
 	return s, nil
 }
 
+// apiVersion returns the negotiated API version for the Alertmanager with
+// the given URL. Before any negotiation has happened v2 is assumed.
+func (s *alertmanagerSet) apiVersion(url string) config.AlertmanagerAPIVersion {
+	s.versionMtx.Lock()
+	defer s.versionMtx.Unlock()
+	if v, ok := s.amVersions[url]; ok {
+		return v
+	}
+	return config.AlertmanagerAPIVersionV2
+}
+
+func (s *alertmanagerSet) setAPIVersion(url string, v config.AlertmanagerAPIVersion) {
+	s.versionMtx.Lock()
+	defer s.versionMtx.Unlock()
+	if s.amVersions == nil {
+		s.amVersions = map[string]config.AlertmanagerAPIVersion{}
+	}
+	s.amVersions[url] = v
+}
+
 // sync extracts a deduplicated set of Alertmanager endpoints from a list
 // of target groups definitions.
 func (s *alertmanagerSet) sync(tgs []*targetgroup.Group) {
@@ -684,13 +784,39 @@ func (s *alertmanagerSet) sync(tgs []*targetgroup.Group) {
 		seen[us] = struct{}{}
 		s.ams = append(s.ams, am)
 	}
+
+	// Drop negotiation results of Alertmanagers that went away so they are
+	// probed again should they come back.
+	s.versionMtx.Lock()
+	for us := range s.amVersions {
+		if _, ok := seen[us]; !ok {
+			delete(s.amVersions, us)
+		}
+	}
+	s.versionMtx.Unlock()
 }
 
 func postPath(pre string, v config.AlertmanagerAPIVersion) string {
+	if v == config.AlertmanagerAPIVersionAuto {
+		// Negotiation starts at v2 and falls back per Alertmanager.
+		v = config.AlertmanagerAPIVersionV2
+	}
 	alertPushEndpoint := fmt.Sprintf("/api/%v/alerts", string(v))
 	return path.Join("/", pre, alertPushEndpoint)
 }
 
+// v1URL rewrites the default v2 push path of the given URL to its v1
+// equivalent. Custom paths set through relabeling are left untouched.
+func v1URL(u *url.URL) string {
+	v2Path := postPath("", config.AlertmanagerAPIVersionV2)
+	if !strings.HasSuffix(u.Path, v2Path) {
+		return u.String()
+	}
+	c := *u
+	c.Path = strings.TrimSuffix(u.Path, v2Path) + postPath("", config.AlertmanagerAPIVersionV1)
+	return c.String()
+}
+
 // alertmanagerFromGroup extracts a list of alertmanagers from a target group
 // and an associated AlertmanagerConfig.
 func alertmanagerFromGroup(tg *targetgroup.Group, cfg *config.AlertmanagerConfig) ([]alertmanager, []alertmanager, error) {
@@ -205,6 +205,50 @@ func TestHandlerSendAll(t *testing.T) {
 	checkNoErr()
 }
 
+func TestHandlerAPIVersionNegotiation(t *testing.T) {
+	var v1Requests, v2Requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/alerts":
+			v1Requests.Inc()
+		case "/api/v2/alerts":
+			v2Requests.Inc()
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	h := NewManager(&Options{}, nil)
+	h.alertmanagers = make(map[string]*alertmanagerSet)
+
+	amCfg := config.DefaultAlertmanagerConfig
+	amCfg.Timeout = model.Duration(time.Second)
+	require.Equal(t, config.AlertmanagerAPIVersionAuto, amCfg.APIVersion)
+
+	h.alertmanagers["1"] = &alertmanagerSet{
+		ams: []alertmanager{
+			alertmanagerMock{
+				urlf: func() string { return server.URL + postPath("", amCfg.APIVersion) },
+			},
+		},
+		cfg: &amCfg,
+	}
+
+	alerts := []*Alert{{Labels: labels.FromStrings("alertname", "test")}}
+
+	// The first send probes v2 and falls back to v1 within the same call.
+	require.True(t, h.sendAll(alerts...), "all sends failed unexpectedly")
+	require.Equal(t, int32(1), v2Requests.Load())
+	require.Equal(t, int32(1), v1Requests.Load())
+
+	// The negotiated version is remembered, so no further v2 probes happen.
+	require.True(t, h.sendAll(alerts...), "all sends failed unexpectedly")
+	require.Equal(t, int32(1), v2Requests.Load())
+	require.Equal(t, int32(2), v1Requests.Load())
+}
+
 func TestCustomDo(t *testing.T) {
 	const testURL = "http://testurl.com/"
 	const testBody = "testbody"
@@ -454,7 +498,7 @@ func TestReload(t *testing.T) {
 					},
 				},
 			},
-			out: "http://alertmanager:9093/api/v1/alerts",
+			out: "http://alertmanager:9093/api/v2/alerts",
 		},
 	}
 
@@ -491,6 +535,34 @@ alerting:
 
 }
 
+func TestApplyConfigQueueCapacity(t *testing.T) {
+	n := NewManager(&Options{QueueCapacity: 10}, nil)
+
+	cfg := &config.Config{}
+	s := `
+alerting:
+  notification_queue_capacity: 100
+`
+	if err := yaml.UnmarshalStrict([]byte(s), cfg); err != nil {
+		t.Fatalf("Unable to load YAML config: %s", err)
+	}
+
+	if err := n.ApplyConfig(cfg); err != nil {
+		t.Fatalf("Error Applying the config:%v", err)
+	}
+	require.Equal(t, 100, n.opts.QueueCapacity)
+
+	// A config without the option keeps the current capacity.
+	cfg = &config.Config{}
+	if err := yaml.UnmarshalStrict([]byte(`alerting: {}`), cfg); err != nil {
+		t.Fatalf("Unable to load YAML config: %s", err)
+	}
+	if err := n.ApplyConfig(cfg); err != nil {
+		t.Fatalf("Error Applying the config:%v", err)
+	}
+	require.Equal(t, 100, n.opts.QueueCapacity)
+}
+
 func TestDroppedAlertmanagers(t *testing.T) {
 	var tests = []struct {
 		in  *targetgroup.Group
@@ -504,7 +576,7 @@ func TestDroppedAlertmanagers(t *testing.T) {
 					},
 				},
 			},
-			out: "http://alertmanager:9093/api/v1/alerts",
+			out: "http://alertmanager:9093/api/v2/alerts",
 		},
 	}
 
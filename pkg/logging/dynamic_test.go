@@ -0,0 +1,59 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynamicLevel(t *testing.T) {
+	var buf bytes.Buffer
+	d, err := NewDynamicLevel(log.NewLogfmtLogger(&buf), "info")
+	require.NoError(t, err)
+
+	level.Debug(d).Log("msg", "dropped")
+	level.Info(d).Log("msg", "kept")
+	require.NoError(t, d.SetLevel("debug"))
+	level.Debug(d).Log("msg", "kept after SetLevel")
+
+	require.NotContains(t, buf.String(), "dropped")
+	require.Equal(t, 2, strings.Count(buf.String(), "kept"))
+
+	require.Error(t, d.SetLevel("verbose"))
+	require.Equal(t, "debug", d.Level())
+}
+
+func TestDynamicLevelComponentOverride(t *testing.T) {
+	var buf bytes.Buffer
+	d, err := NewDynamicLevel(log.NewLogfmtLogger(&buf), "info")
+	require.NoError(t, err)
+	require.NoError(t, d.SetComponentLevel("tsdb", "debug"))
+
+	level.Debug(log.With(d, "component", "tsdb")).Log("msg", "tsdb debug")
+	level.Debug(log.With(d, "component", "web")).Log("msg", "web debug")
+
+	require.Contains(t, buf.String(), "tsdb debug")
+	require.NotContains(t, buf.String(), "web debug")
+
+	// Removing the override restores the global level.
+	require.NoError(t, d.SetComponentLevel("tsdb", ""))
+	level.Debug(log.With(d, "component", "tsdb")).Log("msg", "tsdb debug again")
+	require.NotContains(t, buf.String(), "again")
+}
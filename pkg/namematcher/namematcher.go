@@ -0,0 +1,82 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package namematcher compiles lists of metric name patterns into a matcher
+// that is considerably faster than an equivalent relabeling pipeline.
+package namematcher
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Matcher matches metric names against a list of patterns. A pattern is a
+// literal metric name, optionally containing "*" wildcards matching any
+// (possibly empty) run of characters. Literal names are matched with a
+// single map lookup, "prefix*" patterns with a prefix comparison, and only
+// the remaining patterns fall through to one combined regular expression.
+type Matcher struct {
+	exact    map[string]struct{}
+	prefixes []string
+	re       *regexp.Regexp
+}
+
+// New compiles the patterns into a Matcher. It returns nil for an empty
+// pattern list so callers can cheaply skip matching entirely.
+func New(patterns []string) (*Matcher, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	m := &Matcher{exact: make(map[string]struct{})}
+	var exprs []string
+	for _, p := range patterns {
+		if p == "" {
+			return nil, errors.New("empty metric name pattern")
+		}
+		switch {
+		case !strings.Contains(p, "*"):
+			m.exact[p] = struct{}{}
+		case strings.Count(p, "*") == 1 && strings.HasSuffix(p, "*"):
+			m.prefixes = append(m.prefixes, p[:len(p)-1])
+		default:
+			parts := strings.Split(p, "*")
+			for i, part := range parts {
+				parts[i] = regexp.QuoteMeta(part)
+			}
+			exprs = append(exprs, strings.Join(parts, ".*"))
+		}
+	}
+	if len(exprs) > 0 {
+		re, err := regexp.Compile("^(?:" + strings.Join(exprs, "|") + ")$")
+		if err != nil {
+			return nil, errors.Wrap(err, "compiling metric name patterns")
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Matches reports whether the name matches any of the compiled patterns.
+func (m *Matcher) Matches(name string) bool {
+	if _, ok := m.exact[name]; ok {
+		return true
+	}
+	for _, p := range m.prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return m.re != nil && m.re.MatchString(name)
+}
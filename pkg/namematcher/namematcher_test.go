@@ -0,0 +1,99 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package namematcher
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/relabel"
+)
+
+func TestMatcher(t *testing.T) {
+	m, err := New([]string{"up", "node_cpu_*", "http_*_duration_seconds"})
+	require.NoError(t, err)
+
+	for name, want := range map[string]bool{
+		"up":                             true,
+		"upx":                            false,
+		"node_cpu_seconds_total":         true,
+		"node_cpu_":                      true,
+		"node_memory_bytes":              false,
+		"http_request_duration_seconds":  true,
+		"http_response_duration_seconds": true,
+		"http_request_duration_ms":       false,
+	} {
+		require.Equal(t, want, m.Matches(name), "name %q", name)
+	}
+}
+
+func TestMatcherEmpty(t *testing.T) {
+	m, err := New(nil)
+	require.NoError(t, err)
+	require.Nil(t, m)
+
+	_, err = New([]string{""})
+	require.Error(t, err)
+}
+
+func benchmarkPatterns(n int) ([]string, []string) {
+	patterns := make([]string, 0, n)
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		patterns = append(patterns, fmt.Sprintf("job%d_requests_total", i))
+		names = append(names, fmt.Sprintf("job%d_other_metric", i))
+	}
+	patterns = append(patterns, "node_cpu_*")
+	return patterns, names
+}
+
+func BenchmarkMatcher(b *testing.B) {
+	patterns, names := benchmarkPatterns(500)
+	m, err := New(patterns)
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Matches(names[i%len(names)])
+	}
+}
+
+// BenchmarkRelabelEquivalent measures the relabeling pipeline the matcher
+// replaces: one drop rule per pattern applied to the metric name.
+func BenchmarkRelabelEquivalent(b *testing.B) {
+	patterns, names := benchmarkPatterns(500)
+	var configs []*relabel.Config
+	for _, p := range patterns {
+		cfg := relabel.DefaultRelabelConfig
+		cfg.SourceLabels = model.LabelNames{labels.MetricName}
+		cfg.Regex = relabel.MustNewRegexp(strings.Replace(p, "*", ".*", -1))
+		cfg.Action = relabel.Drop
+		configs = append(configs, &cfg)
+	}
+
+	lsets := make([]labels.Labels, len(names))
+	for i, name := range names {
+		lsets[i] = labels.FromStrings(labels.MetricName, name)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		relabel.Process(lsets[i%len(lsets)], configs...)
+	}
+}
@@ -46,6 +46,16 @@ type WrappedError struct {
 	nodeAlt *yaml.Node
 }
 
+// Error prepends the line and column where the error occurred, if known.
+func (we *WrappedError) Error() string {
+	if we.nodeAlt != nil {
+		return errors.Wrapf(we.err, "%d:%d: %d:%d", we.node.Line, we.node.Column, we.nodeAlt.Line, we.nodeAlt.Column).Error()
+	} else if we.node != nil {
+		return errors.Wrapf(we.err, "%d:%d", we.node.Line, we.node.Column).Error()
+	}
+	return we.err.Error()
+}
+
 func (err *Error) Error() string {
 	if err.Err.nodeAlt != nil {
 		return errors.Wrapf(err.Err.err, "%d:%d: %d:%d: group %q, rule %d, %q", err.Err.node.Line, err.Err.node.Column, err.Err.nodeAlt.Line, err.Err.nodeAlt.Column, err.Group, err.Rule, err.RuleName).Error()
@@ -82,6 +92,15 @@ func (g *RuleGroups) Validate(node ruleGroups) (errs []error) {
 
 		set[g.Name] = struct{}{}
 
+		for k, v := range g.Labels {
+			if !model.LabelName(k).IsValid() || k == model.MetricNameLabel {
+				errs = append(errs, errors.Errorf("%d:%d: invalid label name: %s", node.Groups[j].Line, node.Groups[j].Column, k))
+			}
+			if !model.LabelValue(v).IsValid() {
+				errs = append(errs, errors.Errorf("%d:%d: invalid label value: %s", node.Groups[j].Line, node.Groups[j].Column, v))
+			}
+		}
+
 		for i, r := range g.Rules {
 			for _, node := range r.Validate() {
 				var ruleName yaml.Node
@@ -100,34 +119,109 @@ func (g *RuleGroups) Validate(node ruleGroups) (errs []error) {
 		}
 	}
 
+	for j, g := range g.Groups {
+		for _, dep := range g.DependsOn {
+			if _, ok := set[dep]; !ok {
+				errs = append(
+					errs,
+					errors.Errorf("%d:%d: group \"%s\" depends on unknown group \"%s\"", node.Groups[j].Line, node.Groups[j].Column, g.Name, dep),
+				)
+			}
+		}
+	}
+
+	if name := g.dependencyCycle(); name != "" {
+		errs = append(errs, errors.Errorf("group \"%s\" has a cyclic dependency", name))
+	}
+
 	return errs
 }
 
+// dependencyCycle returns the name of a group whose depends_on chain leads
+// into a cycle, or an empty string if the dependency graph is acyclic.
+// Unknown dependencies are ignored here; they are reported separately.
+func (g *RuleGroups) dependencyCycle() string {
+	deps := make(map[string][]string, len(g.Groups))
+	for _, grp := range g.Groups {
+		deps[grp.Name] = grp.DependsOn
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		switch state[name] {
+		case visiting:
+			return true
+		case done:
+			return false
+		}
+		state[name] = visiting
+		for _, dep := range deps[name] {
+			if _, ok := deps[dep]; !ok {
+				continue
+			}
+			if visit(dep) {
+				return true
+			}
+		}
+		state[name] = done
+		return false
+	}
+
+	for _, grp := range g.Groups {
+		if visit(grp.Name) {
+			return grp.Name
+		}
+	}
+	return ""
+}
+
 // RuleGroup is a list of sequentially evaluated recording and alerting rules.
 type RuleGroup struct {
 	Name     string         `yaml:"name"`
 	Interval model.Duration `yaml:"interval,omitempty"`
-	Rules    []RuleNode     `yaml:"rules"`
+	// EvalOffset delays the group's aligned evaluation timestamps, e.g. to
+	// evaluate shortly after the scrapes feeding the group have completed.
+	// It must be smaller than the group's interval.
+	EvalOffset model.Duration `yaml:"eval_offset,omitempty"`
+	DependsOn  []string       `yaml:"depends_on,omitempty"`
+	// LookbackDelta overrides the engine's lookback delta for all queries in
+	// the group. 0 means to use the engine default.
+	LookbackDelta model.Duration `yaml:"lookback_delta,omitempty"`
+	// Labels are added to every series and alert produced by the group's
+	// rules. Labels set on an individual rule take precedence.
+	Labels map[string]string `yaml:"labels,omitempty"`
+	Rules  []RuleNode        `yaml:"rules"`
 }
 
 // Rule describes an alerting or recording rule.
 type Rule struct {
-	Record      string            `yaml:"record,omitempty"`
-	Alert       string            `yaml:"alert,omitempty"`
-	Expr        string            `yaml:"expr"`
-	For         model.Duration    `yaml:"for,omitempty"`
-	Labels      map[string]string `yaml:"labels,omitempty"`
-	Annotations map[string]string `yaml:"annotations,omitempty"`
+	Record        string            `yaml:"record,omitempty"`
+	Alert         string            `yaml:"alert,omitempty"`
+	Expr          string            `yaml:"expr"`
+	ClearExpr     string            `yaml:"clear_expr,omitempty"`
+	For           model.Duration    `yaml:"for,omitempty"`
+	KeepFiringFor model.Duration    `yaml:"keep_firing_for,omitempty"`
+	Labels        map[string]string `yaml:"labels,omitempty"`
+	Annotations   map[string]string `yaml:"annotations,omitempty"`
 }
 
 // RuleNode adds yaml.v3 layer to support line and column outputs for invalid rules.
 type RuleNode struct {
-	Record      yaml.Node         `yaml:"record,omitempty"`
-	Alert       yaml.Node         `yaml:"alert,omitempty"`
-	Expr        yaml.Node         `yaml:"expr"`
-	For         model.Duration    `yaml:"for,omitempty"`
-	Labels      map[string]string `yaml:"labels,omitempty"`
-	Annotations map[string]string `yaml:"annotations,omitempty"`
+	Record        yaml.Node         `yaml:"record,omitempty"`
+	Alert         yaml.Node         `yaml:"alert,omitempty"`
+	Expr          yaml.Node         `yaml:"expr"`
+	ClearExpr     yaml.Node         `yaml:"clear_expr,omitempty"`
+	For           model.Duration    `yaml:"for,omitempty"`
+	KeepFiringFor model.Duration    `yaml:"keep_firing_for,omitempty"`
+	Labels        map[string]string `yaml:"labels,omitempty"`
+	Annotations   map[string]string `yaml:"annotations,omitempty"`
 }
 
 // Validate the rule and return a list of encountered errors.
@@ -164,7 +258,21 @@ func (r *RuleNode) Validate() (nodes []WrappedError) {
 			node: &r.Expr,
 		})
 	}
+	if r.ClearExpr.Value != "" {
+		if _, err := parser.ParseExpr(r.ClearExpr.Value); err != nil {
+			nodes = append(nodes, WrappedError{
+				err:  errors.Wrapf(err, "could not parse clear expression"),
+				node: &r.ClearExpr,
+			})
+		}
+	}
 	if r.Record.Value != "" {
+		if r.ClearExpr.Value != "" {
+			nodes = append(nodes, WrappedError{
+				err:  errors.Errorf("invalid field 'clear_expr' in recording rule"),
+				node: &r.Record,
+			})
+		}
 		if len(r.Annotations) > 0 {
 			nodes = append(nodes, WrappedError{
 				err:  errors.Errorf("invalid field 'annotations' in recording rule"),
@@ -177,6 +285,12 @@ func (r *RuleNode) Validate() (nodes []WrappedError) {
 				node: &r.Record,
 			})
 		}
+		if r.KeepFiringFor != 0 {
+			nodes = append(nodes, WrappedError{
+				err:  errors.Errorf("invalid field 'keep_firing_for' in recording rule"),
+				node: &r.Record,
+			})
+		}
 		if !model.IsValidMetricName(model.LabelValue(r.Record.Value)) {
 			nodes = append(nodes, WrappedError{
 				err:  errors.Errorf("invalid recording rule name: %s", r.Record.Value),
@@ -75,6 +75,18 @@ func TestParseFileFailure(t *testing.T) {
 			filename: "invalid_label_name.bad.yaml",
 			errMsg:   "invalid label name",
 		},
+		{
+			filename: "bad_group_label.bad.yaml",
+			errMsg:   "invalid label name",
+		},
+		{
+			filename: "depends_on_unknown.bad.yaml",
+			errMsg:   "group \"yolo\" depends on unknown group \"nonexistent\"",
+		},
+		{
+			filename: "depends_on_cycle.bad.yaml",
+			errMsg:   "group \"yolo\" has a cyclic dependency",
+		},
 	}
 
 	for _, c := range table {
@@ -0,0 +1,148 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secrets resolves secret fields in the configuration that reference
+// an external secret provider, such as vault:// or kms-secret:// URIs, so
+// that no plaintext credentials have to live in the configuration files.
+// Resolution happens once per configuration load; each distinct URI is
+// fetched once and the result reused for all fields referencing it.
+package secrets
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	config_util "github.com/prometheus/common/config"
+)
+
+// Provider fetches the secret value a URI of its scheme refers to.
+type Provider interface {
+	Fetch(ctx context.Context, uri *url.URL) (string, error)
+}
+
+var (
+	providersMtx sync.RWMutex
+	providers    = map[string]Provider{}
+)
+
+// Register makes the provider available for secret URIs with the given
+// scheme. It panics when the scheme is already taken.
+func Register(scheme string, p Provider) {
+	providersMtx.Lock()
+	defer providersMtx.Unlock()
+	if _, ok := providers[scheme]; ok {
+		panic("secrets: provider already registered for scheme " + scheme)
+	}
+	providers[scheme] = p
+}
+
+func lookup(scheme string) (Provider, bool) {
+	providersMtx.RLock()
+	defer providersMtx.RUnlock()
+	p, ok := providers[scheme]
+	return p, ok
+}
+
+var secretType = reflect.TypeOf(config_util.Secret(""))
+
+// Resolve walks the given configuration and replaces every secret field
+// whose value is a URI with a registered provider scheme by the secret the
+// URI refers to. Fields holding plain values or URIs with unknown schemes
+// are left untouched. The first fetch error aborts the walk.
+func Resolve(ctx context.Context, cfg interface{}) error {
+	r := &resolver{ctx: ctx, cache: map[string]string{}}
+	return r.walk(reflect.ValueOf(cfg))
+}
+
+// resolver deduplicates fetches within a single Resolve call. Secrets are
+// deliberately not cached across calls so a configuration reload picks up
+// rotated values.
+type resolver struct {
+	ctx   context.Context
+	cache map[string]string
+}
+
+func (r *resolver) walk(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return r.walk(v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			f := v.Field(i)
+			if f.Type() == secretType {
+				if err := r.resolveSecret(f); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := r.walk(f); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := r.walk(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			mv := v.MapIndex(k)
+			// Map values are not addressable, so mutate a copy and
+			// store it back in case it holds secrets.
+			cp := reflect.New(mv.Type()).Elem()
+			cp.Set(mv)
+			if err := r.walk(cp); err != nil {
+				return err
+			}
+			v.SetMapIndex(k, cp)
+		}
+	}
+	return nil
+}
+
+func (r *resolver) resolveSecret(v reflect.Value) error {
+	s := v.String()
+	if !strings.Contains(s, "://") {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil
+	}
+	p, ok := lookup(u.Scheme)
+	if !ok {
+		return nil
+	}
+	if resolved, ok := r.cache[s]; ok {
+		v.SetString(resolved)
+		return nil
+	}
+	resolved, err := p.Fetch(r.ctx, u)
+	if err != nil {
+		return errors.Wrapf(err, "fetching secret %q", u.Redacted())
+	}
+	r.cache[s] = resolved
+	v.SetString(resolved)
+	return nil
+}
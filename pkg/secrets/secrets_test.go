@@ -0,0 +1,186 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	config_util "github.com/prometheus/common/config"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvider struct {
+	fetches int
+	err     error
+}
+
+func (p *fakeProvider) Fetch(ctx context.Context, uri *url.URL) (string, error) {
+	p.fetches++
+	if p.err != nil {
+		return "", p.err
+	}
+	return "resolved-" + uri.Host, nil
+}
+
+func TestResolve(t *testing.T) {
+	p := &fakeProvider{}
+	Register("fake", p)
+	defer func() {
+		providersMtx.Lock()
+		delete(providers, "fake")
+		providersMtx.Unlock()
+	}()
+
+	type inner struct {
+		Password config_util.Secret `yaml:"password"`
+	}
+	cfg := struct {
+		Token    config_util.Secret `yaml:"token"`
+		Same     config_util.Secret `yaml:"same"`
+		Plain    config_util.Secret `yaml:"plain"`
+		Unknown  config_util.Secret `yaml:"unknown"`
+		Nested   *inner
+		Slice    []inner
+		ByName   map[string]inner
+		internal config_util.Secret
+	}{
+		Token:    "fake://a",
+		Same:     "fake://a",
+		Plain:    "hunter2",
+		Unknown:  "other://a",
+		Nested:   &inner{Password: "fake://b"},
+		Slice:    []inner{{Password: "fake://c"}},
+		ByName:   map[string]inner{"x": {Password: "fake://d"}},
+		internal: "fake://e",
+	}
+
+	require.NoError(t, Resolve(context.Background(), &cfg))
+
+	require.Equal(t, config_util.Secret("resolved-a"), cfg.Token)
+	require.Equal(t, config_util.Secret("resolved-a"), cfg.Same)
+	require.Equal(t, config_util.Secret("hunter2"), cfg.Plain)
+	require.Equal(t, config_util.Secret("other://a"), cfg.Unknown)
+	require.Equal(t, config_util.Secret("resolved-b"), cfg.Nested.Password)
+	require.Equal(t, config_util.Secret("resolved-c"), cfg.Slice[0].Password)
+	require.Equal(t, config_util.Secret("resolved-d"), cfg.ByName["x"].Password)
+	require.Equal(t, config_util.Secret("fake://e"), cfg.internal)
+	// Identical URIs are fetched once per Resolve call.
+	require.Equal(t, 4, p.fetches)
+
+	p.err = errors.New("boom")
+	cfg.Token = "fake://a"
+	err := Resolve(context.Background(), &cfg)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "fake://a")
+}
+
+func TestVaultProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "test-token", r.Header.Get("X-Vault-Token"))
+		switch r.URL.Path {
+		case "/v1/secret/data/prometheus/basic-auth": // KV version 2.
+			w.Write([]byte(`{"data":{"data":{"password":"v2-secret"},"metadata":{"version":1}}}`))
+		case "/v1/kv/prometheus/basic-auth": // KV version 1.
+			w.Write([]byte(`{"data":{"password":"v1-secret"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	os.Setenv("VAULT_ADDR", srv.URL)
+	os.Setenv("VAULT_TOKEN", "test-token")
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	p, _ := lookup("vault")
+
+	fetch := func(rawURI string) (string, error) {
+		u, err := url.Parse(rawURI)
+		require.NoError(t, err)
+		return p.Fetch(context.Background(), u)
+	}
+
+	v, err := fetch("vault://secret/prometheus/basic-auth#password")
+	require.NoError(t, err)
+	require.Equal(t, "v2-secret", v)
+
+	v, err = fetch("vault://kv/prometheus/basic-auth#password")
+	require.NoError(t, err)
+	require.Equal(t, "v1-secret", v)
+
+	_, err = fetch("vault://secret/prometheus/basic-auth#missing")
+	require.Error(t, err)
+
+	_, err = fetch("vault://secret/does/not/exist#password")
+	require.Error(t, err)
+
+	_, err = fetch("vault://secret/prometheus/basic-auth")
+	require.Error(t, err)
+}
+
+func TestKMSProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		require.Equal(t, "GetSecretValue", q.Get("Action"))
+		require.Equal(t, "test-key", q.Get("AccessKeyId"))
+		require.NotEmpty(t, q.Get("Signature"))
+		switch q.Get("SecretName") {
+		case "plain":
+			w.Write([]byte(`{"SecretData":"plain-secret"}`))
+		case "json":
+			w.Write([]byte(`{"SecretData":"{\"password\":\"json-secret\"}"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"Code":"Forbidden.ResourceNotFound","Message":"secret not found"}`))
+		}
+	}))
+	defer srv.Close()
+
+	os.Setenv("ALIBABA_CLOUD_KMS_ENDPOINT", srv.URL)
+	os.Setenv("ALIBABA_CLOUD_ACCESS_KEY_ID", "test-key")
+	os.Setenv("ALIBABA_CLOUD_ACCESS_KEY_SECRET", "test-secret")
+	defer os.Unsetenv("ALIBABA_CLOUD_KMS_ENDPOINT")
+	defer os.Unsetenv("ALIBABA_CLOUD_ACCESS_KEY_ID")
+	defer os.Unsetenv("ALIBABA_CLOUD_ACCESS_KEY_SECRET")
+
+	p, _ := lookup("kms-secret")
+
+	fetch := func(rawURI string) (string, error) {
+		u, err := url.Parse(rawURI)
+		require.NoError(t, err)
+		return p.Fetch(context.Background(), u)
+	}
+
+	v, err := fetch("kms-secret://plain")
+	require.NoError(t, err)
+	require.Equal(t, "plain-secret", v)
+
+	v, err = fetch("kms-secret://json#password")
+	require.NoError(t, err)
+	require.Equal(t, "json-secret", v)
+
+	_, err = fetch("kms-secret://json#missing")
+	require.Error(t, err)
+
+	_, err = fetch("kms-secret://nope")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "ResourceNotFound")
+}
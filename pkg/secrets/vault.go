@@ -0,0 +1,103 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	Register("vault", &vaultProvider{
+		client: &http.Client{Timeout: 10 * time.Second},
+	})
+}
+
+// vaultProvider reads secrets from a HashiCorp Vault KV store via its HTTP
+// API. The server address and token are taken from the VAULT_ADDR and
+// VAULT_TOKEN environment variables, as with the vault CLI.
+//
+// URIs have the form vault://<mount>/<path>#<field>, e.g.
+// vault://secret/prometheus/remote-write#password.
+type vaultProvider struct {
+	client *http.Client
+}
+
+func (p *vaultProvider) Fetch(ctx context.Context, uri *url.URL) (string, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return "", errors.New("VAULT_TOKEN is not set")
+	}
+	field := uri.Fragment
+	if field == "" {
+		return "", errors.New("missing field in fragment, expected vault://<mount>/<path>#<field>")
+	}
+
+	// Try the KV version 2 layout first and fall back to version 1.
+	mount, path := uri.Host, uri.Path
+	for _, api := range []string{
+		addr + "/v1/" + mount + "/data" + path,
+		addr + "/v1/" + mount + path,
+	} {
+		req, err := http.NewRequest("GET", api, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("X-Vault-Token", token)
+
+		resp, err := p.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return "", errors.Errorf("unexpected status %s from %s", resp.Status, uri.Redacted())
+		}
+
+		var secret map[string]json.RawMessage
+		err = json.NewDecoder(resp.Body).Decode(&secret)
+		resp.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(secret["data"], &fields); err != nil {
+			return "", err
+		}
+		// KV version 2 nests the fields in another "data" object.
+		if nested, ok := fields["data"].(map[string]interface{}); ok {
+			fields = nested
+		}
+		value, ok := fields[field].(string)
+		if !ok {
+			return "", errors.Errorf("secret %s has no field %q", uri.Redacted(), field)
+		}
+		return value, nil
+	}
+	return "", errors.Errorf("secret %s not found", uri.Redacted())
+}
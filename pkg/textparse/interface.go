@@ -61,12 +61,16 @@ type Parser interface {
 }
 
 // New returns a new parser of the byte slice.
-func New(b []byte, contentType string) Parser {
+//
+// If allowUTF8Names is true, double-quoted metric and label names containing
+// arbitrary UTF-8 characters are accepted. This is only supported for the
+// Prometheus text exposition format.
+func New(b []byte, contentType string, allowUTF8Names bool) Parser {
 	mediaType, _, err := mime.ParseMediaType(contentType)
 	if err == nil && mediaType == "application/openmetrics-text" {
 		return NewOpenMetricsParser(b)
 	}
-	return NewPromParser(b)
+	return NewPromParser(b, allowUTF8Names)
 }
 
 // Entry represents the type of a parsed entry.
@@ -140,6 +140,25 @@ func (l *promlexer) Error(es string) {
 	l.err = errors.New(es)
 }
 
+// scanQuoted scans a double-quoted string at the current position, leaving
+// the lexer positioned after the closing quote. It returns false if the
+// string is not terminated before the end of the line.
+func (l *promlexer) scanQuoted() bool {
+	for i := l.i + 1; i < len(l.b); i++ {
+		switch l.b[i] {
+		case '\\':
+			i++
+		case '"':
+			l.start = l.i
+			l.i = i + 1
+			return true
+		case '\n':
+			return false
+		}
+	}
+	return false
+}
+
 // PromParser parses samples from a byte slice of samples in the official
 // Prometheus text exposition format.
 type PromParser struct {
@@ -152,11 +171,17 @@ type PromParser struct {
 	hasTS   bool
 	start   int
 	offsets []int
+
+	// allowUTF8Names enables double-quoted metric and label names that may
+	// contain arbitrary UTF-8 characters, e.g. {"http.server.duration"}.
+	allowUTF8Names bool
 }
 
-// NewPromParser returns a new parser of the byte slice.
-func NewPromParser(b []byte) Parser {
-	return &PromParser{l: &promlexer{b: append(b, '\n')}}
+// NewPromParser returns a new parser of the byte slice. If allowUTF8Names is
+// true, double-quoted metric and label names are accepted in addition to the
+// classic unquoted syntax.
+func NewPromParser(b []byte, allowUTF8Names bool) Parser {
+	return &PromParser{l: &promlexer{b: append(b, '\n')}, allowUTF8Names: allowUTF8Names}
 }
 
 // Series returns the bytes of the series, the timestamp if set, and the value
@@ -210,9 +235,13 @@ func (p *PromParser) Metric(l *labels.Labels) string {
 	// have to create references on it below.
 	s := string(p.series)
 
+	name := s[:p.offsets[0]-p.start]
+	if len(name) > 0 && name[0] == '"' {
+		name = unquoteName(name)
+	}
 	*l = append(*l, labels.Label{
 		Name:  labels.MetricName,
-		Value: s[:p.offsets[0]-p.start],
+		Value: name,
 	})
 
 	for i := 1; i < len(p.offsets); i += 4 {
@@ -221,12 +250,17 @@ func (p *PromParser) Metric(l *labels.Labels) string {
 		c := p.offsets[i+2] - p.start
 		d := p.offsets[i+3] - p.start
 
+		n := s[a:b]
+		if n[0] == '"' {
+			n = unquoteName(n)
+		}
+
 		// Replacer causes allocations. Replace only when necessary.
 		if strings.IndexByte(s[c:d], byte('\\')) >= 0 {
-			*l = append(*l, labels.Label{Name: s[a:b], Value: lvalReplacer.Replace(s[c:d])})
+			*l = append(*l, labels.Label{Name: n, Value: lvalReplacer.Replace(s[c:d])})
 			continue
 		}
-		*l = append(*l, labels.Label{Name: s[a:b], Value: s[c:d]})
+		*l = append(*l, labels.Label{Name: n, Value: s[c:d]})
 	}
 
 	// Sort labels to maintain the sorted labels invariant.
@@ -245,12 +279,51 @@ func (p *PromParser) Exemplar(e *exemplar.Exemplar) bool {
 // and spaces.
 func (p *PromParser) nextToken() token {
 	for {
+		if p.allowUTF8Names {
+			if tok, ok := p.quotedNameToken(); ok {
+				return tok
+			}
+		}
 		if tok := p.l.Lex(); tok != tWhitespace {
 			return tok
 		}
 	}
 }
 
+// quotedNameToken hand-lexes a double-quoted metric or label name at the
+// current position. The generated lexer only knows the classic unquoted
+// syntax, so quoted names are consumed here before it runs. It reports
+// whether a quoted name was found.
+func (p *PromParser) quotedNameToken() (token, bool) {
+	l := p.l
+	if l.i >= len(l.b) || l.b[l.i] != '"' {
+		return tInvalid, false
+	}
+	switch l.state {
+	case sInit, sMeta1, sLabels:
+	default:
+		return tInvalid, false
+	}
+	if !l.scanQuoted() {
+		l.Error("unterminated quoted name")
+		return tInvalid, true
+	}
+	if !utf8.Valid(l.buf()) {
+		l.Error("quoted name is not valid UTF-8")
+		return tInvalid, true
+	}
+	switch l.state {
+	case sInit:
+		l.state = sValue
+		return tMName, true
+	case sMeta1:
+		l.state = sMeta2
+		return tMName, true
+	default:
+		return tLName, true
+	}
+}
+
 func parseError(exp string, got token) error {
 	return errors.Errorf("%s, got %q", exp, got)
 }
@@ -273,7 +346,12 @@ func (p *PromParser) Next() (Entry, error) {
 	case tHelp, tType:
 		switch t := p.nextToken(); t {
 		case tMName:
-			p.offsets = append(p.offsets, p.l.start, p.l.i)
+			if b := p.l.buf(); len(b) > 1 && b[0] == '"' {
+				// Strip the quotes from a quoted name.
+				p.offsets = append(p.offsets, p.l.start+1, p.l.i-1)
+			} else {
+				p.offsets = append(p.offsets, p.l.start, p.l.i)
+			}
 		default:
 			return EntryInvalid, parseError("expected metric name after HELP", t)
 		}
@@ -402,6 +480,16 @@ func (p *PromParser) parseLVals() error {
 	}
 }
 
+// unquoteName strips the surrounding quotes from a quoted metric or label
+// name and resolves any escape sequences it contains.
+func unquoteName(s string) string {
+	s = s[1 : len(s)-1]
+	if strings.IndexByte(s, byte('\\')) >= 0 {
+		return lvalReplacer.Replace(s)
+	}
+	return s
+}
+
 var lvalReplacer = strings.NewReplacer(
 	`\"`, "\"",
 	`\\`, "\\",
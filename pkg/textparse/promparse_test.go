@@ -170,7 +170,7 @@ testmetric{label="\"bar\""} 1`
 		},
 	}
 
-	p := NewPromParser([]byte(input))
+	p := NewPromParser([]byte(input), false)
 	i := 0
 
 	var res labels.Labels
@@ -213,6 +213,99 @@ testmetric{label="\"bar\""} 1`
 	require.Equal(t, len(exp), i)
 }
 
+func TestPromParseUTF8Names(t *testing.T) {
+	input := `# HELP "http.server.duration" Duration of HTTP server requests.
+# TYPE "http.server.duration" histogram
+"http.server.duration"{"http.method"="GET",code="200"} 4.9351e-05
+"http.server.duration" 99
+"metric.with.\"quotes\"" 1
+"unicode.name.蓝灯"{"label.名"="value"} 2`
+
+	exp := []struct {
+		lset labels.Labels
+		m    string
+		v    float64
+		typ  MetricType
+		help string
+	}{
+		{
+			m:    "http.server.duration",
+			help: "Duration of HTTP server requests.",
+		}, {
+			m:   "http.server.duration",
+			typ: MetricTypeHistogram,
+		}, {
+			m:    `"http.server.duration"{"http.method"="GET",code="200"}`,
+			v:    4.9351e-05,
+			lset: labels.FromStrings("__name__", "http.server.duration", "code", "200", "http.method", "GET"),
+		}, {
+			m:    `"http.server.duration"`,
+			v:    99,
+			lset: labels.FromStrings("__name__", "http.server.duration"),
+		}, {
+			m:    `"metric.with.\"quotes\""`,
+			v:    1,
+			lset: labels.FromStrings("__name__", `metric.with."quotes"`),
+		}, {
+			m:    `"unicode.name.蓝灯"{"label.名"="value"}`,
+			v:    2,
+			lset: labels.FromStrings("__name__", "unicode.name.蓝灯", "label.名", "value"),
+		},
+	}
+
+	p := NewPromParser([]byte(input), true)
+	i := 0
+
+	var res labels.Labels
+
+	for {
+		et, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		switch et {
+		case EntrySeries:
+			m, _, v := p.Series()
+
+			p.Metric(&res)
+
+			require.Equal(t, exp[i].m, string(m))
+			require.Equal(t, exp[i].v, v)
+			require.Equal(t, exp[i].lset, res)
+			res = res[:0]
+
+		case EntryType:
+			m, typ := p.Type()
+			require.Equal(t, exp[i].m, string(m))
+			require.Equal(t, exp[i].typ, typ)
+
+		case EntryHelp:
+			m, h := p.Help()
+			require.Equal(t, exp[i].m, string(m))
+			require.Equal(t, exp[i].help, string(h))
+		}
+
+		i++
+	}
+	require.Equal(t, len(exp), i)
+
+	// Quoted names are rejected with the legacy validation scheme.
+	p = NewPromParser([]byte(`"http.server.duration" 99`), false)
+	_, err := p.Next()
+	require.Error(t, err)
+
+	// Unterminated and non-UTF-8 quoted names are rejected.
+	p = NewPromParser([]byte(`"unterminated 1`), true)
+	_, err = p.Next()
+	require.Error(t, err)
+
+	p = NewPromParser([]byte("\"\xff\" 1"), true)
+	_, err = p.Next()
+	require.Error(t, err)
+}
+
 func TestPromParseErrors(t *testing.T) {
 	cases := []struct {
 		input string
@@ -273,7 +366,7 @@ func TestPromParseErrors(t *testing.T) {
 	}
 
 	for i, c := range cases {
-		p := NewPromParser([]byte(c.input))
+		p := NewPromParser([]byte(c.input), false)
 		var err error
 		for err == nil {
 			_, err = p.Next()
@@ -323,7 +416,7 @@ func TestPromNullByteHandling(t *testing.T) {
 	}
 
 	for i, c := range cases {
-		p := NewPromParser([]byte(c.input))
+		p := NewPromParser([]byte(c.input), false)
 		var err error
 		for err == nil {
 			_, err = p.Next()
@@ -345,7 +438,7 @@ const (
 
 func BenchmarkParse(b *testing.B) {
 	for parserName, parser := range map[string]func([]byte) Parser{
-		"prometheus":  NewPromParser,
+		"prometheus":  func(b []byte) Parser { return NewPromParser(b, false) },
 		"openmetrics": NewOpenMetricsParser,
 	} {
 		for _, fn := range []string{"promtestdata.txt", "promtestdata.nometa.txt"} {
@@ -31,17 +31,27 @@ import (
 // FunctionCall is the type of a PromQL function implementation
 //
 // vals is a list of the evaluated arguments for the function call.
-//    For range vectors it will be a Matrix with one series, instant vectors a
-//    Vector, scalars a Vector with one series whose value is the scalar
-//    value,and nil for strings.
+//
+//	For range vectors it will be a Matrix with one series, instant vectors a
+//	Vector, scalars a Vector with one series whose value is the scalar
+//	value,and nil for strings.
+//
 // args are the original arguments to the function, where you can access
-//    matrixSelectors, vectorSelectors, and StringLiterals.
+//
+//	matrixSelectors, vectorSelectors, and StringLiterals.
+//
 // enh.Out is a pre-allocated empty vector that you may use to accumulate
-//    output before returning it. The vectors in vals should not be returned.a
+//
+//	output before returning it. The vectors in vals should not be returned.a
+//
 // Range vector functions need only return a vector with the right value,
-//     the metric and timestamp are not needed.
+//
+//	the metric and timestamp are not needed.
+//
 // Instant vector functions need only return a vector with the right values and
-//     metrics, the timestamp are not needed.
+//
+//	metrics, the timestamp are not needed.
+//
 // Scalar results should be returned as the value of a sample in a Vector.
 type FunctionCall func(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) Vector
 
@@ -213,6 +223,8 @@ func calcTrendValue(i int, tf, s0, s1, b float64) float64 {
 // data. A lower smoothing factor increases the influence of historical data. The trend factor (0 < tf < 1) affects
 // how trends in historical data will affect the current data. A higher trend factor increases the influence.
 // of trends. Algorithm taken from https://en.wikipedia.org/wiki/Exponential_smoothing titled: "Double exponential smoothing".
+// Also registered under the experimental name double_exponential_smoothing,
+// which will eventually replace holt_winters.
 func funcHoltWinters(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) Vector {
 	samples := vals[0].(Matrix)[0]
 
@@ -436,6 +448,22 @@ func funcQuantileOverTime(vals []parser.Value, args parser.Expressions, enh *Eva
 	})
 }
 
+// === mad_over_time(Matrix parser.ValueTypeMatrix) Vector ===
+func funcMadOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) Vector {
+	return aggrOverTime(vals, enh, func(points []Point) float64 {
+		values := make(vectorByValueHeap, 0, len(points))
+		for _, p := range points {
+			values = append(values, Sample{Point: Point{V: p.V}})
+		}
+		median := quantile(0.5, values)
+		values = values[:0]
+		for _, p := range points {
+			values = append(values, Sample{Point: Point{V: math.Abs(p.V - median)}})
+		}
+		return quantile(0.5, values)
+	})
+}
+
 // === stddev_over_time(Matrix parser.ValueTypeMatrix) Vector ===
 func funcStddevOverTime(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) Vector {
 	return aggrOverTime(vals, enh, func(values []Point) float64 {
@@ -751,6 +779,61 @@ func funcLabelReplace(vals []parser.Value, args parser.Expressions, enh *EvalNod
 	return enh.Out
 }
 
+// === info(vector parser.ValueTypeVector, infoVector parser.ValueTypeVector) Vector ===
+func funcInfo(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) Vector {
+	vector := vals[0].(Vector)
+	infoVector := vals[1].(Vector)
+
+	// Info series are identified by their job and instance labels. All their
+	// remaining labels, the metric name aside, are data labels that get copied
+	// onto matching input series.
+	type infoEntry struct {
+		data     labels.Labels
+		conflict bool
+	}
+
+	var buf []byte
+	info := make(map[uint64]*infoEntry, len(infoVector))
+	for _, el := range infoVector {
+		var h uint64
+		h, buf = el.Metric.HashForLabels(buf, labels.InstanceName, model.JobLabel)
+		data := labels.NewBuilder(el.Metric).
+			Del(labels.MetricName, labels.InstanceName, model.JobLabel).
+			Labels()
+		if e, ok := info[h]; ok {
+			if !labels.Equal(e.data, data) {
+				e.conflict = true
+			}
+			continue
+		}
+		info[h] = &infoEntry{data: data}
+	}
+
+	for _, el := range vector {
+		var h uint64
+		h, buf = el.Metric.HashForLabels(buf, labels.InstanceName, model.JobLabel)
+		outMetric := el.Metric
+		if e, ok := info[h]; ok {
+			if e.conflict {
+				panic(errors.Errorf("multiple info series with different labels found for the same target in info()"))
+			}
+			lb := labels.NewBuilder(el.Metric)
+			for _, l := range e.data {
+				// Labels already present on the input series win.
+				if el.Metric.Get(l.Name) == "" {
+					lb.Set(l.Name, l.Value)
+				}
+			}
+			outMetric = lb.Labels()
+		}
+		enh.Out = append(enh.Out, Sample{
+			Metric: outMetric,
+			Point:  Point{V: el.Point.V},
+		})
+	}
+	return enh.Out
+}
+
 // === Vector(s Scalar) Vector ===
 func funcVector(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper) Vector {
 	return append(enh.Out,
@@ -889,53 +972,56 @@ func funcYear(vals []parser.Value, args parser.Expressions, enh *EvalNodeHelper)
 
 // FunctionCalls is a list of all functions supported by PromQL, including their types.
 var FunctionCalls = map[string]FunctionCall{
-	"abs":                funcAbs,
-	"absent":             funcAbsent,
-	"absent_over_time":   funcAbsentOverTime,
-	"avg_over_time":      funcAvgOverTime,
-	"ceil":               funcCeil,
-	"changes":            funcChanges,
-	"clamp_max":          funcClampMax,
-	"clamp_min":          funcClampMin,
-	"count_over_time":    funcCountOverTime,
-	"days_in_month":      funcDaysInMonth,
-	"day_of_month":       funcDayOfMonth,
-	"day_of_week":        funcDayOfWeek,
-	"delta":              funcDelta,
-	"deriv":              funcDeriv,
-	"exp":                funcExp,
-	"floor":              funcFloor,
-	"histogram_quantile": funcHistogramQuantile,
-	"holt_winters":       funcHoltWinters,
-	"hour":               funcHour,
-	"idelta":             funcIdelta,
-	"increase":           funcIncrease,
-	"irate":              funcIrate,
-	"label_replace":      funcLabelReplace,
-	"label_join":         funcLabelJoin,
-	"ln":                 funcLn,
-	"log10":              funcLog10,
-	"log2":               funcLog2,
-	"max_over_time":      funcMaxOverTime,
-	"min_over_time":      funcMinOverTime,
-	"minute":             funcMinute,
-	"month":              funcMonth,
-	"predict_linear":     funcPredictLinear,
-	"quantile_over_time": funcQuantileOverTime,
-	"rate":               funcRate,
-	"resets":             funcResets,
-	"round":              funcRound,
-	"scalar":             funcScalar,
-	"sort":               funcSort,
-	"sort_desc":          funcSortDesc,
-	"sqrt":               funcSqrt,
-	"stddev_over_time":   funcStddevOverTime,
-	"stdvar_over_time":   funcStdvarOverTime,
-	"sum_over_time":      funcSumOverTime,
-	"time":               funcTime,
-	"timestamp":          funcTimestamp,
-	"vector":             funcVector,
-	"year":               funcYear,
+	"abs":                          funcAbs,
+	"absent":                       funcAbsent,
+	"absent_over_time":             funcAbsentOverTime,
+	"avg_over_time":                funcAvgOverTime,
+	"ceil":                         funcCeil,
+	"changes":                      funcChanges,
+	"clamp_max":                    funcClampMax,
+	"clamp_min":                    funcClampMin,
+	"count_over_time":              funcCountOverTime,
+	"days_in_month":                funcDaysInMonth,
+	"day_of_month":                 funcDayOfMonth,
+	"day_of_week":                  funcDayOfWeek,
+	"delta":                        funcDelta,
+	"deriv":                        funcDeriv,
+	"exp":                          funcExp,
+	"floor":                        funcFloor,
+	"double_exponential_smoothing": funcHoltWinters,
+	"histogram_quantile":           funcHistogramQuantile,
+	"holt_winters":                 funcHoltWinters,
+	"hour":                         funcHour,
+	"idelta":                       funcIdelta,
+	"increase":                     funcIncrease,
+	"info":                         funcInfo,
+	"irate":                        funcIrate,
+	"label_replace":                funcLabelReplace,
+	"label_join":                   funcLabelJoin,
+	"ln":                           funcLn,
+	"log10":                        funcLog10,
+	"log2":                         funcLog2,
+	"mad_over_time":                funcMadOverTime,
+	"max_over_time":                funcMaxOverTime,
+	"min_over_time":                funcMinOverTime,
+	"minute":                       funcMinute,
+	"month":                        funcMonth,
+	"predict_linear":               funcPredictLinear,
+	"quantile_over_time":           funcQuantileOverTime,
+	"rate":                         funcRate,
+	"resets":                       funcResets,
+	"round":                        funcRound,
+	"scalar":                       funcScalar,
+	"sort":                         funcSort,
+	"sort_desc":                    funcSortDesc,
+	"sqrt":                         funcSqrt,
+	"stddev_over_time":             funcStddevOverTime,
+	"stdvar_over_time":             funcStdvarOverTime,
+	"sum_over_time":                funcSumOverTime,
+	"time":                         funcTime,
+	"timestamp":                    funcTimestamp,
+	"vector":                       funcVector,
+	"year":                         funcYear,
 }
 
 type vectorByValueHeap Vector
@@ -48,7 +48,7 @@ func TestDeriv(t *testing.T) {
 
 	require.NoError(t, a.Commit())
 
-	query, err := engine.NewInstantQuery(storage, "deriv(foo[30m])", timestamp.Time(1493712846939))
+	query, err := engine.NewInstantQuery(storage, nil, "deriv(foo[30m])", timestamp.Time(1493712846939))
 	require.NoError(t, err)
 
 	result := query.Exec(context.Background())
@@ -59,6 +59,58 @@ func TestDeriv(t *testing.T) {
 	require.Equal(t, 0.0, vec[0].V, "Expected 0.0 as value, got %f", vec[0].V)
 }
 
+func TestExperimentalFunctions(t *testing.T) {
+	storage := teststorage.New(t)
+	defer storage.Close()
+	opts := EngineOpts{
+		Logger:     nil,
+		Reg:        nil,
+		MaxSamples: 10000,
+		Timeout:    10 * time.Second,
+	}
+	engine := NewEngine(opts)
+
+	a := storage.Appender(context.Background())
+	metric := labels.FromStrings("__name__", "foo")
+	for i, v := range []float64{1, 1, 1, 1, 10} {
+		a.Add(metric, int64(i*30000), v)
+	}
+	require.NoError(t, a.Commit())
+
+	// Experimental functions are rejected at parse time unless enabled.
+	_, err := engine.NewInstantQuery(storage, nil, "mad_over_time(foo[5m])", timestamp.Time(120000))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "promql-experimental-functions")
+
+	parser.EnableExperimentalFunctions = true
+	defer func() { parser.EnableExperimentalFunctions = false }()
+
+	query, err := engine.NewInstantQuery(storage, nil, "mad_over_time(foo[5m])", timestamp.Time(120000))
+	require.NoError(t, err)
+
+	result := query.Exec(context.Background())
+	require.NoError(t, result.Err)
+
+	vec, _ := result.Vector()
+	require.Equal(t, 1, len(vec), "Expected 1 result, got %d", len(vec))
+	// Median of {1, 1, 1, 1, 10} is 1, absolute deviations are
+	// {0, 0, 0, 0, 9} with median 0.
+	require.Equal(t, 0.0, vec[0].V)
+
+	// double_exponential_smoothing behaves exactly like holt_winters.
+	for _, expr := range []string{
+		"holt_winters(foo[5m], 0.5, 0.5)",
+		"double_exponential_smoothing(foo[5m], 0.5, 0.5)",
+	} {
+		query, err := engine.NewInstantQuery(storage, nil, expr, timestamp.Time(120000))
+		require.NoError(t, err)
+		result := query.Exec(context.Background())
+		require.NoError(t, result.Err)
+		vec, _ := result.Vector()
+		require.Equal(t, 1, len(vec))
+	}
+}
+
 func TestFunctionList(t *testing.T) {
 	// Test that Functions and parser.Functions list the same functions.
 	for i := range FunctionCalls {
@@ -56,7 +56,7 @@ const (
 )
 
 func fuzzParseMetricWithContentType(in []byte, contentType string) int {
-	p := textparse.New(in, contentType)
+	p := textparse.New(in, contentType, false)
 	var err error
 	for {
 		_, err = p.Next()
@@ -409,6 +409,10 @@ func lexStatements(l *Lexer) stateFn {
 		l.emit(COLON)
 		l.gotColon = true
 	case r == '(':
+		if l.bracketOpen {
+			l.backup()
+			return lexDurationExpr
+		}
 		l.emit(LEFT_PAREN)
 		l.parenDepth++
 		return lexStatements
@@ -670,13 +674,22 @@ func lexLineComment(l *Lexer) stateFn {
 }
 
 func lexDuration(l *Lexer) stateFn {
+	if l.peek() == '(' {
+		return lexDurationExpr
+	}
 	if l.scanNumber() {
+		if l.durationExprFollows() {
+			return lexDurationExpr
+		}
 		return l.errorf("missing unit character in duration")
 	}
 	if !acceptRemainingDuration(l) {
 		return l.errorf("bad duration syntax: %q", l.input[l.start:l.pos])
 	}
 	l.backup()
+	if l.durationExprFollows() {
+		return lexDurationExpr
+	}
 	l.emit(DURATION)
 	return lexStatements
 }
@@ -693,18 +706,100 @@ func lexNumber(l *Lexer) stateFn {
 // lexNumberOrDuration scans a number or a duration Item.
 func lexNumberOrDuration(l *Lexer) stateFn {
 	if l.scanNumber() {
+		if l.bracketOpen && l.durationExprFollows() {
+			return lexDurationExpr
+		}
 		l.emit(NUMBER)
 		return lexStatements
 	}
 	// Next two chars must be a valid unit and a non-alphanumeric.
 	if acceptRemainingDuration(l) {
 		l.backup()
+		if l.bracketOpen && l.durationExprFollows() {
+			return lexDurationExpr
+		}
 		l.emit(DURATION)
 		return lexStatements
 	}
 	return l.errorf("bad number or duration syntax: %q", l.input[l.start:l.pos])
 }
 
+// durationExprFollows reports whether the upcoming input continues the
+// current duration or number with an arithmetic operator.
+func (l *Lexer) durationExprFollows() bool {
+	for _, r := range l.input[l.pos:] {
+		if isSpace(r) {
+			continue
+		}
+		return r == '+' || r == '-' || r == '*' || r == '/'
+	}
+	return false
+}
+
+// lexDurationExpr scans a duration expression inside a range or subquery
+// selector. Mixed duration literals and simple arithmetic between durations
+// and numbers are emitted as a single DURATION item, which is validated and
+// evaluated when it is consumed by the parser.
+func lexDurationExpr(l *Lexer) stateFn {
+	depth := 0 // Paren depth within the expression.
+Loop:
+	for {
+		switch r := l.next(); {
+		case r == '(':
+			depth++
+		case r == ')':
+			if depth == 0 {
+				return l.errorf("unexpected right parenthesis %q in duration expression", r)
+			}
+			depth--
+		case r == ':' || r == ']':
+			if depth != 0 {
+				return l.errorf("unclosed left parenthesis in duration expression")
+			}
+			l.backup()
+			break Loop
+		case r == eof:
+			return l.errorf("unclosed left bracket")
+		case isDigit(r) || r == '.' || isSpace(r) || strings.ContainsRune("smhdwy+-*/", r):
+			// Absorb.
+		default:
+			return l.errorf("unexpected character in duration expression: %q", r)
+		}
+	}
+	l.emit(DURATION)
+	return lexStatements
+}
+
+// lexOffsetExpr scans the duration of an offset modifier. A parenthesized
+// duration expression is emitted as a single DURATION item, anything else
+// is left to the regular lexing states.
+func lexOffsetExpr(l *Lexer) stateFn {
+	if isSpace(l.peek()) {
+		skipSpaces(l)
+	}
+	if l.peek() != '(' {
+		return lexStatements
+	}
+	l.next()
+	depth := 1
+	for depth > 0 {
+		switch r := l.next(); {
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == eof:
+			return l.errorf("unclosed left parenthesis in duration expression")
+		case isDigit(r) || r == '.' || isSpace(r) || strings.ContainsRune("smhdwy+-*/", r):
+			// Absorb.
+		default:
+			return l.errorf("unexpected character in duration expression: %q", r)
+		}
+	}
+	l.emit(DURATION)
+	return lexStatements
+}
+
 func acceptRemainingDuration(l *Lexer) bool {
 	// Next two char must be a valid duration.
 	if !l.accept("smhdwy") {
@@ -778,6 +873,9 @@ Loop:
 			word := l.input[l.start:l.pos]
 			if kw, ok := key[strings.ToLower(word)]; ok {
 				l.emit(kw)
+				if kw == OFFSET && !l.seriesDesc {
+					return lexOffsetExpr
+				}
 			} else if !strings.Contains(word, ":") {
 				l.emit(IDENTIFIER)
 			} else {
@@ -15,6 +15,7 @@ package parser
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"runtime"
 	"strconv"
@@ -537,6 +538,9 @@ func (p *parser) checkAST(node Node) (typ ValueType) {
 		}
 
 	case *Call:
+		if n.Func.Experimental && !EnableExperimentalFunctions {
+			p.addParseErrf(n.PositionRange(), "function %q is not enabled, use --enable-feature=promql-experimental-functions to enable it", n.Func.Name)
+		}
 		nargs := len(n.Func.ArgTypes)
 		if n.Func.Variadic == 0 {
 			if nargs != len(n.Args) {
@@ -625,6 +629,11 @@ func (p *parser) unquoteString(s string) string {
 }
 
 func parseDuration(ds string) (time.Duration, error) {
+	// An operator or parenthesis makes it a duration expression, a plain
+	// duration literal contains neither.
+	if strings.ContainsAny(ds, "+-*/(") {
+		return parseDurationExpr(ds)
+	}
 	dur, err := model.ParseDuration(ds)
 	if err != nil {
 		return 0, err
@@ -635,6 +644,153 @@ func parseDuration(ds string) (time.Duration, error) {
 	return time.Duration(dur), nil
 }
 
+// durationExprParser evaluates simple arithmetic between duration literals
+// and numbers, as accepted in range selectors and offset modifiers.
+type durationExprParser struct {
+	input string
+	pos   int
+}
+
+func parseDurationExpr(ds string) (time.Duration, error) {
+	p := &durationExprParser{input: ds}
+	val, isDur, err := p.parseAddSub()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return 0, errors.Errorf("unexpected %q in duration expression %q", p.input[p.pos:], ds)
+	}
+	if !isDur {
+		return 0, errors.Errorf("duration expression %q does not evaluate to a duration", ds)
+	}
+	if val <= 0 {
+		return 0, errors.New("duration must be greater than 0")
+	}
+	if val > float64(math.MaxInt64) {
+		return 0, errors.Errorf("duration expression %q overflows", ds)
+	}
+	return time.Duration(val), nil
+}
+
+func (p *durationExprParser) skipSpace() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peekOp returns the upcoming operator if it is one of the given ones.
+func (p *durationExprParser) peekOp(ops string) (byte, bool) {
+	p.skipSpace()
+	if p.pos < len(p.input) && strings.IndexByte(ops, p.input[p.pos]) >= 0 {
+		return p.input[p.pos], true
+	}
+	return 0, false
+}
+
+func (p *durationExprParser) parseAddSub() (val float64, isDur bool, err error) {
+	val, isDur, err = p.parseMulDiv()
+	if err != nil {
+		return 0, false, err
+	}
+	for {
+		op, ok := p.peekOp("+-")
+		if !ok {
+			return val, isDur, nil
+		}
+		p.pos++
+		rhs, rhsDur, err := p.parseMulDiv()
+		if err != nil {
+			return 0, false, err
+		}
+		if !isDur || !rhsDur {
+			return 0, false, errors.Errorf("both operands of %q must be durations in duration expression %q", string(op), p.input)
+		}
+		if op == '+' {
+			val += rhs
+		} else {
+			val -= rhs
+		}
+	}
+}
+
+func (p *durationExprParser) parseMulDiv() (val float64, isDur bool, err error) {
+	val, isDur, err = p.parseOperand()
+	if err != nil {
+		return 0, false, err
+	}
+	for {
+		op, ok := p.peekOp("*/")
+		if !ok {
+			return val, isDur, nil
+		}
+		p.pos++
+		rhs, rhsDur, err := p.parseOperand()
+		if err != nil {
+			return 0, false, err
+		}
+		switch {
+		case op == '*' && isDur && rhsDur:
+			return 0, false, errors.Errorf("cannot multiply two durations in duration expression %q", p.input)
+		case op == '*':
+			val *= rhs
+			isDur = isDur || rhsDur
+		case rhsDur:
+			return 0, false, errors.Errorf("can only divide by a number in duration expression %q", p.input)
+		case rhs == 0:
+			return 0, false, errors.Errorf("division by zero in duration expression %q", p.input)
+		default:
+			val /= rhs
+		}
+	}
+}
+
+func (p *durationExprParser) parseOperand() (val float64, isDur bool, err error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return 0, false, errors.Errorf("unexpected end of duration expression %q", p.input)
+	}
+	if p.input[p.pos] == '(' {
+		p.pos++
+		val, isDur, err = p.parseAddSub()
+		if err != nil {
+			return 0, false, err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.input) || p.input[p.pos] != ')' {
+			return 0, false, errors.Errorf("unclosed left parenthesis in duration expression %q", p.input)
+		}
+		p.pos++
+		return val, isDur, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && (isDigit(rune(p.input[p.pos])) || p.input[p.pos] == '.') {
+		p.pos++
+	}
+	numEnd := p.pos
+	for p.pos < len(p.input) && isAlphaNumeric(rune(p.input[p.pos])) {
+		p.pos++
+	}
+	tok := p.input[start:p.pos]
+	if tok == "" {
+		return 0, false, errors.Errorf("unexpected %q in duration expression %q", p.input[p.pos:], p.input)
+	}
+	if numEnd == p.pos {
+		// No unit, it is a plain number.
+		n, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return 0, false, errors.Errorf("invalid number %q in duration expression %q", tok, p.input)
+		}
+		return n, false, nil
+	}
+	dur, err := model.ParseDuration(tok)
+	if err != nil {
+		return 0, false, err
+	}
+	return float64(time.Duration(dur)), true, nil
+}
+
 // parseGenerated invokes the yacc generated parser.
 // The generated parser gets the provided startSymbol injected into
 // the lexer stream, based on which grammar will be used.
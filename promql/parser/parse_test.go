@@ -1673,6 +1673,103 @@ var testExpr = []struct {
 			Range:  5 * 365 * 24 * time.Hour,
 			EndPos: 25,
 		},
+	}, {
+		input: "test[1h30m]",
+		expected: &MatrixSelector{
+			VectorSelector: &VectorSelector{
+				Name: "test",
+				LabelMatchers: []*labels.Matcher{
+					mustLabelMatcher(labels.MatchEqual, string(model.MetricNameLabel), "test"),
+				},
+				PosRange: PositionRange{
+					Start: 0,
+					End:   4,
+				},
+			},
+			Range:  time.Hour + 30*time.Minute,
+			EndPos: 11,
+		},
+	}, {
+		input: "test[2*30m]",
+		expected: &MatrixSelector{
+			VectorSelector: &VectorSelector{
+				Name: "test",
+				LabelMatchers: []*labels.Matcher{
+					mustLabelMatcher(labels.MatchEqual, string(model.MetricNameLabel), "test"),
+				},
+				PosRange: PositionRange{
+					Start: 0,
+					End:   4,
+				},
+			},
+			Range:  time.Hour,
+			EndPos: 11,
+		},
+	}, {
+		input: "test[1h+30m]",
+		expected: &MatrixSelector{
+			VectorSelector: &VectorSelector{
+				Name: "test",
+				LabelMatchers: []*labels.Matcher{
+					mustLabelMatcher(labels.MatchEqual, string(model.MetricNameLabel), "test"),
+				},
+				PosRange: PositionRange{
+					Start: 0,
+					End:   4,
+				},
+			},
+			Range:  time.Hour + 30*time.Minute,
+			EndPos: 12,
+		},
+	}, {
+		input: "test[(1h + 30m) / 2]",
+		expected: &MatrixSelector{
+			VectorSelector: &VectorSelector{
+				Name: "test",
+				LabelMatchers: []*labels.Matcher{
+					mustLabelMatcher(labels.MatchEqual, string(model.MetricNameLabel), "test"),
+				},
+				PosRange: PositionRange{
+					Start: 0,
+					End:   4,
+				},
+			},
+			Range:  45 * time.Minute,
+			EndPos: 20,
+		},
+	}, {
+		input: "test[1h] offset (30m+15m)",
+		expected: &MatrixSelector{
+			VectorSelector: &VectorSelector{
+				Name:   "test",
+				Offset: 45 * time.Minute,
+				LabelMatchers: []*labels.Matcher{
+					mustLabelMatcher(labels.MatchEqual, string(model.MetricNameLabel), "test"),
+				},
+				PosRange: PositionRange{
+					Start: 0,
+					End:   4,
+				},
+			},
+			Range:  time.Hour,
+			EndPos: 25,
+		},
+	}, {
+		input:  `foo[1h+2]`,
+		fail:   true,
+		errMsg: "both operands of \"+\" must be durations in duration expression \"1h+2\"",
+	}, {
+		input:  `foo[5m*5m]`,
+		fail:   true,
+		errMsg: "cannot multiply two durations in duration expression \"5m*5m\"",
+	}, {
+		input:  `foo[1h/0]`,
+		fail:   true,
+		errMsg: "division by zero in duration expression \"1h/0\"",
+	}, {
+		input:  `foo[30m-1h]`,
+		fail:   true,
+		errMsg: "duration must be greater than 0",
 	}, {
 		input:  `foo[5mm]`,
 		fail:   true,
@@ -445,7 +445,7 @@ func (t *Test) exec(tc testCommand) error {
 		}
 
 	case *evalCmd:
-		q, err := t.QueryEngine().NewInstantQuery(t.storage, cmd.expr, cmd.start)
+		q, err := t.QueryEngine().NewInstantQuery(t.storage, nil, cmd.expr, cmd.start)
 		if err != nil {
 			return err
 		}
@@ -468,7 +468,7 @@ func (t *Test) exec(tc testCommand) error {
 
 		// Check query returns same result in range mode,
 		// by checking against the middle step.
-		q, err = t.queryEngine.NewRangeQuery(t.storage, cmd.expr, cmd.start.Add(-time.Minute), cmd.start.Add(time.Minute), time.Minute)
+		q, err = t.queryEngine.NewRangeQuery(t.storage, nil, cmd.expr, cmd.start.Add(-time.Minute), cmd.start.Add(time.Minute), time.Minute)
 		if err != nil {
 			return err
 		}
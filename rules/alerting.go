@@ -91,6 +91,9 @@ type Alert struct {
 	ResolvedAt time.Time
 	LastSentAt time.Time
 	ValidUntil time.Time
+	// The time at which the expression last stopped returning results for
+	// the labelset while keep_firing_for kept the alert firing.
+	KeepFiringSince time.Time
 }
 
 func (a *Alert) needsSending(ts time.Time, resendDelay time.Duration) bool {
@@ -112,9 +115,16 @@ type AlertingRule struct {
 	name string
 	// The vector expression from which to generate alerts.
 	vector parser.Expr
+	// An optional expression providing hysteresis: a firing alert whose
+	// labelset is absent from the alert expression only resolves once the
+	// clear expression returns results for it.
+	clearVector parser.Expr
 	// The duration for which a labelset needs to persist in the expression
 	// output vector before an alert transitions from Pending to Firing state.
 	holdDuration time.Duration
+	// The duration for which the alert keeps firing after the expression
+	// no longer returns results for its labelset.
+	keepFiringFor time.Duration
 	// Extra labels to attach to the resulting alert sample vectors.
 	labels labels.Labels
 	// Non-identifying key/value pairs.
@@ -143,7 +153,7 @@ type AlertingRule struct {
 
 // NewAlertingRule constructs a new AlertingRule.
 func NewAlertingRule(
-	name string, vec parser.Expr, hold time.Duration,
+	name string, vec parser.Expr, hold, keepFiringFor time.Duration,
 	labels, annotations, externalLabels labels.Labels,
 	restored bool, logger log.Logger,
 ) *AlertingRule {
@@ -156,6 +166,7 @@ func NewAlertingRule(
 		name:           name,
 		vector:         vec,
 		holdDuration:   hold,
+		keepFiringFor:  keepFiringFor,
 		labels:         labels,
 		annotations:    annotations,
 		externalLabels: el,
@@ -171,6 +182,17 @@ func (r *AlertingRule) Name() string {
 	return r.name
 }
 
+// SetClearExpr sets the expression whose results resolve firing alerts. It
+// must be called before the rule is first evaluated.
+func (r *AlertingRule) SetClearExpr(vec parser.Expr) {
+	r.clearVector = vec
+}
+
+// ClearExpr returns the clear expression of the alerting rule, nil if unset.
+func (r *AlertingRule) ClearExpr() parser.Expr {
+	return r.clearVector
+}
+
 // SetLastError sets the current error seen by the alerting rule.
 func (r *AlertingRule) SetLastError(err error) {
 	r.mtx.Lock()
@@ -209,6 +231,12 @@ func (r *AlertingRule) HoldDuration() time.Duration {
 	return r.holdDuration
 }
 
+// KeepFiringFor returns the duration an alerting rule keeps firing after
+// its expression no longer returns results.
+func (r *AlertingRule) KeepFiringFor() time.Duration {
+	return r.keepFiringFor
+}
+
 // Labels returns the labels of the alerting rule.
 func (r *AlertingRule) Labels() labels.Labels {
 	return r.labels
@@ -292,6 +320,64 @@ func (r *AlertingRule) SetRestored(restored bool) {
 // is kept in memory state and consequently repeatedly sent to the AlertManager.
 const resolvedRetention = 15 * time.Minute
 
+// templateExpander returns a function that expands alert templates against
+// the labels and value of the given sample.
+func (r *AlertingRule) templateExpander(ctx context.Context, query QueryFunc, ts time.Time, externalURL *url.URL, smpl promql.Sample) func(string) string {
+	// Provide the alert information to the template.
+	l := make(map[string]string, len(smpl.Metric))
+	for _, lbl := range smpl.Metric {
+		l[lbl.Name] = lbl.Value
+	}
+
+	tmplData := template.AlertTemplateData(l, r.externalLabels, smpl.V)
+	// Inject some convenience variables that are easier to remember for users
+	// who are not used to Go's templating system.
+	defs := []string{
+		"{{$labels := .Labels}}",
+		"{{$externalLabels := .ExternalLabels}}",
+		"{{$value := .Value}}",
+	}
+
+	return func(text string) string {
+		tmpl := template.NewTemplateExpander(
+			ctx,
+			strings.Join(append(defs, text), ""),
+			"__alert_"+r.Name(),
+			tmplData,
+			model.Time(timestamp.FromTime(ts)),
+			template.QueryFunc(query),
+			externalURL,
+		)
+		result, err := tmpl.Expand()
+		if err != nil {
+			result = fmt.Sprintf("<error expanding template: %s>", err)
+			level.Warn(r.logger).Log("msg", "Expanding alert template failed", "err", err, "data", tmplData)
+		}
+		return result
+	}
+}
+
+// clearFingerprints evaluates the clear expression and returns the set of
+// alert label fingerprints for which it currently returns results.
+func (r *AlertingRule) clearFingerprints(ctx context.Context, ts time.Time, query QueryFunc, externalURL *url.URL) (map[uint64]struct{}, error) {
+	res, err := query(ctx, r.clearVector.String(), ts)
+	if err != nil {
+		return nil, err
+	}
+	fps := make(map[uint64]struct{}, len(res))
+	for _, smpl := range res {
+		expand := r.templateExpander(ctx, query, ts, externalURL, smpl)
+
+		lb := labels.NewBuilder(smpl.Metric).Del(labels.MetricName)
+		for _, l := range r.labels {
+			lb.Set(l.Name, expand(l.Value))
+		}
+		lb.Set(labels.AlertName, r.Name())
+		fps[lb.Labels().Hash()] = struct{}{}
+	}
+	return fps, nil
+}
+
 // Eval evaluates the rule expression and then creates pending alerts and fires
 // or removes previously pending alerts accordingly.
 func (r *AlertingRule) Eval(ctx context.Context, ts time.Time, query QueryFunc, externalURL *url.URL) (promql.Vector, error) {
@@ -312,38 +398,7 @@ func (r *AlertingRule) Eval(ctx context.Context, ts time.Time, query QueryFunc,
 	var vec promql.Vector
 	var alerts = make(map[uint64]*Alert, len(res))
 	for _, smpl := range res {
-		// Provide the alert information to the template.
-		l := make(map[string]string, len(smpl.Metric))
-		for _, lbl := range smpl.Metric {
-			l[lbl.Name] = lbl.Value
-		}
-
-		tmplData := template.AlertTemplateData(l, r.externalLabels, smpl.V)
-		// Inject some convenience variables that are easier to remember for users
-		// who are not used to Go's templating system.
-		defs := []string{
-			"{{$labels := .Labels}}",
-			"{{$externalLabels := .ExternalLabels}}",
-			"{{$value := .Value}}",
-		}
-
-		expand := func(text string) string {
-			tmpl := template.NewTemplateExpander(
-				ctx,
-				strings.Join(append(defs, text), ""),
-				"__alert_"+r.Name(),
-				tmplData,
-				model.Time(timestamp.FromTime(ts)),
-				template.QueryFunc(query),
-				externalURL,
-			)
-			result, err := tmpl.Expand()
-			if err != nil {
-				result = fmt.Sprintf("<error expanding template: %s>", err)
-				level.Warn(r.logger).Log("msg", "Expanding alert template failed", "err", err, "data", tmplData)
-			}
-			return result
-		}
+		expand := r.templateExpander(ctx, query, ts, externalURL, smpl)
 
 		lb := labels.NewBuilder(smpl.Metric).Del(labels.MetricName)
 
@@ -391,19 +446,65 @@ func (r *AlertingRule) Eval(ctx context.Context, ts time.Time, query QueryFunc,
 		r.active[h] = a
 	}
 
+	// With a clear expression set, a firing alert whose labelset is absent
+	// from the alert expression only resolves once the clear expression
+	// returns results for it. Evaluate it lazily; the extra query is only
+	// needed when such an alert exists.
+	var clearFPs map[uint64]struct{}
+	if r.clearVector != nil {
+		for fp, a := range r.active {
+			if _, ok := resultFPs[fp]; ok || a.State != StateFiring {
+				continue
+			}
+			if clearFPs, err = r.clearFingerprints(ctx, ts, query, externalURL); err != nil {
+				r.health = HealthBad
+				r.lastError = err
+				return nil, err
+			}
+			break
+		}
+	}
+
 	// Check if any pending alerts should be removed or fire now. Write out alert timeseries.
 	for fp, a := range r.active {
 		if _, ok := resultFPs[fp]; !ok {
+			// The expression no longer returns results for this labelset. If
+			// keep_firing_for is set, a firing alert keeps firing until the
+			// expression has been absent for that long.
+			var keepFiring bool
+			if a.State == StateFiring && r.keepFiringFor > 0 {
+				if a.KeepFiringSince.IsZero() {
+					a.KeepFiringSince = ts
+				}
+				if ts.Sub(a.KeepFiringSince) < r.keepFiringFor {
+					keepFiring = true
+				}
+			}
+
+			// Hysteresis: hold a firing alert until the clear expression
+			// confirms the resolution.
+			if a.State == StateFiring && r.clearVector != nil {
+				if _, cleared := clearFPs[fp]; !cleared {
+					keepFiring = true
+				}
+			}
+
 			// If the alert was previously firing, keep it around for a given
 			// retention time so it is reported as resolved to the AlertManager.
 			if a.State == StatePending || (!a.ResolvedAt.IsZero() && ts.Sub(a.ResolvedAt) > resolvedRetention) {
 				delete(r.active, fp)
 			}
-			if a.State != StateInactive {
+			if a.State != StateInactive && !keepFiring {
 				a.State = StateInactive
 				a.ResolvedAt = ts
 			}
-			continue
+			if !keepFiring {
+				continue
+			}
+		} else {
+			// The expression is returning results again, reset the keep
+			// firing tracking.
+			a.KeepFiringSince = time.Time{}
 		}
 
 		if a.State == StatePending && ts.Sub(a.ActiveAt) >= r.holdDuration {
@@ -497,12 +598,18 @@ func (r *AlertingRule) sendAlerts(ctx context.Context, ts time.Time, resendDelay
 }
 
 func (r *AlertingRule) String() string {
+	clearExpr := ""
+	if r.clearVector != nil {
+		clearExpr = r.clearVector.String()
+	}
 	ar := rulefmt.Rule{
-		Alert:       r.name,
-		Expr:        r.vector.String(),
-		For:         model.Duration(r.holdDuration),
-		Labels:      r.labels.Map(),
-		Annotations: r.annotations.Map(),
+		Alert:         r.name,
+		Expr:          r.vector.String(),
+		ClearExpr:     clearExpr,
+		For:           model.Duration(r.holdDuration),
+		KeepFiringFor: model.Duration(r.keepFiringFor),
+		Labels:        r.labels.Map(),
+		Annotations:   r.annotations.Map(),
 	}
 
 	byt, err := yaml.Marshal(ar)
@@ -532,12 +639,19 @@ func (r *AlertingRule) HTMLSnippet(pathPrefix string) html_template.HTML {
 		annotationsMap[l.Name] = html_template.HTMLEscapeString(l.Value)
 	}
 
+	clearExpr := ""
+	if r.clearVector != nil {
+		clearExpr = fmt.Sprintf("<a href=%q>%s</a>", pathPrefix+strutil.TableLinkForExpression(r.clearVector.String()), html_template.HTMLEscapeString(r.clearVector.String()))
+	}
+
 	ar := rulefmt.Rule{
-		Alert:       fmt.Sprintf("<a href=%q>%s</a>", pathPrefix+strutil.TableLinkForExpression(alertMetric.String()), r.name),
-		Expr:        fmt.Sprintf("<a href=%q>%s</a>", pathPrefix+strutil.TableLinkForExpression(r.vector.String()), html_template.HTMLEscapeString(r.vector.String())),
-		For:         model.Duration(r.holdDuration),
-		Labels:      labelsMap,
-		Annotations: annotationsMap,
+		Alert:         fmt.Sprintf("<a href=%q>%s</a>", pathPrefix+strutil.TableLinkForExpression(alertMetric.String()), r.name),
+		Expr:          fmt.Sprintf("<a href=%q>%s</a>", pathPrefix+strutil.TableLinkForExpression(r.vector.String()), html_template.HTMLEscapeString(r.vector.String())),
+		ClearExpr:     clearExpr,
+		For:           model.Duration(r.holdDuration),
+		KeepFiringFor: model.Duration(r.keepFiringFor),
+		Labels:        labelsMap,
+		Annotations:   annotationsMap,
 	}
 
 	byt, err := yaml.Marshal(ar)
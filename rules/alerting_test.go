@@ -32,7 +32,7 @@ import (
 func TestAlertingRuleHTMLSnippet(t *testing.T) {
 	expr, err := parser.ParseExpr(`foo{html="<b>BOLD<b>"}`)
 	require.NoError(t, err)
-	rule := NewAlertingRule("testrule", expr, 0, labels.FromStrings("html", "<b>BOLD</b>"), labels.FromStrings("html", "<b>BOLD</b>"), nil, false, nil)
+	rule := NewAlertingRule("testrule", expr, 0, 0, labels.FromStrings("html", "<b>BOLD</b>"), labels.FromStrings("html", "<b>BOLD</b>"), nil, false, nil)
 
 	const want = template.HTML(`alert: <a href="/test/prefix/graph?g0.expr=ALERTS%7Balertname%3D%22testrule%22%7D&g0.tab=1">testrule</a>
 expr: <a href="/test/prefix/graph?g0.expr=foo%7Bhtml%3D%22%3Cb%3EBOLD%3Cb%3E%22%7D&g0.tab=1">foo{html=&#34;&lt;b&gt;BOLD&lt;b&gt;&#34;}</a>
@@ -79,7 +79,7 @@ func TestAlertingRuleState(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		rule := NewAlertingRule(test.name, nil, 0, nil, nil, nil, true, nil)
+		rule := NewAlertingRule(test.name, nil, 0, 0, nil, nil, nil, true, nil)
 		rule.active = test.active
 		got := rule.State()
 		require.Equal(t, test.want, got, "test case %d unexpected AlertState, want:%d got:%d", i, test.want, got)
@@ -103,6 +103,7 @@ func TestAlertingRuleLabelsUpdate(t *testing.T) {
 		"HTTPRequestRateLow",
 		expr,
 		time.Minute,
+		0,
 		// Basing alerting rule labels off of a value that can change is a very bad idea.
 		// If an alert is going back and forth between two label values it will never fire.
 		// Instead, you should write two alerts with constant labels.
@@ -205,6 +206,7 @@ func TestAlertingRuleExternalLabelsInTemplate(t *testing.T) {
 		"ExternalLabelDoesNotExist",
 		expr,
 		time.Minute,
+		0,
 		labels.FromStrings("templated_label", "There are {{ len $externalLabels }} external Labels, of which foo is {{ $externalLabels.foo }}."),
 		nil,
 		nil,
@@ -214,6 +216,7 @@ func TestAlertingRuleExternalLabelsInTemplate(t *testing.T) {
 		"ExternalLabelExists",
 		expr,
 		time.Minute,
+		0,
 		labels.FromStrings("templated_label", "There are {{ len $externalLabels }} external Labels, of which foo is {{ $externalLabels.foo }}."),
 		nil,
 		labels.FromStrings("foo", "bar", "dings", "bums"),
@@ -297,6 +300,7 @@ func TestAlertingRuleEmptyLabelFromTemplate(t *testing.T) {
 		"EmptyLabel",
 		expr,
 		time.Minute,
+		0,
 		labels.FromStrings("empty_label", ""),
 		nil,
 		nil,
@@ -357,6 +361,7 @@ func TestAlertingRuleDuplicate(t *testing.T) {
 		"foo",
 		expr,
 		time.Minute,
+		0,
 		labels.FromStrings("test", "test"),
 		nil,
 		nil,
@@ -366,3 +371,111 @@ func TestAlertingRuleDuplicate(t *testing.T) {
 	require.Error(t, err)
 	require.EqualError(t, err, "vector contains metrics with the same labelset after applying alert labels")
 }
+
+func TestAlertingRuleClearExpr(t *testing.T) {
+	suite, err := promql.NewTest(t, `
+		load 1m
+			cpu_usage{job="app-server", instance="0"}	95 88 88 80 95 88 80
+	`)
+	require.NoError(t, err)
+	defer suite.Close()
+
+	require.NoError(t, suite.Run())
+
+	expr, err := parser.ParseExpr(`cpu_usage > 90`)
+	require.NoError(t, err)
+	clearExpr, err := parser.ParseExpr(`cpu_usage < 85`)
+	require.NoError(t, err)
+
+	rule := NewAlertingRule(
+		"CPUUsageHigh",
+		expr,
+		0, 0,
+		nil,
+		nil,
+		nil,
+		true, nil,
+	)
+	rule.SetClearExpr(clearExpr)
+
+	baseTime := time.Unix(0, 0)
+
+	var tests = []struct {
+		time  time.Duration
+		state AlertState
+	}{
+		{0, StateFiring},
+		// The alert expression no longer returns results, but the clear
+		// expression does not either, so the alert keeps firing.
+		{time.Minute, StateFiring},
+		{2 * time.Minute, StateFiring},
+		// The clear expression returns a result, the alert resolves.
+		{3 * time.Minute, StateInactive},
+		// A new cycle starts.
+		{4 * time.Minute, StateFiring},
+		{5 * time.Minute, StateFiring},
+		{6 * time.Minute, StateInactive},
+	}
+
+	for i, test := range tests {
+		t.Logf("case %d", i)
+
+		evalTime := baseTime.Add(test.time)
+		_, err := rule.Eval(suite.Context(), evalTime, EngineQueryFunc(suite.QueryEngine(), suite.Storage()), nil)
+		require.NoError(t, err)
+		require.Equal(t, test.state, rule.State())
+	}
+}
+
+func TestKeepFiringFor(t *testing.T) {
+	suite, err := promql.NewTest(t, `
+		load 1m
+			http_requests{job="app-server", instance="0"}	75 85 70 70 10x5
+	`)
+	require.NoError(t, err)
+	defer suite.Close()
+
+	require.NoError(t, suite.Run())
+
+	expr, err := parser.ParseExpr(`http_requests > 50`)
+	require.NoError(t, err)
+
+	rule := NewAlertingRule(
+		"HTTPRequestRateHigh",
+		expr,
+		time.Minute,
+		// Initial alert lasts for three minutes, spread over two evaluations,
+		// and is then kept firing for another two.
+		2*time.Minute,
+		nil,
+		nil,
+		nil,
+		true, nil,
+	)
+
+	baseTime := time.Unix(0, 0)
+
+	var tests = []struct {
+		time  time.Duration
+		state AlertState
+	}{
+		{0, StatePending},
+		{time.Minute, StateFiring},
+		{2 * time.Minute, StateFiring},
+		{3 * time.Minute, StateFiring},
+		// The expression no longer returns a result, but the alert is kept
+		// firing for another two minutes.
+		{4 * time.Minute, StateFiring},
+		{5 * time.Minute, StateFiring},
+		{6 * time.Minute, StateInactive},
+	}
+
+	for i, test := range tests {
+		t.Logf("case %d", i)
+
+		evalTime := baseTime.Add(test.time)
+		_, err := rule.Eval(suite.Context(), evalTime, EngineQueryFunc(suite.QueryEngine(), suite.Storage()), nil)
+		require.NoError(t, err)
+		require.Equal(t, test.state, rule.State())
+	}
+}
@@ -179,12 +179,20 @@ func NewGroupMetrics(reg prometheus.Registerer) *Metrics {
 // QueryFunc processes PromQL queries.
 type QueryFunc func(ctx context.Context, q string, t time.Time) (promql.Vector, error)
 
+// lookbackDeltaKey is the context key under which a group's lookback delta
+// override is passed from Group.Eval to EngineQueryFunc.
+type lookbackDeltaKey struct{}
+
 // EngineQueryFunc returns a new query function that executes instant queries against
 // the given engine.
 // It converts scalar into vector results.
 func EngineQueryFunc(engine *promql.Engine, q storage.Queryable) QueryFunc {
 	return func(ctx context.Context, qs string, t time.Time) (promql.Vector, error) {
-		q, err := engine.NewInstantQuery(q, qs, t)
+		var opts *promql.QueryOpts
+		if ld, ok := ctx.Value(lookbackDeltaKey{}).(time.Duration); ok {
+			opts = &promql.QueryOpts{LookbackDelta: ld}
+		}
+		q, err := engine.NewInstantQuery(q, opts, qs, t)
 		if err != nil {
 			return nil, err
 		}
@@ -242,6 +250,9 @@ type Group struct {
 	name                 string
 	file                 string
 	interval             time.Duration
+	evalOffset           time.Duration
+	lookbackDelta        time.Duration
+	dependsOn            []string
 	rules                []Rule
 	seriesInPreviousEval []map[string]labels.Labels // One per Rule.
 	staleSeries          []labels.Labels
@@ -257,6 +268,16 @@ type Group struct {
 	terminated  chan struct{}
 	managerDone chan struct{}
 
+	// depMtx guards the dependency bookkeeping below. dependents are the
+	// groups that list this group in their depends_on clause. depPending
+	// counts, per interval slot, how many of this group's own dependencies
+	// have finished; once all have, the latest of their evaluation
+	// timestamps is sent on depTrigger to schedule an evaluation.
+	depMtx     sync.Mutex
+	dependents []*Group
+	depPending map[int64]depSlot
+	depTrigger chan time.Time
+
 	logger log.Logger
 
 	metrics *Metrics
@@ -265,6 +286,9 @@ type Group struct {
 type GroupOptions struct {
 	Name, File    string
 	Interval      time.Duration
+	EvalOffset    time.Duration
+	LookbackDelta time.Duration
+	DependsOn     []string
 	Rules         []Rule
 	ShouldRestore bool
 	Opts          *ManagerOptions
@@ -293,6 +317,9 @@ func NewGroup(o GroupOptions) *Group {
 		name:                 o.Name,
 		file:                 o.File,
 		interval:             o.Interval,
+		evalOffset:           o.EvalOffset,
+		lookbackDelta:        o.LookbackDelta,
+		dependsOn:            o.DependsOn,
 		rules:                o.Rules,
 		shouldRestore:        o.ShouldRestore,
 		opts:                 o.Opts,
@@ -300,6 +327,8 @@ func NewGroup(o GroupOptions) *Group {
 		done:                 make(chan struct{}),
 		managerDone:          o.done,
 		terminated:           make(chan struct{}),
+		depPending:           make(map[int64]depSlot),
+		depTrigger:           make(chan time.Time, 1),
 		logger:               log.With(o.Opts.Logger, "group", o.Name),
 		metrics:              metrics,
 	}
@@ -317,15 +346,84 @@ func (g *Group) Rules() []Rule { return g.rules }
 // Interval returns the group's interval.
 func (g *Group) Interval() time.Duration { return g.interval }
 
+// EvalOffset returns the offset of the group's evaluation timestamps
+// relative to the aligned interval slots, 0 if unset.
+func (g *Group) EvalOffset() time.Duration { return g.evalOffset }
+
+// LookbackDelta returns the group's lookback delta override, 0 if unset.
+func (g *Group) LookbackDelta() time.Duration { return g.lookbackDelta }
+
+// DependsOn returns the names of the groups this group depends on.
+func (g *Group) DependsOn() []string { return g.dependsOn }
+
+// setDependents replaces the set of groups notified after each evaluation.
+func (g *Group) setDependents(deps []*Group) {
+	g.depMtx.Lock()
+	g.dependents = deps
+	g.depMtx.Unlock()
+}
+
+// depSlot tracks, for one interval slot, how many dependencies have finished
+// and the latest of their evaluation timestamps.
+type depSlot struct {
+	count  int
+	latest time.Time
+}
+
+// dependencyDone signals that one of the group's dependencies finished its
+// evaluation for the given timestamp. Dependencies evaluate at their own
+// offset within the shared interval, so completion is tracked per interval
+// slot rather than per timestamp. Once all dependencies have reported for a
+// slot, the group schedules its own evaluation at the latest of their
+// timestamps, so it sees all of their output.
+func (g *Group) dependencyDone(ts time.Time) {
+	slot := ts.Truncate(g.interval).UnixNano()
+
+	g.depMtx.Lock()
+	s := g.depPending[slot]
+	s.count++
+	if ts.After(s.latest) {
+		s.latest = ts
+	}
+	done := s.count == len(g.dependsOn)
+	if done {
+		delete(g.depPending, slot)
+	} else {
+		g.depPending[slot] = s
+	}
+	// Drop slots old enough that they can no longer complete, e.g. because
+	// a dependency missed an evaluation; they would otherwise accumulate
+	// forever.
+	for k := range g.depPending {
+		if k < slot-2*int64(g.interval) {
+			delete(g.depPending, k)
+		}
+	}
+	g.depMtx.Unlock()
+
+	if !done {
+		return
+	}
+	select {
+	case g.depTrigger <- s.latest:
+	default:
+		// The group is still busy with a previous evaluation.
+		g.metrics.iterationsMissed.WithLabelValues(groupKey(g.file, g.name)).Inc()
+		g.metrics.iterationsScheduled.WithLabelValues(groupKey(g.file, g.name)).Inc()
+	}
+}
+
 func (g *Group) run(ctx context.Context) {
 	defer close(g.terminated)
 
 	// Wait an initial amount to have consistently slotted intervals.
 	evalTimestamp := g.evalTimestamp().Add(g.interval)
-	select {
-	case <-time.After(time.Until(evalTimestamp)):
-	case <-g.done:
-		return
+	if len(g.dependsOn) == 0 {
+		select {
+		case <-time.After(time.Until(evalTimestamp)):
+		case <-g.done:
+			return
+		}
 	}
 
 	ctx = promql.NewOriginContext(ctx, map[string]interface{}{
@@ -335,23 +433,24 @@ func (g *Group) run(ctx context.Context) {
 		},
 	})
 
-	iter := func() {
+	iter := func(ts time.Time) {
 		g.metrics.iterationsScheduled.WithLabelValues(groupKey(g.file, g.name)).Inc()
 
 		start := time.Now()
-		g.Eval(ctx, evalTimestamp)
+		g.Eval(ctx, ts)
 		timeSinceStart := time.Since(start)
 
 		g.metrics.iterationDuration.Observe(timeSinceStart.Seconds())
 		g.setEvaluationTime(timeSinceStart)
 		g.setLastEvaluation(start)
-	}
 
-	// The assumption here is that since the ticker was started after having
-	// waited for `evalTimestamp` to pass, the ticks will trigger soon
-	// after each `evalTimestamp + N * g.interval` occurrence.
-	tick := time.NewTicker(g.interval)
-	defer tick.Stop()
+		g.depMtx.Lock()
+		dependents := append([]*Group(nil), g.dependents...)
+		g.depMtx.Unlock()
+		for _, dep := range dependents {
+			dep.dependencyDone(ts)
+		}
+	}
 
 	defer func() {
 		if !g.markStale {
@@ -376,7 +475,37 @@ func (g *Group) run(ctx context.Context) {
 		}(time.Now())
 	}()
 
-	iter()
+	if len(g.dependsOn) > 0 {
+		// Groups with dependencies do not run on their own schedule. They
+		// are evaluated whenever all of their dependencies have finished an
+		// evaluation for an interval slot, reusing the latest of those
+		// evaluations' timestamps so every stage of the pipeline sees a
+		// consistent view of the interval.
+		evals := 0
+		for {
+			select {
+			case <-g.done:
+				return
+			case ts := <-g.depTrigger:
+				iter(ts)
+				evals++
+				if g.shouldRestore && evals > 1 {
+					// As on the timer-driven path below, wait for a second
+					// evaluation before restoring alert state.
+					g.RestoreForState(time.Now())
+					g.shouldRestore = false
+				}
+			}
+		}
+	}
+
+	// The assumption here is that since the ticker was started after having
+	// waited for `evalTimestamp` to pass, the ticks will trigger soon
+	// after each `evalTimestamp + N * g.interval` occurrence.
+	tick := time.NewTicker(g.interval)
+	defer tick.Stop()
+
+	iter(evalTimestamp)
 	if g.shouldRestore {
 		// If we have to restore, we wait for another Eval to finish.
 		// The reason behind this is, during first eval (or before it)
@@ -392,7 +521,7 @@ func (g *Group) run(ctx context.Context) {
 				g.metrics.iterationsScheduled.WithLabelValues(groupKey(g.file, g.name)).Add(float64(missed))
 			}
 			evalTimestamp = evalTimestamp.Add((missed + 1) * g.interval)
-			iter()
+			iter(evalTimestamp)
 		}
 
 		g.RestoreForState(time.Now())
@@ -414,7 +543,7 @@ func (g *Group) run(ctx context.Context) {
 					g.metrics.iterationsScheduled.WithLabelValues(groupKey(g.file, g.name)).Add(float64(missed))
 				}
 				evalTimestamp = evalTimestamp.Add((missed + 1) * g.interval)
-				iter()
+				iter(evalTimestamp)
 			}
 		}
 	}
@@ -499,8 +628,15 @@ func (g *Group) setLastEvaluation(ts time.Time) {
 
 // evalTimestamp returns the immediately preceding consistently slotted evaluation time.
 func (g *Group) evalTimestamp() time.Time {
+	// A configured eval offset pins the evaluation timestamps relative to
+	// the aligned interval slots. Otherwise the offset is derived from the
+	// group's hash to spread evaluations over the interval.
+	offset := int64(g.hash() % uint64(g.interval))
+	if g.evalOffset > 0 {
+		offset = int64(g.evalOffset)
+	}
+
 	var (
-		offset = int64(g.hash() % uint64(g.interval))
 		now    = time.Now().UnixNano()
 		adjNow = now - offset
 		base   = adjNow - (adjNow % int64(g.interval))
@@ -568,6 +704,9 @@ func (g *Group) CopyState(from *Group) {
 
 // Eval runs a single evaluation cycle in which all rules are evaluated sequentially.
 func (g *Group) Eval(ctx context.Context, ts time.Time) {
+	if g.lookbackDelta > 0 {
+		ctx = context.WithValue(ctx, lookbackDeltaKey{}, g.lookbackDelta)
+	}
 	var samplesTotal float64
 	for i, rule := range g.rules {
 		select {
@@ -838,10 +977,28 @@ func (g *Group) Equals(ng *Group) bool {
 		return false
 	}
 
+	if g.evalOffset != ng.evalOffset {
+		return false
+	}
+
+	if g.lookbackDelta != ng.lookbackDelta {
+		return false
+	}
+
 	if len(g.rules) != len(ng.rules) {
 		return false
 	}
 
+	if len(g.dependsOn) != len(ng.dependsOn) {
+		return false
+	}
+
+	for i, dep := range g.dependsOn {
+		if dep != ng.dependsOn[i] {
+			return false
+		}
+	}
+
 	for i, gr := range g.rules {
 		if gr.String() != ng.rules[i].String() {
 			return false
@@ -949,7 +1106,10 @@ func (m *Manager) Update(interval time.Duration, files []string, externalLabels
 	}
 	m.restored = true
 
-	var wg sync.WaitGroup
+	type groupUpdate struct {
+		newg, oldg *Group
+	}
+	var updates []groupUpdate
 	for _, newg := range groups {
 		// If there is an old group with the same identifier,
 		// check if new group equals with the old group, if yes then skip it.
@@ -964,9 +1124,30 @@ func (m *Manager) Update(interval time.Duration, files []string, externalLabels
 			continue
 		}
 
+		if !ok {
+			oldg = nil
+		}
+		updates = append(updates, groupUpdate{newg: newg, oldg: oldg})
+	}
+
+	// Rewire dependency notifications on the final set of groups so that
+	// retained groups trigger the new generation of their dependents.
+	dependents := make(map[string][]*Group)
+	for _, g := range groups {
+		for _, dep := range g.dependsOn {
+			dk := groupKey(g.file, dep)
+			dependents[dk] = append(dependents[dk], g)
+		}
+	}
+	for gn, g := range groups {
+		g.setDependents(dependents[gn])
+	}
+
+	var wg sync.WaitGroup
+	for _, u := range updates {
 		wg.Add(1)
-		go func(newg *Group) {
-			if ok {
+		go func(newg, oldg *Group) {
+			if oldg != nil {
 				oldg.stop()
 				newg.CopyState(oldg)
 			}
@@ -976,7 +1157,7 @@ func (m *Manager) Update(interval time.Duration, files []string, externalLabels
 			// queries against a bootstrapping storage.
 			<-m.block
 			newg.run(m.opts.Context)
-		}(newg)
+		}(u.newg, u.oldg)
 	}
 
 	// Stop remaining old groups.
@@ -1036,11 +1217,35 @@ func (m *Manager) LoadGroups(
 			return nil, errs
 		}
 
+		// Effective intervals per group name, for validating dependencies.
+		itvs := make(map[string]time.Duration, len(rgs.Groups))
 		for _, rg := range rgs.Groups {
 			itv := interval
 			if rg.Interval != 0 {
 				itv = time.Duration(rg.Interval)
 			}
+			itvs[rg.Name] = itv
+		}
+
+		for _, rg := range rgs.Groups {
+			itv := itvs[rg.Name]
+
+			if rg.EvalOffset > 0 && time.Duration(rg.EvalOffset) >= itv {
+				return nil, []error{errors.Errorf("%s: group %q: eval_offset must be smaller than the evaluation interval", fn, rg.Name)}
+			}
+
+			// Dependencies may only reference groups in the same file and
+			// must share the dependent group's evaluation interval as both
+			// are evaluated at the same timestamps.
+			for _, dep := range rg.DependsOn {
+				depItv, ok := itvs[dep]
+				if !ok {
+					return nil, []error{errors.Errorf("%s: group %q depends on unknown group %q", fn, rg.Name, dep)}
+				}
+				if depItv != itv {
+					return nil, []error{errors.Errorf("%s: group %q and its dependency %q must use the same evaluation interval", fn, rg.Name, dep)}
+				}
+			}
 
 			rules := make([]Rule, 0, len(rg.Rules))
 			for _, r := range rg.Rules {
@@ -1050,22 +1255,31 @@ func (m *Manager) LoadGroups(
 				}
 
 				if r.Alert.Value != "" {
-					rules = append(rules, NewAlertingRule(
+					ar := NewAlertingRule(
 						r.Alert.Value,
 						expr,
 						time.Duration(r.For),
-						labels.FromMap(r.Labels),
+						time.Duration(r.KeepFiringFor),
+						mergeGroupLabels(rg.Labels, r.Labels),
 						labels.FromMap(r.Annotations),
 						externalLabels,
 						m.restored,
 						log.With(m.logger, "alert", r.Alert),
-					))
+					)
+					if r.ClearExpr.Value != "" {
+						clearExpr, err := m.opts.GroupLoader.Parse(r.ClearExpr.Value)
+						if err != nil {
+							return nil, []error{errors.Wrap(err, fn)}
+						}
+						ar.SetClearExpr(clearExpr)
+					}
+					rules = append(rules, ar)
 					continue
 				}
 				rules = append(rules, NewRecordingRule(
 					r.Record.Value,
 					expr,
-					labels.FromMap(r.Labels),
+					mergeGroupLabels(rg.Labels, r.Labels),
 				))
 			}
 
@@ -1073,6 +1287,9 @@ func (m *Manager) LoadGroups(
 				Name:          rg.Name,
 				File:          fn,
 				Interval:      itv,
+				EvalOffset:    time.Duration(rg.EvalOffset),
+				LookbackDelta: time.Duration(rg.LookbackDelta),
+				DependsOn:     rg.DependsOn,
 				Rules:         rules,
 				ShouldRestore: shouldRestore,
 				Opts:          m.opts,
@@ -1084,6 +1301,22 @@ func (m *Manager) LoadGroups(
 	return groups, nil
 }
 
+// mergeGroupLabels combines the labels a group declares for all of its rules
+// with the labels of a single rule. Rule labels win on conflict.
+func mergeGroupLabels(group, rule map[string]string) labels.Labels {
+	if len(group) == 0 {
+		return labels.FromMap(rule)
+	}
+	merged := make(map[string]string, len(group)+len(rule))
+	for k, v := range group {
+		merged[k] = v
+	}
+	for k, v := range rule {
+		merged[k] = v
+	}
+	return labels.FromMap(merged)
+}
+
 // Group names need not be unique across filenames.
 func groupKey(file, name string) string {
 	return file + ";" + name
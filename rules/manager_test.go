@@ -63,6 +63,7 @@ func TestAlertingRule(t *testing.T) {
 		"HTTPRequestRateLow",
 		expr,
 		time.Minute,
+		0,
 		labels.FromStrings("severity", "{{\"c\"}}ritical"),
 		nil, nil, true, nil,
 	)
@@ -204,6 +205,7 @@ func TestForStateAddSamples(t *testing.T) {
 		"HTTPRequestRateLow",
 		expr,
 		time.Minute,
+		0,
 		labels.FromStrings("severity", "{{\"c\"}}ritical"),
 		nil, nil, true, nil,
 	)
@@ -378,6 +380,7 @@ func TestForStateRestore(t *testing.T) {
 		"HTTPRequestRateLow",
 		expr,
 		alertForDuration,
+		0,
 		labels.FromStrings("severity", "critical"),
 		nil, nil, true, nil,
 	)
@@ -444,6 +447,7 @@ func TestForStateRestore(t *testing.T) {
 			"HTTPRequestRateLow",
 			expr,
 			alertForDuration,
+			0,
 			labels.FromStrings("severity", "critical"),
 			nil, nil, false, nil,
 		)
@@ -609,13 +613,13 @@ func readSeriesSet(ss storage.SeriesSet) (map[string][]promql.Point, error) {
 func TestCopyState(t *testing.T) {
 	oldGroup := &Group{
 		rules: []Rule{
-			NewAlertingRule("alert", nil, 0, nil, nil, nil, true, nil),
+			NewAlertingRule("alert", nil, 0, 0, nil, nil, nil, true, nil),
 			NewRecordingRule("rule1", nil, nil),
 			NewRecordingRule("rule2", nil, nil),
 			NewRecordingRule("rule3", nil, labels.Labels{{Name: "l1", Value: "v1"}}),
 			NewRecordingRule("rule3", nil, labels.Labels{{Name: "l1", Value: "v2"}}),
 			NewRecordingRule("rule3", nil, labels.Labels{{Name: "l1", Value: "v3"}}),
-			NewAlertingRule("alert2", nil, 0, labels.Labels{{Name: "l2", Value: "v1"}}, nil, nil, true, nil),
+			NewAlertingRule("alert2", nil, 0, 0, labels.Labels{{Name: "l2", Value: "v1"}}, nil, nil, true, nil),
 		},
 		seriesInPreviousEval: []map[string]labels.Labels{
 			{},
@@ -634,10 +638,10 @@ func TestCopyState(t *testing.T) {
 			NewRecordingRule("rule3", nil, labels.Labels{{Name: "l1", Value: "v0"}}),
 			NewRecordingRule("rule3", nil, labels.Labels{{Name: "l1", Value: "v1"}}),
 			NewRecordingRule("rule3", nil, labels.Labels{{Name: "l1", Value: "v2"}}),
-			NewAlertingRule("alert", nil, 0, nil, nil, nil, true, nil),
+			NewAlertingRule("alert", nil, 0, 0, nil, nil, nil, true, nil),
 			NewRecordingRule("rule1", nil, nil),
-			NewAlertingRule("alert2", nil, 0, labels.Labels{{Name: "l2", Value: "v0"}}, nil, nil, true, nil),
-			NewAlertingRule("alert2", nil, 0, labels.Labels{{Name: "l2", Value: "v1"}}, nil, nil, true, nil),
+			NewAlertingRule("alert2", nil, 0, 0, labels.Labels{{Name: "l2", Value: "v0"}}, nil, nil, true, nil),
+			NewAlertingRule("alert2", nil, 0, 0, labels.Labels{{Name: "l2", Value: "v1"}}, nil, nil, true, nil),
 			NewRecordingRule("rule4", nil, nil),
 		},
 		seriesInPreviousEval: make([]map[string]labels.Labels, 8),
@@ -836,6 +840,184 @@ func reloadAndValidate(rgs *rulefmt.RuleGroups, t *testing.T, tmpFile *os.File,
 	}
 }
 
+func TestLoadGroupsDependencies(t *testing.T) {
+	ruleManager := NewManager(&ManagerOptions{
+		Context: context.Background(),
+		Logger:  log.NewNopLogger(),
+	})
+
+	groups, errs := ruleManager.LoadGroups(time.Second, nil, "fixtures/rules_deps.yaml")
+	require.Empty(t, errs)
+	require.Equal(t, []string{"stage1"}, groups["fixtures/rules_deps.yaml;stage2"].DependsOn())
+
+	_, errs = ruleManager.LoadGroups(time.Second, nil, "fixtures/rules_deps_interval.yaml")
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], `fixtures/rules_deps_interval.yaml: group "stage2" and its dependency "stage1" must use the same evaluation interval`)
+}
+
+func TestLoadGroupsEvalOffset(t *testing.T) {
+	ruleManager := NewManager(&ManagerOptions{
+		Context: context.Background(),
+		Logger:  log.NewNopLogger(),
+	})
+
+	groups, errs := ruleManager.LoadGroups(time.Second, nil, "fixtures/rules_eval_offset.yaml")
+	require.Empty(t, errs)
+
+	g := groups["fixtures/rules_eval_offset.yaml;offset"]
+	require.NotNil(t, g)
+	require.Equal(t, 5*time.Second, g.EvalOffset())
+
+	// Evaluation timestamps are pinned to the configured offset within each
+	// interval slot.
+	ts := g.evalTimestamp()
+	require.Equal(t, 5*time.Second, ts.Sub(ts.Truncate(g.Interval())))
+
+	_, errs = ruleManager.LoadGroups(time.Second, nil, "fixtures/rules_eval_offset_invalid.yaml")
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], `fixtures/rules_eval_offset_invalid.yaml: group "offset": eval_offset must be smaller than the evaluation interval`)
+}
+
+func TestLoadGroupsGroupLabels(t *testing.T) {
+	ruleManager := NewManager(&ManagerOptions{
+		Context: context.Background(),
+		Logger:  log.NewNopLogger(),
+	})
+
+	groups, errs := ruleManager.LoadGroups(time.Second, nil, "fixtures/rules_group_labels.yaml")
+	require.Empty(t, errs)
+
+	g := groups["fixtures/rules_group_labels.yaml;labeled"]
+	require.NotNil(t, g)
+
+	rec := g.Rules()[0].(*RecordingRule)
+	require.Equal(t, labels.FromStrings("team", "sre", "tier", "1"), rec.Labels())
+
+	// Labels on the rule itself win over the group's.
+	alert := g.Rules()[1].(*AlertingRule)
+	require.Equal(t, labels.FromStrings("team", "app", "tier", "1"), alert.Labels())
+}
+
+func TestDependencyOrderedEvaluation(t *testing.T) {
+	st := teststorage.New(t)
+	defer st.Close()
+	engineOpts := promql.EngineOpts{
+		Logger:     nil,
+		Reg:        nil,
+		MaxSamples: 10,
+		Timeout:    10 * time.Second,
+	}
+	engine := promql.NewEngine(engineOpts)
+	ruleManager := NewManager(&ManagerOptions{
+		Appendable: st,
+		Queryable:  st,
+		QueryFunc:  EngineQueryFunc(engine, st),
+		Context:    context.Background(),
+		Logger:     log.NewNopLogger(),
+	})
+	ruleManager.start()
+	defer ruleManager.Stop()
+
+	err := ruleManager.Update(100*time.Millisecond, []string{"fixtures/rules_deps.yaml"}, nil)
+	require.NoError(t, err)
+
+	timestamps := func(name string) []int64 {
+		querier, err := st.Querier(context.Background(), 0, time.Now().UnixNano()/int64(time.Millisecond))
+		require.NoError(t, err)
+		defer querier.Close()
+
+		matcher, err := labels.NewMatcher(labels.MatchEqual, model.MetricNameLabel, name)
+		require.NoError(t, err)
+		samples, err := readSeriesSet(querier.Select(false, nil, matcher))
+		require.NoError(t, err)
+
+		var ts []int64
+		for _, points := range samples {
+			for _, p := range points {
+				ts = append(ts, p.T)
+			}
+		}
+		return ts
+	}
+
+	require.Eventually(t, func() bool {
+		return len(timestamps("stage2_metric")) > 0
+	}, 10*time.Second, 100*time.Millisecond)
+
+	// Every evaluation of the dependent group reused the timestamp of the
+	// stage1 evaluation that triggered it, i.e. there is no interval lag.
+	stage1 := timestamps("stage1_metric")
+	for _, ts := range timestamps("stage2_metric") {
+		require.Contains(t, stage1, ts)
+	}
+}
+
+func TestDependencyMultiple(t *testing.T) {
+	opts := &ManagerOptions{
+		Context: context.Background(),
+		Logger:  log.NewNopLogger(),
+	}
+	g := NewGroup(GroupOptions{
+		Name:      "stage2",
+		Interval:  time.Minute,
+		DependsOn: []string{"stage1a", "stage1b"},
+		Opts:      opts,
+	})
+
+	// The dependencies evaluate at different offsets within the shared
+	// interval; the group triggers once both have reported for the slot,
+	// at the latest of their timestamps.
+	slot := time.Now().Truncate(g.interval)
+	g.dependencyDone(slot.Add(3 * time.Second))
+	require.Len(t, g.depTrigger, 0)
+	g.dependencyDone(slot.Add(7 * time.Second))
+	require.Len(t, g.depTrigger, 1)
+	require.Equal(t, slot.Add(7*time.Second), <-g.depTrigger)
+	require.Len(t, g.depPending, 0)
+
+	// Slots that can no longer complete, e.g. because a dependency missed
+	// an evaluation, are dropped instead of accumulating.
+	g.dependencyDone(slot.Add(3 * time.Second))
+	g.dependencyDone(slot.Add(5*g.interval + 3*time.Second))
+	require.Len(t, g.depTrigger, 0)
+	require.Len(t, g.depPending, 1)
+}
+
+func TestDependencyMultipleEvaluation(t *testing.T) {
+	st := teststorage.New(t)
+	defer st.Close()
+	engine := promql.NewEngine(promql.EngineOpts{
+		MaxSamples: 10,
+		Timeout:    10 * time.Second,
+	})
+	ruleManager := NewManager(&ManagerOptions{
+		Appendable: st,
+		Queryable:  st,
+		QueryFunc:  EngineQueryFunc(engine, st),
+		Context:    context.Background(),
+		Logger:     log.NewNopLogger(),
+	})
+	ruleManager.start()
+	defer ruleManager.Stop()
+
+	err := ruleManager.Update(100*time.Millisecond, []string{"fixtures/rules_deps_multi.yaml"}, nil)
+	require.NoError(t, err)
+
+	// The group depending on two others is evaluated once both have
+	// finished an interval slot.
+	require.Eventually(t, func() bool {
+		querier, err := st.Querier(context.Background(), 0, time.Now().UnixNano()/int64(time.Millisecond))
+		require.NoError(t, err)
+		defer querier.Close()
+
+		matcher, err := labels.NewMatcher(labels.MatchEqual, model.MetricNameLabel, "stage2_metric")
+		require.NoError(t, err)
+		samples, err := readSeriesSet(querier.Select(false, nil, matcher))
+		require.NoError(t, err)
+		return len(samples) > 0
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
 func TestNotify(t *testing.T) {
 	storage := teststorage.New(t)
 	defer storage.Close()
@@ -862,7 +1044,7 @@ func TestNotify(t *testing.T) {
 
 	expr, err := parser.ParseExpr("a > 1")
 	require.NoError(t, err)
-	rule := NewAlertingRule("aTooHigh", expr, 0, labels.Labels{}, labels.Labels{}, nil, true, log.NewNopLogger())
+	rule := NewAlertingRule("aTooHigh", expr, 0, 0, labels.Labels{}, labels.Labels{}, nil, true, log.NewNopLogger())
 	group := NewGroup(GroupOptions{
 		Name:          "alert",
 		Interval:      time.Second,
@@ -1134,7 +1316,7 @@ func TestGroupHasAlertingRules(t *testing.T) {
 			group: &Group{
 				name: "HasAlertingRule",
 				rules: []Rule{
-					NewAlertingRule("alert", nil, 0, nil, nil, nil, true, nil),
+					NewAlertingRule("alert", nil, 0, 0, nil, nil, nil, true, nil),
 					NewRecordingRule("record", nil, nil),
 				},
 			},
@@ -0,0 +1,191 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scrape
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/prometheus/prometheus/tsdb/fileutil"
+)
+
+const (
+	// leaseTTL is how long a claimed target lease stays valid without
+	// renewal. A replica takes over a peer's targets once their leases
+	// have been expired for this long.
+	leaseTTL = time.Minute
+	// leaseRecheckInterval is how often a scrape pool renews its leases
+	// and re-checks whether expired peer leases can be taken over.
+	leaseRecheckInterval = 15 * time.Second
+)
+
+// leaseKey identifies a target in the lease file. The job name is included
+// so several jobs can safely share one lease file.
+func leaseKey(job string, hash uint64) string {
+	return fmt.Sprintf("%s/%016x", job, hash)
+}
+
+type targetLease struct {
+	Replica string    `json:"replica"`
+	Renewed time.Time `json:"renewed"`
+}
+
+// leaseCoordinator hands targets off between replicas scraping the same job.
+// Ownership is recorded in a lease file shared between the replicas; a target
+// is scraped only by the replica holding its lease, and a lease that is not
+// renewed within leaseTTL may be claimed by a peer.
+type leaseCoordinator struct {
+	mtx     sync.Mutex
+	path    string
+	replica string
+	logger  log.Logger
+
+	ttl time.Duration
+	now func() time.Time
+}
+
+func newLeaseCoordinator(path, replica string, logger log.Logger) *leaseCoordinator {
+	if replica == "" {
+		replica, _ = os.Hostname()
+	}
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &leaseCoordinator{
+		path:    path,
+		replica: replica,
+		logger:  logger,
+		ttl:     leaseTTL,
+		now:     time.Now,
+	}
+}
+
+// claim attempts to claim or renew the leases for the given target keys in a
+// single pass over the lease file and reports which of them this replica now
+// owns. Leases that are free, expired, or already held by this replica are
+// (re-)claimed. If the lease file cannot be read or written, all targets are
+// reported as owned: scraping a target twice is preferable to not scraping it
+// at all.
+func (c *leaseCoordinator) claim(keys []string) map[string]bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	owned := make(map[string]bool, len(keys))
+
+	leases, release, err := c.load()
+	if err != nil {
+		level.Error(c.logger).Log("msg", "Failed to read lease file, scraping all targets", "file", c.path, "err", err)
+		for _, key := range keys {
+			owned[key] = true
+		}
+		return owned
+	}
+	defer release()
+
+	now := c.now().UTC()
+	for _, key := range keys {
+		if l, ok := leases[key]; ok && l.Replica != c.replica && now.Sub(l.Renewed) < c.ttl {
+			owned[key] = false
+			continue
+		}
+		leases[key] = targetLease{Replica: c.replica, Renewed: now}
+		owned[key] = true
+	}
+
+	// Drop leases of targets that no longer exist so the file does not grow
+	// without bound as fleets churn.
+	for key, l := range leases {
+		if l.Replica == c.replica && !owned[key] {
+			delete(leases, key)
+		}
+	}
+
+	if err := c.store(leases); err != nil {
+		level.Error(c.logger).Log("msg", "Failed to write lease file", "file", c.path, "err", err)
+	}
+	return owned
+}
+
+// releaseAll gives up all leases held by this replica so that peers can take
+// its targets over immediately, e.g. on shutdown or configuration reload.
+func (c *leaseCoordinator) releaseAll() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	leases, release, err := c.load()
+	if err != nil {
+		level.Error(c.logger).Log("msg", "Failed to read lease file", "file", c.path, "err", err)
+		return
+	}
+	defer release()
+
+	for key, l := range leases {
+		if l.Replica == c.replica {
+			delete(leases, key)
+		}
+	}
+	if err := c.store(leases); err != nil {
+		level.Error(c.logger).Log("msg", "Failed to write lease file", "file", c.path, "err", err)
+	}
+}
+
+// load locks and reads the lease file. The returned function releases the
+// file lock and must be called once the corresponding store is done.
+func (c *leaseCoordinator) load() (map[string]targetLease, func(), error) {
+	releaser, _, err := fileutil.Flock(c.path + ".lock")
+	if err != nil {
+		return nil, nil, err
+	}
+	release := func() {
+		if err := releaser.Release(); err != nil {
+			level.Error(c.logger).Log("msg", "Failed to release lease file lock", "file", c.path, "err", err)
+		}
+	}
+
+	leases := map[string]targetLease{}
+	b, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return leases, release, nil
+	}
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &leases); err != nil {
+			release()
+			return nil, nil, err
+		}
+	}
+	return leases, release, nil
+}
+
+func (c *leaseCoordinator) store(leases map[string]targetLease) error {
+	b, err := json.Marshal(leases)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
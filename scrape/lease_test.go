@@ -0,0 +1,132 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scrape
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+)
+
+func TestLeaseCoordinatorClaim(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lease")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "lease.json")
+	c1 := newLeaseCoordinator(path, "replica-1", nil)
+	c2 := newLeaseCoordinator(path, "replica-2", nil)
+
+	keys := []string{leaseKey("job", 1), leaseKey("job", 2)}
+
+	// The first replica to claim a free lease owns it.
+	owned := c1.claim(keys)
+	require.Equal(t, map[string]bool{keys[0]: true, keys[1]: true}, owned)
+
+	// A peer cannot claim leases that are still valid.
+	owned = c2.claim(keys)
+	require.Equal(t, map[string]bool{keys[0]: false, keys[1]: false}, owned)
+
+	// Expired leases may be taken over.
+	c2.now = func() time.Time { return time.Now().Add(2 * leaseTTL) }
+	owned = c2.claim(keys)
+	require.Equal(t, map[string]bool{keys[0]: true, keys[1]: true}, owned)
+
+	owned = c1.claim(keys)
+	require.Equal(t, map[string]bool{keys[0]: false, keys[1]: false}, owned)
+
+	// Released leases are immediately up for grabs again.
+	c2.releaseAll()
+	owned = c1.claim(keys)
+	require.Equal(t, map[string]bool{keys[0]: true, keys[1]: true}, owned)
+}
+
+func TestLeaseCoordinatorFailsOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lease")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Using a regular file as the parent directory makes every file
+	// operation on the lease file fail.
+	blocker := filepath.Join(dir, "blocker")
+	require.NoError(t, ioutil.WriteFile(blocker, nil, 0666))
+
+	c := newLeaseCoordinator(filepath.Join(blocker, "lease.json"), "replica-1", nil)
+	keys := []string{leaseKey("job", 1)}
+	require.Equal(t, map[string]bool{keys[0]: true}, c.claim(keys))
+}
+
+func TestScrapePoolHALease(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lease")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lease.json")
+
+	cfg := &config.ScrapeConfig{
+		JobName:        "ha",
+		ScrapeInterval: model.Duration(3 * time.Second),
+		ScrapeTimeout:  model.Duration(2 * time.Second),
+	}
+	newPool := func(replica string) *scrapePool {
+		return &scrapePool{
+			appendable:    &nopAppendable{},
+			activeTargets: map[uint64]*Target{},
+			loops:         map[uint64]loop{},
+			config:        cfg,
+			client:        http.DefaultClient,
+			leases:        newLeaseCoordinator(path, replica, nil),
+			newLoop: func(opts scrapeLoopOptions) loop {
+				return &testLoop{
+					startFunc: func(interval, timeout time.Duration, errc chan<- error) {},
+					stopFunc:  func() {},
+				}
+			},
+		}
+	}
+	sp1 := newPool("replica-1")
+	sp2 := newPool("replica-2")
+
+	var tgs []*targetgroup.Group
+	for i := 0; i < 10; i++ {
+		tgs = append(tgs, &targetgroup.Group{
+			Targets: []model.LabelSet{
+				{model.AddressLabel: model.LabelValue(fmt.Sprintf("127.0.0.1:%d", 9090+i))},
+			},
+		})
+	}
+
+	// The first replica to sync claims all targets, the second gets none.
+	sp1.Sync(tgs)
+	require.Len(t, sp1.ActiveTargets(), 10)
+	sp2.Sync(tgs)
+	require.Empty(t, sp2.ActiveTargets())
+
+	// Once the first replica's leases expire, the second takes its targets
+	// over and the first drops them on its next sync.
+	sp2.leases.now = func() time.Time { return time.Now().Add(2 * leaseTTL) }
+	sp2.Sync(tgs)
+	require.Len(t, sp2.ActiveTargets(), 10)
+	sp1.Sync(tgs)
+	require.Empty(t, sp1.ActiveTargets())
+}
@@ -106,18 +106,33 @@ func NewManager(logger log.Logger, app storage.Appendable) *Manager {
 		logger = log.NewNopLogger()
 	}
 	m := &Manager{
-		append:        app,
-		logger:        logger,
-		scrapeConfigs: make(map[string]*config.ScrapeConfig),
-		scrapePools:   make(map[string]*scrapePool),
-		graceShut:     make(chan struct{}),
-		triggerReload: make(chan struct{}, 1),
+		append:         app,
+		logger:         logger,
+		scrapeConfigs:  make(map[string]*config.ScrapeConfig),
+		scrapePools:    make(map[string]*scrapePool),
+		graceShut:      make(chan struct{}),
+		triggerReload:  make(chan struct{}, 1),
+		reloadInterval: 5 * time.Second,
 	}
 	targetMetadataCache.registerManager(m)
 
 	return m
 }
 
+// IngestCreatedTimestamps makes scrape loops append a synthetic zero sample
+// at the created timestamp of new counter-like series, so that rate() sees
+// the counter start instead of a spike. It must be called before the first
+// ApplyConfig.
+func (m *Manager) IngestCreatedTimestamps(enabled bool) {
+	m.ingestCTZero = enabled
+}
+
+// SetReloadInterval sets the interval at which received target set updates
+// are coalesced into scrape pool reloads. It must be called before Run.
+func (m *Manager) SetReloadInterval(d time.Duration) {
+	m.reloadInterval = d
+}
+
 // Manager maintains a set of scrape pools and manages start/stop cycles
 // when receiving new target groups form the discovery manager.
 type Manager struct {
@@ -125,13 +140,20 @@ type Manager struct {
 	append    storage.Appendable
 	graceShut chan struct{}
 
-	jitterSeed    uint64     // Global jitterSeed seed is used to spread scrape workload across HA setup.
+	jitterSeed   uint64 // Global jitterSeed seed is used to spread scrape workload across HA setup.
+	ingestCTZero bool   // Whether to ingest synthetic zero samples at created timestamps.
+
 	mtxScrape     sync.Mutex // Guards the fields below.
 	scrapeConfigs map[string]*config.ScrapeConfig
 	scrapePools   map[string]*scrapePool
 	targetSets    map[string][]*targetgroup.Group
 
-	triggerReload chan struct{}
+	triggerReload  chan struct{}
+	reloadInterval time.Duration
+
+	// updatePendingSince is the receive time of the oldest target set update
+	// that has not been applied by a reload yet.
+	updatePendingSince time.Time
 }
 
 // Run receives and saves target set updates and triggers the scraping loops reloading.
@@ -143,9 +165,16 @@ func (m *Manager) Run(tsets <-chan map[string][]*targetgroup.Group) error {
 		case ts := <-tsets:
 			m.updateTsets(ts)
 
+			m.mtxScrape.Lock()
+			if m.updatePendingSince.IsZero() {
+				m.updatePendingSince = time.Now()
+			}
+			m.mtxScrape.Unlock()
+
 			select {
 			case m.triggerReload <- struct{}{}:
 			default:
+				targetUpdatesCoalesced.Inc()
 			}
 
 		case <-m.graceShut:
@@ -155,7 +184,7 @@ func (m *Manager) Run(tsets <-chan map[string][]*targetgroup.Group) error {
 }
 
 func (m *Manager) reloader() {
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(m.reloadInterval)
 	defer ticker.Stop()
 
 	for {
@@ -165,6 +194,12 @@ func (m *Manager) reloader() {
 		case <-ticker.C:
 			select {
 			case <-m.triggerReload:
+				m.mtxScrape.Lock()
+				if !m.updatePendingSince.IsZero() {
+					targetUpdatePropagation.Observe(time.Since(m.updatePendingSince).Seconds())
+					m.updatePendingSince = time.Time{}
+				}
+				m.mtxScrape.Unlock()
 				m.reload()
 			case <-m.graceShut:
 				return
@@ -183,7 +218,7 @@ func (m *Manager) reload() {
 				level.Error(m.logger).Log("msg", "error reloading target set", "err", "invalid config id:"+setName)
 				continue
 			}
-			sp, err := newScrapePool(scrapeConfig, m.append, m.jitterSeed, log.With(m.logger, "scrape_pool", setName))
+			sp, err := newScrapePool(scrapeConfig, m.append, m.jitterSeed, m.ingestCTZero, log.With(m.logger, "scrape_pool", setName))
 			if err != nil {
 				level.Error(m.logger).Log("msg", "error creating new scrape pool", "err", err, "scrape_pool", setName)
 				continue
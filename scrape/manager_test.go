@@ -15,6 +15,7 @@ package scrape
 
 import (
 	"net/http"
+	"net/url"
 	"strconv"
 	"testing"
 	"time"
@@ -64,6 +65,40 @@ func TestPopulateLabels(t *testing.T) {
 				"custom":               "value",
 			}),
 		},
+		// Scrape query parameters built from target labels.
+		{
+			in: labels.FromMap(map[string]string{
+				model.AddressLabel:      "1.2.3.4:1000",
+				"__meta_ecs_private_ip": "10.1.2.3",
+			}),
+			cfg: &config.ScrapeConfig{
+				Scheme:      "http",
+				MetricsPath: "/probe",
+				JobName:     "job",
+				Params:      url.Values{"module": []string{"http_2xx"}},
+				ParamsFromLabels: map[string]string{
+					"target": "__meta_ecs_private_ip",
+				},
+			},
+			res: labels.FromMap(map[string]string{
+				model.AddressLabel:                "1.2.3.4:1000",
+				model.InstanceLabel:               "1.2.3.4:1000",
+				model.SchemeLabel:                 "http",
+				model.MetricsPathLabel:            "/probe",
+				model.JobLabel:                    "job",
+				model.ParamLabelPrefix + "module": "http_2xx",
+				model.ParamLabelPrefix + "target": "10.1.2.3",
+			}),
+			resOrig: labels.FromMap(map[string]string{
+				model.AddressLabel:                "1.2.3.4:1000",
+				"__meta_ecs_private_ip":           "10.1.2.3",
+				model.SchemeLabel:                 "http",
+				model.MetricsPathLabel:            "/probe",
+				model.JobLabel:                    "job",
+				model.ParamLabelPrefix + "module": "http_2xx",
+				model.ParamLabelPrefix + "target": "10.1.2.3",
+			}),
+		},
 		// Pre-define/overwrite scrape config labels.
 		// Leave out port and expect it to be defaulted to scheme.
 		{
@@ -18,18 +18,24 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math"
 	"net/http"
+	"net/url"
 	"reflect"
+	"strings"
 	"sync"
 	"time"
 	"unsafe"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	config_util "github.com/prometheus/common/config"
@@ -39,6 +45,7 @@ import (
 	"github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/namematcher"
 	"github.com/prometheus/prometheus/pkg/pool"
 	"github.com/prometheus/prometheus/pkg/relabel"
 	"github.com/prometheus/prometheus/pkg/textparse"
@@ -55,6 +62,11 @@ const scrapeTimestampTolerance = 2 * time.Millisecond
 // AlignScrapeTimestamps enables the tolerance for scrape appends timestamps described above.
 var AlignScrapeTimestamps = true
 
+// ReportExtraMetrics enables reporting of the scrape_timeout_seconds and
+// scrape_sample_limit synthetic series for every scrape. It must be set
+// before the scrape manager is started.
+var ReportExtraMetrics = false
+
 var errNameLabelMandatory = fmt.Errorf("missing metric name (%s label)", labels.MetricName)
 
 var (
@@ -104,6 +116,13 @@ var (
 			Help: "Total number of times scrape pools hit the target limit, during sync or config reload.",
 		},
 	)
+	targetScrapePoolSyncsSkipped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prometheus_target_scrape_pool_sync_skipped_total",
+			Help: "Total number of syncs skipped because they would have exceeded the target limit, keeping the previous target set.",
+		},
+		[]string{"scrape_job"},
+	)
 	targetScrapePoolTargetLimit = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "prometheus_target_scrape_pool_target_limit",
@@ -133,12 +152,53 @@ var (
 		},
 		[]string{"scrape_job"},
 	)
+	targetUpdatesCoalesced = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "prometheus_target_updates_coalesced_total",
+			Help: "Total number of target set updates from service discovery that were folded into an already pending scrape pool reload.",
+		},
+	)
+	targetUpdatePropagation = prometheus.NewSummary(
+		prometheus.SummaryOpts{
+			Name:       "prometheus_target_update_propagation_seconds",
+			Help:       "Time from receiving a target set update from service discovery until the scrape pool reload applying it started.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		},
+	)
+	targetScrapePoolGoroutines = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "prometheus_target_scrape_pool_goroutines",
+			Help: "Current number of scrape loop goroutines running for this scrape pool.",
+		},
+		[]string{"scrape_job"},
+	)
+	targetScrapePoolBufferBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "prometheus_target_scrape_pool_buffer_bytes",
+			Help: "Number of scrape buffer bytes currently checked out of the buffer pool by this scrape pool.",
+		},
+		[]string{"scrape_job"},
+	)
+	targetScrapePoolAppendDuration = prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Name:       "prometheus_target_scrape_pool_append_duration_seconds",
+			Help:       "Time spent appending scraped samples to storage, per scrape pool.",
+			Objectives: map[float64]float64{0.01: 0.001, 0.05: 0.005, 0.5: 0.05, 0.90: 0.01, 0.99: 0.001},
+		},
+		[]string{"scrape_job"},
+	)
 	targetScrapeSampleLimit = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "prometheus_target_scrapes_exceeded_sample_limit_total",
 			Help: "Total number of scrapes that hit the sample limit and were rejected.",
 		},
 	)
+	targetScrapeDecompressionLimit = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "prometheus_target_scrapes_exceeded_decompression_size_limit_total",
+			Help: "Total number of scrapes whose decompressed response body exceeded the size limit and were rejected.",
+		},
+	)
 	targetScrapeSampleDuplicate = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "prometheus_target_scrapes_sample_duplicate_timestamp_total",
@@ -157,12 +217,36 @@ var (
 			Help: "Total number of samples rejected due to timestamp falling outside of the time bounds",
 		},
 	)
+	targetScrapeCacheFlushSized = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "prometheus_target_scrapes_cache_flush_size_limit_total",
+			Help: "Total number of scrape cache flushes forced by a per-job cache entry limit.",
+		},
+	)
+	targetScrapeCacheEntriesAdded = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "prometheus_target_scrapes_cache_entries_added_total",
+			Help: "Total number of series entries allocated in scrape caches.",
+		},
+	)
+	targetScrapeCacheEntriesReused = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "prometheus_target_scrapes_cache_entries_reused_total",
+			Help: "Total number of scrape cache lookups that reused an existing series entry.",
+		},
+	)
 	targetScrapeCacheFlushForced = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "prometheus_target_scrapes_cache_flush_forced_total",
 			Help: "How many times a scrape cache was flushed due to getting big while scrapes are failing.",
 		},
 	)
+	targetScrapeStaleMarkersDrained = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "prometheus_target_scrapes_drained_staleness_total",
+			Help: "Total number of removed targets whose final staleness markers were written synchronously on removal, preventing their series from lingering.",
+		},
+	)
 )
 
 func init() {
@@ -175,14 +259,25 @@ func init() {
 		targetScrapePoolReloadsFailed,
 		targetSyncIntervalLength,
 		targetScrapePoolSyncsCounter,
+		targetUpdatesCoalesced,
+		targetUpdatePropagation,
 		targetScrapeSampleLimit,
+		targetScrapeDecompressionLimit,
 		targetScrapeSampleDuplicate,
 		targetScrapeSampleOutOfOrder,
 		targetScrapeSampleOutOfBounds,
 		targetScrapePoolExceededTargetLimit,
+		targetScrapePoolSyncsSkipped,
 		targetScrapePoolTargetLimit,
 		targetScrapePoolTargetsAdded,
+		targetScrapePoolGoroutines,
+		targetScrapePoolBufferBytes,
+		targetScrapePoolAppendDuration,
+		targetScrapeCacheFlushSized,
+		targetScrapeCacheEntriesAdded,
+		targetScrapeCacheEntriesReused,
 		targetScrapeCacheFlushForced,
+		targetScrapeStaleMarkersDrained,
 		targetMetadataCache,
 	)
 }
@@ -191,20 +286,38 @@ func init() {
 type scrapePool struct {
 	appendable storage.Appendable
 	logger     log.Logger
+	ctx        context.Context
 	cancel     context.CancelFunc
 
 	// mtx must not be taken after targetMtx.
-	mtx            sync.Mutex
-	config         *config.ScrapeConfig
-	client         *http.Client
+	mtx    sync.Mutex
+	config *config.ScrapeConfig
+	client *http.Client
+	// directClient bypasses the configured proxy for targets carrying the
+	// __proxy_connect__ label set to "false". Identical to client when no
+	// proxy is configured.
+	directClient   *http.Client
 	loops          map[uint64]loop
 	targetLimitHit bool // Internal state to speed up the target_limit checks.
 
+	// leases coordinates target ownership with other replicas scraping the
+	// same job. Nil unless ha_lease_file is configured.
+	leases           *leaseCoordinator
+	leaseLoopStarted bool
+
+	// ingestCTZero makes scrape loops append a synthetic zero sample at the
+	// created timestamp of new counter-like series.
+	ingestCTZero bool
+
 	targetMtx sync.Mutex
 	// activeTargets and loops must always be synchronized to have the same
 	// set of hashes.
 	activeTargets  map[uint64]*Target
 	droppedTargets []*Target
+	// lastSyncTargets is the full post-relabeling target set of the last
+	// Sync, kept so lease rechecks can re-run sync without a new discovery
+	// update.
+	lastSyncTargets []*Target
 
 	// Constructor for new scrape loops. This is settable for testing convenience.
 	newLoop func(scrapeLoopOptions) loop
@@ -216,7 +329,11 @@ type scrapeLoopOptions struct {
 	limit           int
 	honorLabels     bool
 	honorTimestamps bool
+	allowUTF8Names  bool
+	duplicateMode   string
 	mrc             []*relabel.Config
+	externalLabels  labels.Labels
+	nameFilter      func(string) bool
 	cache           *scrapeCache
 }
 
@@ -224,13 +341,46 @@ const maxAheadTime = 10 * time.Minute
 
 type labelsMutator func(labels.Labels) labels.Labels
 
-func newScrapePool(cfg *config.ScrapeConfig, app storage.Appendable, jitterSeed uint64, logger log.Logger) (*scrapePool, error) {
+// newScrapeClients returns the HTTP client for the given scrape config and a
+// second client with the proxy stripped, used for targets that bypass the
+// proxy via the __proxy_connect__ label. Both are the same client when no
+// proxy is configured.
+func newScrapeClients(cfg *config.ScrapeConfig) (client, directClient *http.Client, err error) {
+	client, err = config_util.NewClientFromConfig(cfg.HTTPClientConfig, cfg.JobName, false, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	client.Transport = newUnixSocketRoundTripper(client.Transport)
+
+	if cfg.HTTPClientConfig.ProxyURL.URL == nil {
+		return client, client, nil
+	}
+	directCfg := cfg.HTTPClientConfig
+	directCfg.ProxyURL = config_util.URL{}
+	directClient, err = config_util.NewClientFromConfig(directCfg, cfg.JobName, false, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	directClient.Transport = newUnixSocketRoundTripper(directClient.Transport)
+	return client, directClient, nil
+}
+
+// clientForTarget returns the scrape client to use for the given target,
+// honoring its __proxy_connect__ label.
+func (sp *scrapePool) clientForTarget(t *Target) *http.Client {
+	if t != nil && t.usesDirectConnection() && sp.directClient != nil {
+		return sp.directClient
+	}
+	return sp.client
+}
+
+func newScrapePool(cfg *config.ScrapeConfig, app storage.Appendable, jitterSeed uint64, ingestCTZero bool, logger log.Logger) (*scrapePool, error) {
 	targetScrapePools.Inc()
 	if logger == nil {
 		logger = log.NewNopLogger()
 	}
 
-	client, err := config_util.NewClientFromConfig(cfg.HTTPClientConfig, cfg.JobName, false, false)
+	client, directClient, err := newScrapeClients(cfg)
 	if err != nil {
 		targetScrapePoolsFailed.Inc()
 		return nil, errors.Wrap(err, "error creating HTTP client")
@@ -240,36 +390,57 @@ func newScrapePool(cfg *config.ScrapeConfig, app storage.Appendable, jitterSeed
 
 	ctx, cancel := context.WithCancel(context.Background())
 	sp := &scrapePool{
+		ctx:           ctx,
 		cancel:        cancel,
 		appendable:    app,
 		config:        cfg,
 		client:        client,
+		directClient:  directClient,
 		activeTargets: map[uint64]*Target{},
 		loops:         map[uint64]loop{},
+		ingestCTZero:  ingestCTZero,
 		logger:        logger,
 	}
+	if cfg.HALeaseFile != "" {
+		sp.leases = newLeaseCoordinator(cfg.HALeaseFile, cfg.HAReplicaName, logger)
+		sp.leaseLoopStarted = true
+		go sp.recheckLeases(ctx)
+	}
 	sp.newLoop = func(opts scrapeLoopOptions) loop {
 		// Update the targets retrieval function for metadata to a new scrape cache.
+		// Callers of newLoop hold sp.mtx, so reading sp.config here is safe.
 		cache := opts.cache
 		if cache == nil {
-			cache = newScrapeCache()
+			cache = newScrapeCache(int(sp.config.CacheMaxEntries), time.Duration(sp.config.CacheFlushInterval), time.Duration(sp.config.StaleAfter))
 		}
 		opts.target.SetMetadataStore(cache)
 
-		return newScrapeLoop(
+		sl := newScrapeLoop(
 			ctx,
 			opts.scraper,
 			log.With(logger, "target", opts.target),
 			buffers,
 			func(l labels.Labels) labels.Labels {
-				return mutateSampleLabels(l, opts.target, opts.honorLabels, opts.mrc)
+				if opts.nameFilter != nil && !opts.nameFilter(l.Get(labels.MetricName)) {
+					return nil
+				}
+				return mutateSampleLabels(l, opts.target, opts.honorLabels, opts.mrc, opts.externalLabels)
+			},
+			func(l labels.Labels) labels.Labels {
+				return mutateReportSampleLabels(l, opts.target, opts.externalLabels)
 			},
-			func(l labels.Labels) labels.Labels { return mutateReportSampleLabels(l, opts.target) },
 			func(ctx context.Context) storage.Appender { return appender(app.Appender(ctx), opts.limit) },
 			cache,
 			jitterSeed,
 			opts.honorTimestamps,
 		)
+		sl.sampleLimit = opts.limit
+		sl.allowUTF8Names = opts.allowUTF8Names
+		sl.duplicateMode = opts.duplicateMode
+		sl.ingestCTZero = sp.ingestCTZero
+		sl.bufferBytes = targetScrapePoolBufferBytes.WithLabelValues(sp.config.JobName)
+		sl.appendDuration = targetScrapePoolAppendDuration.WithLabelValues(sp.config.JobName)
+		return sl
 	}
 
 	return sp, nil
@@ -317,12 +488,23 @@ func (sp *scrapePool) stop() {
 
 	wg.Wait()
 	sp.client.CloseIdleConnections()
+	if sp.directClient != nil {
+		sp.directClient.CloseIdleConnections()
+	}
+
+	if sp.leases != nil {
+		sp.leases.releaseAll()
+	}
 
 	if sp.config != nil {
 		targetScrapePoolSyncsCounter.DeleteLabelValues(sp.config.JobName)
+		targetScrapePoolSyncsSkipped.DeleteLabelValues(sp.config.JobName)
 		targetScrapePoolTargetLimit.DeleteLabelValues(sp.config.JobName)
 		targetScrapePoolTargetsAdded.DeleteLabelValues(sp.config.JobName)
 		targetSyncIntervalLength.DeleteLabelValues(sp.config.JobName)
+		targetScrapePoolGoroutines.DeleteLabelValues(sp.config.JobName)
+		targetScrapePoolBufferBytes.DeleteLabelValues(sp.config.JobName)
+		targetScrapePoolAppendDuration.DeleteLabelValues(sp.config.JobName)
 	}
 }
 
@@ -335,16 +517,33 @@ func (sp *scrapePool) reload(cfg *config.ScrapeConfig) error {
 	targetScrapePoolReloads.Inc()
 	start := time.Now()
 
-	client, err := config_util.NewClientFromConfig(cfg.HTTPClientConfig, cfg.JobName, false, false)
+	client, directClient, err := newScrapeClients(cfg)
 	if err != nil {
 		targetScrapePoolReloadsFailed.Inc()
 		return errors.Wrap(err, "error creating HTTP client")
 	}
 
+	if cfg.HALeaseFile == "" {
+		if sp.leases != nil {
+			sp.leases.releaseAll()
+			sp.leases = nil
+		}
+	} else if sp.leases == nil || cfg.HALeaseFile != sp.config.HALeaseFile || cfg.HAReplicaName != sp.config.HAReplicaName {
+		if sp.leases != nil {
+			sp.leases.releaseAll()
+		}
+		sp.leases = newLeaseCoordinator(cfg.HALeaseFile, cfg.HAReplicaName, sp.logger)
+	}
+	if sp.leases != nil && !sp.leaseLoopStarted {
+		sp.leaseLoopStarted = true
+		go sp.recheckLeases(sp.ctx)
+	}
+
 	reuseCache := reusableCache(sp.config, cfg)
 	sp.config = cfg
-	oldClient := sp.client
+	oldClient, oldDirectClient := sp.client, sp.directClient
 	sp.client = client
+	sp.directClient = directClient
 
 	targetScrapePoolTargetLimit.WithLabelValues(sp.config.JobName).Set(float64(sp.config.TargetLimit))
 
@@ -356,6 +555,11 @@ func (sp *scrapePool) reload(cfg *config.ScrapeConfig) error {
 		honorLabels     = sp.config.HonorLabels
 		honorTimestamps = sp.config.HonorTimestamps
 		mrc             = sp.config.MetricRelabelConfigs
+		externalLabels  = sp.config.ExternalLabels
+		decompLimit     = int64(sp.config.DecompressionSizeLimit)
+		allowUTF8Names  = sp.config.MetricNameValidationScheme == config.UTF8ValidationConfig
+		duplicateMode   = sp.config.HonorDuplicateSamples
+		nameFilter      = compileNameFilter(sp.config)
 	)
 
 	sp.targetMtx.Lock()
@@ -367,18 +571,22 @@ func (sp *scrapePool) reload(cfg *config.ScrapeConfig) error {
 			oldLoop.disableEndOfRunStalenessMarkers()
 			cache = oc
 		} else {
-			cache = newScrapeCache()
+			cache = newScrapeCache(int(sp.config.CacheMaxEntries), time.Duration(sp.config.CacheFlushInterval), time.Duration(sp.config.StaleAfter))
 		}
 		var (
 			t       = sp.activeTargets[fp]
-			s       = &targetScraper{Target: t, client: sp.client, timeout: timeout}
+			s       = &targetScraper{Target: t, client: sp.clientForTarget(t), timeout: timeout, decompressionLimit: decompLimit, headers: sp.config.Headers, schemeAutodetect: sp.config.SchemeAutodetect}
 			newLoop = sp.newLoop(scrapeLoopOptions{
 				target:          t,
 				scraper:         s,
 				limit:           limit,
 				honorLabels:     honorLabels,
 				honorTimestamps: honorTimestamps,
+				allowUTF8Names:  allowUTF8Names,
+				duplicateMode:   duplicateMode,
 				mrc:             mrc,
+				externalLabels:  externalLabels,
+				nameFilter:      nameFilter,
 				cache:           cache,
 			})
 		)
@@ -399,6 +607,9 @@ func (sp *scrapePool) reload(cfg *config.ScrapeConfig) error {
 
 	wg.Wait()
 	oldClient.CloseIdleConnections()
+	if oldDirectClient != nil {
+		oldDirectClient.CloseIdleConnections()
+	}
 	targetReloadIntervalLength.WithLabelValues(interval.String()).Observe(
 		time.Since(start).Seconds(),
 	)
@@ -412,9 +623,11 @@ func (sp *scrapePool) Sync(tgs []*targetgroup.Group) {
 	defer sp.mtx.Unlock()
 	start := time.Now()
 
-	sp.targetMtx.Lock()
-	var all []*Target
-	sp.droppedTargets = []*Target{}
+	var (
+		all     []*Target
+		dropped []*Target
+		unique  = map[uint64]struct{}{}
+	)
 	for _, tg := range tgs {
 		targets, err := targetsFromGroup(tg, sp.config)
 		if err != nil {
@@ -424,11 +637,28 @@ func (sp *scrapePool) Sync(tgs []*targetgroup.Group) {
 		for _, t := range targets {
 			if t.Labels().Len() > 0 {
 				all = append(all, t)
+				unique[t.hash()] = struct{}{}
 			} else if t.DiscoveredLabels().Len() > 0 {
-				sp.droppedTargets = append(sp.droppedTargets, t)
+				dropped = append(dropped, t)
 			}
 		}
 	}
+
+	// If relabeling yielded more targets than target_limit allows, keep the
+	// previous target set instead of applying the update. This protects
+	// against an SD misconfiguration that suddenly matches far more targets
+	// than intended.
+	if sp.config.TargetLimit > 0 && len(unique) > int(sp.config.TargetLimit) {
+		level.Error(sp.logger).Log("msg", "Target sync exceeds target_limit, keeping previous target set",
+			"targets", len(unique), "limit", sp.config.TargetLimit)
+		targetScrapePoolExceededTargetLimit.Inc()
+		targetScrapePoolSyncsSkipped.WithLabelValues(sp.config.JobName).Inc()
+		return
+	}
+
+	sp.targetMtx.Lock()
+	sp.droppedTargets = dropped
+	sp.lastSyncTargets = all
 	sp.targetMtx.Unlock()
 	sp.sync(all)
 
@@ -450,21 +680,51 @@ func (sp *scrapePool) sync(targets []*Target) {
 		honorLabels     = sp.config.HonorLabels
 		honorTimestamps = sp.config.HonorTimestamps
 		mrc             = sp.config.MetricRelabelConfigs
+		externalLabels  = sp.config.ExternalLabels
+		decompLimit     = int64(sp.config.DecompressionSizeLimit)
+		allowUTF8Names  = sp.config.MetricNameValidationScheme == config.UTF8ValidationConfig
+		duplicateMode   = sp.config.HonorDuplicateSamples
+		nameFilter      = compileNameFilter(sp.config)
 	)
 
+	// When HA coordination is enabled, only targets whose lease this replica
+	// holds are scraped. Targets handed off to a peer drop out of the set
+	// like disappeared targets, draining their staleness markers below.
+	var owned map[string]bool
+	if sp.leases != nil {
+		keys := make([]string, 0, len(targets))
+		seen := make(map[string]struct{}, len(targets))
+		for _, t := range targets {
+			key := leaseKey(sp.config.JobName, t.hash())
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				keys = append(keys, key)
+			}
+		}
+		owned = sp.leases.claim(keys)
+	}
+
 	sp.targetMtx.Lock()
 	for _, t := range targets {
 		hash := t.hash()
 
+		if owned != nil && !owned[leaseKey(sp.config.JobName, hash)] {
+			continue
+		}
+
 		if _, ok := sp.activeTargets[hash]; !ok {
-			s := &targetScraper{Target: t, client: sp.client, timeout: timeout}
+			s := &targetScraper{Target: t, client: sp.clientForTarget(t), timeout: timeout, decompressionLimit: decompLimit, headers: sp.config.Headers, schemeAutodetect: sp.config.SchemeAutodetect}
 			l := sp.newLoop(scrapeLoopOptions{
 				target:          t,
 				scraper:         s,
 				limit:           limit,
 				honorLabels:     honorLabels,
 				honorTimestamps: honorTimestamps,
+				allowUTF8Names:  allowUTF8Names,
+				duplicateMode:   duplicateMode,
 				mrc:             mrc,
+				externalLabels:  externalLabels,
+				nameFilter:      nameFilter,
 			})
 
 			sp.activeTargets[hash] = t
@@ -484,12 +744,13 @@ func (sp *scrapePool) sync(targets []*Target) {
 
 	var wg sync.WaitGroup
 
-	// Stop and remove old targets and scraper loops.
+	// Stop and remove old targets and scraper loops, draining their final
+	// staleness markers before the target is considered gone.
 	for hash := range sp.activeTargets {
 		if _, ok := uniqueLoops[hash]; !ok {
 			wg.Add(1)
 			go func(l loop) {
-				l.stop()
+				l.stopAndDrain()
 				wg.Done()
 			}(sp.loops[hash])
 
@@ -501,6 +762,7 @@ func (sp *scrapePool) sync(targets []*Target) {
 	sp.targetMtx.Unlock()
 
 	targetScrapePoolTargetsAdded.WithLabelValues(sp.config.JobName).Set(float64(len(uniqueLoops)))
+	targetScrapePoolGoroutines.WithLabelValues(sp.config.JobName).Set(float64(len(sp.loops)))
 	forcedErr := sp.refreshTargetLimitErr()
 	for _, l := range sp.loops {
 		l.setForcedError(forcedErr)
@@ -517,6 +779,33 @@ func (sp *scrapePool) sync(targets []*Target) {
 	wg.Wait()
 }
 
+// recheckLeases periodically renews this pool's target leases and re-runs
+// sync on the last target set so that expired peer leases are taken over and
+// handed-off targets are stopped, without waiting for a discovery update.
+func (sp *scrapePool) recheckLeases(ctx context.Context) {
+	ticker := time.NewTicker(leaseRecheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sp.mtx.Lock()
+		if sp.leases == nil {
+			sp.mtx.Unlock()
+			continue
+		}
+		sp.targetMtx.Lock()
+		targets := append([]*Target(nil), sp.lastSyncTargets...)
+		sp.targetMtx.Unlock()
+		sp.sync(targets)
+		sp.mtx.Unlock()
+	}
+}
+
 // refreshTargetLimitErr returns an error that can be passed to the scrape loops
 // if the number of targets exceeds the configured limit.
 func (sp *scrapePool) refreshTargetLimitErr() error {
@@ -536,7 +825,24 @@ func (sp *scrapePool) refreshTargetLimitErr() error {
 	return err
 }
 
-func mutateSampleLabels(lset labels.Labels, target *Target, honor bool, rc []*relabel.Config) labels.Labels {
+// compileNameFilter builds the metric name allow/deny filter of a scrape
+// config. The patterns were validated at config load time, so compiling
+// cannot fail here. A nil return means no filtering is configured.
+func compileNameFilter(cfg *config.ScrapeConfig) func(string) bool {
+	allow, _ := namematcher.New(cfg.MetricNameAllowlist)
+	deny, _ := namematcher.New(cfg.MetricNameDenylist)
+	if allow == nil && deny == nil {
+		return nil
+	}
+	return func(name string) bool {
+		if allow != nil && !allow.Matches(name) {
+			return false
+		}
+		return deny == nil || !deny.Matches(name)
+	}
+}
+
+func mutateSampleLabels(lset labels.Labels, target *Target, honor bool, rc []*relabel.Config, el labels.Labels) labels.Labels {
 	lb := labels.NewBuilder(lset)
 
 	if honor {
@@ -563,10 +869,10 @@ func mutateSampleLabels(lset labels.Labels, target *Target, honor bool, rc []*re
 		res = relabel.Process(res, rc...)
 	}
 
-	return res
+	return appendExternalLabels(res, el)
 }
 
-func mutateReportSampleLabels(lset labels.Labels, target *Target) labels.Labels {
+func mutateReportSampleLabels(lset labels.Labels, target *Target, el labels.Labels) labels.Labels {
 	lb := labels.NewBuilder(lset)
 
 	for _, l := range target.Labels() {
@@ -574,6 +880,23 @@ func mutateReportSampleLabels(lset labels.Labels, target *Target) labels.Labels
 		lb.Set(l.Name, l.Value)
 	}
 
+	return appendExternalLabels(lb.Labels(), el)
+}
+
+// appendExternalLabels merges the job's external labels onto a sample's
+// labels. Labels already present win, like everywhere else external labels
+// are attached; they are applied after metric relabeling so they cannot be
+// relabeled away.
+func appendExternalLabels(lset labels.Labels, el labels.Labels) labels.Labels {
+	if len(el) == 0 || lset == nil {
+		return lset
+	}
+	lb := labels.NewBuilder(lset)
+	for _, l := range el {
+		if !lset.Has(l.Name) {
+			lb.Set(l.Name, l.Value)
+		}
+	}
 	return lb.Labels()
 }
 
@@ -609,17 +932,81 @@ type targetScraper struct {
 	req     *http.Request
 	timeout time.Duration
 
+	// decompressionLimit is the maximum decompressed response body size in
+	// bytes. 0 means no limit.
+	decompressionLimit int64
+
+	// headers are additional static HTTP headers set on every scrape request.
+	headers map[string]string
+
+	// schemeAutodetect makes the first scrape probe the target over https
+	// and fall back to http if the TLS handshake fails. detectedScheme
+	// caches the outcome for subsequent scrapes.
+	schemeAutodetect bool
+	detectedScheme   string
+
 	gzipr *gzip.Reader
 	buf   *bufio.Reader
 }
 
+// isTLSHandshakeError reports whether a scrape failed because the target does
+// not speak TLS on the scraped port.
+func isTLSHandshakeError(err error) bool {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	if _, ok := err.(tls.RecordHeaderError); ok {
+		return true
+	}
+	return strings.Contains(err.Error(), "handshake failure") ||
+		strings.Contains(err.Error(), "server gave HTTP response to HTTPS client")
+}
+
+// errDecompressionLimit is returned when a scrape response exceeds the
+// configured decompression size limit.
+var errDecompressionLimit = errors.New("decompressed body size limit exceeded")
+
+// copyWithLimit copies the response body to w, enforcing the decompression
+// size limit if one is configured.
+func (s *targetScraper) copyWithLimit(w io.Writer, r io.Reader) error {
+	if s.decompressionLimit <= 0 {
+		_, err := io.Copy(w, r)
+		return err
+	}
+	n, err := io.Copy(w, io.LimitReader(r, s.decompressionLimit+1))
+	if err != nil {
+		return err
+	}
+	if n > s.decompressionLimit {
+		targetScrapeDecompressionLimit.Inc()
+		return errDecompressionLimit
+	}
+	return nil
+}
+
 const acceptHeader = `application/openmetrics-text; version=0.0.1,text/plain;version=0.0.4;q=0.5,*/*;q=0.1`
 
 var userAgentHeader = fmt.Sprintf("Prometheus/%s", version.Version)
 
 func (s *targetScraper) scrape(ctx context.Context, w io.Writer) (string, error) {
+	// A no-op unless tracing has been enabled via the Jaeger environment
+	// variables, whose sampler also decides which scrapes get recorded.
+	span, ctx := opentracing.StartSpanFromContext(ctx, "scrape request")
+	defer span.Finish()
+	ext.HTTPUrl.Set(span, s.URL().String())
+	ext.HTTPMethod.Set(span, "GET")
+
 	if s.req == nil {
-		req, err := http.NewRequest("GET", s.URL().String(), nil)
+		u := s.URL()
+		if s.schemeAutodetect {
+			// Probe https first, the error handling below downgrades to
+			// http if the target does not speak TLS.
+			u.Scheme = "https"
+			if s.detectedScheme != "" {
+				u.Scheme = s.detectedScheme
+			}
+		}
+		req, err := http.NewRequest("GET", u.String(), nil)
 		if err != nil {
 			return "", err
 		}
@@ -627,26 +1014,50 @@ func (s *targetScraper) scrape(ctx context.Context, w io.Writer) (string, error)
 		req.Header.Add("Accept-Encoding", "gzip")
 		req.Header.Set("User-Agent", userAgentHeader)
 		req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", fmt.Sprintf("%f", s.timeout.Seconds()))
+		for name, value := range s.headers {
+			req.Header.Set(name, value)
+		}
 
 		s.req = req
 	}
 
+	// Per-target authorization set via special labels overrides the job-level
+	// client configuration. The bearer token file variant is re-read on every
+	// scrape to pick up rotated credentials.
+	auth, err := s.authorizationHeader()
+	if err != nil {
+		return "", err
+	}
+	if auth != "" {
+		s.req.Header.Set("Authorization", auth)
+	}
+
 	resp, err := s.client.Do(s.req.WithContext(ctx))
 	if err != nil {
+		if s.schemeAutodetect && s.detectedScheme == "" && isTLSHandshakeError(err) {
+			s.detectedScheme = "http"
+			s.req = nil
+			return s.scrape(ctx, w)
+		}
+		ext.Error.Set(span, true)
+		span.LogKV("error", err)
 		return "", err
 	}
+	if s.schemeAutodetect && s.detectedScheme == "" {
+		s.detectedScheme = "https"
+	}
 	defer func() {
 		io.Copy(ioutil.Discard, resp.Body)
 		resp.Body.Close()
 	}()
+	ext.HTTPStatusCode.Set(span, uint16(resp.StatusCode))
 
 	if resp.StatusCode != http.StatusOK {
-		return "", errors.Errorf("server returned HTTP status %s", resp.Status)
+		return "", &errHTTPStatus{status: resp.Status, code: resp.StatusCode}
 	}
 
 	if resp.Header.Get("Content-Encoding") != "gzip" {
-		_, err = io.Copy(w, resp.Body)
-		if err != nil {
+		if err := s.copyWithLimit(w, resp.Body); err != nil {
 			return "", err
 		}
 		return resp.Header.Get("Content-Type"), nil
@@ -665,7 +1076,7 @@ func (s *targetScraper) scrape(ctx context.Context, w io.Writer) (string, error)
 		}
 	}
 
-	_, err = io.Copy(w, s.gzipr)
+	err = s.copyWithLimit(w, s.gzipr)
 	s.gzipr.Close()
 	if err != nil {
 		return "", err
@@ -678,6 +1089,7 @@ type loop interface {
 	run(interval, timeout time.Duration, errc chan<- error)
 	setForcedError(err error)
 	stop()
+	stopAndDrain()
 	getCache() *scrapeCache
 	disableEndOfRunStalenessMarkers()
 }
@@ -703,6 +1115,12 @@ type scrapeLoop struct {
 	appender            func(ctx context.Context) storage.Appender
 	sampleMutator       labelsMutator
 	reportSampleMutator labelsMutator
+	sampleLimit         int
+	allowUTF8Names      bool
+	duplicateMode       string
+	ingestCTZero        bool
+	bufferBytes         prometheus.Gauge
+	appendDuration      prometheus.Observer
 
 	parentCtx context.Context
 	ctx       context.Context
@@ -710,6 +1128,7 @@ type scrapeLoop struct {
 	stopped   chan struct{}
 
 	disabledEndOfRunStalenessMarkers bool
+	drainStalenessMarkers            bool
 }
 
 // scrapeCache tracks mappings of exposed metric strings to label sets and
@@ -721,6 +1140,14 @@ type scrapeCache struct {
 	// How many series and metadata entries there were at the last success.
 	successfulCount int
 
+	// More than maxEntries cache entries force a flush after the next scrape.
+	// 0 leaves only the built-in growth heuristic.
+	maxEntries int
+	// The cache is flushed at least every flushInterval regardless of scrape
+	// outcome. 0 disables age-based flushing.
+	flushInterval time.Duration
+	lastFlush     time.Time
+
 	// Parsed string to an entry with information about the actual label set
 	// and its storage reference.
 	series map[string]*cacheEntry
@@ -736,6 +1163,12 @@ type scrapeCache struct {
 	seriesCur  map[uint64]labels.Labels
 	seriesPrev map[uint64]labels.Labels
 
+	// staleAfter delays staleness markers for disappeared series until they
+	// have been absent for the given duration. The affected series wait in
+	// seriesMissing in the meantime. 0 marks series stale at the next scrape.
+	staleAfter    time.Duration
+	seriesMissing map[uint64]missingEntry
+
 	metaMtx  sync.Mutex
 	metadata map[string]*metaEntry
 }
@@ -753,12 +1186,24 @@ func (m *metaEntry) size() int {
 	return len(m.help) + len(m.unit) + len(m.typ)
 }
 
-func newScrapeCache() *scrapeCache {
+// missingEntry records a series that disappeared from a target's scrapes and
+// the time it was first found missing.
+type missingEntry struct {
+	lset  labels.Labels
+	since time.Time
+}
+
+func newScrapeCache(maxEntries int, flushInterval, staleAfter time.Duration) *scrapeCache {
 	return &scrapeCache{
+		maxEntries:    maxEntries,
+		flushInterval: flushInterval,
+		lastFlush:     time.Now(),
 		series:        map[string]*cacheEntry{},
 		droppedSeries: map[string]*uint64{},
 		seriesCur:     map[uint64]labels.Labels{},
 		seriesPrev:    map[uint64]labels.Labels{},
+		staleAfter:    staleAfter,
+		seriesMissing: map[uint64]missingEntry{},
 		metadata:      map[string]*metaEntry{},
 	}
 }
@@ -770,6 +1215,10 @@ func (c *scrapeCache) iterDone(flushCache bool) {
 
 	if flushCache {
 		c.successfulCount = count
+	} else if c.maxEntries > 0 && count > c.maxEntries {
+		// The configured per-job entry limit was exceeded.
+		flushCache = true
+		targetScrapeCacheFlushSized.Inc()
 	} else if count > c.successfulCount*2+1000 {
 		// If a target had varying labels in scrapes that ultimately failed,
 		// the caches would grow indefinitely. Force a flush when this happens.
@@ -779,6 +1228,9 @@ func (c *scrapeCache) iterDone(flushCache bool) {
 		flushCache = true
 		targetScrapeCacheFlushForced.Inc()
 	}
+	if !flushCache && c.flushInterval > 0 && time.Since(c.lastFlush) >= c.flushInterval {
+		flushCache = true
+	}
 
 	if flushCache {
 		// All caches may grow over time through series churn
@@ -804,6 +1256,7 @@ func (c *scrapeCache) iterDone(flushCache bool) {
 		c.metaMtx.Unlock()
 
 		c.iter++
+		c.lastFlush = time.Now()
 	}
 
 	// Swap current and previous series.
@@ -820,6 +1273,7 @@ func (c *scrapeCache) get(met string) (*cacheEntry, bool) {
 	if !ok {
 		return nil, false
 	}
+	targetScrapeCacheEntriesReused.Inc()
 	e.lastIter = c.iter
 	return e, true
 }
@@ -828,6 +1282,7 @@ func (c *scrapeCache) addRef(met string, ref uint64, lset labels.Labels, hash ui
 	if ref == 0 {
 		return
 	}
+	targetScrapeCacheEntriesAdded.Inc()
 	c.series[met] = &cacheEntry{ref: ref, lastIter: c.iter, lset: lset, hash: hash}
 }
 
@@ -846,16 +1301,34 @@ func (c *scrapeCache) getDropped(met string) bool {
 
 func (c *scrapeCache) trackStaleness(hash uint64, lset labels.Labels) {
 	c.seriesCur[hash] = lset
+	delete(c.seriesMissing, hash)
 }
 
-func (c *scrapeCache) forEachStale(f func(labels.Labels) bool) {
+func (c *scrapeCache) forEachStale(now time.Time, f func(labels.Labels) bool) {
 	for h, lset := range c.seriesPrev {
 		if _, ok := c.seriesCur[h]; !ok {
+			if c.staleAfter > 0 {
+				// Delay the staleness marker until the series has been
+				// absent for staleAfter.
+				if _, ok := c.seriesMissing[h]; !ok {
+					c.seriesMissing[h] = missingEntry{lset: lset, since: now}
+				}
+				continue
+			}
 			if !f(lset) {
-				break
+				return
 			}
 		}
 	}
+	for h, e := range c.seriesMissing {
+		if now.Sub(e.since) < c.staleAfter {
+			continue
+		}
+		delete(c.seriesMissing, h)
+		if !f(e.lset) {
+			return
+		}
+	}
 }
 
 func (c *scrapeCache) setType(metric []byte, t textparse.MetricType) {
@@ -974,7 +1447,7 @@ func newScrapeLoop(ctx context.Context,
 		buffers = pool.New(1e3, 1e6, 3, func(sz int) interface{} { return make([]byte, 0, sz) })
 	}
 	if cache == nil {
-		cache = newScrapeCache()
+		cache = newScrapeCache(0, 0, 0)
 	}
 	sl := &scrapeLoop{
 		scraper:             sc,
@@ -1048,9 +1521,17 @@ mainLoop:
 		}
 	}
 
+	if !sl.disabledEndOfRunStalenessMarkers && sl.drainStalenessMarkers && !last.IsZero() {
+		// The target was removed from discovery, so there is no risk of a
+		// scrape racing the markers. Write them before signalling the stop,
+		// so that the removal is only complete once the series are stale.
+		sl.writeStaleMarkers(time.Now())
+		targetScrapeStaleMarkersDrained.Inc()
+	}
+
 	close(sl.stopped)
 
-	if !sl.disabledEndOfRunStalenessMarkers {
+	if !sl.disabledEndOfRunStalenessMarkers && !sl.drainStalenessMarkers {
 		sl.endOfRunStaleness(last, ticker, interval)
 	}
 }
@@ -1063,6 +1544,9 @@ mainLoop:
 func (sl *scrapeLoop) scrapeAndReport(interval, timeout time.Duration, last, appendTime time.Time, errc chan<- error) time.Time {
 	start := time.Now()
 
+	span, ctx := opentracing.StartSpanFromContext(sl.parentCtx, "scrape")
+	defer span.Finish()
+
 	// Only record after the first scrape.
 	if !last.IsZero() {
 		targetIntervalLength.WithLabelValues(interval.String()).Observe(
@@ -1071,7 +1555,16 @@ func (sl *scrapeLoop) scrapeAndReport(interval, timeout time.Duration, last, app
 	}
 
 	b := sl.buffers.Get(sl.lastScrapeSize).([]byte)
-	defer sl.buffers.Put(b)
+	bufSize := float64(cap(b))
+	if sl.bufferBytes != nil {
+		sl.bufferBytes.Add(bufSize)
+	}
+	defer func(b []byte) {
+		sl.buffers.Put(b)
+		if sl.bufferBytes != nil {
+			sl.bufferBytes.Sub(bufSize)
+		}
+	}(b)
 	buf := bytes.NewBuffer(b)
 
 	var total, added, seriesAdded int
@@ -1090,7 +1583,7 @@ func (sl *scrapeLoop) scrapeAndReport(interval, timeout time.Duration, last, app
 	}()
 
 	defer func() {
-		if err = sl.report(app, appendTime, time.Since(start), total, added, seriesAdded, scrapeErr); err != nil {
+		if err = sl.report(app, appendTime, timeout, time.Since(start), total, added, seriesAdded, scrapeErr); err != nil {
 			level.Warn(sl.l).Log("msg", "Appending scrape report failed", "err", err)
 		}
 	}()
@@ -1111,7 +1604,7 @@ func (sl *scrapeLoop) scrapeAndReport(interval, timeout time.Duration, last, app
 	}
 
 	var contentType string
-	scrapeCtx, cancel := context.WithTimeout(sl.parentCtx, timeout)
+	scrapeCtx, cancel := context.WithTimeout(ctx, timeout)
 	contentType, scrapeErr = sl.scraper.scrape(scrapeCtx, buf)
 	cancel()
 
@@ -1132,7 +1625,19 @@ func (sl *scrapeLoop) scrapeAndReport(interval, timeout time.Duration, last, app
 
 	// A failed scrape is the same as an empty scrape,
 	// we still call sl.append to trigger stale markers.
+	appStart := time.Now()
+	appSpan, _ := opentracing.StartSpanFromContext(ctx, "scrape append")
 	total, added, seriesAdded, appErr = sl.append(app, b, contentType, appendTime)
+	appSpan.Finish()
+	if sl.appendDuration != nil {
+		sl.appendDuration.Observe(time.Since(appStart).Seconds())
+	}
+	span.SetTag("samples", total)
+	span.SetTag("added", added)
+	if scrapeErr != nil {
+		ext.Error.Set(span, true)
+		span.LogKV("error", scrapeErr)
+	}
 	if appErr != nil {
 		app.Rollback()
 		app = sl.appender(sl.parentCtx)
@@ -1202,9 +1707,19 @@ func (sl *scrapeLoop) endOfRunStaleness(last time.Time, ticker *time.Ticker, int
 	case <-time.After(interval / 10):
 	}
 
-	// Call sl.append again with an empty scrape to trigger stale markers.
 	// If the target has since been recreated and scraped, the
 	// stale markers will be out of order and ignored.
+	sl.writeStaleMarkers(staleTime)
+}
+
+// writeStaleMarkers calls sl.append with an empty scrape to trigger stale
+// markers for all series of the target as of staleTime.
+func (sl *scrapeLoop) writeStaleMarkers(staleTime time.Time) {
+	// The target is gone for good, so write the markers right away even if
+	// the job delays staleness for disappeared series. Scraping has stopped,
+	// no scrape iteration races with this.
+	sl.cache.staleAfter = 0
+
 	app := sl.appender(sl.ctx)
 	var err error
 	defer func() {
@@ -1234,6 +1749,16 @@ func (sl *scrapeLoop) stop() {
 	<-sl.stopped
 }
 
+// stopAndDrain stops the scraping like stop, but also writes final staleness
+// markers for the target's series before returning. It is used when a target
+// was removed from discovery, where waiting two scrape intervals for the
+// regular end-of-run staleness handling would leave the series without
+// markers if the server reloads or shuts down in the meantime.
+func (sl *scrapeLoop) stopAndDrain() {
+	sl.drainStalenessMarkers = true
+	sl.stop()
+}
+
 func (sl *scrapeLoop) disableEndOfRunStalenessMarkers() {
 	sl.disabledEndOfRunStalenessMarkers = true
 }
@@ -1250,11 +1775,19 @@ type appendErrors struct {
 
 func (sl *scrapeLoop) append(app storage.Appender, b []byte, contentType string, ts time.Time) (total, added, seriesAdded int, err error) {
 	var (
-		p              = textparse.New(b, contentType)
+		p              = textparse.New(b, contentType, sl.allowUTF8Names)
 		defTime        = timestamp.FromTime(ts)
 		appErrs        = appendErrors{}
 		sampleLimitErr error
+		dupSeries      map[uint64]int
+		ctimes         map[string]int64
 	)
+	if sl.duplicateMode == config.DuplicateSamplesLast {
+		dupSeries = countDuplicateSeries(b, contentType, sl.allowUTF8Names)
+	}
+	if sl.ingestCTZero {
+		ctimes = collectCreatedTimestamps(b, contentType, sl.allowUTF8Names)
+	}
 
 	defer func() {
 		if err != nil {
@@ -1305,6 +1838,14 @@ loop:
 		if sl.cache.getDropped(yoloString(met)) {
 			continue
 		}
+		if dupSeries != nil {
+			if h := xxhash.Sum64(met); dupSeries[h] > 1 {
+				// Not the last occurrence of this series in the scrape; only
+				// the final one is ingested.
+				dupSeries[h]--
+				continue
+			}
+		}
 		ce, ok := sl.cache.get(yoloString(met))
 
 		if ok {
@@ -1321,6 +1862,13 @@ loop:
 			mets := p.Metric(&lset)
 			hash := lset.Hash()
 
+			// The created timestamp is keyed by the exposed labels, so look
+			// it up before relabeling rewrites them.
+			var ctKey string
+			if ctimes != nil {
+				ctKey = ctSeriesKey(lset)
+			}
+
 			// Hash label set as it is seen local to the target. Then add target labels
 			// and relabeling and store the final label set.
 			lset = sl.sampleMutator(lset)
@@ -1336,6 +1884,16 @@ loop:
 				break loop
 			}
 
+			// For a series not seen before, ingest a synthetic zero sample at
+			// its created timestamp so rate() sees the counter reset. Best
+			// effort: the sample may be rejected, e.g. when the series
+			// existed before with a different label set.
+			if ct, found := ctimes[ctKey]; found && ct < t {
+				if _, cerr := app.Add(lset, ct, 0); cerr != nil {
+					level.Debug(sl.l).Log("msg", "Ingesting created timestamp zero sample failed", "series", string(met), "err", cerr)
+				}
+			}
+
 			var ref uint64
 			ref, err = app.Add(lset, t, v)
 			sampleAdded, err = sl.checkAddError(nil, met, tp, err, &sampleLimitErr, &appErrs)
@@ -1346,8 +1904,9 @@ loop:
 				break loop
 			}
 
-			if tp == nil {
-				// Bypass staleness logic if there is an explicit timestamp.
+			if tp == nil || sl.cache.staleAfter > 0 {
+				// Without a delayed staleness window, bypass staleness
+				// logic if there is an explicit timestamp.
 				sl.cache.trackStaleness(hash, lset)
 			}
 			sl.cache.addRef(mets, ref, lset, hash)
@@ -1378,7 +1937,7 @@ loop:
 		level.Warn(sl.l).Log("msg", "Error on ingesting samples that are too old or are too far into the future", "num_dropped", appErrs.numOutOfBounds)
 	}
 	if err == nil {
-		sl.cache.forEachStale(func(lset labels.Labels) bool {
+		sl.cache.forEachStale(ts, func(lset labels.Labels) bool {
 			// Series no longer exposed, mark it stale.
 			_, err = app.Add(lset, defTime, math.Float64frombits(value.StaleNaN))
 			switch errors.Cause(err) {
@@ -1397,6 +1956,110 @@ func yoloString(b []byte) string {
 	return *((*string)(unsafe.Pointer(&b)))
 }
 
+// countDuplicateSeries parses the scrape body once up front and returns how
+// often each series that appears more than once occurs, keyed by the hash of
+// its exposed metric string. Jobs that keep the last duplicate sample need
+// this to know which occurrence is the final one.
+func countDuplicateSeries(b []byte, contentType string, allowUTF8Names bool) map[uint64]int {
+	p := textparse.New(b, contentType, allowUTF8Names)
+	counts := map[uint64]int{}
+	for {
+		et, err := p.Next()
+		if err != nil {
+			break
+		}
+		if et != textparse.EntrySeries {
+			continue
+		}
+		met, _, _ := p.Series()
+		counts[xxhash.Sum64(met)]++
+	}
+	for h, n := range counts {
+		if n == 1 {
+			delete(counts, h)
+		}
+	}
+	return counts
+}
+
+// ctFamilyName returns the metric family name that would expose a created
+// timestamp for the given metric name.
+func ctFamilyName(name string) string {
+	for _, suffix := range []string{"_total", "_sum", "_count", "_bucket"} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// ctSeriesKey keys a series for created timestamp lookup by its metric
+// family name and all exposed labels except le and quantile.
+func ctSeriesKey(lset labels.Labels) string {
+	return ctKeyFor(ctFamilyName(lset.Get(labels.MetricName)), lset)
+}
+
+func ctKeyFor(family string, lset labels.Labels) string {
+	var sb strings.Builder
+	sb.WriteString(family)
+	for _, l := range lset {
+		if l.Name == labels.MetricName || l.Name == labels.BucketLabel || l.Name == "quantile" {
+			continue
+		}
+		sb.WriteByte(0xff)
+		sb.WriteString(l.Name)
+		sb.WriteByte(0xff)
+		sb.WriteString(l.Value)
+	}
+	return sb.String()
+}
+
+// collectCreatedTimestamps parses the scrape body once up front and returns
+// the created timestamps exposed as _created series, in milliseconds, keyed
+// by ctSeriesKey. Only families typed counter, summary or histogram expose
+// created timestamps.
+func collectCreatedTimestamps(b []byte, contentType string, allowUTF8 bool) map[string]int64 {
+	var (
+		p      = textparse.New(b, contentType, allowUTF8)
+		ctimes map[string]int64
+		types  = map[string]textparse.MetricType{}
+	)
+	for {
+		et, err := p.Next()
+		if err != nil {
+			break
+		}
+		switch et {
+		case textparse.EntryType:
+			name, typ := p.Type()
+			types[string(name)] = typ
+		case textparse.EntrySeries:
+			met, _, v := p.Series()
+			name := string(met)
+			if i := strings.IndexAny(name, "{ "); i >= 0 {
+				name = name[:i]
+			}
+			if !strings.HasSuffix(name, "_created") {
+				continue
+			}
+			family := strings.TrimSuffix(name, "_created")
+			switch types[family] {
+			case textparse.MetricTypeCounter, textparse.MetricTypeSummary, textparse.MetricTypeHistogram:
+			default:
+				continue
+			}
+			var lset labels.Labels
+			p.Metric(&lset)
+			if ctimes == nil {
+				ctimes = map[string]int64{}
+			}
+			// The exposed value is a Unix timestamp in seconds.
+			ctimes[ctKeyFor(family, lset)] = int64(v * 1000)
+		}
+	}
+	return ctimes
+}
+
 // Adds samples to the appender, checking the error, and then returns the # of samples added,
 // whether the caller should continue to process more samples, and any sample limit errors.
 
@@ -1415,6 +2078,9 @@ func (sl *scrapeLoop) checkAddError(ce *cacheEntry, met []byte, tp *int64, err e
 		targetScrapeSampleOutOfOrder.Inc()
 		return false, nil
 	case storage.ErrDuplicateSampleForTimestamp:
+		if sl.duplicateMode == config.DuplicateSamplesFail {
+			return false, err
+		}
 		appErrs.numDuplicates++
 		level.Debug(sl.l).Log("msg", "Duplicate sample for timestamp", "series", string(met))
 		targetScrapeSampleDuplicate.Inc()
@@ -1442,9 +2108,11 @@ const (
 	scrapeSamplesMetricName      = "scrape_samples_scraped" + "\xff"
 	samplesPostRelabelMetricName = "scrape_samples_post_metric_relabeling" + "\xff"
 	scrapeSeriesAddedMetricName  = "scrape_series_added" + "\xff"
+	scrapeTimeoutMetricName      = "scrape_timeout_seconds" + "\xff"
+	scrapeSampleLimitMetricName  = "scrape_sample_limit" + "\xff"
 )
 
-func (sl *scrapeLoop) report(app storage.Appender, start time.Time, duration time.Duration, scraped, added, seriesAdded int, scrapeErr error) (err error) {
+func (sl *scrapeLoop) report(app storage.Appender, start time.Time, timeout, duration time.Duration, scraped, added, seriesAdded int, scrapeErr error) (err error) {
 	sl.scraper.Report(start, duration, scrapeErr)
 
 	ts := timestamp.FromTime(start)
@@ -1469,6 +2137,14 @@ func (sl *scrapeLoop) report(app storage.Appender, start time.Time, duration tim
 	if err = sl.addReportSample(app, scrapeSeriesAddedMetricName, ts, float64(seriesAdded)); err != nil {
 		return
 	}
+	if ReportExtraMetrics {
+		if err = sl.addReportSample(app, scrapeTimeoutMetricName, ts, timeout.Seconds()); err != nil {
+			return
+		}
+		if err = sl.addReportSample(app, scrapeSampleLimitMetricName, ts, float64(sl.sampleLimit)); err != nil {
+			return
+		}
+	}
 	return
 }
 
@@ -1492,6 +2168,14 @@ func (sl *scrapeLoop) reportStale(app storage.Appender, start time.Time) (err er
 	if err = sl.addReportSample(app, scrapeSeriesAddedMetricName, ts, stale); err != nil {
 		return
 	}
+	if ReportExtraMetrics {
+		if err = sl.addReportSample(app, scrapeTimeoutMetricName, ts, stale); err != nil {
+			return
+		}
+		if err = sl.addReportSample(app, scrapeSampleLimitMetricName, ts, stale); err != nil {
+			return
+		}
+	}
 	return
 }
 
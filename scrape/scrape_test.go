@@ -15,6 +15,7 @@ package scrape
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
@@ -30,6 +31,7 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
 	dto "github.com/prometheus/client_model/go"
 	config_util "github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
@@ -55,7 +57,7 @@ func TestNewScrapePool(t *testing.T) {
 	var (
 		app   = &nopAppendable{}
 		cfg   = &config.ScrapeConfig{}
-		sp, _ = newScrapePool(cfg, app, 0, nil)
+		sp, _ = newScrapePool(cfg, app, 0, false, nil)
 	)
 
 	if a, ok := sp.appendable.(*nopAppendable); !ok || a != app {
@@ -90,7 +92,7 @@ func TestDroppedTargetsList(t *testing.T) {
 				},
 			},
 		}
-		sp, _                  = newScrapePool(cfg, app, 0, nil)
+		sp, _                  = newScrapePool(cfg, app, 0, false, nil)
 		expectedLabelSetString = "{__address__=\"127.0.0.1:9090\", job=\"dropMe\"}"
 		expectedLength         = 1
 	)
@@ -173,6 +175,10 @@ func (l *testLoop) stop() {
 	l.stopFunc()
 }
 
+func (l *testLoop) stopAndDrain() {
+	l.stopFunc()
+}
+
 func (l *testLoop) getCache() *scrapeCache {
 	return nil
 }
@@ -340,7 +346,7 @@ func TestScrapePoolTargetLimit(t *testing.T) {
 		activeTargets: map[uint64]*Target{},
 		loops:         map[uint64]loop{},
 		newLoop:       newLoop,
-		logger:        nil,
+		logger:        log.NewNopLogger(),
 		client:        http.DefaultClient,
 	}
 
@@ -390,21 +396,29 @@ func TestScrapePoolTargetLimit(t *testing.T) {
 		}
 	}
 
+	validateTargetCount := func(n int) {
+		require.Equal(t, n, len(sp.loops), "sync should have kept %d targets", n)
+	}
+
 	reloadWithLimit(0)
 	loadTargets(50)
 	validateIsRunning()
 
-	// Simulate an initial config with a limit.
+	// Simulate an initial config with a limit. The over-limit sync is
+	// skipped and the previous target set is kept.
 	sp.config.TargetLimit = 30
 	limit = 30
 	loadTargets(50)
 	validateIsRunning()
-	validateErrorMessage(true)
+	validateTargetCount(50)
+	validateErrorMessage(false)
 
 	reloadWithLimit(50)
 	validateIsRunning()
 	validateErrorMessage(false)
 
+	// A reload that lowers the limit below the current target set still
+	// forces an error on the running loops.
 	reloadWithLimit(40)
 	validateIsRunning()
 	validateErrorMessage(true)
@@ -419,7 +433,8 @@ func TestScrapePoolTargetLimit(t *testing.T) {
 
 	loadTargets(41)
 	validateIsRunning()
-	validateErrorMessage(true)
+	validateTargetCount(40)
+	validateErrorMessage(false)
 
 	reloadWithLimit(51)
 	validateIsRunning()
@@ -443,10 +458,56 @@ func TestScrapePoolTargetLimit(t *testing.T) {
 	validateErrorMessage(false)
 }
 
+func TestScrapePoolGoroutinesMetric(t *testing.T) {
+	newLoop := func(opts scrapeLoopOptions) loop {
+		return &testLoop{
+			startFunc: func(interval, timeout time.Duration, errc chan<- error) {},
+			stopFunc:  func() {},
+		}
+	}
+	sp := &scrapePool{
+		appendable:    &nopAppendable{},
+		activeTargets: map[uint64]*Target{},
+		loops:         map[uint64]loop{},
+		newLoop:       newLoop,
+		logger:        log.NewNopLogger(),
+		client:        http.DefaultClient,
+		cancel:        func() {},
+		config: &config.ScrapeConfig{
+			JobName:        "goroutine_metric_test",
+			ScrapeInterval: model.Duration(3 * time.Second),
+			ScrapeTimeout:  model.Duration(2 * time.Second),
+		},
+	}
+
+	var tgs []*targetgroup.Group
+	for i := 0; i < 3; i++ {
+		tgs = append(tgs, &targetgroup.Group{
+			Targets: []model.LabelSet{
+				{model.AddressLabel: model.LabelValue(fmt.Sprintf("127.0.0.1:%d", 9090+i))},
+			},
+		})
+	}
+
+	goroutines := func() float64 {
+		return prom_testutil.ToFloat64(targetScrapePoolGoroutines.WithLabelValues("goroutine_metric_test"))
+	}
+
+	sp.Sync(tgs)
+	require.Equal(t, 3.0, goroutines())
+
+	sp.Sync(tgs[:1])
+	require.Equal(t, 1.0, goroutines())
+
+	// stop removes the per-job series; a fresh lookup starts back at zero.
+	sp.stop()
+	require.Equal(t, 0.0, goroutines())
+}
+
 func TestScrapePoolAppender(t *testing.T) {
 	cfg := &config.ScrapeConfig{}
 	app := &nopAppendable{}
-	sp, _ := newScrapePool(cfg, app, 0, nil)
+	sp, _ := newScrapePool(cfg, app, 0, false, nil)
 
 	loop := sp.newLoop(scrapeLoopOptions{
 		target: &Target{},
@@ -487,7 +548,7 @@ func TestScrapePoolRaces(t *testing.T) {
 	newConfig := func() *config.ScrapeConfig {
 		return &config.ScrapeConfig{ScrapeInterval: interval, ScrapeTimeout: timeout}
 	}
-	sp, _ := newScrapePool(newConfig(), &nopAppendable{}, 0, nil)
+	sp, _ := newScrapePool(newConfig(), &nopAppendable{}, 0, false, nil)
 	tgts := []*targetgroup.Group{
 		{
 			Targets: []model.LabelSet{
@@ -688,6 +749,61 @@ func TestScrapeLoopStop(t *testing.T) {
 	}
 }
 
+func TestScrapeLoopStopAndDrain(t *testing.T) {
+	var (
+		signal   = make(chan struct{}, 1)
+		appender = &collectResultAppender{}
+		scraper  = &testScraper{}
+		app      = func(ctx context.Context) storage.Appender { return appender }
+	)
+
+	sl := newScrapeLoop(context.Background(),
+		scraper,
+		nil, nil,
+		nopMutator,
+		nopMutator,
+		app,
+		nil,
+		0,
+		true,
+	)
+
+	// Terminate the loop after 2 scrapes.
+	numScrapes := 0
+
+	scraper.scrapeFunc = func(ctx context.Context, w io.Writer) error {
+		numScrapes++
+		if numScrapes == 2 {
+			go sl.stopAndDrain()
+			<-sl.ctx.Done()
+		}
+		w.Write([]byte("metric_a 42\n"))
+		return ctx.Err()
+	}
+
+	go func() {
+		sl.run(10*time.Millisecond, time.Hour, nil)
+		signal <- struct{}{}
+	}()
+
+	select {
+	case <-signal:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Scrape wasn't stopped.")
+	}
+
+	// Unlike stop, stopAndDrain must only return once the stale markers have
+	// been appended, without waiting for further scrape intervals.
+	if len(appender.result) < 6*3 || len(appender.result)%6 != 0 {
+		t.Fatalf("Expected at least 3 scrapes with 6 samples each, got %d samples", len(appender.result))
+	}
+	for _, s := range appender.result[len(appender.result)-5:] {
+		if !value.IsStaleNaN(s.v) {
+			t.Fatalf("Appended last sample not as expected. Wanted: stale NaN Got: %x", math.Float64bits(s.v))
+		}
+	}
+}
+
 func TestScrapeLoopRun(t *testing.T) {
 	var (
 		signal = make(chan struct{}, 1)
@@ -841,7 +957,7 @@ func TestScrapeLoopMetadata(t *testing.T) {
 	var (
 		signal  = make(chan struct{})
 		scraper = &testScraper{}
-		cache   = newScrapeCache()
+		cache   = newScrapeCache(0, 0, 0)
 	)
 	defer close(signal)
 
@@ -889,6 +1005,56 @@ test_metric 1
 	require.Equal(t, "", md.Unit)
 }
 
+func TestClientForTarget(t *testing.T) {
+	proxyURL, err := url.Parse("http://proxy.test:3128")
+	require.NoError(t, err)
+
+	cfg := &config.ScrapeConfig{
+		JobName: "proxied",
+		HTTPClientConfig: config_util.HTTPClientConfig{
+			ProxyURL: config_util.URL{URL: proxyURL},
+		},
+	}
+	sp, err := newScrapePool(cfg, &nopAppendable{}, 0, false, nil)
+	require.NoError(t, err)
+	defer sp.stop()
+
+	require.NotEqual(t, sp.client, sp.directClient)
+
+	proxied := NewTarget(labels.FromStrings(model.AddressLabel, "remote.test:9090"), nil, nil)
+	direct := NewTarget(labels.FromStrings(model.AddressLabel, "local.test:9090", proxyConnectLabel, "false"), nil, nil)
+	require.Equal(t, sp.client, sp.clientForTarget(proxied))
+	require.Equal(t, sp.directClient, sp.clientForTarget(direct))
+
+	// Without a proxy there is nothing to bypass, both targets share the
+	// same client.
+	sp2, err := newScrapePool(&config.ScrapeConfig{JobName: "direct"}, &nopAppendable{}, 0, false, nil)
+	require.NoError(t, err)
+	defer sp2.stop()
+
+	require.Equal(t, sp2.client, sp2.directClient)
+	require.Equal(t, sp2.client, sp2.clientForTarget(direct))
+}
+
+func TestCompileNameFilter(t *testing.T) {
+	require.Nil(t, compileNameFilter(&config.ScrapeConfig{}))
+
+	f := compileNameFilter(&config.ScrapeConfig{
+		MetricNameAllowlist: []string{"up", "node_*"},
+		MetricNameDenylist:  []string{"node_scrape_*"},
+	})
+	require.NotNil(t, f)
+	require.True(t, f("up"))
+	require.True(t, f("node_cpu_seconds_total"))
+	require.False(t, f("node_scrape_collector_duration_seconds"), "denylist must win over allowlist")
+	require.False(t, f("go_goroutines"))
+
+	// A lone denylist keeps everything else.
+	f = compileNameFilter(&config.ScrapeConfig{MetricNameDenylist: []string{"go_*"}})
+	require.True(t, f("up"))
+	require.False(t, f("go_goroutines"))
+}
+
 func TestScrapeLoopSeriesAdded(t *testing.T) {
 	// Need a full storage for correct Add/AddFast semantics.
 	s := teststorage.New(t)
@@ -1162,12 +1328,44 @@ func TestScrapeLoopCacheMemoryExhaustionProtection(t *testing.T) {
 	}
 }
 
+func TestScrapeCacheEntryLimit(t *testing.T) {
+	c := newScrapeCache(10, 0, 0)
+
+	// Fill the cache beyond its limit with entries from failing scrapes.
+	// The built-in heuristic alone would not flush at this size.
+	for i := 0; i < 20; i++ {
+		c.addRef(fmt.Sprintf("metric{n=\"%d\"}", i), uint64(i)+1, nil, uint64(i))
+	}
+	c.iterDone(false)
+	c.iterDone(false)
+
+	if len(c.series) > 10 {
+		t.Fatalf("Expected entry limit to flush the cache. Got %d entries", len(c.series))
+	}
+}
+
+func TestScrapeCacheFlushInterval(t *testing.T) {
+	c := newScrapeCache(0, time.Minute, 0)
+	c.addRef("metric", 1, nil, 1)
+	c.iterDone(false)
+	require.Len(t, c.series, 1)
+
+	// Push the last flush beyond the interval; the next iteration flushes
+	// regardless of scrape outcome.
+	c.lastFlush = time.Now().Add(-2 * time.Minute)
+	c.iterDone(false)
+	c.lastFlush = time.Now().Add(-2 * time.Minute)
+	c.iterDone(false)
+	require.Len(t, c.series, 0)
+}
+
 func TestScrapeLoopAppend(t *testing.T) {
 	tests := []struct {
 		title           string
 		honorLabels     bool
 		scrapeLabels    string
 		discoveryLabels []string
+		externalLabels  []string
 		expLset         labels.Labels
 		expValue        float64
 	}{
@@ -1205,6 +1403,22 @@ func TestScrapeLoopAppend(t *testing.T) {
 			discoveryLabels: []string{"n1", "0"},
 			expLset:         labels.FromStrings("__name__", "metric", "n1", "1", "n2", "2"),
 			expValue:        0,
+		}, {
+			// External labels of the job are added to samples missing them.
+			title:          "External labels",
+			honorLabels:    false,
+			scrapeLabels:   `metric 0`,
+			externalLabels: []string{"region", "eu-1"},
+			expLset:        labels.FromStrings("__name__", "metric", "region", "eu-1"),
+			expValue:       0,
+		}, {
+			// Labels already on the sample win over external labels.
+			title:          "External labels do not override",
+			honorLabels:    false,
+			scrapeLabels:   `metric{region="us-2"} 0`,
+			externalLabels: []string{"region", "eu-1"},
+			expLset:        labels.FromStrings("__name__", "metric", "region", "us-2"),
+			expValue:       0,
 		}, {
 			title:           "Stale - NaN",
 			honorLabels:     false,
@@ -1225,10 +1439,10 @@ func TestScrapeLoopAppend(t *testing.T) {
 		sl := newScrapeLoop(context.Background(),
 			nil, nil, nil,
 			func(l labels.Labels) labels.Labels {
-				return mutateSampleLabels(l, discoveryLabels, test.honorLabels, nil)
+				return mutateSampleLabels(l, discoveryLabels, test.honorLabels, nil, labels.FromStrings(test.externalLabels...))
 			},
 			func(l labels.Labels) labels.Labels {
-				return mutateReportSampleLabels(l, discoveryLabels)
+				return mutateReportSampleLabels(l, discoveryLabels, labels.FromStrings(test.externalLabels...))
 			},
 			func(ctx context.Context) storage.Appender { return app },
 			nil,
@@ -1280,7 +1494,7 @@ func TestScrapeLoopAppendCacheEntryButErrNotFound(t *testing.T) {
 	fakeRef := uint64(1)
 	expValue := float64(1)
 	metric := `metric{n="1"} 1`
-	p := textparse.New([]byte(metric), "")
+	p := textparse.New([]byte(metric), "", false)
 
 	var lset labels.Labels
 	p.Next()
@@ -1499,6 +1713,79 @@ func TestScrapeLoopAppendNoStalenessIfTimestamp(t *testing.T) {
 	require.Equal(t, want, app.result, "Appended samples not as expected")
 }
 
+func TestScrapeLoopAppendStalenessDelayed(t *testing.T) {
+	app := &collectResultAppender{}
+
+	sl := newScrapeLoop(context.Background(),
+		nil, nil, nil,
+		nopMutator,
+		nopMutator,
+		func(ctx context.Context) storage.Appender { return app },
+		newScrapeCache(0, 0, time.Minute),
+		0,
+		true,
+	)
+
+	now := time.Now()
+	slApp := sl.appender(context.Background())
+	_, _, _, err := sl.append(slApp, []byte("metric_a 1\n"), "", now)
+	require.NoError(t, err)
+	require.NoError(t, slApp.Commit())
+
+	// The series disappears, but has not been absent for stale_after yet,
+	// so no staleness marker is written.
+	slApp = sl.appender(context.Background())
+	_, _, _, err = sl.append(slApp, []byte(""), "", now.Add(time.Second))
+	require.NoError(t, err)
+	require.NoError(t, slApp.Commit())
+	require.Len(t, app.result, 1, "Expected no stale sample before stale_after elapsed")
+
+	// Once stale_after has elapsed, the marker is written.
+	slApp = sl.appender(context.Background())
+	_, _, _, err = sl.append(slApp, []byte(""), "", now.Add(2*time.Minute))
+	require.NoError(t, err)
+	require.NoError(t, slApp.Commit())
+
+	require.Len(t, app.result, 2)
+	require.Equal(t, timestamp.FromTime(now.Add(2*time.Minute)), app.result[1].t)
+	require.Equal(t, value.StaleNaN, math.Float64bits(app.result[1].v), "Appended stale sample wasn't as expected")
+}
+
+func TestScrapeLoopAppendDelayedStalenessIfTimestamp(t *testing.T) {
+	app := &collectResultAppender{}
+	sl := newScrapeLoop(context.Background(),
+		nil, nil, nil,
+		nopMutator,
+		nopMutator,
+		func(ctx context.Context) storage.Appender { return app },
+		newScrapeCache(0, 0, time.Minute),
+		0,
+		true,
+	)
+
+	// With stale_after set, series with explicit timestamps are tracked for
+	// staleness as well.
+	now := time.Now()
+	slApp := sl.appender(context.Background())
+	_, _, _, err := sl.append(slApp, []byte("metric_a 1 1000\n"), "", now)
+	require.NoError(t, err)
+	require.NoError(t, slApp.Commit())
+
+	slApp = sl.appender(context.Background())
+	_, _, _, err = sl.append(slApp, []byte(""), "", now.Add(time.Second))
+	require.NoError(t, err)
+	require.NoError(t, slApp.Commit())
+	require.Len(t, app.result, 1, "Expected no stale sample before stale_after elapsed")
+
+	slApp = sl.appender(context.Background())
+	_, _, _, err = sl.append(slApp, []byte(""), "", now.Add(2*time.Minute))
+	require.NoError(t, err)
+	require.NoError(t, slApp.Commit())
+
+	require.Len(t, app.result, 2)
+	require.Equal(t, value.StaleNaN, math.Float64bits(app.result[1].v), "Appended stale sample wasn't as expected")
+}
+
 func TestScrapeLoopRunReportsTargetDownOnScrapeError(t *testing.T) {
 	var (
 		scraper  = &testScraper{}
@@ -1610,6 +1897,110 @@ func TestScrapeLoopAppendGracefullyIfAmendOrOutOfOrderOrOutOfBounds(t *testing.T
 	require.Equal(t, 1, seriesAdded)
 }
 
+func TestScrapeLoopAppendDuplicateSamplesLast(t *testing.T) {
+	app := &collectResultAppender{}
+
+	sl := newScrapeLoop(context.Background(),
+		nil,
+		nil, nil,
+		nopMutator,
+		nopMutator,
+		func(ctx context.Context) storage.Appender { return app },
+		nil,
+		0,
+		true,
+	)
+	sl.duplicateMode = config.DuplicateSamplesLast
+
+	now := time.Unix(1, 0)
+	slApp := sl.appender(context.Background())
+	total, added, seriesAdded, err := sl.append(slApp, []byte("metric_a 1\nmetric_b 2\nmetric_a 3\n"), "", now)
+	require.NoError(t, err)
+	require.NoError(t, slApp.Commit())
+
+	want := []sample{
+		{
+			metric: labels.FromStrings(model.MetricNameLabel, "metric_b"),
+			t:      timestamp.FromTime(now),
+			v:      2,
+		},
+		{
+			metric: labels.FromStrings(model.MetricNameLabel, "metric_a"),
+			t:      timestamp.FromTime(now),
+			v:      3,
+		},
+	}
+	require.Equal(t, want, app.result, "Appended samples not as expected")
+	require.Equal(t, 3, total)
+	require.Equal(t, 2, added)
+	require.Equal(t, 2, seriesAdded)
+}
+
+func TestScrapeLoopAppendCreatedTimestampZero(t *testing.T) {
+	app := &collectResultAppender{}
+
+	sl := newScrapeLoop(context.Background(),
+		nil,
+		nil, nil,
+		nopMutator,
+		nopMutator,
+		func(ctx context.Context) storage.Appender { return app },
+		nil,
+		0,
+		true,
+	)
+	sl.ingestCTZero = true
+
+	now := time.Unix(10, 0)
+	slApp := sl.appender(context.Background())
+	body := "# TYPE a counter\na_total 17.0 5.0\na_created 2.0\n# EOF\n"
+	_, _, _, err := sl.append(slApp, []byte(body), "application/openmetrics-text", now)
+	require.NoError(t, err)
+	require.NoError(t, slApp.Commit())
+
+	want := []sample{
+		{
+			// Synthetic zero sample at the created timestamp.
+			metric: labels.FromStrings(model.MetricNameLabel, "a_total"),
+			t:      2000,
+			v:      0,
+		},
+		{
+			metric: labels.FromStrings(model.MetricNameLabel, "a_total"),
+			t:      5000,
+			v:      17,
+		},
+		{
+			metric: labels.FromStrings(model.MetricNameLabel, "a_created"),
+			t:      timestamp.FromTime(now),
+			v:      2,
+		},
+	}
+	require.Equal(t, want, app.result, "Appended samples not as expected")
+}
+
+func TestScrapeLoopAppendDuplicateSamplesFail(t *testing.T) {
+	app := &errorAppender{}
+
+	sl := newScrapeLoop(context.Background(),
+		nil,
+		nil, nil,
+		nopMutator,
+		nopMutator,
+		func(ctx context.Context) storage.Appender { return app },
+		nil,
+		0,
+		true,
+	)
+	sl.duplicateMode = config.DuplicateSamplesFail
+
+	now := time.Unix(1, 0)
+	slApp := sl.appender(context.Background())
+	_, _, _, err := sl.append(slApp, []byte("normal 1\namend 1\n"), "", now)
+	require.Equal(t, storage.ErrDuplicateSampleForTimestamp, errors.Cause(err))
+	require.NoError(t, slApp.Rollback())
+}
+
 func TestScrapeLoopOutOfBoundsTimeError(t *testing.T) {
 	app := &collectResultAppender{}
 	sl := newScrapeLoop(context.Background(),
@@ -1686,6 +2077,134 @@ func TestTargetScraperScrapeOK(t *testing.T) {
 	require.Equal(t, "metric_a 1\nmetric_b 2\n", buf.String())
 }
 
+func TestTargetScraperSchemeAutodetect(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("metric_a 1\n"))
+	})
+
+	// A plain http target: the https probe fails the TLS handshake and the
+	// scraper downgrades to http for this and all subsequent scrapes.
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	ts := &targetScraper{
+		Target: &Target{
+			labels: labels.FromStrings(
+				model.SchemeLabel, "http",
+				model.AddressLabel, serverURL.Host,
+			),
+		},
+		client:           http.DefaultClient,
+		timeout:          time.Second,
+		schemeAutodetect: true,
+	}
+	var buf bytes.Buffer
+	_, err = ts.scrape(context.Background(), &buf)
+	require.NoError(t, err)
+	require.Equal(t, "http", ts.detectedScheme)
+	require.Equal(t, "metric_a 1\n", buf.String())
+
+	// A TLS-enabled target sticks with https.
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+
+	tlsURL, err := url.Parse(tlsServer.URL)
+	require.NoError(t, err)
+
+	ts = &targetScraper{
+		Target: &Target{
+			labels: labels.FromStrings(
+				model.SchemeLabel, "http",
+				model.AddressLabel, tlsURL.Host,
+			),
+		},
+		client:           tlsServer.Client(),
+		timeout:          time.Second,
+		schemeAutodetect: true,
+	}
+	buf.Reset()
+	_, err = ts.scrape(context.Background(), &buf)
+	require.NoError(t, err)
+	require.Equal(t, "https", ts.detectedScheme)
+}
+
+func TestTargetScraperCustomHeaders(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if got := r.Header.Get("X-Org-Id"); got != "42" {
+				t.Errorf("Expected X-Org-Id header %q, got %q", "42", got)
+			}
+			w.Write([]byte("metric_a 1\n"))
+		}),
+	)
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := &targetScraper{
+		Target: &Target{
+			labels: labels.FromStrings(
+				model.SchemeLabel, serverURL.Scheme,
+				model.AddressLabel, serverURL.Host,
+			),
+		},
+		client:  http.DefaultClient,
+		headers: map[string]string{"X-Org-Id": "42"},
+	}
+	var buf bytes.Buffer
+
+	_, err = ts.scrape(context.Background(), &buf)
+	require.NoError(t, err)
+	require.Equal(t, "metric_a 1\n", buf.String())
+}
+
+func TestTargetScraperDecompressionLimit(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			gzw := gzip.NewWriter(w)
+			for i := 0; i < 1000; i++ {
+				gzw.Write([]byte("metric_a 1\n"))
+			}
+			gzw.Close()
+		}),
+	)
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := &targetScraper{
+		Target: &Target{
+			labels: labels.FromStrings(
+				model.SchemeLabel, serverURL.Scheme,
+				model.AddressLabel, serverURL.Host,
+			),
+		},
+		client:             http.DefaultClient,
+		decompressionLimit: 100,
+	}
+	var buf bytes.Buffer
+
+	_, err = ts.scrape(context.Background(), &buf)
+	require.Equal(t, errDecompressionLimit, err)
+
+	// A large enough limit lets the scrape through.
+	ts.decompressionLimit = 1 << 20
+	buf.Reset()
+	_, err = ts.scrape(context.Background(), &buf)
+	require.NoError(t, err)
+	require.Equal(t, 11000, buf.Len())
+}
+
 func TestTargetScrapeScrapeCancel(t *testing.T) {
 	block := make(chan struct{})
 
@@ -2020,7 +2539,7 @@ func TestReuseScrapeCache(t *testing.T) {
 			ScrapeInterval: model.Duration(5 * time.Second),
 			MetricsPath:    "/metrics",
 		}
-		sp, _ = newScrapePool(cfg, app, 0, nil)
+		sp, _ = newScrapePool(cfg, app, 0, false, nil)
 		t1    = &Target{
 			discoveredLabels: labels.Labels{
 				labels.Label{
@@ -2174,7 +2693,7 @@ func TestReuseCacheRace(t *testing.T) {
 			ScrapeInterval: model.Duration(5 * time.Second),
 			MetricsPath:    "/metrics",
 		}
-		sp, _ = newScrapePool(cfg, app, 0, nil)
+		sp, _ = newScrapePool(cfg, app, 0, false, nil)
 		t1    = &Target{
 			discoveredLabels: labels.Labels{
 				labels.Label{
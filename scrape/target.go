@@ -14,12 +14,17 @@
 package scrape
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
 	"hash/fnv"
+	"io/ioutil"
 	"net"
+	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
@@ -59,6 +64,17 @@ type Target struct {
 	lastScrapeDuration time.Duration
 	health             TargetHealth
 	metadata           MetricMetadataStore
+	history            []ScrapeOutcome
+}
+
+// scrapeHistoryLen is the number of past scrape outcomes kept per target.
+const scrapeHistoryLen = 10
+
+// ScrapeOutcome records the result of a single scrape of a target.
+type ScrapeOutcome struct {
+	Start    time.Time
+	Duration time.Duration
+	Err      error
 }
 
 // NewTarget creates a reasonably configured target for querying.
@@ -217,14 +233,64 @@ func (t *Target) URL() *url.URL {
 		}
 	}
 
+	host := t.labels.Get(model.AddressLabel)
+	// Unix socket targets carry the socket path percent-encoded in the URL
+	// host; unixSocketRoundTripper decodes it again when dialing.
+	if strings.HasPrefix(host, "unix://") {
+		host = url.QueryEscape(strings.TrimPrefix(host, "unix://"))
+	}
+
 	return &url.URL{
 		Scheme:   t.labels.Get(model.SchemeLabel),
-		Host:     t.labels.Get(model.AddressLabel),
+		Host:     host,
 		Path:     t.labels.Get(model.MetricsPathLabel),
 		RawQuery: params.Encode(),
 	}
 }
 
+// Special labels overriding scrape authorization for an individual target.
+// They are typically set by relabeling, e.g. from SD metadata carrying
+// per-host credentials, and are removed before series are ingested.
+const (
+	bearerTokenLabel       = "__bearer_token__"
+	bearerTokenFileLabel   = "__bearer_token_file__"
+	basicAuthUsernameLabel = "__basic_auth_username__"
+	basicAuthPasswordLabel = "__basic_auth_password__"
+)
+
+// authorizationHeader returns the Authorization header value configured for
+// this target through the special auth labels, or an empty string if the
+// job-level HTTP client configuration applies.
+func (t *Target) authorizationHeader() (string, error) {
+	if token := t.labels.Get(bearerTokenLabel); token != "" {
+		return "Bearer " + token, nil
+	}
+	if f := t.labels.Get(bearerTokenFileLabel); f != "" {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return "", errors.Wrapf(err, "unable to read bearer token file %s", f)
+		}
+		return "Bearer " + strings.TrimSpace(string(b)), nil
+	}
+	if user := t.labels.Get(basicAuthUsernameLabel); user != "" {
+		auth := user + ":" + t.labels.Get(basicAuthPasswordLabel)
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(auth)), nil
+	}
+	return "", nil
+}
+
+// proxyConnectLabel is a special label controlling whether an individual
+// target is scraped through the job-level proxy. Setting it to "false" via
+// relabeling, e.g. for targets the server can reach directly, bypasses the
+// configured proxy_url for that target.
+const proxyConnectLabel = "__proxy_connect__"
+
+// usesDirectConnection reports whether the target opted out of the job-level
+// proxy through the __proxy_connect__ special label.
+func (t *Target) usesDirectConnection() bool {
+	return t.labels.Get(proxyConnectLabel) == "false"
+}
+
 // Report sets target data about the last scrape.
 func (t *Target) Report(start time.Time, dur time.Duration, err error) {
 	t.mtx.Lock()
@@ -239,6 +305,23 @@ func (t *Target) Report(start time.Time, dur time.Duration, err error) {
 	t.lastError = err
 	t.lastScrape = start
 	t.lastScrapeDuration = dur
+
+	if len(t.history) == scrapeHistoryLen {
+		copy(t.history, t.history[1:])
+		t.history = t.history[:scrapeHistoryLen-1]
+	}
+	t.history = append(t.history, ScrapeOutcome{Start: start, Duration: dur, Err: err})
+}
+
+// ScrapeHistory returns the outcomes of the most recent scrapes of the
+// target, oldest first.
+func (t *Target) ScrapeHistory() []ScrapeOutcome {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	history := make([]ScrapeOutcome, len(t.history))
+	copy(history, t.history)
+	return history
 }
 
 // LastError returns the error encountered during the last scrape.
@@ -249,6 +332,49 @@ func (t *Target) LastError() error {
 	return t.lastError
 }
 
+// errHTTPStatus is returned when a scrape target responds with an unexpected
+// HTTP status code.
+type errHTTPStatus struct {
+	status string
+	code   int
+}
+
+func (e *errHTTPStatus) Error() string {
+	return fmt.Sprintf("server returned HTTP status %s", e.status)
+}
+
+// ErrorReason classifies a scrape error into a coarse category that can be
+// aggregated across a fleet: "timeout", "dns", "refused", "http_4xx",
+// "http_5xx" or "other". It returns an empty string for a nil error.
+func ErrorReason(err error) string {
+	if err == nil {
+		return ""
+	}
+	var (
+		httpErr *errHTTPStatus
+		dnsErr  *net.DNSError
+		netErr  net.Error
+	)
+	switch {
+	case errors.As(err, &httpErr):
+		switch {
+		case httpErr.code >= 500:
+			return "http_5xx"
+		case httpErr.code >= 400:
+			return "http_4xx"
+		}
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "refused"
+	}
+	return "other"
+}
+
 // LastScrape returns the time of the last scrape.
 func (t *Target) LastScrape() time.Time {
 	t.mtx.RLock()
@@ -364,6 +490,15 @@ func populateLabels(lset labels.Labels, cfg *config.ScrapeConfig) (res, orig lab
 			lb.Set(model.ParamLabelPrefix+k, v[0])
 		}
 	}
+	// Encode scrape query parameters taken from target labels. They are
+	// resolved before relabeling, so discovery meta labels may be referenced,
+	// and override a static parameter of the same name. The values are
+	// URL-encoded when the scrape URL is built.
+	for k, name := range cfg.ParamsFromLabels {
+		if v := lset.Get(name); v != "" {
+			lb.Set(model.ParamLabelPrefix+k, v)
+		}
+	}
 
 	preRelabelLabels := lb.Labels()
 	lset = relabel.Process(preRelabelLabels, cfg.RelabelConfigs...)
@@ -392,7 +527,7 @@ func populateLabels(lset labels.Labels, cfg *config.ScrapeConfig) (res, orig lab
 	}
 	addr := lset.Get(model.AddressLabel)
 	// If it's an address with no trailing port, infer it based on the used scheme.
-	if addPort(addr) {
+	if !strings.HasPrefix(addr, "unix://") && addPort(addr) {
 		// Addresses reaching this point are already wrapped in [] if necessary.
 		switch lset.Get(model.SchemeLabel) {
 		case "http", "":
@@ -460,3 +595,37 @@ func targetsFromGroup(tg *targetgroup.Group, cfg *config.ScrapeConfig) ([]*Targe
 	}
 	return targets, nil
 }
+
+// unixSocketRoundTripper routes requests for unix socket targets to a
+// transport that dials the socket path encoded in the URL host by
+// Target.URL. All other requests pass through unchanged.
+type unixSocketRoundTripper struct {
+	next http.RoundTripper
+	unix http.RoundTripper
+}
+
+func newUnixSocketRoundTripper(next http.RoundTripper) http.RoundTripper {
+	return &unixSocketRoundTripper{
+		next: next,
+		unix: &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				host, _, err := net.SplitHostPort(addr)
+				if err != nil {
+					host = addr
+				}
+				path, err := url.QueryUnescape(host)
+				if err != nil {
+					return nil, err
+				}
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
+
+func (rt *unixSocketRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if path, err := url.QueryUnescape(req.URL.Host); err == nil && strings.HasPrefix(path, "/") {
+		return rt.unix.RoundTrip(req)
+	}
+	return rt.next.RoundTrip(req)
+}
@@ -14,17 +14,24 @@
 package scrape
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
 	config_util "github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
@@ -43,6 +50,30 @@ func TestTargetLabels(t *testing.T) {
 	require.Equal(t, want, got)
 }
 
+func TestTargetScrapeHistory(t *testing.T) {
+	target := newTestTarget("example.com:80", 0, nil)
+	require.Empty(t, target.ScrapeHistory())
+
+	start := time.Unix(0, 0)
+	for i := 0; i < scrapeHistoryLen+2; i++ {
+		var err error
+		if i%2 == 0 {
+			err = fmt.Errorf("scrape %d failed", i)
+		}
+		target.Report(start.Add(time.Duration(i)*time.Second), time.Duration(i)*time.Millisecond, err)
+	}
+
+	history := target.ScrapeHistory()
+	require.Len(t, history, scrapeHistoryLen)
+	// The two oldest outcomes have been dropped.
+	require.Equal(t, start.Add(2*time.Second), history[0].Start)
+	require.EqualError(t, history[0].Err, "scrape 2 failed")
+	last := history[len(history)-1]
+	require.Equal(t, start.Add(time.Duration(scrapeHistoryLen+1)*time.Second), last.Start)
+	require.Equal(t, time.Duration(scrapeHistoryLen+1)*time.Millisecond, last.Duration)
+	require.NoError(t, last.Err)
+}
+
 func TestTargetOffset(t *testing.T) {
 	interval := 10 * time.Second
 	jitter := uint64(0)
@@ -121,6 +152,47 @@ func TestTargetURL(t *testing.T) {
 	require.Equal(t, expectedURL, target.URL())
 }
 
+func TestTargetAuthorizationHeader(t *testing.T) {
+	tokenFile, err := ioutil.TempFile("", "bearertoken")
+	require.NoError(t, err)
+	defer os.Remove(tokenFile.Name())
+	_, err = tokenFile.WriteString("filetoken\n")
+	require.NoError(t, err)
+	require.NoError(t, tokenFile.Close())
+
+	cases := []struct {
+		lbls     map[string]string
+		expected string
+	}{
+		{
+			lbls:     map[string]string{},
+			expected: "",
+		},
+		{
+			lbls:     map[string]string{bearerTokenLabel: "secret"},
+			expected: "Bearer secret",
+		},
+		{
+			lbls:     map[string]string{bearerTokenFileLabel: tokenFile.Name()},
+			expected: "Bearer filetoken",
+		},
+		{
+			lbls:     map[string]string{basicAuthUsernameLabel: "user", basicAuthPasswordLabel: "pass"},
+			expected: "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass")),
+		},
+	}
+	for _, c := range cases {
+		target := NewTarget(labels.FromMap(c.lbls), nil, nil)
+		auth, err := target.authorizationHeader()
+		require.NoError(t, err)
+		require.Equal(t, c.expected, auth)
+	}
+
+	target := NewTarget(labels.FromMap(map[string]string{bearerTokenFileLabel: "does-not-exist"}), nil, nil)
+	_, err = target.authorizationHeader()
+	require.Error(t, err)
+}
+
 func newTestTarget(targetURL string, deadline time.Duration, lbls labels.Labels) *Target {
 	lb := labels.NewBuilder(lbls)
 	lb.Set(model.SchemeLabel, "http")
@@ -365,3 +437,52 @@ func TestNewClientWithBadTLSConfig(t *testing.T) {
 		t.Fatalf("Expected error, got nil.")
 	}
 }
+
+func TestErrorReason(t *testing.T) {
+	cases := []struct {
+		err    error
+		reason string
+	}{
+		{nil, ""},
+		{&errHTTPStatus{status: "503 Service Unavailable", code: 503}, "http_5xx"},
+		{&errHTTPStatus{status: "404 Not Found", code: 404}, "http_4xx"},
+		{&net.DNSError{Err: "no such host"}, "dns"},
+		{context.DeadlineExceeded, "timeout"},
+		{&url.Error{Op: "Get", Err: syscall.ECONNREFUSED}, "refused"},
+		{errors.New("something else"), "other"},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.reason, ErrorReason(c.err))
+	}
+}
+
+func TestUnixSocketTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unixsocket")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "exporter.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("metric_a 1\n"))
+	})}
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	target := NewTarget(labels.FromMap(map[string]string{
+		model.SchemeLabel:      "http",
+		model.AddressLabel:     "unix://" + socket,
+		model.MetricsPathLabel: "/metrics",
+	}), nil, nil)
+
+	client := &http.Client{Transport: newUnixSocketRoundTripper(http.DefaultTransport)}
+	resp, err := client.Get(target.URL().String())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "metric_a 1\n", string(body))
+}
@@ -29,6 +29,12 @@ type fanout struct {
 
 	primary     Storage
 	secondaries []Storage
+
+	// If failover is set, errors from the primary querier do not fail the
+	// query as long as there are secondaries to answer it from; instead the
+	// primary is demoted to a best effort querier and its errors are
+	// returned as warnings.
+	failover bool
 }
 
 // NewFanout returns a new fanout Storage, which proxies reads and writes
@@ -48,6 +54,21 @@ func NewFanout(logger log.Logger, primary Storage, secondaries ...Storage) Stora
 	}
 }
 
+// NewFailoverFanout works like NewFanout, except that read errors from the
+// primary storage only fail a query if there is no secondary to fall back to.
+// With secondaries configured, the primary is queried on a best effort basis
+// like the secondaries, so e.g. after local data loss a query is transparently
+// answered from a peer's remote read endpoint, with the local error surfaced
+// as a warning.
+func NewFailoverFanout(logger log.Logger, primary Storage, secondaries ...Storage) Storage {
+	return &fanout{
+		logger:      logger,
+		primary:     primary,
+		secondaries: secondaries,
+		failover:    true,
+	}
+}
+
 // StartTime implements the Storage interface.
 func (f *fanout) StartTime() (int64, error) {
 	// StartTime of a fanout should be the earliest StartTime of all its storages,
@@ -72,15 +93,28 @@ func (f *fanout) StartTime() (int64, error) {
 func (f *fanout) Querier(ctx context.Context, mint, maxt int64) (Querier, error) {
 	primary, err := f.primary.Querier(ctx, mint, maxt)
 	if err != nil {
-		return nil, err
+		if !f.failover || len(f.secondaries) == 0 {
+			return nil, err
+		}
+		level.Warn(f.logger).Log("msg", "Primary querier failed, serving reads from secondaries only", "err", err)
+		primary = nil
 	}
 
-	secondaries := make([]Querier, 0, len(f.secondaries))
+	secondaries := make([]Querier, 0, len(f.secondaries)+1)
+	if f.failover && primary != nil && len(f.secondaries) > 0 {
+		// In failover mode the primary is queried on a best effort basis as
+		// well, so that its errors during Select degrade to warnings.
+		secondaries = append(secondaries, primary)
+		primary = nil
+	}
 	for _, storage := range f.secondaries {
 		querier, err := storage.Querier(ctx, mint, maxt)
 		if err != nil {
 			// Close already open Queriers, append potential errors to returned error.
-			errs := tsdb_errors.NewMulti(err, primary.Close())
+			errs := tsdb_errors.NewMulti(err)
+			if primary != nil {
+				errs.Add(primary.Close())
+			}
 			for _, q := range secondaries {
 				errs.Add(q.Close())
 			}
@@ -88,21 +122,39 @@ func (f *fanout) Querier(ctx context.Context, mint, maxt int64) (Querier, error)
 		}
 		secondaries = append(secondaries, querier)
 	}
-	return NewMergeQuerier([]Querier{primary}, secondaries, ChainedSeriesMerge), nil
+
+	var primaries []Querier
+	if primary != nil {
+		primaries = append(primaries, primary)
+	}
+	return NewMergeQuerier(primaries, secondaries, ChainedSeriesMerge), nil
 }
 
 func (f *fanout) ChunkQuerier(ctx context.Context, mint, maxt int64) (ChunkQuerier, error) {
 	primary, err := f.primary.ChunkQuerier(ctx, mint, maxt)
 	if err != nil {
-		return nil, err
+		if !f.failover || len(f.secondaries) == 0 {
+			return nil, err
+		}
+		level.Warn(f.logger).Log("msg", "Primary chunk querier failed, serving reads from secondaries only", "err", err)
+		primary = nil
 	}
 
-	secondaries := make([]ChunkQuerier, 0, len(f.secondaries))
+	secondaries := make([]ChunkQuerier, 0, len(f.secondaries)+1)
+	if f.failover && primary != nil && len(f.secondaries) > 0 {
+		// In failover mode the primary is queried on a best effort basis as
+		// well, so that its errors during Select degrade to warnings.
+		secondaries = append(secondaries, primary)
+		primary = nil
+	}
 	for _, storage := range f.secondaries {
 		querier, err := storage.ChunkQuerier(ctx, mint, maxt)
 		if err != nil {
 			// Close already open Queriers, append potential errors to returned error.
-			errs := tsdb_errors.NewMulti(err, primary.Close())
+			errs := tsdb_errors.NewMulti(err)
+			if primary != nil {
+				errs.Add(primary.Close())
+			}
 			for _, q := range secondaries {
 				errs.Add(q.Close())
 			}
@@ -110,7 +162,12 @@ func (f *fanout) ChunkQuerier(ctx context.Context, mint, maxt int64) (ChunkQueri
 		}
 		secondaries = append(secondaries, querier)
 	}
-	return NewMergeChunkQuerier([]ChunkQuerier{primary}, secondaries, NewCompactingChunkSeriesMerger(ChainedSeriesMerge)), nil
+
+	var primaries []ChunkQuerier
+	if primary != nil {
+		primaries = append(primaries, primary)
+	}
+	return NewMergeChunkQuerier(primaries, secondaries, NewCompactingChunkSeriesMerger(ChainedSeriesMerge)), nil
 }
 
 func (f *fanout) Appender(ctx context.Context) Appender {
@@ -207,6 +207,45 @@ func TestFanoutErrors(t *testing.T) {
 	}
 }
 
+func TestFailoverFanoutErrors(t *testing.T) {
+	workingStorage := teststorage.New(t)
+	defer workingStorage.Close()
+
+	// With failover enabled, a failing primary degrades to a warning as long
+	// as a secondary can answer the query.
+	fanoutStorage := storage.NewFailoverFanout(nil, errStorage{}, workingStorage)
+
+	querier, err := fanoutStorage.Querier(context.Background(), 0, 8000)
+	require.NoError(t, err)
+	defer querier.Close()
+
+	matcher := labels.MustNewMatcher(labels.MatchEqual, "a", "b")
+	ss := querier.Select(true, nil, matcher)
+
+	// Exhaust.
+	for ss.Next() {
+		ss.At()
+	}
+
+	require.NoError(t, ss.Err())
+	require.Greater(t, len(ss.Warnings()), 0, "warnings expected")
+	require.Equal(t, errSelect.Error(), ss.Warnings()[0].Error())
+
+	// Without a secondary, the primary error is returned as usual.
+	fanoutStorage = storage.NewFailoverFanout(nil, errStorage{})
+
+	querier, err = fanoutStorage.Querier(context.Background(), 0, 8000)
+	require.NoError(t, err)
+	defer querier.Close()
+
+	ss = querier.Select(true, nil, matcher)
+	for ss.Next() {
+		ss.At()
+	}
+	require.Error(t, ss.Err())
+	require.Equal(t, errSelect.Error(), ss.Err().Error())
+}
+
 var errSelect = errors.New("select error")
 
 type errStorage struct{}
@@ -0,0 +1,84 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// NewSeriesLimitQueryable returns a Queryable that restricts the number of
+// series any single Select of the given Queryable may return. As every
+// evaluation step of a query operates on the series of one Select, this
+// bounds the width of a query. A limit of 0 or less means no limit.
+func NewSeriesLimitQueryable(q Queryable, limit int) Queryable {
+	if limit <= 0 {
+		return q
+	}
+	return &seriesLimitQueryable{q: q, limit: limit}
+}
+
+type seriesLimitQueryable struct {
+	q     Queryable
+	limit int
+}
+
+func (q *seriesLimitQueryable) Querier(ctx context.Context, mint, maxt int64) (Querier, error) {
+	qr, err := q.q.Querier(ctx, mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+	return &seriesLimitQuerier{Querier: qr, limit: q.limit}, nil
+}
+
+type seriesLimitQuerier struct {
+	Querier
+	limit int
+}
+
+func (q *seriesLimitQuerier) Select(sortSeries bool, hints *SelectHints, matchers ...*labels.Matcher) SeriesSet {
+	return &seriesLimitSeriesSet{SeriesSet: q.Querier.Select(sortSeries, hints, matchers...), limit: q.limit}
+}
+
+type seriesLimitSeriesSet struct {
+	SeriesSet
+	limit int
+	n     int
+	err   error
+}
+
+func (s *seriesLimitSeriesSet) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	if !s.SeriesSet.Next() {
+		return false
+	}
+	s.n++
+	if s.n > s.limit {
+		s.err = errors.Errorf("query would return more than %d series per step", s.limit)
+		return false
+	}
+	return true
+}
+
+func (s *seriesLimitSeriesSet) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.SeriesSet.Err()
+}
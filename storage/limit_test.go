@@ -0,0 +1,69 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+type staticQueryable struct {
+	series []Series
+}
+
+func (q staticQueryable) Querier(_ context.Context, mint, maxt int64) (Querier, error) {
+	return staticQuerier{series: q.series}, nil
+}
+
+type staticQuerier struct {
+	noopQuerier
+	series []Series
+}
+
+func (q staticQuerier) Select(bool, *SelectHints, ...*labels.Matcher) SeriesSet {
+	return NewMockSeriesSet(q.series...)
+}
+
+func TestSeriesLimitQueryable(t *testing.T) {
+	var series []Series
+	for i := 0; i < 10; i++ {
+		series = append(series, NewListSeries(labels.FromStrings("i", fmt.Sprintf("%d", i)), nil))
+	}
+	queryable := staticQueryable{series: series}
+
+	// No limit configured returns the Queryable unchanged.
+	require.Equal(t, Queryable(queryable), NewSeriesLimitQueryable(queryable, 0))
+
+	q, err := NewSeriesLimitQueryable(queryable, 10).Querier(context.Background(), 0, 100)
+	require.NoError(t, err)
+	ss := q.Select(false, nil)
+	for i := 0; ss.Next(); i++ {
+		require.Equal(t, series[i].Labels(), ss.At().Labels())
+	}
+	require.NoError(t, ss.Err())
+
+	q, err = NewSeriesLimitQueryable(queryable, 3).Querier(context.Background(), 0, 100)
+	require.NoError(t, err)
+	ss = q.Select(false, nil)
+	for i := 0; i < 3; i++ {
+		require.True(t, ss.Next())
+	}
+	require.False(t, ss.Next())
+	require.EqualError(t, ss.Err(), "query would return more than 3 series per step")
+}
@@ -0,0 +1,393 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oss uploads finished TSDB blocks to Alibaba Cloud Object Storage
+// Service (OSS), providing simple long-term block storage without external
+// agents.
+package oss
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/prometheus/prometheus/tsdb"
+)
+
+var (
+	uploadsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "prometheus_oss_block_uploads_total",
+		Help: "Total number of TSDB blocks uploaded to OSS.",
+	})
+	uploadFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "prometheus_oss_block_upload_failures_total",
+		Help: "Total number of TSDB block uploads to OSS that failed.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(uploadsTotal)
+	prometheus.MustRegister(uploadFailuresTotal)
+}
+
+// Options configures the OSS block uploader.
+type Options struct {
+	// Endpoint of the OSS region the bucket lives in, e.g.
+	// oss-cn-hangzhou.aliyuncs.com.
+	Endpoint string
+	// Bucket the blocks are uploaded to. Uploading is disabled if empty.
+	Bucket string
+	// Prefix prepended to the object keys of uploaded blocks.
+	Prefix string
+	// AccessKeyID and AccessKeySecret are the credentials used to sign
+	// requests. If empty, they are read from the standard Alibaba Cloud
+	// environment variables.
+	AccessKeyID     string
+	AccessKeySecret string
+	// SyncInterval is how often the local blocks are compared against the
+	// bucket contents.
+	SyncInterval time.Duration
+	// DeleteLocal marks uploaded blocks as deletable so the TSDB removes
+	// the local copies during its next compaction cycle.
+	DeleteLocal bool
+}
+
+// stateFilename is the file in the TSDB directory recording which files of
+// partially uploaded blocks already exist in the bucket, so interrupted
+// uploads resume after a restart instead of starting over.
+const stateFilename = "oss_upload_state.json"
+
+// uploadState is the on-disk format of the upload progress file. It maps
+// block ULIDs to the files of that block that have been fully uploaded.
+type uploadState struct {
+	Version int                 `json:"version"`
+	Blocks  map[string][]string `json:"blocks"`
+}
+
+// Uploader periodically scans the TSDB directory for finished blocks and
+// uploads those missing from the configured bucket. A block counts as
+// uploaded once its meta.json object exists; it is therefore written last.
+// Progress of partial uploads is persisted after every file so interrupted
+// uploads resume where they left off.
+type Uploader struct {
+	logger log.Logger
+	opts   Options
+	dir    string
+	base   string
+	client *http.Client
+
+	mtx      sync.Mutex
+	uploaded map[ulid.ULID]struct{}
+	// state is only accessed from the sync goroutine.
+	state uploadState
+
+	done chan struct{}
+}
+
+// NewUploader returns a new Uploader watching the given TSDB directory.
+func NewUploader(logger log.Logger, dir string, opts Options) (*Uploader, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if opts.Endpoint == "" {
+		return nil, errors.New("OSS endpoint must not be empty")
+	}
+	if opts.Bucket == "" {
+		return nil, errors.New("OSS bucket must not be empty")
+	}
+	if opts.AccessKeyID == "" {
+		opts.AccessKeyID = os.Getenv("ALIBABA_CLOUD_ACCESS_KEY_ID")
+	}
+	if opts.AccessKeySecret == "" {
+		opts.AccessKeySecret = os.Getenv("ALIBABA_CLOUD_ACCESS_KEY_SECRET")
+	}
+	if opts.AccessKeyID == "" || opts.AccessKeySecret == "" {
+		return nil, errors.New("no OSS credentials found, set ALIBABA_CLOUD_ACCESS_KEY_ID and ALIBABA_CLOUD_ACCESS_KEY_SECRET")
+	}
+	scheme, host := "https", opts.Endpoint
+	if i := strings.Index(host, "://"); i >= 0 {
+		scheme, host = host[:i], host[i+3:]
+	}
+	u := &Uploader{
+		logger:   logger,
+		opts:     opts,
+		dir:      dir,
+		base:     fmt.Sprintf("%s://%s.%s", scheme, opts.Bucket, host),
+		client:   &http.Client{Timeout: 10 * time.Minute},
+		uploaded: map[ulid.ULID]struct{}{},
+		state:    uploadState{Version: 1, Blocks: map[string][]string{}},
+		done:     make(chan struct{}),
+	}
+	if err := u.loadState(); err != nil {
+		level.Warn(logger).Log("msg", "Failed to load OSS upload state, starting over", "err", err)
+	}
+	return u, nil
+}
+
+// loadState restores persisted upload progress from the TSDB directory.
+// A missing state file is not an error.
+func (u *Uploader) loadState() error {
+	b, err := ioutil.ReadFile(filepath.Join(u.dir, stateFilename))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state uploadState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+	if state.Blocks == nil {
+		state.Blocks = map[string][]string{}
+	}
+	state.Version = 1
+	u.state = state
+	return nil
+}
+
+// saveState atomically persists the current upload progress.
+func (u *Uploader) saveState() error {
+	b, err := json.Marshal(u.state)
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(u.dir, stateFilename)
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// Run uploads new blocks every sync interval until Stop is called.
+func (u *Uploader) Run() {
+	ticker := time.NewTicker(u.opts.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := u.sync(); err != nil {
+			level.Error(u.logger).Log("msg", "Failed to sync blocks to OSS", "err", err)
+		}
+		select {
+		case <-u.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop terminates the Run loop.
+func (u *Uploader) Stop() {
+	close(u.done)
+}
+
+// BlocksToDelete wraps the given function so that blocks already uploaded to
+// OSS are additionally marked as deletable when local pruning is enabled.
+func (u *Uploader) BlocksToDelete(next tsdb.BlocksToDeleteFunc) tsdb.BlocksToDeleteFunc {
+	return func(blocks []*tsdb.Block) map[ulid.ULID]struct{} {
+		deletable := next(blocks)
+		if !u.opts.DeleteLocal {
+			return deletable
+		}
+		u.mtx.Lock()
+		defer u.mtx.Unlock()
+		for _, b := range blocks {
+			if _, ok := u.uploaded[b.Meta().ULID]; ok {
+				deletable[b.Meta().ULID] = struct{}{}
+			}
+		}
+		return deletable
+	}
+}
+
+// sync uploads all finished local blocks that do not exist in the bucket yet.
+func (u *Uploader) sync() error {
+	dirs, err := ioutil.ReadDir(u.dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range dirs {
+		if !fi.IsDir() {
+			continue
+		}
+		id, err := ulid.ParseStrict(fi.Name())
+		if err != nil {
+			continue
+		}
+		u.mtx.Lock()
+		_, ok := u.uploaded[id]
+		u.mtx.Unlock()
+		if ok {
+			continue
+		}
+		dir := filepath.Join(u.dir, fi.Name())
+		if _, err := os.Stat(filepath.Join(dir, "meta.json")); err != nil {
+			// The block is still being written or is being deleted.
+			continue
+		}
+		ok, err = u.exists(u.key(id, "meta.json"))
+		if err != nil {
+			return errors.Wrapf(err, "check block %s", id)
+		}
+		if !ok {
+			if err := u.uploadBlock(dir, id); err != nil {
+				uploadFailuresTotal.Inc()
+				return errors.Wrapf(err, "upload block %s", id)
+			}
+			uploadsTotal.Inc()
+			level.Info(u.logger).Log("msg", "Uploaded block to OSS", "block", id, "bucket", u.opts.Bucket)
+		}
+		u.mtx.Lock()
+		u.uploaded[id] = struct{}{}
+		u.mtx.Unlock()
+
+		if _, ok := u.state.Blocks[id.String()]; ok {
+			// The block was completed, by this or a previous run.
+			delete(u.state.Blocks, id.String())
+			if err := u.saveState(); err != nil {
+				level.Warn(u.logger).Log("msg", "Failed to save OSS upload state", "err", err)
+			}
+		}
+	}
+	return nil
+}
+
+// uploadBlock uploads all files of a block, the meta.json last so that a
+// block only counts as uploaded once it is complete. Every uploaded file is
+// recorded in the state file and skipped by subsequent attempts; an object
+// interrupted mid-PUT never appears in the bucket, so retrying unrecorded
+// files is safe.
+func (u *Uploader) uploadBlock(dir string, id ulid.ULID) error {
+	var files []string
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	done := map[string]struct{}{}
+	for _, f := range u.state.Blocks[id.String()] {
+		done[f] = struct{}{}
+	}
+	for _, last := range []bool{false, true} {
+		for _, f := range files {
+			if (f == "meta.json") != last {
+				continue
+			}
+			if _, ok := done[f]; ok {
+				continue
+			}
+			if err := u.putObject(u.key(id, f), filepath.Join(dir, filepath.FromSlash(f))); err != nil {
+				return errors.Wrapf(err, "upload %s", f)
+			}
+			u.state.Blocks[id.String()] = append(u.state.Blocks[id.String()], f)
+			if err := u.saveState(); err != nil {
+				level.Warn(u.logger).Log("msg", "Failed to save OSS upload state", "err", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (u *Uploader) key(id ulid.ULID, file string) string {
+	return path.Join(u.opts.Prefix, id.String(), file)
+}
+
+func (u *Uploader) exists(key string) (bool, error) {
+	resp, err := u.do(http.MethodHead, key, nil, 0)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, errors.Errorf("unexpected status %s", resp.Status)
+}
+
+func (u *Uploader) putObject(key, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	resp, err := u.do(http.MethodPut, key, f, fi.Size())
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// do sends a signed OSS request for the given object key.
+func (u *Uploader) do(method, key string, body io.Reader, length int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, u.base+"/"+key, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = length
+
+	const contentType = "application/octet-stream"
+	date := time.Now().UTC().Format(http.TimeFormat)
+	msg := strings.Join([]string{
+		method,
+		"", // Content-MD5.
+		contentType,
+		date,
+		"/" + u.opts.Bucket + "/" + key,
+	}, "\n")
+	mac := hmac.New(sha1.New, []byte(u.opts.AccessKeySecret))
+	mac.Write([]byte(msg))
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Date", date)
+	req.Header.Set("Authorization", fmt.Sprintf("OSS %s:%s", u.opts.AccessKeyID, base64.StdEncoding.EncodeToString(mac.Sum(nil))))
+
+	return u.client.Do(req)
+}
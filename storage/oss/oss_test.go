@@ -0,0 +1,161 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oss
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOSS is a minimal object store handler recording uploaded objects.
+type fakeOSS struct {
+	mtx     sync.Mutex
+	objects map[string][]byte
+	puts    []string
+	// failSuffix makes PUTs of matching keys fail with a 500.
+	failSuffix string
+}
+
+func (f *fakeOSS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodHead:
+		if _, ok := f.objects[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case http.MethodPut:
+		if f.failSuffix != "" && strings.HasSuffix(key, f.failSuffix) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.objects[key] = b
+		f.puts = append(f.puts, key)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestUploaderSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oss")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// A finished block, an unfinished one without meta.json, and a
+	// non-block directory.
+	const blockID = "01EM6Q6A1YPX4G9TEB20J22B2R"
+	blockDir := filepath.Join(dir, blockID)
+	require.NoError(t, os.MkdirAll(filepath.Join(blockDir, "chunks"), 0777))
+	for _, f := range []string{"meta.json", "index", "chunks/000001"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(blockDir, f), []byte(f), 0666))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "01EM6Q6A1YPX4G9TEB20J22B3A"), 0777))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "wal"), 0777))
+
+	store := &fakeOSS{objects: map[string][]byte{}}
+	srv := httptest.NewServer(store)
+	defer srv.Close()
+
+	u, err := NewUploader(nil, dir, Options{
+		Endpoint:        "oss-cn-hangzhou.aliyuncs.com",
+		Bucket:          "test",
+		Prefix:          "prom",
+		AccessKeyID:     "id",
+		AccessKeySecret: "secret",
+	})
+	require.NoError(t, err)
+	u.base = srv.URL
+
+	require.NoError(t, u.sync())
+	require.Equal(t, []string{
+		"prom/" + blockID + "/chunks/000001",
+		"prom/" + blockID + "/index",
+		"prom/" + blockID + "/meta.json",
+	}, store.puts)
+	require.Equal(t, []byte("index"), store.objects["prom/"+blockID+"/index"])
+
+	// A second sync must not re-upload anything.
+	require.NoError(t, u.sync())
+	require.Len(t, store.puts, 3)
+
+	// Neither must a fresh uploader: the block already exists remotely.
+	u2, err := NewUploader(nil, dir, u.opts)
+	require.NoError(t, err)
+	u2.base = srv.URL
+	require.NoError(t, u2.sync())
+	require.Len(t, store.puts, 3)
+}
+
+func TestUploaderResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oss")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	const blockID = "01EM6Q6A1YPX4G9TEB20J22B2R"
+	blockDir := filepath.Join(dir, blockID)
+	require.NoError(t, os.MkdirAll(filepath.Join(blockDir, "chunks"), 0777))
+	for _, f := range []string{"meta.json", "index", "chunks/000001"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(blockDir, f), []byte(f), 0666))
+	}
+
+	store := &fakeOSS{objects: map[string][]byte{}, failSuffix: "/index"}
+	srv := httptest.NewServer(store)
+	defer srv.Close()
+
+	opts := Options{
+		Endpoint:        "oss-cn-hangzhou.aliyuncs.com",
+		Bucket:          "test",
+		Prefix:          "prom",
+		AccessKeyID:     "id",
+		AccessKeySecret: "secret",
+	}
+	u, err := NewUploader(nil, dir, opts)
+	require.NoError(t, err)
+	u.base = srv.URL
+
+	// The first sync gets the chunks file through but dies on the index.
+	require.Error(t, u.sync())
+	require.Equal(t, []string{"prom/" + blockID + "/chunks/000001"}, store.puts)
+
+	// A fresh uploader, as after a crash, picks up where the old one left
+	// off instead of re-uploading the chunks.
+	store.failSuffix = ""
+	u2, err := NewUploader(nil, dir, opts)
+	require.NoError(t, err)
+	u2.base = srv.URL
+	require.NoError(t, u2.sync())
+	require.Equal(t, []string{
+		"prom/" + blockID + "/chunks/000001",
+		"prom/" + blockID + "/index",
+		"prom/" + blockID + "/meta.json",
+	}, store.puts)
+
+	// The state entry for the completed block is cleaned up.
+	require.Empty(t, u2.state.Blocks)
+}
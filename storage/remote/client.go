@@ -34,7 +34,9 @@ import (
 	config_util "github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/version"
+	"go.uber.org/atomic"
 
+	"github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/prompb"
 )
 
@@ -84,6 +86,9 @@ type Client struct {
 	Client     *http.Client
 	timeout    time.Duration
 
+	protoMsg      string // The configured remote write protobuf message.
+	v2Unsupported atomic.Bool
+
 	readQueries         prometheus.Gauge
 	readQueriesTotal    *prometheus.CounterVec
 	readQueriesDuration prometheus.Observer
@@ -94,6 +99,7 @@ type ClientConfig struct {
 	URL              *config_util.URL
 	Timeout          model.Duration
 	HTTPClientConfig config_util.HTTPClientConfig
+	ProtobufMessage  string
 }
 
 // ReadClient uses the SAMPLES method of remote read to read series samples from remote server.
@@ -142,6 +148,7 @@ func NewWriteClient(name string, conf *ClientConfig) (WriteClient, error) {
 		url:        conf.URL,
 		Client:     httpClient,
 		timeout:    time.Duration(conf.Timeout),
+		protoMsg:   conf.ProtobufMessage,
 	}, nil
 }
 
@@ -149,6 +156,17 @@ type RecoverableError struct {
 	error
 }
 
+// errV2Fallback is returned by Store when the endpoint rejected the Remote
+// Write 2.0 message. The client downgrades itself to the 1.0 message and the
+// caller is expected to re-encode the batch and retry.
+var errV2Fallback = errors.New("endpoint does not accept the io.prometheus.write.v2.Request message")
+
+// WriteV2 reports whether the next Store call expects the Remote Write 2.0
+// message, i.e. it is configured and the endpoint has not rejected it yet.
+func (c *Client) WriteV2() bool {
+	return c.protoMsg == config.RemoteWriteProtoMsgV2 && !c.v2Unsupported.Load()
+}
+
 // Store sends a batch of samples to the HTTP endpoint, the request is the proto marshalled
 // and encoded bytes from codec.go.
 func (c *Client) Store(ctx context.Context, req []byte) error {
@@ -158,10 +176,16 @@ func (c *Client) Store(ctx context.Context, req []byte) error {
 		// recoverable.
 		return err
 	}
+	v2 := c.WriteV2()
 	httpReq.Header.Add("Content-Encoding", "snappy")
-	httpReq.Header.Set("Content-Type", "application/x-protobuf")
 	httpReq.Header.Set("User-Agent", UserAgent)
-	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if v2 {
+		httpReq.Header.Set("Content-Type", "application/x-protobuf;proto=io.prometheus.write.v2.Request")
+		httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "2.0.0")
+	} else {
+		httpReq.Header.Set("Content-Type", "application/x-protobuf")
+		httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	}
 	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 
@@ -189,6 +213,12 @@ func (c *Client) Store(ctx context.Context, req []byte) error {
 		httpResp.Body.Close()
 	}()
 
+	if v2 && (httpResp.StatusCode == http.StatusUnsupportedMediaType || httpResp.StatusCode == http.StatusNotImplemented) {
+		// Content negotiation: remember the downgrade so all subsequent
+		// requests use the 1.0 message straight away.
+		c.v2Unsupported.Store(true)
+		return errV2Fallback
+	}
 	if httpResp.StatusCode/100 != 2 {
 		scanner := bufio.NewScanner(io.LimitReader(httpResp.Body, maxErrMsgLen))
 		line := ""
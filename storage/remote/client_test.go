@@ -26,10 +26,48 @@ import (
 	config_util "github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/config"
 )
 
 var longErrMessage = strings.Repeat("error message", maxErrMsgLen)
 
+func TestStoreV2Fallback(t *testing.T) {
+	var contentTypes []string
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+			if strings.Contains(r.Header.Get("Content-Type"), "io.prometheus.write.v2.Request") {
+				http.Error(w, "unsupported", http.StatusUnsupportedMediaType)
+				return
+			}
+		}),
+	)
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	c, err := NewWriteClient("test_client", &ClientConfig{
+		URL:             &config_util.URL{URL: serverURL},
+		Timeout:         model.Duration(time.Second),
+		ProtobufMessage: config.RemoteWriteProtoMsgV2,
+	})
+	require.NoError(t, err)
+
+	require.True(t, c.(*Client).WriteV2())
+	require.Equal(t, errV2Fallback, c.Store(context.Background(), []byte{}))
+
+	// The rejection downgrades the client to the 1.0 message permanently.
+	require.False(t, c.(*Client).WriteV2())
+	require.NoError(t, c.Store(context.Background(), []byte{}))
+
+	require.Equal(t, []string{
+		"application/x-protobuf;proto=io.prometheus.write.v2.Request",
+		"application/x-protobuf",
+	}, contentTypes)
+}
+
 func TestStoreHTTPErrorHandling(t *testing.T) {
 	tests := []struct {
 		code int
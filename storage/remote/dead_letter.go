@@ -0,0 +1,108 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// deadLetterMaxSeries bounds how many series of a rejected batch are recorded
+// per entry so a single bad batch cannot blow up the file.
+const deadLetterMaxSeries = 50
+
+type deadLetterSample struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+type deadLetterSeries struct {
+	Labels  map[string]string  `json:"labels"`
+	Samples []deadLetterSample `json:"samples"`
+}
+
+type deadLetterEntry struct {
+	Timestamp time.Time          `json:"timestamp"`
+	Error     string             `json:"error"`
+	Truncated bool               `json:"truncated,omitempty"`
+	Series    []deadLetterSeries `json:"series"`
+}
+
+// deadLetterWriter appends batches that the remote endpoint rejected with a
+// non-recoverable error to a file, one JSON entry per line, so the offending
+// series can be inspected without packet captures.
+type deadLetterWriter struct {
+	mtx    sync.Mutex
+	path   string
+	logger log.Logger
+}
+
+func newDeadLetterWriter(path string, logger log.Logger) *deadLetterWriter {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &deadLetterWriter{path: path, logger: logger}
+}
+
+// Log records the rejected batch together with the send error. Failures to
+// write the file are logged but otherwise ignored; the samples are dropped
+// either way.
+func (w *deadLetterWriter) Log(samples []prompb.TimeSeries, sendErr error) {
+	entry := deadLetterEntry{
+		Timestamp: time.Now().UTC(),
+		Error:     sendErr.Error(),
+	}
+	n := len(samples)
+	if n > deadLetterMaxSeries {
+		n = deadLetterMaxSeries
+		entry.Truncated = true
+	}
+	for _, ts := range samples[:n] {
+		lset := make(map[string]string, len(ts.Labels))
+		for _, l := range ts.Labels {
+			lset[l.Name] = l.Value
+		}
+		series := deadLetterSeries{Labels: lset}
+		for _, s := range ts.Samples {
+			series.Samples = append(series.Samples, deadLetterSample{Timestamp: s.Timestamp, Value: s.Value})
+		}
+		entry.Series = append(entry.Series, series)
+	}
+
+	b, err := json.Marshal(&entry)
+	if err != nil {
+		level.Error(w.logger).Log("msg", "Failed to marshal dead letter entry", "err", err)
+		return
+	}
+	b = append(b, '\n')
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		level.Error(w.logger).Log("msg", "Failed to open dead letter file", "file", w.path, "err", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(b); err != nil {
+		level.Error(w.logger).Log("msg", "Failed to write dead letter entry", "file", w.path, "err", err)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"sort"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// dedupQuerier strips the configured replica labels from read results and
+// merges series that become identical, so the HA replicas behind the remote
+// read endpoints are seen as one gap-filled series.
+type dedupQuerier struct {
+	storage.Querier
+	replicaLabels map[string]struct{}
+}
+
+func newDedupQuerier(q storage.Querier, replicaLabels []string) storage.Querier {
+	m := make(map[string]struct{}, len(replicaLabels))
+	for _, l := range replicaLabels {
+		m[l] = struct{}{}
+	}
+	return &dedupQuerier{Querier: q, replicaLabels: m}
+}
+
+// Select implements storage.Querier. The result is always sorted: stripping
+// labels breaks the inner ordering, so the series are materialized and
+// re-sorted regardless of sortSeries.
+func (q *dedupQuerier) Select(_ bool, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	// Matchers on replica labels would pin the query to one replica and
+	// defeat the deduplication, so they are dropped.
+	kept := make([]*labels.Matcher, 0, len(matchers))
+	for _, m := range matchers {
+		if _, ok := q.replicaLabels[m.Name]; !ok {
+			kept = append(kept, m)
+		}
+	}
+
+	set := q.Querier.Select(true, hints, kept...)
+	var series []storage.Series
+	for set.Next() {
+		s := set.At()
+		series = append(series, &seriesWithLabels{Series: s, lset: q.stripReplicaLabels(s.Labels())})
+	}
+	if err := set.Err(); err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return labels.Compare(series[i].Labels(), series[j].Labels()) < 0
+	})
+
+	// Chain runs of series that collapsed onto the same label set.
+	deduped := make([]storage.Series, 0, len(series))
+	for i := 0; i < len(series); {
+		j := i + 1
+		for j < len(series) && labels.Equal(series[j].Labels(), series[i].Labels()) {
+			j++
+		}
+		if j == i+1 {
+			deduped = append(deduped, series[i])
+		} else {
+			deduped = append(deduped, storage.ChainedSeriesMerge(series[i:j]...))
+		}
+		i = j
+	}
+	return &dedupSeriesSet{series: deduped, warnings: set.Warnings()}
+}
+
+// LabelNames implements storage.LabelQuerier, hiding the replica labels.
+func (q *dedupQuerier) LabelNames() ([]string, storage.Warnings, error) {
+	names, w, err := q.Querier.LabelNames()
+	if err != nil {
+		return nil, w, err
+	}
+	kept := names[:0]
+	for _, n := range names {
+		if _, ok := q.replicaLabels[n]; !ok {
+			kept = append(kept, n)
+		}
+	}
+	return kept, w, nil
+}
+
+// LabelValues implements storage.LabelQuerier, hiding the replica labels.
+func (q *dedupQuerier) LabelValues(name string) ([]string, storage.Warnings, error) {
+	if _, ok := q.replicaLabels[name]; ok {
+		return nil, nil, nil
+	}
+	return q.Querier.LabelValues(name)
+}
+
+func (q *dedupQuerier) stripReplicaLabels(lset labels.Labels) labels.Labels {
+	out := make(labels.Labels, 0, len(lset))
+	for _, l := range lset {
+		if _, ok := q.replicaLabels[l.Name]; !ok {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// seriesWithLabels overrides the label set of a series.
+type seriesWithLabels struct {
+	storage.Series
+	lset labels.Labels
+}
+
+func (s *seriesWithLabels) Labels() labels.Labels { return s.lset }
+
+type dedupSeriesSet struct {
+	series   []storage.Series
+	i        int
+	warnings storage.Warnings
+}
+
+func (s *dedupSeriesSet) Next() bool {
+	if s.i >= len(s.series) {
+		return false
+	}
+	s.i++
+	return true
+}
+
+func (s *dedupSeriesSet) At() storage.Series         { return s.series[s.i-1] }
+func (s *dedupSeriesSet) Err() error                 { return nil }
+func (s *dedupSeriesSet) Warnings() storage.Warnings { return s.warnings }
@@ -0,0 +1,96 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+)
+
+type dedupTestSample struct {
+	t int64
+	v float64
+}
+
+func (s dedupTestSample) T() int64   { return s.t }
+func (s dedupTestSample) V() float64 { return s.v }
+
+type dedupTestQuerier struct {
+	storage.Querier
+	series   []storage.Series
+	matchers []*labels.Matcher
+}
+
+func (q *dedupTestQuerier) Select(_ bool, _ *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	q.matchers = matchers
+	return &dedupSeriesSet{series: q.series}
+}
+
+func TestDedupQuerierSelect(t *testing.T) {
+	inner := &dedupTestQuerier{series: []storage.Series{
+		storage.NewListSeries(
+			labels.FromStrings(labels.MetricName, "up", "job", "a", "replica", "r1"),
+			[]tsdbutil.Sample{dedupTestSample{1, 1}, dedupTestSample{2, 1}},
+		),
+		storage.NewListSeries(
+			labels.FromStrings(labels.MetricName, "up", "job", "a", "replica", "r2"),
+			[]tsdbutil.Sample{dedupTestSample{2, 1}, dedupTestSample{3, 1}},
+		),
+		storage.NewListSeries(
+			labels.FromStrings(labels.MetricName, "up", "job", "b", "replica", "r1"),
+			[]tsdbutil.Sample{dedupTestSample{1, 0}},
+		),
+	}}
+	q := newDedupQuerier(inner, []string{"replica"})
+
+	replicaMatcher := labels.MustNewMatcher(labels.MatchEqual, "replica", "r1")
+	jobMatcher := labels.MustNewMatcher(labels.MatchEqual, "job", "a")
+	set := q.Select(false, nil, replicaMatcher, jobMatcher)
+
+	// Matchers on the replica label are dropped so the query is not pinned
+	// to a single replica.
+	require.Equal(t, []*labels.Matcher{jobMatcher}, inner.matchers)
+
+	var (
+		sets    []labels.Labels
+		samples [][]dedupTestSample
+	)
+	for set.Next() {
+		s := set.At()
+		sets = append(sets, s.Labels())
+		var ss []dedupTestSample
+		it := s.Iterator()
+		for it.Next() {
+			t, v := it.At()
+			ss = append(ss, dedupTestSample{t, v})
+		}
+		samples = append(samples, ss)
+	}
+	require.NoError(t, set.Err())
+
+	// The two replicas of job "a" collapse into one gap-filled series.
+	require.Equal(t, []labels.Labels{
+		labels.FromStrings(labels.MetricName, "up", "job", "a"),
+		labels.FromStrings(labels.MetricName, "up", "job", "b"),
+	}, sets)
+	require.Equal(t, [][]dedupTestSample{
+		{{1, 1}, {2, 1}, {3, 1}},
+		{{1, 0}},
+	}, samples)
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var remoteWriteFailovers = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "failovers_total",
+		Help:      "Total number of times a remote write failover group switched its active endpoint.",
+	},
+	[]string{remoteName},
+)
+
+func init() {
+	prometheus.MustRegister(remoteWriteFailovers)
+}
+
+// failoverProbeInterval is how often a failover client that is writing to a
+// standby endpoint retries the primary so traffic moves back automatically.
+const failoverProbeInterval = 1 * time.Minute
+
+// failoverClient fans one logical remote write endpoint out over several URLs.
+// Batches go to a single endpoint at a time; when it fails, the remaining
+// endpoints are tried in configuration order and the first one accepting the
+// batch becomes active. While a standby is active the primary is probed
+// periodically so that recovering it does not require a config change.
+type failoverClient struct {
+	logger        log.Logger
+	clients       []WriteClient
+	probeInterval time.Duration
+	failovers     prometheus.Counter
+
+	mtx       sync.Mutex
+	active    int
+	lastProbe time.Time
+}
+
+// newFailoverClient returns a WriteClient backed by the given clients. The
+// first client is the primary endpoint.
+func newFailoverClient(logger log.Logger, clients []WriteClient) *failoverClient {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &failoverClient{
+		logger:        logger,
+		clients:       clients,
+		probeInterval: failoverProbeInterval,
+		failovers:     remoteWriteFailovers.WithLabelValues(clients[0].Name()),
+	}
+}
+
+// Store implements WriteClient.
+func (f *failoverClient) Store(ctx context.Context, req []byte) error {
+	f.mtx.Lock()
+	start := f.active
+	if start != 0 && time.Since(f.lastProbe) >= f.probeInterval {
+		f.lastProbe = time.Now()
+		start = 0
+	}
+	f.mtx.Unlock()
+
+	var err error
+	for i := 0; i < len(f.clients); i++ {
+		idx := (start + i) % len(f.clients)
+		c := f.clients[idx]
+		err = c.Store(ctx, req)
+		if err == errV2Fallback {
+			// Content negotiation, not an outage: the caller re-encodes the
+			// batch with the 1.0 message and retries the same endpoint.
+			return err
+		}
+		if err == nil {
+			f.setActive(idx, c.Endpoint())
+			return nil
+		}
+		level.Debug(f.logger).Log("msg", "Remote write endpoint of failover group failed", "endpoint", c.Endpoint(), "err", err)
+	}
+	return err
+}
+
+func (f *failoverClient) setActive(idx int, endpoint string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if idx == f.active {
+		return
+	}
+	f.failovers.Inc()
+	f.active = idx
+	level.Warn(f.logger).Log("msg", "Remote write switched to a different endpoint of its failover group", "endpoint", endpoint)
+}
+
+// WriteV2 implements WriteV2Client by deferring to the active endpoint.
+func (f *failoverClient) WriteV2() bool {
+	f.mtx.Lock()
+	c := f.clients[f.active]
+	f.mtx.Unlock()
+	if v2c, ok := c.(WriteV2Client); ok {
+		return v2c.WriteV2()
+	}
+	return false
+}
+
+// Name uniquely identifies the client.
+func (f *failoverClient) Name() string {
+	return f.clients[0].Name()
+}
+
+// Endpoint returns the primary URL. The queue identity must not churn as the
+// group fails over, so standby URLs never show up here.
+func (f *failoverClient) Endpoint() string {
+	return f.clients[0].Endpoint()
+}
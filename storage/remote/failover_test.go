@@ -0,0 +1,82 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeFailoverEndpoint struct {
+	name, url string
+	fail      bool
+	stores    int
+}
+
+func (e *fakeFailoverEndpoint) Store(_ context.Context, _ []byte) error {
+	e.stores++
+	if e.fail {
+		return errors.New("endpoint down")
+	}
+	return nil
+}
+
+func (e *fakeFailoverEndpoint) Name() string     { return e.name }
+func (e *fakeFailoverEndpoint) Endpoint() string { return e.url }
+
+func TestFailoverClient(t *testing.T) {
+	primary := &fakeFailoverEndpoint{name: "group", url: "http://primary/api/v1/write"}
+	standby := &fakeFailoverEndpoint{name: "group", url: "http://standby/api/v1/write"}
+	f := newFailoverClient(nil, []WriteClient{primary, standby})
+	ctx := context.Background()
+
+	// While the primary is healthy the standby sees no traffic.
+	require.NoError(t, f.Store(ctx, nil))
+	require.Equal(t, 1, primary.stores)
+	require.Equal(t, 0, standby.stores)
+	require.Equal(t, "http://primary/api/v1/write", f.Endpoint())
+
+	// A failing primary hands the batch to the standby within the same call.
+	primary.fail = true
+	require.NoError(t, f.Store(ctx, nil))
+	require.Equal(t, 2, primary.stores)
+	require.Equal(t, 1, standby.stores)
+	require.Equal(t, 1, f.active)
+	// The queue identity stays with the primary URL.
+	require.Equal(t, "http://primary/api/v1/write", f.Endpoint())
+
+	// Within the probe interval the dead primary is left alone.
+	f.lastProbe = time.Now()
+	require.NoError(t, f.Store(ctx, nil))
+	require.Equal(t, 2, primary.stores)
+	require.Equal(t, 2, standby.stores)
+
+	// Once the probe interval has passed and the primary accepts writes
+	// again, traffic falls back without a config change.
+	primary.fail = false
+	f.lastProbe = time.Time{}
+	require.NoError(t, f.Store(ctx, nil))
+	require.Equal(t, 3, primary.stores)
+	require.Equal(t, 2, standby.stores)
+	require.Equal(t, 0, f.active)
+
+	// When every endpoint is down the last error surfaces to the queue.
+	primary.fail = true
+	standby.fail = true
+	require.Error(t, f.Store(ctx, nil))
+}
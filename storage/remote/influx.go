@@ -0,0 +1,227 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/influxdata/influxdb/models"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/strutil"
+)
+
+var (
+	influxIngestedSamples = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "influx_ingested_samples_total",
+		Help:      "Number of samples ingested via the Influx line protocol endpoint.",
+	})
+	influxDroppedFields = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "influx_dropped_fields_total",
+		Help:      "Number of Influx fields dropped because their value type cannot be represented as a sample.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(influxIngestedSamples, influxDroppedFields)
+}
+
+// influxWriteHandler accepts InfluxDB line protocol writes and appends the
+// translated series to local storage.
+type influxWriteHandler struct {
+	logger     log.Logger
+	appendable storage.Appendable
+	configFunc func() config.Config
+
+	tenantLabel  string
+	tenantHeader string
+}
+
+// NewInfluxWriteHandler returns an http.Handler that accepts InfluxDB line
+// protocol on POST requests and writes the translated series to the provided
+// appendable. Tenancy is enforced the same way as on the OTLP receiver.
+func NewInfluxWriteHandler(logger log.Logger, appendable storage.Appendable, configFunc func() config.Config, tenantLabel, tenantHeader string) http.Handler {
+	return &influxWriteHandler{
+		logger:       logger,
+		appendable:   appendable,
+		configFunc:   configFunc,
+		tenantLabel:  tenantLabel,
+		tenantHeader: tenantHeader,
+	}
+}
+
+func (h *influxWriteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var tenant string
+	if h.tenantLabel != "" {
+		if tenant = r.Header.Get(h.tenantHeader); tenant == "" {
+			http.Error(w, fmt.Sprintf("missing tenant header %q", h.tenantHeader), http.StatusBadRequest)
+			return
+		}
+	}
+
+	body := io.Reader(r.Body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		// Telegraf and the Influx clients gzip request bodies by default.
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer zr.Close()
+		body = zr
+	}
+	buf, err := ioutil.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	precision := r.URL.Query().Get("precision")
+	if precision == "" {
+		precision = "ns"
+	}
+	points, err := models.ParsePointsWithPrecision(buf, time.Now().UTC(), precision)
+	if err != nil {
+		level.Error(h.logger).Log("msg", "Error decoding Influx write request", "err", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	samples, err := h.translate(points)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	app := h.appendable.Appender(r.Context())
+	for _, s := range samples {
+		if tenant != "" {
+			s.lset = labels.NewBuilder(s.lset).Set(h.tenantLabel, tenant).Labels()
+		}
+		if _, err = app.Add(s.lset, s.t, s.v); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		app.Rollback()
+		level.Error(h.logger).Log("msg", "Error appending Influx samples", "err", err.Error())
+		code := http.StatusInternalServerError
+		switch errors.Cause(err) {
+		case storage.ErrOutOfOrderSample, storage.ErrOutOfBounds, storage.ErrDuplicateSampleForTimestamp:
+			code = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if err := app.Commit(); err != nil {
+		level.Error(h.logger).Log("msg", "Error committing Influx samples", "err", err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	influxIngestedSamples.Add(float64(len(samples)))
+
+	// The Influx write endpoint signals success with 204.
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// translate converts parsed line protocol points into samples, resolving the
+// metric name of each field through the configured mappings.
+func (h *influxWriteHandler) translate(points []models.Point) ([]otlpSample, error) {
+	cfg := h.configFunc().InfluxConfig
+
+	type key struct{ measurement, field string }
+	mappings := make(map[key]string, len(cfg.Mappings))
+	for _, m := range cfg.Mappings {
+		mappings[key{m.Measurement, m.Field}] = m.Name
+	}
+	separator := cfg.MeasurementFieldSeparator
+	if separator == "" {
+		separator = "_"
+	}
+
+	var samples []otlpSample
+	for _, p := range points {
+		fields, err := p.Fields()
+		if err != nil {
+			return nil, err
+		}
+		measurement := string(p.Name())
+		t := p.UnixNano() / int64(time.Millisecond)
+
+		tagLabels := map[string]string{}
+		for _, tag := range p.Tags() {
+			tagLabels[strutil.SanitizeLabelName(string(tag.Key))] = string(tag.Value)
+		}
+
+		for field, value := range fields {
+			var v float64
+			switch value := value.(type) {
+			case float64:
+				v = value
+			case int64:
+				v = float64(value)
+			case uint64:
+				v = float64(value)
+			case bool:
+				if value {
+					v = 1
+				}
+			default:
+				// String fields have no sample representation.
+				influxDroppedFields.Inc()
+				continue
+			}
+
+			name, ok := mappings[key{measurement, field}]
+			if !ok {
+				if base, ok := mappings[key{measurement, ""}]; ok {
+					name = base + separator + field
+				} else if field == "value" {
+					// "value" is the default field name of single-field
+					// points; appending it would only add noise.
+					name = measurement
+				} else {
+					name = measurement + separator + field
+				}
+				name = invalidMetricCharRE.ReplaceAllString(name, "_")
+			}
+
+			lset := make(labels.Labels, 0, len(tagLabels)+1)
+			lset = append(lset, labels.Label{Name: model.MetricNameLabel, Value: name})
+			for k, lv := range tagLabels {
+				lset = append(lset, labels.Label{Name: k, Value: lv})
+			}
+			sort.Sort(lset)
+			samples = append(samples, otlpSample{lset: lset, t: t, v: v})
+		}
+	}
+	return samples, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+func TestInfluxWriteHandler(t *testing.T) {
+	body := strings.Join([]string{
+		`cpu,host=ecs-1,cpu=cpu0 usage_idle=90.5,usage_user=4i 1600000000000000000`,
+		`uptime,host=ecs-1 value=12345i 1600000000000000000`,
+		`disk,host=ecs-1 status="ok",full=f 1600000000000000000`,
+	}, "\n")
+
+	app := &otlpTestAppendable{}
+	handler := NewInfluxWriteHandler(log.NewNopLogger(), app, func() config.Config {
+		cfg := config.DefaultConfig
+		cfg.InfluxConfig.Mappings = []config.InfluxMapping{
+			{Measurement: "cpu", Field: "usage_idle", Name: "cpu_usage_idle_ratio"},
+		}
+		return cfg
+	}, "", "")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/api/v1/influx/write?db=telegraf", strings.NewReader(body)))
+	require.Equal(t, http.StatusNoContent, recorder.Code, recorder.Body.String())
+
+	byName := map[string]otlpSample{}
+	for _, s := range app.samples {
+		byName[s.lset.Get(labels.MetricName)] = s
+	}
+	require.Equal(t, 4, len(app.samples))
+
+	// Field mapped through the configured mapping.
+	mapped := byName["cpu_usage_idle_ratio"]
+	require.Equal(t, 90.5, mapped.v)
+	require.Equal(t, int64(1600000000000), mapped.t)
+	require.Equal(t, "ecs-1", mapped.lset.Get("host"))
+	require.Equal(t, "cpu0", mapped.lset.Get("cpu"))
+
+	// Unmapped fields get <measurement><sep><field> names.
+	require.Equal(t, 4.0, byName["cpu_usage_user"].v)
+
+	// The default "value" field maps to the bare measurement name.
+	require.Equal(t, 12345.0, byName["uptime"].v)
+
+	// Booleans translate to 0/1, string fields are dropped.
+	require.Equal(t, 0.0, byName["disk_full"].v)
+	_, ok := byName["disk_status"]
+	require.False(t, ok, "string field must be dropped")
+}
+
+func TestInfluxWriteHandlerErrors(t *testing.T) {
+	handler := NewInfluxWriteHandler(log.NewNopLogger(), &otlpTestAppendable{}, func() config.Config {
+		return config.DefaultConfig
+	}, "", "")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/api/v1/influx/write", strings.NewReader("not line protocol")))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestInfluxWriteHandlerTenant(t *testing.T) {
+	app := &otlpTestAppendable{}
+	handler := NewInfluxWriteHandler(log.NewNopLogger(), app, func() config.Config {
+		return config.DefaultConfig
+	}, "tenant", "X-Scope-OrgID")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/api/v1/influx/write", strings.NewReader(`cpu value=1`)))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Equal(t, 0, len(app.samples))
+
+	recorder = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/influx/write", strings.NewReader(`cpu,tenant=spoofed value=1`))
+	req.Header.Set("X-Scope-OrgID", "team-a")
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+	require.Equal(t, 1, len(app.samples))
+	require.Equal(t, "team-a", app.samples[0].lset.Get("tenant"))
+}
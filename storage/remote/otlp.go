@@ -0,0 +1,465 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/strutil"
+)
+
+var (
+	otlpIngestedSamples = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "otlp_ingested_samples_total",
+		Help:      "Number of samples ingested via the OTLP endpoint.",
+	})
+	otlpDroppedMetrics = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "otlp_dropped_metrics_total",
+		Help:      "Number of OTLP metrics dropped because their type or temporality is unsupported.",
+	})
+
+	invalidMetricCharRE = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+)
+
+func init() {
+	prometheus.MustRegister(otlpIngestedSamples, otlpDroppedMetrics)
+}
+
+// otlpWriteHandler accepts OTLP/HTTP metric export requests in JSON encoding
+// and appends the translated series to local storage.
+type otlpWriteHandler struct {
+	logger     log.Logger
+	appendable storage.Appendable
+	configFunc func() config.Config
+
+	tenantLabel  string
+	tenantHeader string
+}
+
+// NewOTLPWriteHandler returns an http.Handler that accepts OTLP metrics on
+// POST requests and writes them to the provided appendable. If tenantLabel is
+// non-empty, requests must carry the tenant name in the tenantHeader header
+// and every ingested series gets the tenant set as the value of that label,
+// overriding any value sent by the client.
+func NewOTLPWriteHandler(logger log.Logger, appendable storage.Appendable, configFunc func() config.Config, tenantLabel, tenantHeader string) http.Handler {
+	return &otlpWriteHandler{
+		logger:       logger,
+		appendable:   appendable,
+		configFunc:   configFunc,
+		tenantLabel:  tenantLabel,
+		tenantHeader: tenantHeader,
+	}
+}
+
+// The minimal subset of the OTLP metrics protocol we translate, in the
+// canonical proto3 JSON encoding. 64-bit integers may arrive as JSON strings
+// or numbers depending on the client, hence the flexible otlpInt/otlpUint.
+
+type otlpExportRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource otlpResourceInfo `json:"resource"`
+	// Older SDKs use instrumentationLibraryMetrics instead of scopeMetrics.
+	ScopeMetrics                  []otlpScopeMetrics `json:"scopeMetrics"`
+	InstrumentationLibraryMetrics []otlpScopeMetrics `json:"instrumentationLibraryMetrics"`
+}
+
+type otlpResourceInfo struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpMetric struct {
+	Name      string             `json:"name"`
+	Gauge     *otlpNumberPoints  `json:"gauge"`
+	Sum       *otlpSum           `json:"sum"`
+	Histogram *otlpHistogram     `json:"histogram"`
+	Summary   *otlpSummaryPoints `json:"summary"`
+}
+
+type otlpNumberPoints struct {
+	DataPoints []otlpNumberPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberPoint `json:"dataPoints"`
+	AggregationTemporality otlpTemporality   `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramPoint `json:"dataPoints"`
+	AggregationTemporality otlpTemporality      `json:"aggregationTemporality"`
+}
+
+type otlpSummaryPoints struct {
+	DataPoints []otlpSummaryPoint `json:"dataPoints"`
+}
+
+type otlpNumberPoint struct {
+	Attributes   []otlpAttribute `json:"attributes"`
+	TimeUnixNano otlpUint        `json:"timeUnixNano"`
+	AsDouble     *float64        `json:"asDouble"`
+	AsInt        *otlpInt        `json:"asInt"`
+}
+
+type otlpHistogramPoint struct {
+	Attributes     []otlpAttribute `json:"attributes"`
+	TimeUnixNano   otlpUint        `json:"timeUnixNano"`
+	Count          otlpUint        `json:"count"`
+	Sum            *float64        `json:"sum"`
+	BucketCounts   []otlpUint      `json:"bucketCounts"`
+	ExplicitBounds []float64       `json:"explicitBounds"`
+}
+
+type otlpSummaryPoint struct {
+	Attributes     []otlpAttribute `json:"attributes"`
+	TimeUnixNano   otlpUint        `json:"timeUnixNano"`
+	Count          otlpUint        `json:"count"`
+	Sum            float64         `json:"sum"`
+	QuantileValues []otlpQuantile  `json:"quantileValues"`
+}
+
+type otlpQuantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue"`
+	BoolValue   *bool    `json:"boolValue"`
+	IntValue    *otlpInt `json:"intValue"`
+	DoubleValue *float64 `json:"doubleValue"`
+}
+
+func (v otlpValue) String() string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue)
+	case v.IntValue != nil:
+		return strconv.FormatInt(int64(*v.IntValue), 10)
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(*v.DoubleValue, 'f', -1, 64)
+	}
+	return ""
+}
+
+type otlpUint uint64
+
+func (u *otlpUint) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if len(s) > 1 && s[0] == '"' {
+		var err error
+		s, err = strconv.Unquote(s)
+		if err != nil {
+			return err
+		}
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*u = otlpUint(v)
+	return nil
+}
+
+type otlpInt int64
+
+func (i *otlpInt) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if len(s) > 1 && s[0] == '"' {
+		var err error
+		s, err = strconv.Unquote(s)
+		if err != nil {
+			return err
+		}
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = otlpInt(v)
+	return nil
+}
+
+// otlpTemporality accepts the aggregation temporality enum either as its
+// proto3 JSON name or as a plain number.
+type otlpTemporality string
+
+func (t *otlpTemporality) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n int
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		s = strconv.Itoa(n)
+	}
+	*t = otlpTemporality(s)
+	return nil
+}
+
+func (t otlpTemporality) isCumulative() bool {
+	return t == "" || t == "2" || t == "AGGREGATION_TEMPORALITY_CUMULATIVE"
+}
+
+type otlpSample struct {
+	lset labels.Labels
+	t    int64
+	v    float64
+}
+
+func (h *otlpWriteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if ct := r.Header.Get("Content-Type"); ct != "" && ct != "application/json" {
+		http.Error(w, fmt.Sprintf("unsupported content type %q, only application/json is supported", ct), http.StatusUnsupportedMediaType)
+		return
+	}
+	var tenant string
+	if h.tenantLabel != "" {
+		if tenant = r.Header.Get(h.tenantHeader); tenant == "" {
+			http.Error(w, fmt.Sprintf("missing tenant header %q", h.tenantHeader), http.StatusBadRequest)
+			return
+		}
+	}
+	var req otlpExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		level.Error(h.logger).Log("msg", "Error decoding OTLP write request", "err", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	samples := h.translate(&req)
+
+	app := h.appendable.Appender(r.Context())
+	var err error
+	for _, s := range samples {
+		if tenant != "" {
+			s.lset = labels.NewBuilder(s.lset).Set(h.tenantLabel, tenant).Labels()
+		}
+		if _, err = app.Add(s.lset, s.t, s.v); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		app.Rollback()
+		level.Error(h.logger).Log("msg", "Error appending OTLP samples", "err", err.Error())
+		code := http.StatusInternalServerError
+		switch errors.Cause(err) {
+		case storage.ErrOutOfOrderSample, storage.ErrOutOfBounds, storage.ErrDuplicateSampleForTimestamp:
+			code = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if err := app.Commit(); err != nil {
+		level.Error(h.logger).Log("msg", "Error committing OTLP samples", "err", err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	otlpIngestedSamples.Add(float64(len(samples)))
+
+	// An empty ExportMetricsServiceResponse signals full success.
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+}
+
+// translate converts the request into a flat list of samples, promoting the
+// configured resource attributes to labels.
+func (h *otlpWriteHandler) translate(req *otlpExportRequest) []otlpSample {
+	promoted := h.configFunc().OTLPConfig.PromoteResourceAttributes
+
+	var samples []otlpSample
+	for _, rm := range req.ResourceMetrics {
+		resourceLabels := map[string]string{}
+		for _, attr := range rm.Resource.Attributes {
+			switch attr.Key {
+			// The standard OTLP identity attributes map to job and instance.
+			case "service.name":
+				resourceLabels[model.JobLabel] = attr.Value.String()
+			case "service.instance.id":
+				resourceLabels[model.InstanceLabel] = attr.Value.String()
+			default:
+				for _, p := range promoted {
+					if attr.Key == p {
+						resourceLabels[strutil.SanitizeLabelName(attr.Key)] = attr.Value.String()
+						break
+					}
+				}
+			}
+		}
+
+		scopes := rm.ScopeMetrics
+		scopes = append(scopes, rm.InstrumentationLibraryMetrics...)
+		for _, sm := range scopes {
+			for _, m := range sm.Metrics {
+				samples = append(samples, translateMetric(m, resourceLabels)...)
+			}
+		}
+	}
+	return samples
+}
+
+func translateMetric(m otlpMetric, resourceLabels map[string]string) []otlpSample {
+	name := invalidMetricCharRE.ReplaceAllString(m.Name, "_")
+	var samples []otlpSample
+
+	addNumberPoints := func(points []otlpNumberPoint) {
+		for _, p := range points {
+			var v float64
+			switch {
+			case p.AsDouble != nil:
+				v = *p.AsDouble
+			case p.AsInt != nil:
+				v = float64(*p.AsInt)
+			default:
+				continue
+			}
+			samples = append(samples, otlpSample{
+				lset: pointLabels(name, resourceLabels, p.Attributes, nil),
+				t:    timestampMs(p.TimeUnixNano),
+				v:    v,
+			})
+		}
+	}
+
+	switch {
+	case m.Gauge != nil:
+		addNumberPoints(m.Gauge.DataPoints)
+	case m.Sum != nil:
+		if !m.Sum.AggregationTemporality.isCumulative() {
+			otlpDroppedMetrics.Inc()
+			return nil
+		}
+		addNumberPoints(m.Sum.DataPoints)
+	case m.Histogram != nil:
+		if !m.Histogram.AggregationTemporality.isCumulative() {
+			otlpDroppedMetrics.Inc()
+			return nil
+		}
+		for _, p := range m.Histogram.DataPoints {
+			t := timestampMs(p.TimeUnixNano)
+			var cum uint64
+			for i, bound := range p.ExplicitBounds {
+				if i < len(p.BucketCounts) {
+					cum += uint64(p.BucketCounts[i])
+				}
+				le := strconv.FormatFloat(bound, 'f', -1, 64)
+				samples = append(samples, otlpSample{
+					lset: pointLabels(name+"_bucket", resourceLabels, p.Attributes, map[string]string{model.BucketLabel: le}),
+					t:    t,
+					v:    float64(cum),
+				})
+			}
+			samples = append(samples, otlpSample{
+				lset: pointLabels(name+"_bucket", resourceLabels, p.Attributes, map[string]string{model.BucketLabel: "+Inf"}),
+				t:    t,
+				v:    float64(p.Count),
+			})
+			if p.Sum != nil {
+				samples = append(samples, otlpSample{
+					lset: pointLabels(name+"_sum", resourceLabels, p.Attributes, nil),
+					t:    t,
+					v:    *p.Sum,
+				})
+			}
+			samples = append(samples, otlpSample{
+				lset: pointLabels(name+"_count", resourceLabels, p.Attributes, nil),
+				t:    t,
+				v:    float64(p.Count),
+			})
+		}
+	case m.Summary != nil:
+		for _, p := range m.Summary.DataPoints {
+			t := timestampMs(p.TimeUnixNano)
+			for _, q := range p.QuantileValues {
+				quantile := strconv.FormatFloat(q.Quantile, 'f', -1, 64)
+				samples = append(samples, otlpSample{
+					lset: pointLabels(name, resourceLabels, p.Attributes, map[string]string{model.QuantileLabel: quantile}),
+					t:    t,
+					v:    q.Value,
+				})
+			}
+			samples = append(samples, otlpSample{
+				lset: pointLabels(name+"_sum", resourceLabels, p.Attributes, nil),
+				t:    t,
+				v:    p.Sum,
+			})
+			samples = append(samples, otlpSample{
+				lset: pointLabels(name+"_count", resourceLabels, p.Attributes, nil),
+				t:    t,
+				v:    float64(p.Count),
+			})
+		}
+	default:
+		otlpDroppedMetrics.Inc()
+	}
+	return samples
+}
+
+func pointLabels(name string, resourceLabels map[string]string, attrs []otlpAttribute, extra map[string]string) labels.Labels {
+	m := map[string]string{model.MetricNameLabel: name}
+	for k, v := range resourceLabels {
+		m[k] = v
+	}
+	for _, attr := range attrs {
+		m[strutil.SanitizeLabelName(attr.Key)] = attr.Value.String()
+	}
+	for k, v := range extra {
+		m[k] = v
+	}
+	lset := make(labels.Labels, 0, len(m))
+	for k, v := range m {
+		lset = append(lset, labels.Label{Name: k, Value: v})
+	}
+	sort.Sort(lset)
+	return lset
+}
+
+func timestampMs(t otlpUint) int64 {
+	if t == 0 {
+		return time.Now().UnixNano() / int64(time.Millisecond)
+	}
+	return int64(t) / int64(time.Millisecond)
+}
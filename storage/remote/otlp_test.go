@@ -0,0 +1,181 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+)
+
+type otlpTestAppendable struct {
+	samples []otlpSample
+}
+
+func (a *otlpTestAppendable) Appender(_ context.Context) storage.Appender { return a }
+
+func (a *otlpTestAppendable) Add(l labels.Labels, t int64, v float64) (uint64, error) {
+	a.samples = append(a.samples, otlpSample{lset: l, t: t, v: v})
+	return 0, nil
+}
+
+func (a *otlpTestAppendable) AddFast(ref uint64, t int64, v float64) error { return nil }
+func (a *otlpTestAppendable) Commit() error                                { return nil }
+func (a *otlpTestAppendable) Rollback() error                              { return nil }
+
+func TestOTLPWriteHandler(t *testing.T) {
+	body := `{
+		"resourceMetrics": [{
+			"resource": {"attributes": [
+				{"key": "service.name", "value": {"stringValue": "shop"}},
+				{"key": "service.instance.id", "value": {"stringValue": "i-123"}},
+				{"key": "aliyun.ecs.instance.id", "value": {"stringValue": "i-abc"}},
+				{"key": "ignored.attribute", "value": {"stringValue": "x"}}
+			]},
+			"scopeMetrics": [{"metrics": [
+				{
+					"name": "http.client.duration",
+					"sum": {
+						"aggregationTemporality": "AGGREGATION_TEMPORALITY_CUMULATIVE",
+						"isMonotonic": true,
+						"dataPoints": [{
+							"attributes": [{"key": "status", "value": {"stringValue": "200"}}],
+							"timeUnixNano": "1600000000000000000",
+							"asInt": "42"
+						}]
+					}
+				},
+				{
+					"name": "queue.length",
+					"gauge": {"dataPoints": [{"timeUnixNano": 1600000000000000000, "asDouble": 7.5}]}
+				},
+				{
+					"name": "request.size",
+					"histogram": {
+						"aggregationTemporality": 2,
+						"dataPoints": [{
+							"timeUnixNano": "1600000000000000000",
+							"count": "6",
+							"sum": 30,
+							"bucketCounts": ["1", "3"],
+							"explicitBounds": [1, 10]
+						}]
+					}
+				},
+				{
+					"name": "dropped.delta",
+					"sum": {"aggregationTemporality": "AGGREGATION_TEMPORALITY_DELTA", "dataPoints": [{"asInt": "1"}]}
+				}
+			]}]
+		}]
+	}`
+
+	app := &otlpTestAppendable{}
+	handler := NewOTLPWriteHandler(log.NewNopLogger(), app, func() config.Config {
+		cfg := config.DefaultConfig
+		cfg.OTLPConfig.PromoteResourceAttributes = []string{"aliyun.ecs.instance.id"}
+		return cfg
+	}, "", "")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/api/v1/otlp/v1/metrics", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	byName := map[string][]otlpSample{}
+	for _, s := range app.samples {
+		name := s.lset.Get(labels.MetricName)
+		byName[name] = append(byName[name], s)
+	}
+
+	sum := byName["http_client_duration"]
+	require.Equal(t, 1, len(sum))
+	require.Equal(t, 42.0, sum[0].v)
+	require.Equal(t, int64(1600000000000), sum[0].t)
+	require.Equal(t, "shop", sum[0].lset.Get("job"))
+	require.Equal(t, "i-123", sum[0].lset.Get("instance"))
+	require.Equal(t, "i-abc", sum[0].lset.Get("aliyun_ecs_instance_id"))
+	require.Equal(t, "", sum[0].lset.Get("ignored_attribute"))
+	require.Equal(t, "200", sum[0].lset.Get("status"))
+
+	require.Equal(t, 7.5, byName["queue_length"][0].v)
+
+	// Histogram buckets are cumulative, with a +Inf bucket from the count.
+	buckets := byName["request_size_bucket"]
+	require.Equal(t, 3, len(buckets))
+	les := map[string]float64{}
+	for _, s := range buckets {
+		les[s.lset.Get(labels.BucketLabel)] = s.v
+	}
+	require.Equal(t, map[string]float64{"1": 1, "10": 4, "+Inf": 6}, les)
+	require.Equal(t, 30.0, byName["request_size_sum"][0].v)
+	require.Equal(t, 6.0, byName["request_size_count"][0].v)
+
+	// Delta temporality is not translatable and must be dropped.
+	require.Equal(t, 0, len(byName["dropped_delta"]))
+}
+
+func TestOTLPWriteHandlerErrors(t *testing.T) {
+	handler := NewOTLPWriteHandler(log.NewNopLogger(), &otlpTestAppendable{}, func() config.Config {
+		return config.DefaultConfig
+	}, "", "")
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/otlp/v1/metrics", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/api/v1/otlp/v1/metrics", strings.NewReader("not json")))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestOTLPWriteHandlerTenant(t *testing.T) {
+	body := `{
+		"resourceMetrics": [{
+			"scopeMetrics": [{"metrics": [{
+				"name": "queue.length",
+				"gauge": {"dataPoints": [{"timeUnixNano": "1600000000000000000", "asDouble": 7.5, "attributes": [{"key": "team", "value": {"stringValue": "spoofed"}}]}]}
+			}]}]
+		}]
+	}`
+
+	app := &otlpTestAppendable{}
+	handler := NewOTLPWriteHandler(log.NewNopLogger(), app, func() config.Config {
+		return config.DefaultConfig
+	}, "team", "X-Prometheus-Tenant")
+
+	// Requests without the tenant header are rejected.
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/api/v1/otlp/v1/metrics", strings.NewReader(body)))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// The tenant label is enforced, overriding any client-sent value.
+	recorder = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/otlp/v1/metrics", strings.NewReader(body))
+	req.Header.Set("X-Prometheus-Tenant", "a")
+	handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, 1, len(app.samples))
+	require.Equal(t, "a", app.samples[0].lset.Get("team"))
+}
@@ -46,6 +46,9 @@ const (
 
 	// Allow 30% too many shards before scaling down.
 	shardToleranceFraction = 0.3
+
+	// How often the WAL backlog size is re-checked against max_backlog_size.
+	backlogCheckInterval = 5 * time.Second
 )
 
 type queueManagerMetrics struct {
@@ -58,6 +61,7 @@ type queueManagerMetrics struct {
 	retriedSamplesTotal  prometheus.Counter
 	retriedMetadataTotal prometheus.Counter
 	droppedSamplesTotal  prometheus.Counter
+	droppedBacklogTotal  prometheus.Counter
 	enqueueRetriesTotal  prometheus.Counter
 	sentBatchDuration    prometheus.Histogram
 	highestSentTimestamp *maxTimestamp
@@ -130,6 +134,13 @@ func newQueueManagerMetrics(r prometheus.Registerer, rn, e string) *queueManager
 		Help:        "Total number of samples which were dropped after being read from the WAL before being sent via remote write.",
 		ConstLabels: constLabels,
 	})
+	m.droppedBacklogTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "samples_dropped_backlog_total",
+		Help:        "Total number of samples dropped because the unread WAL behind this queue exceeded max_backlog_size.",
+		ConstLabels: constLabels,
+	})
 	m.enqueueRetriesTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace:   namespace,
 		Subsystem:   subsystem,
@@ -231,6 +242,7 @@ func (m *queueManagerMetrics) register() {
 			m.retriedSamplesTotal,
 			m.retriedMetadataTotal,
 			m.droppedSamplesTotal,
+			m.droppedBacklogTotal,
 			m.enqueueRetriesTotal,
 			m.sentBatchDuration,
 			m.highestSentTimestamp,
@@ -256,6 +268,7 @@ func (m *queueManagerMetrics) unregister() {
 		m.reg.Unregister(m.retriedSamplesTotal)
 		m.reg.Unregister(m.retriedMetadataTotal)
 		m.reg.Unregister(m.droppedSamplesTotal)
+		m.reg.Unregister(m.droppedBacklogTotal)
 		m.reg.Unregister(m.enqueueRetriesTotal)
 		m.reg.Unregister(m.sentBatchDuration)
 		m.reg.Unregister(m.highestSentTimestamp)
@@ -282,6 +295,13 @@ type WriteClient interface {
 	Endpoint() string
 }
 
+// WriteV2Client is implemented by write clients that can negotiate the Remote
+// Write 2.0 message. WriteV2 reports whether the next Store call expects the
+// io.prometheus.write.v2.Request encoding.
+type WriteV2Client interface {
+	WriteV2() bool
+}
+
 // QueueManager manages a queue of samples to be sent to the Storage
 // indicated by the provided WriteClient. Implements writeTo interface
 // used by WAL Watcher.
@@ -295,6 +315,7 @@ type QueueManager struct {
 	externalLabels  labels.Labels
 	relabelConfigs  []*relabel.Config
 	watcher         *wal.Watcher
+	tailer          *walTailer
 	metadataWatcher *MetadataWatcher
 
 	clientMtx   sync.RWMutex
@@ -316,6 +337,12 @@ type QueueManager struct {
 	metrics              *queueManagerMetrics
 	interner             *pool
 	highestRecvTimestamp *maxTimestamp
+
+	deadLetter *deadLetterWriter
+
+	backlogMtx       sync.Mutex
+	lastBacklogCheck time.Time
+	backlogExceeded  bool
 }
 
 // NewQueueManager builds a new QueueManager.
@@ -323,6 +350,7 @@ func NewQueueManager(
 	metrics *queueManagerMetrics,
 	watcherMetrics *wal.WatcherMetrics,
 	readerMetrics *wal.LiveReaderMetrics,
+	tailer *walTailer,
 	logger log.Logger,
 	walDir string,
 	samplesIn *ewmaRate,
@@ -368,7 +396,17 @@ func NewQueueManager(
 		highestRecvTimestamp: highestRecvTimestamp,
 	}
 
-	t.watcher = wal.NewWatcher(watcherMetrics, readerMetrics, logger, client.Name(), t, walDir)
+	if cfg.DeadLetterFile != "" {
+		t.deadLetter = newDeadLetterWriter(cfg.DeadLetterFile, logger)
+	}
+
+	if tailer != nil {
+		// A shared tailer decodes the WAL once for all queues instead of
+		// every queue running a watcher of its own.
+		t.tailer = tailer
+	} else {
+		t.watcher = wal.NewWatcher(watcherMetrics, readerMetrics, logger, client.Name(), t, walDir)
+	}
 	if t.mcfg.Send {
 		t.metadataWatcher = NewMetadataWatcher(logger, sm, client.Name(), t, t.mcfg.SendInterval, flushDeadline)
 	}
@@ -399,7 +437,15 @@ func (t *QueueManager) AppendMetadata(ctx context.Context, metadata []scrape.Met
 
 func (t *QueueManager) sendMetadataWithBackoff(ctx context.Context, metadata []prompb.MetricMetadata) error {
 	// Build the WriteRequest with no samples.
-	req, _, err := buildWriteRequest(nil, metadata, nil)
+	var (
+		req []byte
+		err error
+	)
+	if t.sendV2() {
+		req, _, err = buildV2WriteRequest(nil, metadata, nil)
+	} else {
+		req, _, err = buildWriteRequest(nil, metadata, nil, nil)
+	}
 	if err != nil {
 		return err
 	}
@@ -420,6 +466,16 @@ func (t *QueueManager) sendMetadataWithBackoff(ctx context.Context, metadata []p
 		t.metrics.sentBatchDuration.Observe(time.Since(begin).Seconds())
 
 		if err != nil {
+			if err == errV2Fallback {
+				// The client has downgraded itself; re-encode with the 1.0
+				// message and let the backoff loop retry.
+				level.Warn(t.logger).Log("msg", "Falling back to the Remote Write 1.0 message", "err", err)
+				var rerr error
+				if req, _, rerr = buildWriteRequest(nil, metadata, nil, nil); rerr != nil {
+					return rerr
+				}
+				return RecoverableError{err}
+			}
 			span.LogKV("error", err)
 			ext.Error.Set(span, true)
 			return err
@@ -440,9 +496,45 @@ func (t *QueueManager) sendMetadataWithBackoff(ctx context.Context, metadata []p
 	return nil
 }
 
+// backlogLimitExceeded reports whether the unread WAL behind this queue is
+// over max_backlog_size. Segment sizes are only re-checked every
+// backlogCheckInterval to keep Append cheap.
+func (t *QueueManager) backlogLimitExceeded() bool {
+	if t.cfg.MaxBacklogSize <= 0 {
+		return false
+	}
+	t.backlogMtx.Lock()
+	defer t.backlogMtx.Unlock()
+	if time.Since(t.lastBacklogCheck) >= backlogCheckInterval {
+		t.lastBacklogCheck = time.Now()
+		exceeded := t.walBacklog() > int64(t.cfg.MaxBacklogSize)
+		if exceeded && !t.backlogExceeded {
+			level.Warn(t.logger).Log("msg", "WAL backlog exceeds max_backlog_size, dropping oldest pending samples", "limit", t.cfg.MaxBacklogSize)
+		}
+		t.backlogExceeded = exceeded
+	}
+	return t.backlogExceeded
+}
+
+// walBacklog returns the unread WAL size behind this queue, read from the
+// shared tailer when one is used.
+func (t *QueueManager) walBacklog() int64 {
+	if t.tailer != nil {
+		return t.tailer.Backlog()
+	}
+	return t.watcher.Backlog()
+}
+
 // Append queues a sample to be sent to the remote storage. Blocks until all samples are
 // enqueued on their shards or a shutdown signal is received.
 func (t *QueueManager) Append(samples []record.RefSample) bool {
+	if t.backlogLimitExceeded() {
+		// Drop the oldest pending data instead of stalling the WAL watcher
+		// and letting the unread WAL fill the disk during a long outage.
+		t.metrics.droppedBacklogTotal.Add(float64(len(samples)))
+		t.samplesDropped.incr(int64(len(samples)))
+		return true
+	}
 outer:
 	for _, s := range samples {
 		t.seriesMtx.Lock()
@@ -474,6 +566,14 @@ outer:
 				continue outer
 			}
 
+			// The shards can stay full for the whole duration of a remote
+			// store outage; keep honoring the backlog limit while blocked.
+			if t.backlogLimitExceeded() {
+				t.metrics.droppedBacklogTotal.Inc()
+				t.samplesDropped.incr(1)
+				continue outer
+			}
+
 			t.metrics.enqueueRetriesTotal.Inc()
 			time.Sleep(time.Duration(backoff))
 			backoff = backoff * 2
@@ -497,7 +597,11 @@ func (t *QueueManager) Start() {
 	t.metrics.maxSamplesPerSend.Set(float64(t.cfg.MaxSamplesPerSend))
 
 	t.shards.start(t.numShards)
-	t.watcher.Start()
+	if t.tailer != nil {
+		t.tailer.register(t)
+	} else {
+		t.watcher.Start()
+	}
 	if t.mcfg.Send {
 		t.metadataWatcher.Start()
 	}
@@ -519,7 +623,11 @@ func (t *QueueManager) Stop() {
 	// is to ensure we don't end up executing a reshard and shards.stop() at the same time, which
 	// causes a closed channel panic.
 	t.shards.stop()
-	t.watcher.Stop()
+	if t.tailer != nil {
+		t.tailer.deregister(t)
+	} else {
+		t.watcher.Stop()
+	}
 	if t.mcfg.Send {
 		t.metadataWatcher.Stop()
 	}
@@ -589,6 +697,15 @@ func (t *QueueManager) client() WriteClient {
 	return t.storeClient
 }
 
+// sendV2 reports whether batches should currently be encoded with the Remote
+// Write 2.0 message. It flips to false when the endpoint rejects the format.
+func (t *QueueManager) sendV2() bool {
+	if c, ok := t.client().(WriteV2Client); ok {
+		return c.WriteV2()
+	}
+	return false
+}
+
 func (t *QueueManager) internLabels(lbls labels.Labels) {
 	for i, l := range lbls {
 		lbls[i].Name = t.interner.intern(l.Name)
@@ -904,6 +1021,7 @@ func (s *shards) runShard(ctx context.Context, shardID int, queue chan sample) {
 		max            = s.qm.cfg.MaxSamplesPerSend
 		nPending       = 0
 		pendingSamples = allocateTimeSeries(max)
+		pBuf           = proto.NewBuffer(nil)
 		buf            []byte
 	)
 
@@ -933,7 +1051,7 @@ func (s *shards) runShard(ctx context.Context, shardID int, queue chan sample) {
 			if !ok {
 				if nPending > 0 {
 					level.Debug(s.qm.logger).Log("msg", "Flushing samples to remote storage...", "count", nPending)
-					s.sendSamples(ctx, pendingSamples[:nPending], &buf)
+					s.sendSamples(ctx, pendingSamples[:nPending], pBuf, &buf)
 					s.qm.metrics.pendingSamples.Sub(float64(nPending))
 					level.Debug(s.qm.logger).Log("msg", "Done flushing.")
 				}
@@ -949,7 +1067,7 @@ func (s *shards) runShard(ctx context.Context, shardID int, queue chan sample) {
 			nPending++
 
 			if nPending >= max {
-				s.sendSamples(ctx, pendingSamples, &buf)
+				s.sendSamples(ctx, pendingSamples, pBuf, &buf)
 				nPending = 0
 				s.qm.metrics.pendingSamples.Sub(float64(max))
 
@@ -960,7 +1078,7 @@ func (s *shards) runShard(ctx context.Context, shardID int, queue chan sample) {
 		case <-timer.C:
 			if nPending > 0 {
 				level.Debug(s.qm.logger).Log("msg", "runShard timer ticked, sending samples", "samples", nPending, "shard", shardNum)
-				s.sendSamples(ctx, pendingSamples[:nPending], &buf)
+				s.sendSamples(ctx, pendingSamples[:nPending], pBuf, &buf)
 				s.qm.metrics.pendingSamples.Sub(float64(nPending))
 				nPending = 0
 			}
@@ -969,12 +1087,15 @@ func (s *shards) runShard(ctx context.Context, shardID int, queue chan sample) {
 	}
 }
 
-func (s *shards) sendSamples(ctx context.Context, samples []prompb.TimeSeries, buf *[]byte) {
+func (s *shards) sendSamples(ctx context.Context, samples []prompb.TimeSeries, pBuf *proto.Buffer, buf *[]byte) {
 	begin := time.Now()
-	err := s.sendSamplesWithBackoff(ctx, samples, buf)
+	err := s.sendSamplesWithBackoff(ctx, samples, pBuf, buf)
 	if err != nil {
 		level.Error(s.qm.logger).Log("msg", "non-recoverable error", "count", len(samples), "err", err)
 		s.qm.metrics.failedSamplesTotal.Add(float64(len(samples)))
+		if s.qm.deadLetter != nil {
+			s.qm.deadLetter.Log(samples, err)
+		}
 	}
 
 	// These counters are used to calculate the dynamic sharding, and as such
@@ -985,16 +1106,25 @@ func (s *shards) sendSamples(ctx context.Context, samples []prompb.TimeSeries, b
 }
 
 // sendSamples to the remote storage with backoff for recoverable errors.
-func (s *shards) sendSamplesWithBackoff(ctx context.Context, samples []prompb.TimeSeries, buf *[]byte) error {
+func (s *shards) sendSamplesWithBackoff(ctx context.Context, samples []prompb.TimeSeries, pBuf *proto.Buffer, buf *[]byte) error {
 	// Build the WriteRequest with no metadata.
-	req, highest, err := buildWriteRequest(samples, nil, *buf)
+	var (
+		req     []byte
+		highest int64
+		err     error
+	)
+	if s.qm.sendV2() {
+		req, highest, err = buildV2WriteRequest(samples, nil, *buf)
+	} else {
+		req, highest, err = buildWriteRequest(samples, nil, pBuf, *buf)
+	}
 	if err != nil {
 		// Failing to build the write request is non-recoverable, since it will
 		// only error if marshaling the proto to bytes fails.
 		return err
 	}
 
-	reqSize := len(*buf)
+	reqSize := len(req)
 	sampleCount := len(samples)
 	*buf = req
 
@@ -1017,6 +1147,18 @@ func (s *shards) sendSamplesWithBackoff(ctx context.Context, samples []prompb.Ti
 		s.qm.metrics.sentBatchDuration.Observe(time.Since(begin).Seconds())
 
 		if err != nil {
+			if err == errV2Fallback {
+				// The client has downgraded itself; re-encode with the 1.0
+				// message and let the backoff loop retry.
+				level.Warn(s.qm.logger).Log("msg", "Falling back to the Remote Write 1.0 message", "err", err)
+				req, _, rerr := buildWriteRequest(samples, nil, pBuf, *buf)
+				if rerr != nil {
+					return rerr
+				}
+				reqSize = len(req)
+				*buf = req
+				return RecoverableError{err}
+			}
 			span.LogKV("error", err)
 			ext.Error.Set(span, true)
 			return err
@@ -1076,7 +1218,7 @@ func sendWriteRequestWithBackoff(ctx context.Context, cfg config.QueueConfig, s
 	}
 }
 
-func buildWriteRequest(samples []prompb.TimeSeries, metadata []prompb.MetricMetadata, buf []byte) ([]byte, int64, error) {
+func buildWriteRequest(samples []prompb.TimeSeries, metadata []prompb.MetricMetadata, pBuf *proto.Buffer, buf []byte) ([]byte, int64, error) {
 	var highest int64
 	for _, ts := range samples {
 		// At the moment we only ever append a TimeSeries with a single sample in it.
@@ -1090,8 +1232,12 @@ func buildWriteRequest(samples []prompb.TimeSeries, metadata []prompb.MetricMeta
 		Metadata:   metadata,
 	}
 
-	data, err := proto.Marshal(req)
-	if err != nil {
+	if pBuf == nil {
+		pBuf = proto.NewBuffer(nil) // For convenience in tests. Not efficient.
+	} else {
+		pBuf.Reset()
+	}
+	if err := pBuf.Marshal(req); err != nil {
 		return nil, highest, err
 	}
 
@@ -1100,7 +1246,7 @@ func buildWriteRequest(samples []prompb.TimeSeries, metadata []prompb.MetricMeta
 	if buf != nil {
 		buf = buf[0:cap(buf)]
 	}
-	compressed := snappy.Encode(buf, data)
+	compressed := snappy.Encode(buf, pBuf.Bytes())
 	return compressed, highest, nil
 }
 
@@ -0,0 +1,121 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// cachingReadClient wraps a ReadClient with a size- and time-bounded LRU
+// cache keyed by the serialized query, i.e. by matchers and range. Repeated
+// dashboard loads issue identical queries, which are then served from memory
+// instead of hitting the remote endpoint again.
+type cachingReadClient struct {
+	client     ReadClient
+	maxEntries int
+	ttl        time.Duration
+
+	mtx     sync.Mutex
+	lru     *list.List // Of *readCacheEntry, most recently used in front.
+	entries map[string]*list.Element
+
+	now func() time.Time // Abstracted for testing.
+}
+
+type readCacheEntry struct {
+	key     string
+	result  *prompb.QueryResult
+	created time.Time
+}
+
+func newCachingReadClient(c ReadClient, maxEntries int, ttl time.Duration) ReadClient {
+	return &cachingReadClient{
+		client:     c,
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// Read implements ReadClient.
+func (c *cachingReadClient) Read(ctx context.Context, query *prompb.Query) (*prompb.QueryResult, error) {
+	data, err := proto.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	key := string(data)
+
+	if res, ok := c.get(key); ok {
+		return res, nil
+	}
+
+	res, err := c.client.Read(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, res)
+	return res, nil
+}
+
+func (c *cachingReadClient) get(key string) (*prompb.QueryResult, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*readCacheEntry)
+	if c.now().Sub(entry.created) >= c.ttl {
+		c.lru.Remove(e)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return entry.result, true
+}
+
+func (c *cachingReadClient) put(key string, result *prompb.QueryResult) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		entry := e.Value.(*readCacheEntry)
+		entry.result = result
+		entry.created = c.now()
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	for c.lru.Len() >= c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*readCacheEntry).key)
+	}
+
+	c.entries[key] = c.lru.PushFront(&readCacheEntry{
+		key:     key,
+		result:  result,
+		created: c.now(),
+	})
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+type countingReadClient struct {
+	reads int
+}
+
+func (c *countingReadClient) Read(_ context.Context, query *prompb.Query) (*prompb.QueryResult, error) {
+	c.reads++
+	return &prompb.QueryResult{}, nil
+}
+
+func testQuery(start, end int64) *prompb.Query {
+	return &prompb.Query{
+		StartTimestampMs: start,
+		EndTimestampMs:   end,
+		Matchers:         []*prompb.LabelMatcher{{Name: "foo", Value: "bar"}},
+	}
+}
+
+func TestCachingReadClient(t *testing.T) {
+	upstream := &countingReadClient{}
+	c := newCachingReadClient(upstream, 2, time.Minute).(*cachingReadClient)
+
+	now := time.Unix(0, 0)
+	c.now = func() time.Time { return now }
+
+	ctx := context.Background()
+
+	// An identical query only reaches the upstream client once.
+	_, err := c.Read(ctx, testQuery(0, 100))
+	require.NoError(t, err)
+	_, err = c.Read(ctx, testQuery(0, 100))
+	require.NoError(t, err)
+	require.Equal(t, 1, upstream.reads)
+
+	// A different range misses the cache.
+	_, err = c.Read(ctx, testQuery(0, 200))
+	require.NoError(t, err)
+	require.Equal(t, 2, upstream.reads)
+
+	// The cache holds two entries, so a third query evicts the least
+	// recently used one.
+	_, err = c.Read(ctx, testQuery(0, 300))
+	require.NoError(t, err)
+	_, err = c.Read(ctx, testQuery(0, 100))
+	require.NoError(t, err)
+	require.Equal(t, 4, upstream.reads)
+
+	// Entries expire after the TTL.
+	now = now.Add(time.Minute)
+	_, err = c.Read(ctx, testQuery(0, 100))
+	require.NoError(t, err)
+	require.Equal(t, 5, upstream.reads)
+}
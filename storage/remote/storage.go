@@ -58,6 +58,7 @@ type Storage struct {
 
 	// For reads.
 	queryables             []storage.SampleAndChunkQueryable
+	replicaLabels          []string
 	localStartTimeCallback startTimeCallback
 }
 
@@ -116,6 +117,10 @@ func (s *Storage) ApplyConfig(conf *config.Config) error {
 			return err
 		}
 
+		if rrConf.CacheSize > 0 {
+			c = newCachingReadClient(c, rrConf.CacheSize, time.Duration(rrConf.CacheTTL))
+		}
+
 		queryables = append(queryables, NewSampleAndChunkQueryableClient(
 			c,
 			conf.GlobalConfig.ExternalLabels,
@@ -126,6 +131,20 @@ func (s *Storage) ApplyConfig(conf *config.Config) error {
 	}
 	s.queryables = queryables
 
+	// The replica labels of all read configs are combined: deduplication
+	// is across endpoints, so there is one set for the whole read path.
+	seen := map[string]struct{}{}
+	replicaLabels := []string{}
+	for _, rrConf := range conf.RemoteReadConfigs {
+		for _, l := range rrConf.ReplicaLabels {
+			if _, ok := seen[l]; !ok {
+				seen[l] = struct{}{}
+				replicaLabels = append(replicaLabels, l)
+			}
+		}
+	}
+	s.replicaLabels = replicaLabels
+
 	return nil
 }
 
@@ -142,6 +161,7 @@ func (s *Storage) StartTime() (int64, error) {
 func (s *Storage) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
 	s.mtx.Lock()
 	queryables := s.queryables
+	replicaLabels := s.replicaLabels
 	s.mtx.Unlock()
 
 	queriers := make([]storage.Querier, 0, len(queryables))
@@ -150,6 +170,12 @@ func (s *Storage) Querier(ctx context.Context, mint, maxt int64) (storage.Querie
 		if err != nil {
 			return nil, err
 		}
+		if len(replicaLabels) > 0 {
+			// Each endpoint's replica labels are stripped before the merge,
+			// so the merge querier chains the replicas of one series into a
+			// single deduplicated, gap-filled series.
+			q = newDedupQuerier(q, replicaLabels)
+		}
 		queriers = append(queriers, q)
 	}
 	return storage.NewMergeQuerier(nil, queriers, storage.ChainedSeriesMerge), nil
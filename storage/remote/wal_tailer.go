@@ -0,0 +1,168 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/prometheus/prometheus/tsdb/record"
+	"github.com/prometheus/prometheus/tsdb/wal"
+)
+
+// walTailer tails the WAL with a single watcher and fans the decoded records
+// out to every registered queue manager, so configuring a second remote
+// write endpoint does not double the WAL read and decode work.
+type walTailer struct {
+	watcherMetrics *wal.WatcherMetrics
+	readerMetrics  *wal.LiveReaderMetrics
+	logger         log.Logger
+	walDir         string
+
+	mtx       sync.Mutex
+	watcher   *wal.Watcher
+	consumers map[wal.WriteTo]struct{}
+	// Series records seen per segment since the last checkpoint, replayed
+	// to consumers that register after tailing has started so they can
+	// resolve the refs of subsequent samples.
+	series map[int][]record.RefSeries
+}
+
+func newWALTailer(watcherMetrics *wal.WatcherMetrics, readerMetrics *wal.LiveReaderMetrics, logger log.Logger, walDir string) *walTailer {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &walTailer{
+		watcherMetrics: watcherMetrics,
+		readerMetrics:  readerMetrics,
+		logger:         logger,
+		walDir:         walDir,
+		consumers:      map[wal.WriteTo]struct{}{},
+		series:         map[int][]record.RefSeries{},
+	}
+}
+
+// register adds a consumer to the fan-out. The first consumer starts the
+// watcher; consumers registered later first receive the series records read
+// since the last checkpoint.
+func (t *walTailer) register(w wal.WriteTo) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	segments := make([]int, 0, len(t.series))
+	for seg := range t.series {
+		segments = append(segments, seg)
+	}
+	sort.Ints(segments)
+	for _, seg := range segments {
+		w.StoreSeries(t.series[seg], seg)
+	}
+
+	t.consumers[w] = struct{}{}
+	if t.watcher == nil {
+		// The watcher cannot be restarted once stopped, so a fresh one is
+		// created whenever the first consumer registers.
+		t.watcher = wal.NewWatcher(t.watcherMetrics, t.readerMetrics, t.logger, "fanout", t, t.walDir)
+		t.watcher.Start()
+	}
+}
+
+// deregister removes a consumer. The watcher is stopped once the last
+// consumer is gone.
+func (t *walTailer) deregister(w wal.WriteTo) {
+	t.mtx.Lock()
+	delete(t.consumers, w)
+	stop := len(t.consumers) == 0 && t.watcher != nil
+	var watcher *wal.Watcher
+	if stop {
+		watcher = t.watcher
+		t.watcher = nil
+		t.series = map[int][]record.RefSeries{}
+	}
+	t.mtx.Unlock()
+
+	// Stop without holding the lock as the watcher may be mid fan-out.
+	if stop {
+		watcher.Stop()
+	}
+}
+
+// Backlog returns the backlog of the underlying watcher, 0 if it is not
+// running.
+func (t *walTailer) Backlog() int64 {
+	t.mtx.Lock()
+	watcher := t.watcher
+	t.mtx.Unlock()
+	if watcher == nil {
+		return 0
+	}
+	return watcher.Backlog()
+}
+
+func (t *walTailer) snapshot() []wal.WriteTo {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	consumers := make([]wal.WriteTo, 0, len(t.consumers))
+	for w := range t.consumers {
+		consumers = append(consumers, w)
+	}
+	return consumers
+}
+
+// Append implements wal.WriteTo.
+func (t *walTailer) Append(samples []record.RefSample) bool {
+	ok := true
+	for _, w := range t.snapshot() {
+		if !w.Append(samples) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// StoreSeries implements wal.WriteTo.
+func (t *walTailer) StoreSeries(series []record.RefSeries, segment int) {
+	t.mtx.Lock()
+	t.series[segment] = append(t.series[segment], series...)
+	consumers := make([]wal.WriteTo, 0, len(t.consumers))
+	for w := range t.consumers {
+		consumers = append(consumers, w)
+	}
+	t.mtx.Unlock()
+
+	for _, w := range consumers {
+		w.StoreSeries(series, segment)
+	}
+}
+
+// SeriesReset implements wal.WriteTo.
+func (t *walTailer) SeriesReset(segment int) {
+	t.mtx.Lock()
+	for seg := range t.series {
+		if seg < segment {
+			delete(t.series, seg)
+		}
+	}
+	consumers := make([]wal.WriteTo, 0, len(t.consumers))
+	for w := range t.consumers {
+		consumers = append(consumers, w)
+	}
+	t.mtx.Unlock()
+
+	for _, w := range consumers {
+		w.SeriesReset(segment)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/tsdb/record"
+)
+
+type testTailerConsumer struct {
+	samples []record.RefSample
+	series  map[int][]record.RefSeries
+	resets  []int
+}
+
+func newTestTailerConsumer() *testTailerConsumer {
+	return &testTailerConsumer{series: map[int][]record.RefSeries{}}
+}
+
+func (c *testTailerConsumer) Append(samples []record.RefSample) bool {
+	c.samples = append(c.samples, samples...)
+	return true
+}
+
+func (c *testTailerConsumer) StoreSeries(series []record.RefSeries, segment int) {
+	c.series[segment] = append(c.series[segment], series...)
+}
+
+func (c *testTailerConsumer) SeriesReset(segment int) {
+	c.resets = append(c.resets, segment)
+}
+
+func TestWALTailerFanOut(t *testing.T) {
+	tailer := newWALTailer(nil, nil, nil, "")
+
+	c1 := newTestTailerConsumer()
+	tailer.consumers[c1] = struct{}{}
+	c2 := newTestTailerConsumer()
+	tailer.consumers[c2] = struct{}{}
+
+	series := []record.RefSeries{{Ref: 1}, {Ref: 2}}
+	samples := []record.RefSample{{Ref: 1, T: 1, V: 1}}
+	tailer.StoreSeries(series, 0)
+	tailer.Append(samples)
+	tailer.SeriesReset(1)
+
+	for _, c := range []*testTailerConsumer{c1, c2} {
+		require.Equal(t, series, c.series[0])
+		require.Equal(t, samples, c.samples)
+		require.Equal(t, []int{1}, c.resets)
+	}
+}
+
+func TestWALTailerSeriesReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWALTailerSeriesReplay")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	err = os.Mkdir(path.Join(dir, "wal"), 0777)
+	require.NoError(t, err)
+
+	tailer := newWALTailer(nil, nil, nil, dir)
+
+	first := newTestTailerConsumer()
+	tailer.register(first)
+	defer tailer.deregister(first)
+
+	tailer.StoreSeries([]record.RefSeries{{Ref: 1}}, 0)
+	tailer.StoreSeries([]record.RefSeries{{Ref: 2}}, 1)
+	tailer.SeriesReset(1)
+
+	// A consumer registered later receives the series records that are
+	// still referenced, in segment order, but not old samples or resets.
+	late := newTestTailerConsumer()
+	tailer.register(late)
+	defer tailer.deregister(late)
+
+	require.Equal(t, map[int][]record.RefSeries{1: {{Ref: 2}}}, late.series)
+	require.Equal(t, 0, len(late.samples))
+	require.Equal(t, 0, len(late.resets))
+}
+
+func TestWALTailerWatcherLifecycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWALTailerWatcherLifecycle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	err = os.Mkdir(path.Join(dir, "wal"), 0777)
+	require.NoError(t, err)
+
+	tailer := newWALTailer(nil, nil, nil, dir)
+	require.Nil(t, tailer.watcher)
+
+	c1 := newTestTailerConsumer()
+	c2 := newTestTailerConsumer()
+
+	tailer.register(c1)
+	require.NotNil(t, tailer.watcher)
+	watcher := tailer.watcher
+
+	// A second consumer does not start another watcher.
+	tailer.register(c2)
+	require.Equal(t, watcher, tailer.watcher)
+
+	tailer.deregister(c1)
+	require.NotNil(t, tailer.watcher)
+
+	// The watcher is stopped with the last consumer and a fresh one is
+	// created on the next registration.
+	tailer.deregister(c2)
+	require.Nil(t, tailer.watcher)
+
+	tailer.register(c1)
+	require.NotNil(t, tailer.watcher)
+	require.NotEqual(t, watcher, tailer.watcher)
+	tailer.deregister(c1)
+}
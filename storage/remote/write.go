@@ -46,6 +46,7 @@ type WriteStorage struct {
 
 	watcherMetrics    *wal.WatcherMetrics
 	liveReaderMetrics *wal.LiveReaderMetrics
+	tailer            *walTailer
 	externalLabels    labels.Labels
 	walDir            string
 	queues            map[string]*QueueManager
@@ -83,6 +84,7 @@ func NewWriteStorage(logger log.Logger, reg prometheus.Registerer, walDir string
 			}),
 		},
 	}
+	rws.tailer = newWALTailer(rws.watcherMetrics, rws.liveReaderMetrics, logger, walDir)
 	if reg != nil {
 		reg.MustRegister(rws.highestTimestamp)
 	}
@@ -130,14 +132,32 @@ func (rws *WriteStorage) ApplyConfig(conf *config.Config) error {
 			name = rwConf.Name
 		}
 
-		c, err := NewWriteClient(name, &ClientConfig{
+		var c WriteClient
+		c, err = NewWriteClient(name, &ClientConfig{
 			URL:              rwConf.URL,
 			Timeout:          rwConf.RemoteTimeout,
 			HTTPClientConfig: rwConf.HTTPClientConfig,
+			ProtobufMessage:  rwConf.ProtobufMessage,
 		})
 		if err != nil {
 			return err
 		}
+		if len(rwConf.FailoverURLs) > 0 {
+			clients := []WriteClient{c}
+			for _, u := range rwConf.FailoverURLs {
+				sc, err := NewWriteClient(name, &ClientConfig{
+					URL:              u,
+					Timeout:          rwConf.RemoteTimeout,
+					HTTPClientConfig: rwConf.HTTPClientConfig,
+					ProtobufMessage:  rwConf.ProtobufMessage,
+				})
+				if err != nil {
+					return err
+				}
+				clients = append(clients, sc)
+			}
+			c = newFailoverClient(rws.logger, clients)
+		}
 
 		queue, ok := rws.queues[hash]
 		if externalLabelUnchanged && ok {
@@ -153,6 +173,7 @@ func (rws *WriteStorage) ApplyConfig(conf *config.Config) error {
 			newQueueManagerMetrics(rws.reg, name, endpoint),
 			rws.watcherMetrics,
 			rws.liveReaderMetrics,
+			rws.tailer,
 			rws.logger,
 			rws.walDir,
 			rws.samplesIn,
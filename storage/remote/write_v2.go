@@ -0,0 +1,365 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// This file implements the Remote Write 2.0 wire format, the
+// io.prometheus.write.v2.Request protobuf message. Every label name, label
+// value, help and unit string is interned exactly once in a symbols table and
+// referenced by index, which roughly halves the size of a typical request
+// compared to the 1.0 prometheus.WriteRequest message. Marshaling is done by
+// hand against the protobuf wire format since the repository does not
+// regenerate its protobuf code. Native histogram samples do not exist in this
+// server's data model and are therefore not implemented.
+
+// writeV2Request is the io.prometheus.write.v2.Request message. Fields 1-3
+// are reserved by the spec to stay disjoint from prometheus.WriteRequest.
+type writeV2Request struct {
+	Symbols    []string            // Field 4.
+	Timeseries []writeV2TimeSeries // Field 5.
+}
+
+// writeV2TimeSeries is the io.prometheus.write.v2.TimeSeries message.
+// Exemplars (field 4) and native histograms (field 3) are not implemented.
+type writeV2TimeSeries struct {
+	LabelsRefs       []uint32        // Field 1, packed, flat name/value ref pairs.
+	Samples          []prompb.Sample // Field 2.
+	Metadata         writeV2Metadata // Field 5.
+	CreatedTimestamp int64           // Field 6.
+}
+
+// writeV2Metadata is the io.prometheus.write.v2.Metadata message.
+type writeV2Metadata struct {
+	Type    int32  // Field 1, same numbering as prompb.MetricMetadata_MetricType.
+	HelpRef uint32 // Field 3.
+	UnitRef uint32 // Field 4.
+}
+
+// symbolTable interns strings for a single writeV2Request. Ref 0 is reserved
+// for the empty string by the spec.
+type symbolTable struct {
+	symbols []string
+	refs    map[string]uint32
+}
+
+func newSymbolTable() *symbolTable {
+	return &symbolTable{
+		symbols: []string{""},
+		refs:    map[string]uint32{"": 0},
+	}
+}
+
+func (t *symbolTable) ref(s string) uint32 {
+	if ref, ok := t.refs[s]; ok {
+		return ref
+	}
+	ref := uint32(len(t.symbols))
+	t.symbols = append(t.symbols, s)
+	t.refs[s] = ref
+	return ref
+}
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendKey(b []byte, field, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wire))
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendKey(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func (m writeV2Metadata) marshal() []byte {
+	var b []byte
+	if m.Type != 0 {
+		b = appendKey(b, 1, wireVarint)
+		b = binary.AppendUvarint(b, uint64(m.Type))
+	}
+	if m.HelpRef != 0 {
+		b = appendKey(b, 3, wireVarint)
+		b = binary.AppendUvarint(b, uint64(m.HelpRef))
+	}
+	if m.UnitRef != 0 {
+		b = appendKey(b, 4, wireVarint)
+		b = binary.AppendUvarint(b, uint64(m.UnitRef))
+	}
+	return b
+}
+
+func (ts writeV2TimeSeries) marshal() []byte {
+	var b []byte
+	if len(ts.LabelsRefs) > 0 {
+		var refs []byte
+		for _, r := range ts.LabelsRefs {
+			refs = binary.AppendUvarint(refs, uint64(r))
+		}
+		b = appendBytes(b, 1, refs)
+	}
+	for _, s := range ts.Samples {
+		var sb []byte
+		sb = appendKey(sb, 1, wireFixed64)
+		sb = binary.LittleEndian.AppendUint64(sb, math.Float64bits(s.Value))
+		if s.Timestamp != 0 {
+			sb = appendKey(sb, 2, wireVarint)
+			sb = binary.AppendUvarint(sb, uint64(s.Timestamp))
+		}
+		b = appendBytes(b, 2, sb)
+	}
+	if md := ts.Metadata.marshal(); len(md) > 0 {
+		b = appendBytes(b, 5, md)
+	}
+	if ts.CreatedTimestamp != 0 {
+		b = appendKey(b, 6, wireVarint)
+		b = binary.AppendUvarint(b, uint64(ts.CreatedTimestamp))
+	}
+	return b
+}
+
+func (r *writeV2Request) marshal() []byte {
+	var b []byte
+	for _, s := range r.Symbols {
+		b = appendBytes(b, 4, []byte(s))
+	}
+	for _, ts := range r.Timeseries {
+		b = appendBytes(b, 5, ts.marshal())
+	}
+	return b
+}
+
+var errV2Truncated = errors.New("truncated io.prometheus.write.v2.Request message")
+
+// readField consumes one key/value pair from b, returning the field number
+// and, for length-delimited and varint fields, the value.
+func readField(b []byte) (field int, wire int, val uint64, raw []byte, n int, err error) {
+	key, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, 0, 0, nil, 0, errV2Truncated
+	}
+	field, wire = int(key>>3), int(key&7)
+	switch wire {
+	case wireVarint:
+		v, m := binary.Uvarint(b[n:])
+		if m <= 0 {
+			return 0, 0, 0, nil, 0, errV2Truncated
+		}
+		return field, wire, v, nil, n + m, nil
+	case wireFixed64:
+		if len(b[n:]) < 8 {
+			return 0, 0, 0, nil, 0, errV2Truncated
+		}
+		return field, wire, binary.LittleEndian.Uint64(b[n : n+8]), nil, n + 8, nil
+	case wireBytes:
+		l, m := binary.Uvarint(b[n:])
+		if m <= 0 || uint64(len(b[n+m:])) < l {
+			return 0, 0, 0, nil, 0, errV2Truncated
+		}
+		return field, wire, 0, b[n+m : n+m+int(l)], n + m + int(l), nil
+	default:
+		return 0, 0, 0, nil, 0, errors.Errorf("unsupported wire type %d in io.prometheus.write.v2.Request message", wire)
+	}
+}
+
+func (m *writeV2Metadata) unmarshal(b []byte) error {
+	for len(b) > 0 {
+		field, _, val, _, n, err := readField(b)
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 1:
+			m.Type = int32(val)
+		case 3:
+			m.HelpRef = uint32(val)
+		case 4:
+			m.UnitRef = uint32(val)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func (ts *writeV2TimeSeries) unmarshal(b []byte) error {
+	for len(b) > 0 {
+		field, wire, val, raw, n, err := readField(b)
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 1:
+			if wire == wireVarint {
+				ts.LabelsRefs = append(ts.LabelsRefs, uint32(val))
+				break
+			}
+			for len(raw) > 0 {
+				v, m := binary.Uvarint(raw)
+				if m <= 0 {
+					return errV2Truncated
+				}
+				ts.LabelsRefs = append(ts.LabelsRefs, uint32(v))
+				raw = raw[m:]
+			}
+		case 2:
+			var s prompb.Sample
+			if err := s.Unmarshal(raw); err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, s)
+		case 5:
+			if err := ts.Metadata.unmarshal(raw); err != nil {
+				return err
+			}
+		case 6:
+			ts.CreatedTimestamp = int64(val)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func (r *writeV2Request) unmarshal(b []byte) error {
+	for len(b) > 0 {
+		field, _, _, raw, n, err := readField(b)
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 4:
+			r.Symbols = append(r.Symbols, string(raw))
+		case 5:
+			var ts writeV2TimeSeries
+			if err := ts.unmarshal(raw); err != nil {
+				return err
+			}
+			r.Timeseries = append(r.Timeseries, ts)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// toV1 resolves the symbol references and converts the request back into the
+// 1.0 representation. It is mainly useful for receivers and tests.
+func (r *writeV2Request) toV1() ([]prompb.TimeSeries, []prompb.MetricMetadata, error) {
+	sym := func(ref uint32) (string, error) {
+		if int(ref) >= len(r.Symbols) {
+			return "", errors.Errorf("symbol reference %d out of bounds", ref)
+		}
+		return r.Symbols[ref], nil
+	}
+	var (
+		series   []prompb.TimeSeries
+		metadata []prompb.MetricMetadata
+	)
+	for _, ts := range r.Timeseries {
+		if len(ts.LabelsRefs)%2 != 0 {
+			return nil, nil, errors.Errorf("odd number of label references: %d", len(ts.LabelsRefs))
+		}
+		v1 := prompb.TimeSeries{Samples: ts.Samples}
+		var name string
+		for i := 0; i < len(ts.LabelsRefs); i += 2 {
+			ln, err := sym(ts.LabelsRefs[i])
+			if err != nil {
+				return nil, nil, err
+			}
+			lv, err := sym(ts.LabelsRefs[i+1])
+			if err != nil {
+				return nil, nil, err
+			}
+			v1.Labels = append(v1.Labels, prompb.Label{Name: ln, Value: lv})
+			if ln == "__name__" {
+				name = lv
+			}
+		}
+		if len(v1.Samples) > 0 {
+			series = append(series, v1)
+		}
+		if md := ts.Metadata; md.Type != 0 || md.HelpRef != 0 || md.UnitRef != 0 {
+			help, err := sym(md.HelpRef)
+			if err != nil {
+				return nil, nil, err
+			}
+			unit, err := sym(md.UnitRef)
+			if err != nil {
+				return nil, nil, err
+			}
+			metadata = append(metadata, prompb.MetricMetadata{
+				MetricFamilyName: name,
+				Type:             prompb.MetricMetadata_MetricType(md.Type),
+				Help:             help,
+				Unit:             unit,
+			})
+		}
+	}
+	return series, metadata, nil
+}
+
+// buildV2WriteRequest is the 2.0 counterpart of buildWriteRequest. Metadata
+// entries become series carrying only a metric name and metadata references,
+// matching how receivers expect metadata in the 2.0 message.
+func buildV2WriteRequest(samples []prompb.TimeSeries, metadata []prompb.MetricMetadata, buf []byte) ([]byte, int64, error) {
+	var highest int64
+	st := newSymbolTable()
+	req := &writeV2Request{
+		Timeseries: make([]writeV2TimeSeries, 0, len(samples)+len(metadata)),
+	}
+
+	for _, ts := range samples {
+		// At the moment we only ever append a TimeSeries with a single sample in it.
+		if ts.Samples[0].Timestamp > highest {
+			highest = ts.Samples[0].Timestamp
+		}
+		refs := make([]uint32, 0, 2*len(ts.Labels))
+		for _, l := range ts.Labels {
+			refs = append(refs, st.ref(l.Name), st.ref(l.Value))
+		}
+		req.Timeseries = append(req.Timeseries, writeV2TimeSeries{
+			LabelsRefs: refs,
+			Samples:    ts.Samples,
+		})
+	}
+	for _, m := range metadata {
+		req.Timeseries = append(req.Timeseries, writeV2TimeSeries{
+			LabelsRefs: []uint32{st.ref("__name__"), st.ref(m.MetricFamilyName)},
+			Metadata: writeV2Metadata{
+				Type:    int32(m.Type),
+				HelpRef: st.ref(m.Help),
+				UnitRef: st.ref(m.Unit),
+			},
+		})
+	}
+	req.Symbols = st.symbols
+
+	// snappy uses len() to see if it needs to allocate a new slice. Make the
+	// buffer as long as possible.
+	if buf != nil {
+		buf = buf[0:cap(buf)]
+	}
+	compressed := snappy.Encode(buf, req.marshal())
+	return compressed, highest, nil
+}
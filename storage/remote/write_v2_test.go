@@ -0,0 +1,91 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+func TestBuildV2WriteRequestRoundtrip(t *testing.T) {
+	samples := []prompb.TimeSeries{
+		{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: "http_requests_total"},
+				{Name: "job", Value: "api"},
+				{Name: "instance", Value: "a:9090"},
+			},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 100}},
+		},
+		{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: "http_requests_total"},
+				{Name: "job", Value: "api"},
+				{Name: "instance", Value: "b:9090"},
+			},
+			Samples: []prompb.Sample{{Value: 2, Timestamp: 200}},
+		},
+	}
+	metadata := []prompb.MetricMetadata{
+		{
+			MetricFamilyName: "http_requests_total",
+			Type:             prompb.MetricMetadata_COUNTER,
+			Help:             "Total HTTP requests.",
+		},
+	}
+
+	compressed, highest, err := buildV2WriteRequest(samples, metadata, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(200), highest)
+
+	raw, err := snappy.Decode(nil, compressed)
+	require.NoError(t, err)
+
+	var req writeV2Request
+	require.NoError(t, req.unmarshal(raw))
+
+	// All strings are interned exactly once: the empty string, the 5 label
+	// strings shared between the series, the 2 distinct instance values and
+	// the metadata help text.
+	require.Len(t, req.Symbols, 9)
+
+	gotSamples, gotMetadata, err := req.toV1()
+	require.NoError(t, err)
+	require.Equal(t, samples, gotSamples)
+	require.Equal(t, metadata, gotMetadata)
+}
+
+func TestBuildV2WriteRequestSmaller(t *testing.T) {
+	var samples []prompb.TimeSeries
+	for i := 0; i < 100; i++ {
+		samples = append(samples, prompb.TimeSeries{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: "some_longish_metric_name_total"},
+				{Name: "job", Value: "some/longish-job-name"},
+				{Name: "instance", Value: "host-with-a-long-name:12345"},
+			},
+			Samples: []prompb.Sample{{Value: float64(i), Timestamp: int64(i)}},
+		})
+	}
+
+	v1, _, err := buildWriteRequest(samples, nil, nil, nil)
+	require.NoError(t, err)
+	v2, _, err := buildV2WriteRequest(samples, nil, nil)
+	require.NoError(t, err)
+	require.Less(t, len(v2), len(v1), "v2 request not smaller than v1")
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// NewTenantQueryable returns a Queryable that restricts every Select of the
+// given Queryable to series carrying the given value for the tenant label,
+// by appending an equality matcher to the selectors. An empty label name or
+// tenant value disables the restriction.
+func NewTenantQueryable(q Queryable, name, tenant string) Queryable {
+	if name == "" || tenant == "" {
+		return q
+	}
+	return &tenantQueryable{q: q, matcher: labels.MustNewMatcher(labels.MatchEqual, name, tenant)}
+}
+
+type tenantQueryable struct {
+	q       Queryable
+	matcher *labels.Matcher
+}
+
+func (q *tenantQueryable) Querier(ctx context.Context, mint, maxt int64) (Querier, error) {
+	qr, err := q.q.Querier(ctx, mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+	return &tenantQuerier{Querier: qr, matcher: q.matcher}, nil
+}
+
+type tenantQuerier struct {
+	Querier
+	matcher *labels.Matcher
+}
+
+func (q *tenantQuerier) Select(sortSeries bool, hints *SelectHints, matchers ...*labels.Matcher) SeriesSet {
+	ms := make([]*labels.Matcher, 0, len(matchers)+1)
+	ms = append(ms, matchers...)
+	ms = append(ms, q.matcher)
+	return q.Querier.Select(sortSeries, hints, ms...)
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+type matchingQueryable struct {
+	series []Series
+}
+
+func (q matchingQueryable) Querier(_ context.Context, mint, maxt int64) (Querier, error) {
+	return matchingQuerier{series: q.series}, nil
+}
+
+type matchingQuerier struct {
+	noopQuerier
+	series []Series
+}
+
+func (q matchingQuerier) Select(_ bool, _ *SelectHints, matchers ...*labels.Matcher) SeriesSet {
+	var matched []Series
+	for _, s := range q.series {
+		keep := true
+		for _, m := range matchers {
+			if !m.Matches(s.Labels().Get(m.Name)) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			matched = append(matched, s)
+		}
+	}
+	return NewMockSeriesSet(matched...)
+}
+
+func TestTenantQueryable(t *testing.T) {
+	series := []Series{
+		NewListSeries(labels.FromStrings("__name__", "up", "team", "a"), nil),
+		NewListSeries(labels.FromStrings("__name__", "up", "team", "b"), nil),
+		NewListSeries(labels.FromStrings("__name__", "up"), nil),
+	}
+	queryable := matchingQueryable{series: series}
+
+	// No tenant label or value configured returns the Queryable unchanged.
+	require.Equal(t, Queryable(queryable), NewTenantQueryable(queryable, "", "a"))
+	require.Equal(t, Queryable(queryable), NewTenantQueryable(queryable, "team", ""))
+
+	q, err := NewTenantQueryable(queryable, "team", "a").Querier(context.Background(), 0, 100)
+	require.NoError(t, err)
+	ss := q.Select(false, nil, labels.MustNewMatcher(labels.MatchEqual, "__name__", "up"))
+	require.True(t, ss.Next())
+	require.Equal(t, series[0].Labels(), ss.At().Labels())
+	require.False(t, ss.Next())
+	require.NoError(t, ss.Err())
+}
@@ -158,6 +158,18 @@ func NewTemplateExpander(
 			"toLower":   strings.ToLower,
 			"graphLink": strutil.GraphLinkForExpression,
 			"tableLink": strutil.TableLinkForExpression,
+			"aliyunConsoleLink": func(instanceID, region string) string {
+				return fmt.Sprintf("https://ecs.console.aliyun.com/#/server/%s/detail?regionId=%s",
+					url.QueryEscape(instanceID), url.QueryEscape(region))
+			},
+			"aliyunRegionFromZone": func(zone string) string {
+				// Zone IDs carry the region as a prefix, e.g. the zone
+				// cn-hangzhou-b belongs to the region cn-hangzhou.
+				if i := strings.LastIndex(zone, "-"); i > 0 {
+					return zone[:i]
+				}
+				return zone
+			},
 			"sortByLabel": func(label string, v queryResult) queryResult {
 				sorter := queryResultByLabelSorter{v[:], label}
 				sort.Stable(sorter)
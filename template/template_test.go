@@ -248,6 +248,16 @@ func TestTemplateExpansion(t *testing.T) {
 			text:   "{{ tableLink \"up\" }}",
 			output: "/graph?g0.expr=up&g0.tab=1",
 		},
+		{
+			// aliyunConsoleLink.
+			text:   "{{ aliyunConsoleLink \"i-bp1abcdef\" \"cn-hangzhou\" }}",
+			output: "https://ecs.console.aliyun.com/#/server/i-bp1abcdef/detail?regionId=cn-hangzhou",
+		},
+		{
+			// aliyunRegionFromZone.
+			text:   "{{ aliyunRegionFromZone \"cn-hangzhou-b\" }} {{ aliyunRegionFromZone \"weird\" }}",
+			output: "cn-hangzhou weird",
+		},
 		{
 			// tmpl.
 			text:   "{{ define \"a\" }}x{{ end }}{{ $name := \"a\"}}{{ tmpl $name . }}",
@@ -148,6 +148,15 @@ type BlockMeta struct {
 
 	// Version of the index format.
 	Version int `json:"version"`
+
+	// Labels are arbitrary metadata labels attached to the block by the tool
+	// that created it, e.g. the region a backfilled block was imported from.
+	// They are not attached to the series in the block.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Resolution is the downsampling resolution of the block's data in
+	// milliseconds. 0 means raw data.
+	Resolution int64 `json:"resolution,omitempty"`
 }
 
 // BlockStats contains stats about contents of a block.
@@ -260,6 +269,10 @@ type Block struct {
 
 	logger log.Logger
 
+	// postingsCache, if set, caches expanded postings of this block's index
+	// across queries.
+	postingsCache *PostingsCache
+
 	numBytesChunks    int64
 	numBytesIndex     int64
 	numBytesTombstone int64
@@ -425,7 +438,34 @@ func (r blockIndexReader) LabelValues(name string) ([]string, error) {
 	return st, errors.Wrapf(err, "block: %s", r.b.Meta().ULID)
 }
 
+// setPostingsCache makes the block's index reader serve repeated postings
+// lookups from the given cache.
+func (pb *Block) setPostingsCache(c *PostingsCache) {
+	pb.postingsCache = c
+}
+
 func (r blockIndexReader) Postings(name string, values ...string) (index.Postings, error) {
+	if c := r.b.postingsCache; c != nil {
+		its := make([]index.Postings, 0, len(values))
+		for _, v := range values {
+			key := postingsCacheKey{block: r.b.meta.ULID, name: name, value: v}
+			if refs, ok := c.get(key); ok {
+				its = append(its, index.NewListPostings(refs))
+				continue
+			}
+			p, err := r.ir.Postings(name, v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "block: %s", r.b.Meta().ULID)
+			}
+			refs, err := index.ExpandPostings(p)
+			if err != nil {
+				return nil, errors.Wrapf(err, "block: %s", r.b.Meta().ULID)
+			}
+			c.set(key, refs)
+			its = append(its, index.NewListPostings(refs))
+		}
+		return index.Merge(its...), nil
+	}
 	p, err := r.ir.Postings(name, values...)
 	if err != nil {
 		return p, errors.Wrapf(err, "block: %s", r.b.Meta().ULID)
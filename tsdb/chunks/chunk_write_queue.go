@@ -0,0 +1,154 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chunks
+
+import (
+	"sync"
+
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+// chunkWriteJob is a chunk waiting to be written to its head chunk file.
+// The chunk reference has already been assigned by the eventual position
+// tracker, so the background writer only has to put the chunk at the
+// position the reference points to.
+type chunkWriteJob struct {
+	cutFile   bool
+	seriesRef uint64
+	mint      int64
+	maxt      int64
+	chk       chunkenc.Chunk
+	ref       uint64
+}
+
+// chunkWriteQueue decouples the appenders from the head chunk file writes.
+// Queued chunks are served from the queue by their reference until the
+// background writer has persisted them.
+type chunkWriteQueue struct {
+	jobs chan chunkWriteJob
+
+	chunkRefMapMtx sync.RWMutex
+	chunkRefMap    map[uint64]chunkenc.Chunk
+
+	errMtx sync.Mutex
+	err    error // Sticky error of the background writer.
+
+	isRunningMtx sync.Mutex
+	isRunning    bool // Used to prevent appending jobs to a closed queue.
+
+	writeChunk func(chunkWriteJob) error
+
+	workerWg  sync.WaitGroup
+	closeOnce sync.Once
+}
+
+func newChunkWriteQueue(size int, writeChunk func(chunkWriteJob) error) *chunkWriteQueue {
+	q := &chunkWriteQueue{
+		jobs:        make(chan chunkWriteJob, size),
+		chunkRefMap: make(map[uint64]chunkenc.Chunk, size),
+		writeChunk:  writeChunk,
+		isRunning:   true,
+	}
+
+	q.workerWg.Add(1)
+	go func() {
+		defer q.workerWg.Done()
+		for job := range q.jobs {
+			q.processJob(job)
+		}
+	}()
+
+	return q
+}
+
+func (q *chunkWriteQueue) processJob(job chunkWriteJob) {
+	if err := q.writeChunk(job); err != nil {
+		q.errMtx.Lock()
+		if q.err == nil {
+			q.err = err
+		}
+		q.errMtx.Unlock()
+	}
+
+	// The chunk has been written to the write buffer of the chunk disk
+	// mapper by now, from where reads are already being served, so it can
+	// be dropped from the queue.
+	q.chunkRefMapMtx.Lock()
+	delete(q.chunkRefMap, job.ref)
+	q.chunkRefMapMtx.Unlock()
+}
+
+// addJob adds a job to the queue, blocking while the queue is full.
+// It returns the sticky error of the background writer, if there is one,
+// without adding the job; a chunk disk mapper with a failed writer must be
+// closed and re-opened as its on-disk position tracking can be off.
+func (q *chunkWriteQueue) addJob(job chunkWriteJob) error {
+	// The lock is also held while blocking on a full queue, so that close()
+	// cannot close the channel under a pending send.
+	q.isRunningMtx.Lock()
+	defer q.isRunningMtx.Unlock()
+
+	if !q.isRunning {
+		return ErrChunkDiskMapperClosed
+	}
+
+	q.errMtx.Lock()
+	err := q.err
+	q.errMtx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	q.chunkRefMapMtx.Lock()
+	q.chunkRefMap[job.ref] = job.chk
+	q.chunkRefMapMtx.Unlock()
+
+	q.jobs <- job
+
+	return nil
+}
+
+// get returns a chunk that is waiting in the queue by its reference,
+// or nil if it is not (or no longer) queued.
+func (q *chunkWriteQueue) get(ref uint64) chunkenc.Chunk {
+	q.chunkRefMapMtx.RLock()
+	defer q.chunkRefMapMtx.RUnlock()
+
+	return q.chunkRefMap[ref]
+}
+
+// depth returns the number of chunks waiting in the queue.
+func (q *chunkWriteQueue) depth() int {
+	q.chunkRefMapMtx.RLock()
+	defer q.chunkRefMapMtx.RUnlock()
+
+	return len(q.chunkRefMap)
+}
+
+// close drains the queue, stops the background writer and returns its
+// sticky error, if there is one.
+func (q *chunkWriteQueue) close() error {
+	q.closeOnce.Do(func() {
+		q.isRunningMtx.Lock()
+		q.isRunning = false
+		close(q.jobs)
+		q.isRunningMtx.Unlock()
+
+		q.workerWg.Wait()
+	})
+
+	q.errMtx.Lock()
+	defer q.errMtx.Unlock()
+	return q.err
+}
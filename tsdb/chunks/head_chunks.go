@@ -68,6 +68,9 @@ const (
 	MaxWriteBufferSize = 8 * 1024 * 1024 // 8 MiB.
 	// DefaultWriteBufferSize is the default write buffer size.
 	DefaultWriteBufferSize = 4 * 1024 * 1024 // 4 MiB.
+	// DefaultWriteQueueSize is the default size of the chunk write queue,
+	// 0 disables the queue and makes the chunk writes synchronous.
+	DefaultWriteQueueSize = 0
 )
 
 // corruptionErr is an error that's returned when corruption is encountered.
@@ -81,6 +84,91 @@ func (e *CorruptionErr) Error() string {
 	return errors.Wrapf(e.Err, "corruption in head chunk file %s", segmentFile(e.Dir, e.FileIndex)).Error()
 }
 
+// chunkPos keeps track of the position in the head chunk files.
+// chunkPos is exclusively used whenever a chunk is appended or deleted from the chunkWriteQueue
+// so that the position accounting is synchronized with the chunk writes.
+type chunkPos struct {
+	seq     uint64 // Index of chunk file.
+	offset  uint64 // Offset within chunk file.
+	cutFile bool   // When true then the next chunk will be written to a new file.
+}
+
+// getNextChunkRef takes a chunk and returns the chunk reference which will refer to it once it has been written.
+// getNextChunkRef also decides whether a new file should be cut before writing this chunk, and it returns the decision via the second return value.
+// The caller of getNextChunkRef must hold the evtlPosMtx of the ChunkDiskMapper.
+func (f *chunkPos) getNextChunkRef(chk chunkenc.Chunk) (chkRef uint64, cutFile bool) {
+	chkLen := uint64(len(chk.Bytes()))
+	bytesToWrite := f.bytesToWriteForChunk(chkLen)
+
+	if f.shouldCutNewFile(bytesToWrite) {
+		f.toNewFile()
+		f.cutFile = false
+		cutFile = true
+	}
+
+	chkOffset := f.offset
+	f.offset += bytesToWrite
+
+	return chunkRef(f.seq, chkOffset), cutFile
+}
+
+// toNewFile updates the seq/offset position to point to the beginning of a new chunk file.
+func (f *chunkPos) toNewFile() {
+	f.seq++
+	f.offset = SegmentHeaderSize
+}
+
+// cutFileOnNextChunk triggers that the next chunk will be written in to a new file.
+// Not thread safe, a lock must be held when calling this.
+func (f *chunkPos) cutFileOnNextChunk() {
+	f.cutFile = true
+}
+
+// setSeq sets the sequence number of the head chunk file.
+func (f *chunkPos) setSeq(seq uint64) {
+	f.seq = seq
+}
+
+// shouldCutNewFile returns whether a new file should be cut based on the file size.
+// The read or write lock on chunkPos must be held when calling this.
+func (f *chunkPos) shouldCutNewFile(bytesToWrite uint64) bool {
+	if f.cutFile {
+		return true
+	}
+
+	return f.offset == 0 || // First head chunk file.
+		f.offset+bytesToWrite > MaxHeadChunkFileSize // Exceeds the max head chunk file size.
+}
+
+// bytesToWriteForChunk returns the number of bytes that will get written to the disk
+// for the given chunk size, including all meta data before and after the chunk data.
+// The head chunk format is described in tsdb/docs/format/head_chunks.md.
+func (f *chunkPos) bytesToWriteForChunk(chkLen uint64) uint64 {
+	// Headers.
+	bytes := uint64(SeriesRefSize) + 2*MintMaxtSize + ChunkEncodingSize
+
+	// Size of chunk length encoded as uvarint.
+	bytes += uint64(uvarintSize(chkLen))
+
+	// Chunk length.
+	bytes += chkLen
+
+	// crc32.
+	bytes += CRCSize
+
+	return bytes
+}
+
+// uvarintSize returns the number of bytes binary.PutUvarint would need to encode v.
+func uvarintSize(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
 // ChunkDiskMapper is for writing the Head block chunks to the disk
 // and access chunks via mmapped file.
 type ChunkDiskMapper struct {
@@ -115,6 +203,11 @@ type ChunkDiskMapper struct {
 	// after iterating through all the chunks in those files.
 	fileMaxtSet bool
 
+	writeQueue *chunkWriteQueue // Queue used to write chunks to disk in a background routine, nil when the queue is disabled.
+
+	evtlPos    chunkPos   // Eventual position of the next chunk that enters the write queue.
+	evtlPosMtx sync.Mutex // Protects evtlPos.
+
 	closed bool
 }
 
@@ -125,9 +218,10 @@ type mmappedChunkFile struct {
 
 // NewChunkDiskMapper returns a new writer against the given directory
 // using the default head chunk file duration.
+// A writeQueueSize of 0 disables the write queue, making the chunk writes synchronous.
 // NOTE: 'IterateAllChunks' method needs to be called at least once after creating ChunkDiskMapper
 // to set the maxt of all the file.
-func NewChunkDiskMapper(dir string, pool chunkenc.Pool, writeBufferSize int) (*ChunkDiskMapper, error) {
+func NewChunkDiskMapper(dir string, pool chunkenc.Pool, writeBufferSize, writeQueueSize int) (*ChunkDiskMapper, error) {
 	// Validate write buffer size.
 	if writeBufferSize < MinWriteBufferSize || writeBufferSize > MaxWriteBufferSize {
 		return nil, errors.Errorf("ChunkDiskMapper write buffer size should be between %d and %d (actual: %d)", MinWriteBufferSize, MaxHeadChunkFileSize, writeBufferSize)
@@ -135,6 +229,9 @@ func NewChunkDiskMapper(dir string, pool chunkenc.Pool, writeBufferSize int) (*C
 	if writeBufferSize%1024 != 0 {
 		return nil, errors.Errorf("ChunkDiskMapper write buffer size should be a multiple of 1024 (actual: %d)", writeBufferSize)
 	}
+	if writeQueueSize < 0 {
+		return nil, errors.Errorf("ChunkDiskMapper write queue size should not be negative (actual: %d)", writeQueueSize)
+	}
 
 	if err := os.MkdirAll(dir, 0777); err != nil {
 		return nil, err
@@ -156,7 +253,23 @@ func NewChunkDiskMapper(dir string, pool chunkenc.Pool, writeBufferSize int) (*C
 		m.pool = chunkenc.NewPool()
 	}
 
-	return m, m.openMMapFiles()
+	if err := m.openMMapFiles(); err != nil {
+		return nil, err
+	}
+
+	// The eventual position tracker continues from the last chunk file on
+	// disk; its first write cuts a new file, just like the writer does.
+	for seq := range m.mmappedChunkFiles {
+		if uint64(seq) > m.evtlPos.seq {
+			m.evtlPos.setSeq(uint64(seq))
+		}
+	}
+
+	if writeQueueSize > 0 {
+		m.writeQueue = newChunkWriteQueue(writeQueueSize, m.writeQueuedChunk)
+	}
+
+	return m, nil
 }
 
 func (cdm *ChunkDiskMapper) openMMapFiles() (returnErr error) {
@@ -273,6 +386,10 @@ func repairLastChunkFile(files map[int]string) (_ map[int]string, returnErr erro
 // WriteChunk writes the chunk to the disk.
 // The returned chunk ref is the reference from where the chunk encoding starts for the chunk.
 func (cdm *ChunkDiskMapper) WriteChunk(seriesRef uint64, mint, maxt int64, chk chunkenc.Chunk) (chkRef uint64, err error) {
+	if cdm.writeQueue != nil {
+		return cdm.writeChunkViaQueue(seriesRef, mint, maxt, chk)
+	}
+
 	cdm.writePathMtx.Lock()
 	defer cdm.writePathMtx.Unlock()
 
@@ -286,6 +403,63 @@ func (cdm *ChunkDiskMapper) WriteChunk(seriesRef uint64, mint, maxt int64, chk c
 		}
 	}
 
+	return cdm.writeChunkLocked(seriesRef, mint, maxt, chk)
+}
+
+// writeChunkViaQueue assigns the chunk its eventual reference and hands it
+// over to the write queue, where it is served from until it has been written
+// by the background routine.
+func (cdm *ChunkDiskMapper) writeChunkViaQueue(seriesRef uint64, mint, maxt int64, chk chunkenc.Chunk) (chkRef uint64, err error) {
+	// The lock is held until the job is in the queue so that the order of
+	// the queued jobs matches the order of the assigned references.
+	cdm.evtlPosMtx.Lock()
+	defer cdm.evtlPosMtx.Unlock()
+
+	ref, cutFile := cdm.evtlPos.getNextChunkRef(chk)
+	err = cdm.writeQueue.addJob(chunkWriteJob{
+		cutFile:   cutFile,
+		seriesRef: seriesRef,
+		mint:      mint,
+		maxt:      maxt,
+		chk:       chk,
+		ref:       ref,
+	})
+
+	return ref, err
+}
+
+// writeQueuedChunk writes a chunk that was queued by writeChunkViaQueue.
+// The decision whether to cut a new file was already taken when the chunk
+// entered the queue, so shouldCutNewFile is not consulted here.
+func (cdm *ChunkDiskMapper) writeQueuedChunk(job chunkWriteJob) error {
+	cdm.writePathMtx.Lock()
+	defer cdm.writePathMtx.Unlock()
+
+	if cdm.closed {
+		return ErrChunkDiskMapperClosed
+	}
+
+	if job.cutFile {
+		if err := cdm.cut(); err != nil {
+			return err
+		}
+	}
+
+	ref, err := cdm.writeChunkLocked(job.seriesRef, job.mint, job.maxt, job.chk)
+	if err != nil {
+		return err
+	}
+	if ref != job.ref {
+		return errors.Errorf("chunk write queue: chunk got written to unexpected reference %d, expected %d", ref, job.ref)
+	}
+
+	return nil
+}
+
+// writeChunkLocked writes the chunk at the current position of the writer.
+// The write path lock must be held and the decision whether to cut a new
+// file must have been acted upon before calling this.
+func (cdm *ChunkDiskMapper) writeChunkLocked(seriesRef uint64, mint, maxt int64, chk chunkenc.Chunk) (chkRef uint64, err error) {
 	// if len(chk.Bytes())+MaxHeadChunkMetaSize >= writeBufferSize, it means that chunk >= the buffer size;
 	// so no need to flush here, as we have to flush at the end (to not keep partial chunks in buffer).
 	if len(chk.Bytes())+MaxHeadChunkMetaSize < cdm.writeBufferSize && cdm.chkWriter.Available() < MaxHeadChunkMetaSize+len(chk.Bytes()) {
@@ -351,8 +525,19 @@ func (cdm *ChunkDiskMapper) shouldCutNewFile(chunkSize int) bool {
 		cdm.curFileSize()+int64(chunkSize+MaxHeadChunkMetaSize) > MaxHeadChunkFileSize // Exceeds the max head chunk file size.
 }
 
-// CutNewFile creates a new m-mapped file.
+// CutNewFile makes that a new file will be created for the next chunk.
 func (cdm *ChunkDiskMapper) CutNewFile() (returnErr error) {
+	if cdm.writeQueue != nil {
+		// The file is cut by the background routine when the next queued
+		// chunk is written, which keeps the file cut in order with the
+		// chunk writes that are still in the queue.
+		cdm.evtlPosMtx.Lock()
+		defer cdm.evtlPosMtx.Unlock()
+
+		cdm.evtlPos.cutFileOnNextChunk()
+		return nil
+	}
+
 	cdm.writePathMtx.Lock()
 	defer cdm.writePathMtx.Unlock()
 
@@ -457,6 +642,15 @@ func (cdm *ChunkDiskMapper) flushBuffer() error {
 
 // Chunk returns a chunk from a given reference.
 func (cdm *ChunkDiskMapper) Chunk(ref uint64) (chunkenc.Chunk, error) {
+	// The chunk can still be waiting in the write queue. Once it is gone from
+	// the queue it has been handed to the write buffer, which the paths below
+	// already serve from.
+	if cdm.writeQueue != nil {
+		if chunk := cdm.writeQueue.get(ref); chunk != nil {
+			return chunk, nil
+		}
+	}
+
 	cdm.readPathMtx.RLock()
 	// We hold this read lock for the entire duration because if the Close()
 	// is called, the data in the byte slice will get corrupted as the mmapped
@@ -775,6 +969,15 @@ func (cdm *ChunkDiskMapper) Size() (int64, error) {
 	return fileutil.DirSize(cdm.dir.Name())
 }
 
+// WriteQueueDepth returns the number of chunks that are waiting in the write
+// queue, 0 when the queue is disabled.
+func (cdm *ChunkDiskMapper) WriteQueueDepth() int {
+	if cdm.writeQueue == nil {
+		return 0
+	}
+	return cdm.writeQueue.depth()
+}
+
 func (cdm *ChunkDiskMapper) curFileSize() int64 {
 	return cdm.curFileNumBytes.Load()
 }
@@ -782,6 +985,13 @@ func (cdm *ChunkDiskMapper) curFileSize() int64 {
 // Close closes all the open files in ChunkDiskMapper.
 // It is not longer safe to access chunks from this struct after calling Close.
 func (cdm *ChunkDiskMapper) Close() error {
+	// Drain the write queue before acquiring the write path lock, the
+	// background routine needs it to write the remaining queued chunks.
+	var queueErr error
+	if cdm.writeQueue != nil {
+		queueErr = cdm.writeQueue.close()
+	}
+
 	// 'WriteChunk' locks writePathMtx first and then readPathMtx for cutting head chunk file.
 	// The lock order should not be reversed here else it can cause deadlocks.
 	cdm.writePathMtx.Lock()
@@ -795,6 +1005,7 @@ func (cdm *ChunkDiskMapper) Close() error {
 	cdm.closed = true
 
 	errs := tsdb_errors.NewMulti(
+		queueErr,
 		closeAllFromMap(cdm.closers),
 		cdm.finalizeCurFile(),
 		cdm.dir.Close(),
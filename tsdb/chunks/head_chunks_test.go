@@ -27,6 +27,11 @@ import (
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 )
 
+// The tests in this file inspect the internal state of the writer between the
+// chunk writes, so they run without the write queue to keep the writes
+// synchronous. The queue itself is covered by TestChunkDiskMapper_WriteQueue.
+const writeQueueSize = DefaultWriteQueueSize
+
 func TestChunkDiskMapper_WriteChunk_Chunk_IterateChunks(t *testing.T) {
 	hrw := testChunkDiskMapper(t)
 	defer func() {
@@ -133,7 +138,7 @@ func TestChunkDiskMapper_WriteChunk_Chunk_IterateChunks(t *testing.T) {
 	// Testing IterateAllChunks method.
 	dir := hrw.dir.Name()
 	require.NoError(t, hrw.Close())
-	hrw, err = NewChunkDiskMapper(dir, chunkenc.NewPool(), DefaultWriteBufferSize)
+	hrw, err = NewChunkDiskMapper(dir, chunkenc.NewPool(), DefaultWriteBufferSize, writeQueueSize)
 	require.NoError(t, err)
 
 	idx := 0
@@ -223,7 +228,7 @@ func TestChunkDiskMapper_Truncate(t *testing.T) {
 
 	// Restarted.
 	var err error
-	hrw, err = NewChunkDiskMapper(dir, chunkenc.NewPool(), DefaultWriteBufferSize)
+	hrw, err = NewChunkDiskMapper(dir, chunkenc.NewPool(), DefaultWriteBufferSize, writeQueueSize)
 	require.NoError(t, err)
 
 	require.False(t, hrw.fileMaxtSet)
@@ -316,7 +321,7 @@ func TestChunkDiskMapper_Truncate_PreservesFileSequence(t *testing.T) {
 
 	// Restarting checks for unsequential files.
 	var err error
-	hrw, err = NewChunkDiskMapper(dir, chunkenc.NewPool(), DefaultWriteBufferSize)
+	hrw, err = NewChunkDiskMapper(dir, chunkenc.NewPool(), DefaultWriteBufferSize, writeQueueSize)
 	require.NoError(t, err)
 	verifyFiles([]int{3, 4, 5, 6, 7})
 }
@@ -337,7 +342,7 @@ func TestHeadReadWriter_TruncateAfterFailedIterateChunks(t *testing.T) {
 	require.NoError(t, hrw.Close())
 
 	// Restarting to recreate https://github.com/prometheus/prometheus/issues/7753.
-	hrw, err = NewChunkDiskMapper(dir, chunkenc.NewPool(), DefaultWriteBufferSize)
+	hrw, err = NewChunkDiskMapper(dir, chunkenc.NewPool(), DefaultWriteBufferSize, writeQueueSize)
 	require.NoError(t, err)
 
 	// Forcefully failing IterateAllChunks.
@@ -394,7 +399,7 @@ func TestHeadReadWriter_ReadRepairOnEmptyLastFile(t *testing.T) {
 	require.NoError(t, f.Close())
 
 	// Open chunk disk mapper again, corrupt file should be removed.
-	hrw, err = NewChunkDiskMapper(dir, chunkenc.NewPool(), DefaultWriteBufferSize)
+	hrw, err = NewChunkDiskMapper(dir, chunkenc.NewPool(), DefaultWriteBufferSize, writeQueueSize)
 	require.NoError(t, err)
 	require.False(t, hrw.fileMaxtSet)
 	require.NoError(t, hrw.IterateAllChunks(func(_, _ uint64, _, _ int64, _ uint16) error { return nil }))
@@ -418,6 +423,71 @@ func TestHeadReadWriter_ReadRepairOnEmptyLastFile(t *testing.T) {
 
 }
 
+// TestChunkDiskMapper_WriteQueue tests that chunks take the same references
+// and can be read back when they are written through the write queue.
+func TestChunkDiskMapper_WriteQueue(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "data")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, os.RemoveAll(tmpdir))
+	})
+
+	hrw, err := NewChunkDiskMapper(tmpdir, chunkenc.NewPool(), DefaultWriteBufferSize, 16)
+	require.NoError(t, err)
+	require.NoError(t, hrw.IterateAllChunks(func(_, _ uint64, _, _ int64, _ uint16) error { return nil }))
+
+	type expectedDataType struct {
+		seriesRef, chunkRef uint64
+		chunk               chunkenc.Chunk
+	}
+	var expectedData []expectedDataType
+
+	for i := 0; i < 100; i++ {
+		seriesRef, chkRef, _, _, chunk := createChunk(t, i, hrw)
+		expectedData = append(expectedData, expectedDataType{
+			seriesRef: seriesRef,
+			chunkRef:  chkRef,
+			chunk:     chunk,
+		})
+
+		// Queued chunks must be readable before they have been written.
+		actChunk, err := hrw.Chunk(chkRef)
+		require.NoError(t, err)
+		require.Equal(t, chunk.Bytes(), actChunk.Bytes())
+	}
+
+	// Cut a new file through the queue and make sure the references of the
+	// following chunks point to the new file.
+	require.NoError(t, hrw.CutNewFile())
+	seriesRef, chkRef, _, _, chunk := createChunk(t, 100, hrw)
+	require.Equal(t, uint64(2), chkRef>>32, "chunk after the file cut should be in the second file")
+	expectedData = append(expectedData, expectedDataType{seriesRef: seriesRef, chunkRef: chkRef, chunk: chunk})
+
+	// Restart the chunk disk mapper, draining the queue, and verify that all
+	// chunks got written at the references they were assigned.
+	require.NoError(t, hrw.Close())
+	hrw, err = NewChunkDiskMapper(tmpdir, chunkenc.NewPool(), DefaultWriteBufferSize, 16)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, hrw.Close())
+	}()
+
+	idx := 0
+	require.NoError(t, hrw.IterateAllChunks(func(seriesRef, chunkRef uint64, _, _ int64, _ uint16) error {
+		require.Equal(t, expectedData[idx].seriesRef, seriesRef)
+		require.Equal(t, expectedData[idx].chunkRef, chunkRef)
+		idx++
+		return nil
+	}))
+	require.Equal(t, len(expectedData), idx)
+
+	for _, exp := range expectedData {
+		actChunk, err := hrw.Chunk(exp.chunkRef)
+		require.NoError(t, err)
+		require.Equal(t, exp.chunk.Bytes(), actChunk.Bytes())
+	}
+}
+
 func testChunkDiskMapper(t *testing.T) *ChunkDiskMapper {
 	tmpdir, err := ioutil.TempDir("", "data")
 	require.NoError(t, err)
@@ -425,7 +495,7 @@ func testChunkDiskMapper(t *testing.T) *ChunkDiskMapper {
 		require.NoError(t, os.RemoveAll(tmpdir))
 	})
 
-	hrw, err := NewChunkDiskMapper(tmpdir, chunkenc.NewPool(), DefaultWriteBufferSize)
+	hrw, err := NewChunkDiskMapper(tmpdir, chunkenc.NewPool(), DefaultWriteBufferSize, writeQueueSize)
 	require.NoError(t, err)
 	require.False(t, hrw.fileMaxtSet)
 	require.NoError(t, hrw.IterateAllChunks(func(_, _ uint64, _, _ int64, _ uint16) error { return nil }))
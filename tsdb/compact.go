@@ -373,6 +373,23 @@ func CompactBlockMetas(uid ulid.ULID, blocks ...*BlockMeta) *BlockMeta {
 		return res.Compaction.Sources[i].Compare(res.Compaction.Sources[j]) < 0
 	})
 
+	// Only metadata labels that agree across all source blocks survive the
+	// compaction, e.g. when blocks imported from different regions overlap.
+	labels := map[string]string{}
+	for k, v := range blocks[0].Labels {
+		labels[k] = v
+	}
+	for _, b := range blocks[1:] {
+		for k, v := range labels {
+			if b.Labels[k] != v {
+				delete(labels, k)
+			}
+		}
+	}
+	if len(labels) > 0 {
+		res.Labels = labels
+	}
+
 	res.MaxTime = maxt
 	return res
 }
@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
@@ -1093,7 +1094,7 @@ func BenchmarkCompactionFromHead(b *testing.B) {
 			defer func() {
 				require.NoError(b, os.RemoveAll(chunkDir))
 			}()
-			h, err := NewHead(nil, nil, nil, 1000, chunkDir, nil, chunks.DefaultWriteBufferSize, DefaultStripeSize, nil)
+			h, err := NewHead(nil, nil, nil, 1000, chunkDir, nil, chunks.DefaultWriteBufferSize, chunks.DefaultWriteQueueSize, DefaultStripeSize, nil)
 			require.NoError(b, err)
 			for ln := 0; ln < labelNames; ln++ {
 				app := h.Appender(context.Background())
@@ -1308,3 +1309,20 @@ func TestDeleteCompactionBlockAfterFailedReload(t *testing.T) {
 		})
 	}
 }
+
+func TestCompactBlockMetasLabels(t *testing.T) {
+	var uid ulid.ULID
+
+	// Only labels shared by all source blocks survive.
+	meta := CompactBlockMetas(uid,
+		&BlockMeta{MinTime: 0, MaxTime: 100, Labels: map[string]string{"region": "eu", "source": "a"}},
+		&BlockMeta{MinTime: 50, MaxTime: 150, Labels: map[string]string{"region": "eu", "source": "b"}},
+	)
+	require.Equal(t, map[string]string{"region": "eu"}, meta.Labels)
+
+	meta = CompactBlockMetas(uid,
+		&BlockMeta{MinTime: 0, MaxTime: 100, Labels: map[string]string{"region": "eu"}},
+		&BlockMeta{MinTime: 100, MaxTime: 200},
+	)
+	require.Nil(t, meta.Labels)
+}
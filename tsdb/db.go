@@ -77,6 +77,7 @@ func DefaultOptions() *Options {
 		WALCompression:            false,
 		StripeSize:                DefaultStripeSize,
 		HeadChunksWriteBufferSize: chunks.DefaultWriteBufferSize,
+		HeadChunksWriteQueueSize:  chunks.DefaultWriteQueueSize,
 	}
 }
 
@@ -124,9 +125,36 @@ type Options struct {
 	// Typically it is in milliseconds.
 	MaxBlockDuration int64
 
+	// HeadChunkRange is the time range covered by a single in-memory head
+	// chunk before a new one is cut. 0 or less means MinBlockDuration is used.
+	// Unit agnostic as long as unit is consistent with MinBlockDuration.
+	// Typically it is in milliseconds.
+	HeadChunkRange int64
+
 	// HeadChunksWriteBufferSize configures the write buffer size used by the head chunks mapper.
 	HeadChunksWriteBufferSize int
 
+	// HeadChunksWriteQueueSize configures the size of the chunk write queue used by the head chunks mapper,
+	// 0 disables the queue and makes the chunk writes synchronous.
+	HeadChunksWriteQueueSize int
+
+	// HeadChurnLabels are the label names by which head series creations and
+	// removals are additionally broken down in metrics, so churn can be
+	// attributed to specific jobs or instances. Empty disables the breakdown.
+	HeadChurnLabels []string
+
+	// HeadGCPause is the time the head garbage collection sleeps between
+	// batches of postings deletions, bounding how long appends are blocked
+	// in a row during large GCs. This is wall-clock time, not unit agnostic.
+	// 0 disables the pacing.
+	HeadGCPause time.Duration
+
+	// PostingsCacheSize is the maximum size in bytes of expanded postings
+	// lists of persisted blocks cached across queries, sharded by label
+	// pair. Head postings are served from memory and are not cached.
+	// 0 disables the cache.
+	PostingsCacheSize int64
+
 	// SeriesLifecycleCallback specifies a list of callbacks that will be called during a lifecycle of a series.
 	// It is always a no-op in Prometheus and mainly meant for external users who import TSDB.
 	SeriesLifecycleCallback SeriesLifecycleCallback
@@ -135,6 +163,18 @@ type Options struct {
 	// It is always the default time and size based retention in Prometheus and
 	// mainly meant for external users who import TSDB.
 	BlocksToDelete BlocksToDeleteFunc
+
+	// HeadStats, if non-nil, is used by the head to report WAL replay
+	// progress, so callers can observe startup before Open returns.
+	HeadStats *HeadStats
+
+	// DownsampleAfter, when greater than 0, makes compaction generate 5m and
+	// 1h downsampled versions of blocks whose data is entirely older than
+	// this, measured against the newest sample in the database. Queries over
+	// long ranges read the downsampled data instead of the raw blocks.
+	// Unit agnostic as long as unit is consistent with RetentionDuration.
+	// Typically it is in milliseconds. 0 disables downsampling.
+	DownsampleAfter int64
 }
 
 type BlocksToDeleteFunc func(blocks []*Block) map[ulid.ULID]struct{}
@@ -156,8 +196,19 @@ type DB struct {
 	mtx    sync.RWMutex
 	blocks []*Block
 
+	// downsampled are the downsampled blocks by resolution. They live in
+	// separate subdirectories and are not part of the regular block layout.
+	downsampled map[int64][]*Block
+	// downsampleSkip are blocks whose downsampling yielded no data, kept so
+	// they are not re-read on every compaction cycle.
+	downsampleSkip map[ulid.ULID]struct{}
+
 	head *Head
 
+	// postingsCache is shared by the index readers of all loaded blocks.
+	// Nil unless enabled through the options.
+	postingsCache *PostingsCache
+
 	compactc chan struct{}
 	donec    chan struct{}
 	stopc    chan struct{}
@@ -333,7 +384,7 @@ func (db *DBReadOnly) FlushWAL(dir string) (returnErr error) {
 	if err != nil {
 		return err
 	}
-	head, err := NewHead(nil, db.logger, w, DefaultBlockDuration, db.dir, nil, chunks.DefaultWriteBufferSize, DefaultStripeSize, nil)
+	head, err := NewHead(nil, db.logger, w, DefaultBlockDuration, db.dir, nil, chunks.DefaultWriteBufferSize, chunks.DefaultWriteQueueSize, DefaultStripeSize, nil)
 	if err != nil {
 		return err
 	}
@@ -386,7 +437,7 @@ func (db *DBReadOnly) loadDataAsQueryable(maxt int64) (storage.SampleAndChunkQue
 		blocks[i] = b
 	}
 
-	head, err := NewHead(nil, db.logger, nil, DefaultBlockDuration, db.dir, nil, chunks.DefaultWriteBufferSize, DefaultStripeSize, nil)
+	head, err := NewHead(nil, db.logger, nil, DefaultBlockDuration, db.dir, nil, chunks.DefaultWriteBufferSize, chunks.DefaultWriteQueueSize, DefaultStripeSize, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -404,7 +455,7 @@ func (db *DBReadOnly) loadDataAsQueryable(maxt int64) (storage.SampleAndChunkQue
 		if err != nil {
 			return nil, err
 		}
-		head, err = NewHead(nil, db.logger, w, DefaultBlockDuration, db.dir, nil, chunks.DefaultWriteBufferSize, DefaultStripeSize, nil)
+		head, err = NewHead(nil, db.logger, w, DefaultBlockDuration, db.dir, nil, chunks.DefaultWriteBufferSize, chunks.DefaultWriteQueueSize, DefaultStripeSize, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -595,6 +646,8 @@ func open(dir string, l log.Logger, r prometheus.Registerer, opts *Options, rngs
 		autoCompact:    true,
 		chunkPool:      chunkenc.NewPool(),
 		blocksToDelete: opts.BlocksToDelete,
+		downsampled:    map[int64][]*Block{},
+		downsampleSkip: map[ulid.ULID]struct{}{},
 	}
 	defer func() {
 		// Close files if startup fails somewhere.
@@ -649,10 +702,22 @@ func open(dir string, l log.Logger, r prometheus.Registerer, opts *Options, rngs
 		}
 	}
 
-	db.head, err = NewHead(r, l, wlog, rngs[0], dir, db.chunkPool, opts.HeadChunksWriteBufferSize, opts.StripeSize, opts.SeriesLifecycleCallback)
+	headChunkRange := rngs[0]
+	if opts.HeadChunkRange > 0 {
+		headChunkRange = opts.HeadChunkRange
+	}
+	db.head, err = NewHead(r, l, wlog, headChunkRange, dir, db.chunkPool, opts.HeadChunksWriteBufferSize, opts.HeadChunksWriteQueueSize, opts.StripeSize, opts.SeriesLifecycleCallback)
+	if err == nil && opts.HeadStats != nil {
+		db.head.stats = opts.HeadStats
+	}
 	if err != nil {
 		return nil, err
 	}
+	db.head.TrackChurnLabels(opts.HeadChurnLabels)
+	db.head.SetGCPause(opts.HeadGCPause)
+	if opts.PostingsCacheSize > 0 {
+		db.postingsCache = NewPostingsCache(opts.PostingsCacheSize, r)
+	}
 
 	// Register metrics after assigning the head block.
 	db.metrics = newDBMetrics(db, r)
@@ -665,6 +730,11 @@ func open(dir string, l log.Logger, r prometheus.Registerer, opts *Options, rngs
 	if err := db.reload(); err != nil {
 		return nil, err
 	}
+	if opts.DownsampleAfter > 0 {
+		if err := db.loadDownsampled(); err != nil {
+			return nil, err
+		}
+	}
 	// Set the min valid time for the ingested samples
 	// to be no lower than the maxt of the last block.
 	blocks := db.Blocks()
@@ -839,7 +909,16 @@ func (db *DB) Compact() (returnErr error) {
 		return errors.Wrap(err, "WAL truncation in Compact")
 	}
 
-	return db.compactBlocks()
+	if err := db.compactBlocks(); err != nil {
+		return errors.Wrap(err, "compact blocks")
+	}
+
+	if db.opts.DownsampleAfter > 0 {
+		if err := db.downsampleBlocks(); err != nil {
+			return errors.Wrap(err, "downsample blocks")
+		}
+	}
+	return nil
 }
 
 // CompactHead compacts the given RangeHead.
@@ -958,6 +1037,11 @@ func (db *DB) reloadBlocks() (err error) {
 	if err != nil {
 		return err
 	}
+	if db.postingsCache != nil {
+		for _, block := range loadable {
+			block.setPostingsCache(db.postingsCache)
+		}
+	}
 
 	deletableULIDs := db.blocksToDelete(loadable)
 	deletable := make(map[ulid.ULID]*Block, len(deletableULIDs))
@@ -1343,6 +1427,11 @@ func (db *DB) Close() error {
 	for _, pb := range db.blocks {
 		g.Go(pb.Close)
 	}
+	for _, blocks := range db.downsampled {
+		for _, pb := range blocks {
+			g.Go(pb.Close)
+		}
+	}
 
 	errs := tsdb_errors.NewMulti(g.Wait())
 	if db.lockf != nil {
@@ -1412,16 +1501,10 @@ func (db *DB) Snapshot(dir string, withHead bool) error {
 
 // Querier returns a new querier over the data partition for the given time range.
 func (db *DB) Querier(_ context.Context, mint, maxt int64) (storage.Querier, error) {
-	var blocks []BlockReader
-
 	db.mtx.RLock()
 	defer db.mtx.RUnlock()
 
-	for _, b := range db.blocks {
-		if b.OverlapsClosedInterval(mint, maxt) {
-			blocks = append(blocks, b)
-		}
-	}
+	blocks := db.selectBlocks(mint, maxt)
 	if maxt >= db.head.MinTime() {
 		blocks = append(blocks, NewRangeHead(db.head, mint, maxt))
 	}
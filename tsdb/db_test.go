@@ -1626,10 +1626,10 @@ func TestQuerierWithBoundaryChunks(t *testing.T) {
 }
 
 // TestInitializeHeadTimestamp ensures that the h.minTime is set properly.
-// 	- no blocks no WAL: set to the time of the first  appended sample
-// 	- no blocks with WAL: set to the smallest sample from the WAL
-//	- with blocks no WAL: set to the last block maxT
-// 	- with blocks with WAL: same as above
+//   - no blocks no WAL: set to the time of the first  appended sample
+//   - no blocks with WAL: set to the smallest sample from the WAL
+//   - with blocks no WAL: set to the last block maxT
+//   - with blocks with WAL: same as above
 func TestInitializeHeadTimestamp(t *testing.T) {
 	t.Run("clean", func(t *testing.T) {
 		dir, err := ioutil.TempDir("", "test_head_init")
@@ -1987,10 +1987,12 @@ func TestCorrectNumTombstones(t *testing.T) {
 }
 
 // TestBlockRanges checks the following use cases:
-//  - No samples can be added with timestamps lower than the last block maxt.
-//  - The compactor doesn't create overlapping blocks
+//   - No samples can be added with timestamps lower than the last block maxt.
+//   - The compactor doesn't create overlapping blocks
+//
 // even when the last blocks is not within the default boundaries.
-//	- Lower boundary is based on the smallest sample in the head and
+//   - Lower boundary is based on the smallest sample in the head and
+//
 // upper boundary is rounded to the configured block range.
 //
 // This ensures that a snapshot that includes the head and creates a block with a custom time range
@@ -3000,3 +3002,25 @@ func TestNoPanicOnTSDBOpenError(t *testing.T) {
 
 	require.NoError(t, lockf.Release())
 }
+
+func TestHeadChunkRangeOption(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "test_head_chunk_range")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, os.RemoveAll(tmpdir))
+	})
+
+	opts := DefaultOptions()
+	opts.HeadChunkRange = 600000
+
+	db, err := Open(tmpdir, nil, nil, opts)
+	require.NoError(t, err)
+	require.Equal(t, int64(600000), db.head.chunkRange.Load())
+	require.NoError(t, db.Close())
+
+	// Without the option the head keeps using the smallest block range.
+	db, err = Open(tmpdir, nil, nil, DefaultOptions())
+	require.NoError(t, err)
+	require.Equal(t, DefaultBlockDuration, db.head.chunkRange.Load())
+	require.NoError(t, db.Close())
+}
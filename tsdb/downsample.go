@@ -0,0 +1,294 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tsdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+// Downsampling resolutions generated for blocks older than DownsampleAfter,
+// in milliseconds.
+const (
+	DownsampleResolution5m = 5 * 60 * 1000
+	DownsampleResolution1h = 60 * 60 * 1000
+)
+
+// downsampleResolutions is ordered from finest to coarsest.
+var downsampleResolutions = []int64{DownsampleResolution5m, DownsampleResolution1h}
+
+// downsampleDir is the directory inside the database directory that
+// downsampled blocks of the given resolution are stored in.
+func downsampleDir(dir string, resolution int64) string {
+	return filepath.Join(dir, fmt.Sprintf("downsample-%d", resolution))
+}
+
+// wantedResolution returns the downsampling resolution preferred for a query
+// over the given time range. Short ranges read raw data.
+func wantedResolution(rangeMillis int64) int64 {
+	const day = 24 * 60 * 60 * 1000
+	switch {
+	case rangeMillis >= 28*day:
+		return DownsampleResolution1h
+	case rangeMillis >= 2*day:
+		return DownsampleResolution5m
+	}
+	return 0
+}
+
+// downsampleChunk keeps the last raw sample of every aligned resolution
+// window. Keeping the last sample rather than an average preserves the
+// monotonicity of counters, so rate() and increase() keep working on
+// downsampled data. Chunks are downsampled individually, so a window
+// spanning a chunk boundary keeps one sample per chunk.
+func downsampleChunk(c chunkenc.Chunk, resolution int64) (chunkenc.Chunk, error) {
+	out := chunkenc.NewXORChunk()
+	app, err := out.Appender()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		have   bool
+		window int64
+		t      int64
+		v      float64
+	)
+	it := c.Iterator(nil)
+	for it.Next() {
+		ts, val := it.At()
+		w := ts - ts%resolution
+		if have && w != window {
+			app.Append(t, v)
+		}
+		window, t, v, have = w, ts, val, true
+	}
+	if it.Err() != nil {
+		return nil, it.Err()
+	}
+	if have {
+		app.Append(t, v)
+	}
+	return out, nil
+}
+
+// downsampleChunkReader downsamples every chunk it reads.
+type downsampleChunkReader struct {
+	ChunkReader
+	resolution int64
+}
+
+func (r downsampleChunkReader) Chunk(ref uint64) (chunkenc.Chunk, error) {
+	c, err := r.ChunkReader.Chunk(ref)
+	if err != nil {
+		return nil, err
+	}
+	return downsampleChunk(c, r.resolution)
+}
+
+// downsampleReader is a BlockReader serving a block's data downsampled to the
+// given resolution, used to feed the compactor when writing downsampled
+// blocks.
+type downsampleReader struct {
+	*Block
+	resolution int64
+}
+
+func (r downsampleReader) Chunks() (ChunkReader, error) {
+	chunkr, err := r.Block.Chunks()
+	if err != nil {
+		return nil, err
+	}
+	return downsampleChunkReader{ChunkReader: chunkr, resolution: r.resolution}, nil
+}
+
+// loadDownsampled opens all existing downsampled blocks.
+func (db *DB) loadDownsampled() error {
+	for _, res := range downsampleResolutions {
+		dirs, err := blockDirs(downsampleDir(db.dir, res))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, d := range dirs {
+			b, err := OpenBlock(db.logger, d, db.chunkPool)
+			if err != nil {
+				return errors.Wrapf(err, "open downsampled block %s", d)
+			}
+			db.downsampled[res] = append(db.downsampled[res], b)
+		}
+	}
+	return nil
+}
+
+// downsampleBlocks writes missing downsampled versions of all blocks whose
+// data is entirely older than DownsampleAfter, and drops downsampled blocks
+// that have fallen out of the retention period. Like retention, block age is
+// measured against the newest sample in the database.
+func (db *DB) downsampleBlocks() error {
+	db.mtx.RLock()
+	blocks := append([]*Block(nil), db.blocks...)
+	db.mtx.RUnlock()
+
+	if len(blocks) == 0 {
+		return nil
+	}
+	now := db.head.MaxTime()
+	for _, b := range blocks {
+		if m := b.Meta().MaxTime; m > now {
+			now = m
+		}
+	}
+
+	for _, res := range downsampleResolutions {
+		covered := map[ulid.ULID]struct{}{}
+		db.mtx.RLock()
+		for _, d := range db.downsampled[res] {
+			for _, p := range d.Meta().Compaction.Parents {
+				covered[p.ULID] = struct{}{}
+			}
+		}
+		db.mtx.RUnlock()
+
+		for _, b := range blocks {
+			meta := b.Meta()
+			if now-meta.MaxTime < db.opts.DownsampleAfter {
+				continue
+			}
+			if _, ok := covered[meta.ULID]; ok {
+				continue
+			}
+			if _, ok := db.downsampleSkip[meta.ULID]; ok {
+				continue
+			}
+			uid, err := db.compactor.Write(downsampleDir(db.dir, res), downsampleReader{Block: b, resolution: res}, meta.MinTime, meta.MaxTime, &meta)
+			if err != nil {
+				return errors.Wrapf(err, "downsample block %s to %dms", meta.ULID, res)
+			}
+			if uid.Compare(ulid.ULID{}) == 0 {
+				// The block was empty; remember it so it is not re-read on
+				// every compaction cycle.
+				db.downsampleSkip[meta.ULID] = struct{}{}
+				continue
+			}
+			bdir := filepath.Join(downsampleDir(db.dir, res), uid.String())
+			nm, _, err := readMetaFile(bdir)
+			if err != nil {
+				return errors.Wrapf(err, "read downsampled block meta %s", bdir)
+			}
+			nm.Resolution = res
+			if _, err := writeMetaFile(db.logger, bdir, nm); err != nil {
+				return errors.Wrapf(err, "write downsampled block meta %s", bdir)
+			}
+			nb, err := OpenBlock(db.logger, bdir, db.chunkPool)
+			if err != nil {
+				return errors.Wrapf(err, "open downsampled block %s", bdir)
+			}
+			db.mtx.Lock()
+			db.downsampled[res] = append(db.downsampled[res], nb)
+			db.mtx.Unlock()
+			level.Info(db.logger).Log("msg", "Wrote downsampled block", "parent", meta.ULID, "ulid", uid, "resolution", res)
+		}
+	}
+
+	return db.truncateDownsampled(now)
+}
+
+// truncateDownsampled deletes downsampled blocks beyond the retention period.
+func (db *DB) truncateDownsampled(now int64) error {
+	if db.opts.RetentionDuration == 0 {
+		return nil
+	}
+	for _, res := range downsampleResolutions {
+		db.mtx.Lock()
+		var (
+			keep    []*Block
+			deleted []*Block
+		)
+		for _, b := range db.downsampled[res] {
+			if now-b.Meta().MaxTime > db.opts.RetentionDuration {
+				deleted = append(deleted, b)
+			} else {
+				keep = append(keep, b)
+			}
+		}
+		db.downsampled[res] = keep
+		db.mtx.Unlock()
+
+		for _, b := range deleted {
+			if err := b.Close(); err != nil {
+				return errors.Wrapf(err, "close downsampled block %s", b)
+			}
+			if err := os.RemoveAll(b.Dir()); err != nil {
+				return errors.Wrapf(err, "delete downsampled block %s", b)
+			}
+		}
+	}
+	return nil
+}
+
+// selectBlocks returns the persisted blocks overlapping the given range,
+// substituting raw blocks with their downsampled versions when the length of
+// the range prefers a coarser resolution. Downsampled blocks whose raw parent
+// already fell out of retention are served as well. The caller must hold the
+// database read lock.
+func (db *DB) selectBlocks(mint, maxt int64) []BlockReader {
+	var blocks []BlockReader
+
+	best := map[ulid.ULID]*Block{}
+	if res := wantedResolution(maxt - mint); res > 0 {
+		// Coarser resolutions overwrite finer ones, so the coarsest
+		// resolution not exceeding the wanted one wins per parent.
+		for _, r := range downsampleResolutions {
+			if r > res {
+				break
+			}
+			for _, b := range db.downsampled[r] {
+				if !b.OverlapsClosedInterval(mint, maxt) {
+					continue
+				}
+				if ps := b.Meta().Compaction.Parents; len(ps) == 1 {
+					best[ps[0].ULID] = b
+				}
+			}
+		}
+	}
+
+	raw := map[ulid.ULID]struct{}{}
+	for _, b := range db.blocks {
+		raw[b.Meta().ULID] = struct{}{}
+		if !b.OverlapsClosedInterval(mint, maxt) {
+			continue
+		}
+		if d, ok := best[b.Meta().ULID]; ok {
+			blocks = append(blocks, d)
+		} else {
+			blocks = append(blocks, b)
+		}
+	}
+	for parent, d := range best {
+		if _, ok := raw[parent]; !ok {
+			blocks = append(blocks, d)
+		}
+	}
+	return blocks
+}
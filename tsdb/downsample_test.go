@@ -0,0 +1,135 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tsdb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/oklog/ulid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+func TestDownsampleChunk(t *testing.T) {
+	raw := chunkenc.NewXORChunk()
+	app, err := raw.Appender()
+	require.NoError(t, err)
+	// 15s scrapes over 30 minutes.
+	for ts := int64(0); ts < 30*60*1000; ts += 15000 {
+		app.Append(ts, float64(ts))
+	}
+
+	ds, err := downsampleChunk(raw, DownsampleResolution5m)
+	require.NoError(t, err)
+
+	var (
+		timestamps []int64
+		it         = ds.Iterator(nil)
+	)
+	for it.Next() {
+		ts, v := it.At()
+		// The last raw sample of each window is kept verbatim.
+		require.Equal(t, float64(ts), v)
+		timestamps = append(timestamps, ts)
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, []int64{285000, 585000, 885000, 1185000, 1485000, 1785000}, timestamps)
+}
+
+func TestWantedResolution(t *testing.T) {
+	const day = int64(24 * 60 * 60 * 1000)
+	require.Equal(t, int64(0), wantedResolution(6*60*60*1000))
+	require.Equal(t, int64(DownsampleResolution5m), wantedResolution(3*day))
+	require.Equal(t, int64(DownsampleResolution1h), wantedResolution(365*day))
+}
+
+func TestDBDownsampleBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "downsample")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	// An old block eligible for downsampling and a recent one that is not.
+	createBlock(t, dir, genSeries(3, 2, 0, 1000))
+	createBlock(t, dir, genSeries(3, 2, 1000, 2000))
+
+	opts := DefaultOptions()
+	opts.DownsampleAfter = 500
+
+	db, err := Open(dir, nil, nil, opts)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, db.Close())
+	}()
+
+	require.NoError(t, db.downsampleBlocks())
+
+	var oldBlock, newBlock ulid.ULID
+	for _, b := range db.Blocks() {
+		if b.Meta().MaxTime == 1000 {
+			oldBlock = b.Meta().ULID
+		} else {
+			newBlock = b.Meta().ULID
+		}
+	}
+
+	for _, res := range downsampleResolutions {
+		require.Len(t, db.downsampled[res], 1)
+		meta := db.downsampled[res][0].Meta()
+		require.Equal(t, res, meta.Resolution)
+		require.Len(t, meta.Compaction.Parents, 1)
+		require.Equal(t, oldBlock, meta.Compaction.Parents[0].ULID)
+		// All raw samples fall into a single window. Chunks are downsampled
+		// individually, so each of the 9 raw chunks per series contributes
+		// one sample to the window.
+		require.Equal(t, uint64(27), meta.Stats.NumSamples)
+	}
+
+	// Downsampling is idempotent.
+	require.NoError(t, db.downsampleBlocks())
+	for _, res := range downsampleResolutions {
+		require.Len(t, db.downsampled[res], 1)
+	}
+
+	ulids := func(blocks []BlockReader) map[ulid.ULID]struct{} {
+		m := map[ulid.ULID]struct{}{}
+		for _, b := range blocks {
+			m[b.Meta().ULID] = struct{}{}
+		}
+		return m
+	}
+
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+
+	// Short ranges read raw blocks.
+	got := ulids(db.selectBlocks(0, 2000))
+	require.Contains(t, got, oldBlock)
+	require.Contains(t, got, newBlock)
+
+	// Long ranges substitute downsampled versions where available.
+	const day = int64(24 * 60 * 60 * 1000)
+	got = ulids(db.selectBlocks(0, 3*day))
+	require.Contains(t, got, db.downsampled[DownsampleResolution5m][0].Meta().ULID)
+	require.NotContains(t, got, oldBlock)
+	require.Contains(t, got, newBlock)
+
+	got = ulids(db.selectBlocks(0, 365*day))
+	require.Contains(t, got, db.downsampled[DownsampleResolution1h][0].Meta().ULID)
+	require.NotContains(t, got, oldBlock)
+}
@@ -51,6 +51,10 @@ var (
 	ErrAppenderClosed = errors.New("appender closed")
 )
 
+// gcPostingsBatchSize is the number of postings lists the head GC processes
+// between pauses when GC pacing is enabled.
+const gcPostingsBatchSize = 4096
+
 // Head handles reads and writes of time series data within a time window.
 type Head struct {
 	chunkRange            atomic.Int64
@@ -72,6 +76,18 @@ type Head struct {
 	series         *stripeSeries
 	seriesCallback SeriesLifecycleCallback
 
+	// churnLabels are the label names by which series creations and removals
+	// are broken down in metrics. Empty means no per-label churn metrics.
+	churnLabels []string
+
+	// gcPause is the time gc() sleeps between batches of postings deletions,
+	// so appenders can make progress during large GCs. 0 disables the pacing.
+	gcPause time.Duration
+
+	// stats collects WAL replay progress; it may be shared with the caller
+	// via Options.HeadStats to observe startup before Init returns.
+	stats *HeadStats
+
 	symMtx  sync.RWMutex
 	symbols map[string]struct{}
 
@@ -102,11 +118,14 @@ type headMetrics struct {
 	series                   prometheus.GaugeFunc
 	seriesCreated            prometheus.Counter
 	seriesRemoved            prometheus.Counter
+	seriesCreatedByLabel     *prometheus.CounterVec
+	seriesRemovedByLabel     *prometheus.CounterVec
 	seriesNotFound           prometheus.Counter
 	chunks                   prometheus.Gauge
 	chunksCreated            prometheus.Counter
 	chunksRemoved            prometheus.Counter
 	gcDuration               prometheus.Summary
+	gcPauseDuration          prometheus.Counter
 	samplesAppended          prometheus.Counter
 	outOfBoundSamples        prometheus.Counter
 	outOfOrderSamples        prometheus.Counter
@@ -142,6 +161,14 @@ func newHeadMetrics(h *Head, r prometheus.Registerer) *headMetrics {
 			Name: "prometheus_tsdb_head_series_removed_total",
 			Help: "Total number of series removed in the head",
 		}),
+		seriesCreatedByLabel: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "prometheus_tsdb_head_series_created_by_label_total",
+			Help: "Total number of series created in the head, broken down by the configured churn label names.",
+		}, []string{"label_name", "label_value"}),
+		seriesRemovedByLabel: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "prometheus_tsdb_head_series_removed_by_label_total",
+			Help: "Total number of series removed in the head, broken down by the configured churn label names.",
+		}, []string{"label_name", "label_value"}),
 		seriesNotFound: prometheus.NewCounter(prometheus.CounterOpts{
 			Name: "prometheus_tsdb_head_series_not_found_total",
 			Help: "Total number of requests for series that were not found.",
@@ -162,6 +189,10 @@ func newHeadMetrics(h *Head, r prometheus.Registerer) *headMetrics {
 			Name: "prometheus_tsdb_head_gc_duration_seconds",
 			Help: "Runtime of garbage collection in the head block.",
 		}),
+		gcPauseDuration: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "prometheus_tsdb_head_gc_pause_seconds_total",
+			Help: "Total time the head garbage collection slept between batches of postings deletions to let appends proceed.",
+		}),
 		walTruncateDuration: prometheus.NewSummary(prometheus.SummaryOpts{
 			Name: "prometheus_tsdb_wal_truncate_duration_seconds",
 			Help: "Duration of WAL truncation.",
@@ -225,8 +256,11 @@ func newHeadMetrics(h *Head, r prometheus.Registerer) *headMetrics {
 			m.chunksRemoved,
 			m.seriesCreated,
 			m.seriesRemoved,
+			m.seriesCreatedByLabel,
+			m.seriesRemovedByLabel,
 			m.seriesNotFound,
 			m.gcDuration,
+			m.gcPauseDuration,
 			m.walTruncateDuration,
 			m.walCorruptionsTotal,
 			m.walTotalReplayDuration,
@@ -266,6 +300,29 @@ func newHeadMetrics(h *Head, r prometheus.Registerer) *headMetrics {
 			}, func() float64 {
 				return float64(h.iso.lastAppendID())
 			}),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "prometheus_tsdb_head_mmapped_chunks_bytes",
+				Help: "Size of the on-disk head chunk files that the chunks of the head block are memory-mapped from.",
+			}, func() float64 {
+				// The metrics are created before the chunk disk mapper.
+				if h.chunkDiskMapper == nil {
+					return 0
+				}
+				size, err := h.chunkDiskMapper.Size()
+				if err != nil {
+					return 0
+				}
+				return float64(size)
+			}),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "prometheus_tsdb_head_chunk_write_queue_depth",
+				Help: "Number of chunks waiting in the head chunk write queue, 0 when the queue is disabled.",
+			}, func() float64 {
+				if h.chunkDiskMapper == nil {
+					return 0
+				}
+				return float64(h.chunkDiskMapper.WriteQueueDepth())
+			}),
 		)
 	}
 	return m
@@ -291,11 +348,43 @@ func (h *Head) PostingsCardinalityStats(statsByLabelName string) *index.Postings
 	return h.cardinalityCache
 }
 
+// HeadStats are the statistics for the Head component of the DB.
+type HeadStats struct {
+	WALReplayStatus *WALReplayStatus
+}
+
+// NewHeadStats returns a new HeadStats object.
+func NewHeadStats() *HeadStats {
+	return &HeadStats{
+		WALReplayStatus: &WALReplayStatus{},
+	}
+}
+
+// WALReplayStatus contains status information about the WAL replay.
+type WALReplayStatus struct {
+	sync.RWMutex
+	Min     int
+	Max     int
+	Current int
+}
+
+// GetWALReplayStatus returns the current status of the WAL replay.
+func (s *WALReplayStatus) GetWALReplayStatus() WALReplayStatus {
+	s.RLock()
+	defer s.RUnlock()
+
+	return WALReplayStatus{
+		Min:     s.Min,
+		Max:     s.Max,
+		Current: s.Current,
+	}
+}
+
 // NewHead opens the head block in dir.
 // stripeSize sets the number of entries in the hash map, it must be a power of 2.
 // A larger stripeSize will allocate more memory up-front, but will increase performance when handling a large number of series.
 // A smaller stripeSize reduces the memory allocated, but can decrease performance with large number of series.
-func NewHead(r prometheus.Registerer, l log.Logger, wal *wal.WAL, chunkRange int64, chkDirRoot string, chkPool chunkenc.Pool, chkWriteBufferSize, stripeSize int, seriesCallback SeriesLifecycleCallback) (*Head, error) {
+func NewHead(r prometheus.Registerer, l log.Logger, wal *wal.WAL, chunkRange int64, chkDirRoot string, chkPool chunkenc.Pool, chkWriteBufferSize, chkWriteQueueSize, stripeSize int, seriesCallback SeriesLifecycleCallback) (*Head, error) {
 	if l == nil {
 		l = log.NewNopLogger()
 	}
@@ -305,10 +394,13 @@ func NewHead(r prometheus.Registerer, l log.Logger, wal *wal.WAL, chunkRange int
 	if seriesCallback == nil {
 		seriesCallback = &noopSeriesLifecycleCallback{}
 	}
+	// The churn callback wraps the user-provided one so that series removed
+	// during GC can be attributed to the configured churn labels.
+	churnCB := &churnSeriesCallback{next: seriesCallback}
 	h := &Head{
 		wal:        wal,
 		logger:     l,
-		series:     newStripeSeries(stripeSize, seriesCallback),
+		series:     newStripeSeries(stripeSize, churnCB),
 		symbols:    map[string]struct{}{},
 		postings:   index.NewUnorderedMemPostings(),
 		tombstones: tombstones.NewMemTombstones(),
@@ -321,7 +413,9 @@ func NewHead(r prometheus.Registerer, l log.Logger, wal *wal.WAL, chunkRange int
 		},
 		chunkDirRoot:   chkDirRoot,
 		seriesCallback: seriesCallback,
+		stats:          NewHeadStats(),
 	}
+	churnCB.head = h
 	h.chunkRange.Store(chunkRange)
 	h.minTime.Store(math.MaxInt64)
 	h.maxTime.Store(math.MinInt64)
@@ -333,7 +427,7 @@ func NewHead(r prometheus.Registerer, l log.Logger, wal *wal.WAL, chunkRange int
 	}
 
 	var err error
-	h.chunkDiskMapper, err = chunks.NewChunkDiskMapper(mmappedChunksDir(chkDirRoot), chkPool, chkWriteBufferSize)
+	h.chunkDiskMapper, err = chunks.NewChunkDiskMapper(mmappedChunksDir(chkDirRoot), chkPool, chkWriteBufferSize, chkWriteQueueSize)
 	if err != nil {
 		return nil, err
 	}
@@ -341,6 +435,30 @@ func NewHead(r prometheus.Registerer, l log.Logger, wal *wal.WAL, chunkRange int
 	return h, nil
 }
 
+// TrackChurnLabels makes series creations and removals additionally counted
+// per value of the given label names, so that churn can be attributed to
+// specific jobs or instances. It must be called before any samples are
+// appended to the head.
+func (h *Head) TrackChurnLabels(names []string) {
+	h.churnLabels = names
+}
+
+// SetGCPause makes gc() sleep for pause between batches of postings
+// deletions, bounding how long appenders are blocked in a row during large
+// garbage collections. 0 disables the pacing.
+func (h *Head) SetGCPause(pause time.Duration) {
+	h.gcPause = pause
+}
+
+// countChurn increments vec once per configured churn label present in lset.
+func (h *Head) countChurn(vec *prometheus.CounterVec, lset labels.Labels) {
+	for _, n := range h.churnLabels {
+		if v := lset.Get(n); v != "" {
+			vec.WithLabelValues(n, v).Inc()
+		}
+	}
+}
+
 func mmappedChunksDir(dir string) string { return filepath.Join(dir, "chunks_head") }
 
 // processWALSamples adds a partition of samples it receives to the head and passes
@@ -699,6 +817,8 @@ func (h *Head) Init(minValidTime int64) error {
 		return errors.Wrap(err, "finding WAL segments")
 	}
 
+	h.startWALReplayStatus(startFrom, last)
+
 	// Backfill segments from the most recent checkpoint onwards.
 	for i := startFrom; i <= last; i++ {
 		s, err := wal.OpenReadSegment(wal.SegmentName(h.wal.Dir(), i))
@@ -715,6 +835,7 @@ func (h *Head) Init(minValidTime int64) error {
 			return err
 		}
 		level.Info(h.logger).Log("msg", "WAL segment loaded", "segment", i, "maxSegment", last)
+		h.updateWALReplayStatusRead(i)
 	}
 
 	walReplayDuration := time.Since(start)
@@ -729,6 +850,27 @@ func (h *Head) Init(minValidTime int64) error {
 	return nil
 }
 
+// WALReplayStatus returns the WAL replay status of the head.
+func (h *Head) WALReplayStatus() WALReplayStatus {
+	return h.stats.WALReplayStatus.GetWALReplayStatus()
+}
+
+func (h *Head) startWALReplayStatus(startFrom, last int) {
+	h.stats.WALReplayStatus.Lock()
+	defer h.stats.WALReplayStatus.Unlock()
+
+	h.stats.WALReplayStatus.Min = startFrom
+	h.stats.WALReplayStatus.Max = last
+	h.stats.WALReplayStatus.Current = startFrom
+}
+
+func (h *Head) updateWALReplayStatusRead(current int) {
+	h.stats.WALReplayStatus.Lock()
+	defer h.stats.WALReplayStatus.Unlock()
+
+	h.stats.WALReplayStatus.Current = current
+}
+
 func (h *Head) loadMmappedChunks() (map[uint64][]*mmappedChunk, error) {
 	mmappedChunks := map[uint64][]*mmappedChunk{}
 	if err := h.chunkDiskMapper.IterateAllChunks(func(seriesRef, chunkRef uint64, mint, maxt int64, numSamples uint16) error {
@@ -1367,8 +1509,10 @@ func (h *Head) gc() int64 {
 	h.metrics.chunks.Sub(float64(chunksRemoved))
 	h.numSeries.Sub(uint64(seriesRemoved))
 
-	// Remove deleted series IDs from the postings lists.
-	h.postings.Delete(deleted)
+	// Remove deleted series IDs from the postings lists, yielding between
+	// batches so appends are not starved while the GC holds the lock.
+	paused := h.postings.DeletePaced(deleted, gcPostingsBatchSize, h.gcPause)
+	h.metrics.gcPauseDuration.Add(paused.Seconds())
 
 	if h.wal != nil {
 		_, last, _ := wal.Segments(h.wal.Dir())
@@ -1736,6 +1880,7 @@ func (h *Head) getOrCreateWithID(id, hash uint64, lset labels.Labels) (*memSerie
 	}
 
 	h.metrics.seriesCreated.Inc()
+	h.countChurn(h.metrics.seriesCreatedByLabel, lset)
 	h.numSeries.Inc()
 
 	h.symMtx.Lock()
@@ -2391,6 +2536,22 @@ type SeriesLifecycleCallback interface {
 	PostDeletion(...labels.Labels)
 }
 
+// churnSeriesCallback wraps a SeriesLifecycleCallback to count series removed
+// during GC against the head's configured churn labels.
+type churnSeriesCallback struct {
+	head *Head
+	next SeriesLifecycleCallback
+}
+
+func (c *churnSeriesCallback) PreCreation(lset labels.Labels) error { return c.next.PreCreation(lset) }
+func (c *churnSeriesCallback) PostCreation(lset labels.Labels)      { c.next.PostCreation(lset) }
+func (c *churnSeriesCallback) PostDeletion(lsets ...labels.Labels) {
+	for _, lset := range lsets {
+		c.head.countChurn(c.head.metrics.seriesRemovedByLabel, lset)
+	}
+	c.next.PostDeletion(lsets...)
+}
+
 type noopSeriesLifecycleCallback struct{}
 
 func (noopSeriesLifecycleCallback) PreCreation(labels.Labels) error { return nil }
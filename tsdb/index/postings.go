@@ -20,6 +20,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/prometheus/prometheus/pkg/labels"
 )
@@ -219,7 +220,19 @@ func (p *MemPostings) EnsureOrder() {
 
 // Delete removes all ids in the given map from the postings lists.
 func (p *MemPostings) Delete(deleted map[uint64]struct{}) {
-	var keys, vals []string
+	p.DeletePaced(deleted, 0, 0)
+}
+
+// DeletePaced is like Delete but sleeps for pause after every batchSize
+// processed postings lists, so writers contending for the lock can make
+// progress during large deletions. A batchSize or pause of 0 or less
+// disables the pacing. It returns the total time spent sleeping.
+func (p *MemPostings) DeletePaced(deleted map[uint64]struct{}, batchSize int, pause time.Duration) time.Duration {
+	var (
+		keys, vals []string
+		processed  int
+		paused     time.Duration
+	)
 
 	// Collect all keys relevant for deletion once. New keys added afterwards
 	// can by definition not be affected by any of the given deletes.
@@ -240,6 +253,12 @@ func (p *MemPostings) Delete(deleted map[uint64]struct{}) {
 		// For each posting we first analyse whether the postings list is affected by the deletes.
 		// If yes, we actually reallocate a new postings list.
 		for _, l := range vals {
+			processed++
+			if batchSize > 0 && pause > 0 && processed%batchSize == 0 {
+				time.Sleep(pause)
+				paused += pause
+			}
+
 			// Only lock for processing one postings list so we don't block reads for too long.
 			p.mtx.Lock()
 
@@ -274,6 +293,8 @@ func (p *MemPostings) Delete(deleted map[uint64]struct{}) {
 		}
 		p.mtx.Unlock()
 	}
+
+	return paused
 }
 
 // Iter calls f for each postings list. It aborts if f returns an error and returns it.
@@ -18,7 +18,9 @@ import (
 	"fmt"
 	"math/rand"
 	"sort"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -874,3 +876,18 @@ func TestMemPostings_Delete(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, 0, len(expanded), "expected empty postings, got %v", expanded)
 }
+
+func TestMemPostings_DeletePaced(t *testing.T) {
+	p := NewMemPostings()
+	for i := uint64(1); i <= 10; i++ {
+		p.Add(i, labels.FromStrings("lbl1", strconv.FormatUint(i, 10)))
+	}
+
+	deleted := map[uint64]struct{}{2: {}, 5: {}}
+	paused := p.DeletePaced(deleted, 2, time.Millisecond)
+	require.True(t, paused >= time.Millisecond, "expected at least one pause, got %v", paused)
+
+	expanded, err := ExpandPostings(p.Get(allPostingsKey.Name, allPostingsKey.Value))
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 3, 4, 6, 7, 8, 9, 10}, expanded)
+}
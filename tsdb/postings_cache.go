@@ -0,0 +1,149 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tsdb
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// postingsCacheShards is the number of independently locked cache shards,
+// spreading lock contention of concurrent queries.
+const postingsCacheShards = 32
+
+// PostingsCache caches expanded postings lists of persisted blocks, keyed by
+// block and label pair, so that repeated selectors on hot dashboards do not
+// hit the block index again. Blocks are immutable, so entries never go stale;
+// entries of deleted blocks simply age out through the LRU eviction.
+type PostingsCache struct {
+	shards   [postingsCacheShards]postingsCacheShard
+	maxBytes int64
+	bytes    int64
+
+	hits   prometheus.Counter
+	misses prometheus.Counter
+}
+
+type postingsCacheShard struct {
+	mtx     sync.Mutex
+	entries map[postingsCacheKey]*list.Element
+	lru     *list.List
+	bytes   int64
+}
+
+type postingsCacheKey struct {
+	block       ulid.ULID
+	name, value string
+}
+
+type postingsCacheEntry struct {
+	key   postingsCacheKey
+	refs  []uint64
+	bytes int64
+}
+
+// NewPostingsCache returns a postings cache bounded to approximately maxBytes
+// of expanded postings.
+func NewPostingsCache(maxBytes int64, r prometheus.Registerer) *PostingsCache {
+	c := &PostingsCache{
+		maxBytes: maxBytes,
+		hits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "prometheus_tsdb_postings_cache_hits_total",
+			Help: "Total number of postings lookups served from the postings cache.",
+		}),
+		misses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "prometheus_tsdb_postings_cache_misses_total",
+			Help: "Total number of postings lookups that missed the postings cache.",
+		}),
+	}
+	for i := range c.shards {
+		c.shards[i].entries = map[postingsCacheKey]*list.Element{}
+		c.shards[i].lru = list.New()
+	}
+	if r != nil {
+		r.MustRegister(c.hits, c.misses, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "prometheus_tsdb_postings_cache_bytes",
+			Help: "Current approximate size of the postings cache in bytes.",
+		}, func() float64 {
+			return float64(atomic.LoadInt64(&c.bytes))
+		}))
+	}
+	return c
+}
+
+func (c *PostingsCache) shard(key postingsCacheKey) *postingsCacheShard {
+	h := xxhash.New()
+	h.Write(key.block[:])
+	h.WriteString(key.name)
+	h.WriteString("\xff")
+	h.WriteString(key.value)
+	return &c.shards[h.Sum64()%postingsCacheShards]
+}
+
+// get returns the cached postings for the key, if present.
+func (c *PostingsCache) get(key postingsCacheKey) ([]uint64, bool) {
+	s := c.shard(key)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		c.misses.Inc()
+		return nil, false
+	}
+	s.lru.MoveToFront(e)
+	c.hits.Inc()
+	return e.Value.(*postingsCacheEntry).refs, true
+}
+
+// set stores the postings for the key, evicting the least recently used
+// entries of the shard if the shard's share of the budget is exceeded.
+func (c *PostingsCache) set(key postingsCacheKey, refs []uint64) {
+	entry := &postingsCacheEntry{
+		key:  key,
+		refs: refs,
+		// Key strings, slice header and map overhead are approximated.
+		bytes: int64(len(key.name)+len(key.value)) + 8*int64(len(refs)) + 64,
+	}
+	if entry.bytes > c.maxBytes/postingsCacheShards {
+		// Never cache a single entry larger than a whole shard.
+		return
+	}
+	s := c.shard(key)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if _, ok := s.entries[key]; ok {
+		return
+	}
+	s.entries[key] = s.lru.PushFront(entry)
+	s.bytes += entry.bytes
+	atomic.AddInt64(&c.bytes, entry.bytes)
+
+	for s.bytes > c.maxBytes/postingsCacheShards {
+		e := s.lru.Back()
+		evicted := e.Value.(*postingsCacheEntry)
+		s.lru.Remove(e)
+		delete(s.entries, evicted.key)
+		s.bytes -= evicted.bytes
+		atomic.AddInt64(&c.bytes, -evicted.bytes)
+	}
+}
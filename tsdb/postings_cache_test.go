@@ -0,0 +1,121 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tsdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/tsdb/index"
+)
+
+func TestPostingsCache(t *testing.T) {
+	c := NewPostingsCache(1<<20, nil)
+
+	key := postingsCacheKey{name: "job", value: "a"}
+	_, ok := c.get(key)
+	require.False(t, ok)
+
+	c.set(key, []uint64{1, 2, 3})
+	refs, ok := c.get(key)
+	require.True(t, ok)
+	require.Equal(t, []uint64{1, 2, 3}, refs)
+
+	// A different block yields a different key.
+	_, ok = c.get(postingsCacheKey{block: ulid.MustNew(1, nil), name: "job", value: "a"})
+	require.False(t, ok)
+}
+
+func TestPostingsCacheEviction(t *testing.T) {
+	// Small budget so that inserts of a single shard must evict.
+	c := NewPostingsCache(postingsCacheShards*200, nil)
+
+	var keys []postingsCacheKey
+	for i := 0; i < 100; i++ {
+		key := postingsCacheKey{name: "job", value: fmt.Sprintf("a%d", i)}
+		keys = append(keys, key)
+		c.set(key, []uint64{uint64(i)})
+	}
+	var cached int
+	for _, key := range keys {
+		if _, ok := c.get(key); ok {
+			cached++
+		}
+	}
+	require.Greater(t, cached, 0)
+	require.Less(t, cached, 100)
+	require.LessOrEqual(t, c.bytes, int64(postingsCacheShards*200))
+
+	// Entries larger than a shard's budget are never cached.
+	c.set(postingsCacheKey{name: "job", value: "huge"}, make([]uint64, 1000))
+	_, ok := c.get(postingsCacheKey{name: "job", value: "huge"})
+	require.False(t, ok)
+}
+
+func TestBlockPostingsCached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "postings_cache")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	blockDir := createBlock(t, dir, genSeries(10, 2, 0, 10))
+	b, err := OpenBlock(nil, blockDir, nil)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, b.Close())
+	}()
+
+	c := NewPostingsCache(1<<20, nil)
+	b.setPostingsCache(c)
+
+	ir, err := b.Index()
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, ir.Close())
+	}()
+
+	lbls, err := ir.LabelValues(defaultLabelName)
+	require.NoError(t, err)
+	require.NotEmpty(t, lbls)
+
+	query := func() []uint64 {
+		p, err := ir.Postings(defaultLabelName, lbls[0])
+		require.NoError(t, err)
+		refs, err := index.ExpandPostings(p)
+		require.NoError(t, err)
+		return refs
+	}
+
+	first := query()
+	require.NotEmpty(t, first)
+	require.Equal(t, 0.0, counterValue(t, c.hits))
+
+	// The second identical query is served from the cache.
+	require.Equal(t, first, query())
+	require.Equal(t, 1.0, counterValue(t, c.hits))
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	var m dto.Metric
+	require.NoError(t, c.Write(&m))
+	return m.GetCounter().GetValue()
+}
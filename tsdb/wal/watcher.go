@@ -29,6 +29,7 @@ import (
 	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
 
 	"github.com/prometheus/prometheus/pkg/timestamp"
 	"github.com/prometheus/prometheus/tsdb/record"
@@ -73,6 +74,10 @@ type Watcher struct {
 	startTimestamp int64 // the start time as a Prometheus timestamp
 	sendSamples    bool
 
+	// Segment currently being read, -1 before the first Run. Used to compute
+	// the remaining WAL backlog.
+	currentSegment *atomic.Int64
+
 	recordsReadMetric       *prometheus.CounterVec
 	recordDecodeFailsMetric prometheus.Counter
 	samplesSentPreTailing   prometheus.Counter
@@ -141,14 +146,15 @@ func NewWatcher(metrics *WatcherMetrics, readerMetrics *LiveReaderMetrics, logge
 		logger = log.NewNopLogger()
 	}
 	return &Watcher{
-		logger:        logger,
-		writer:        writer,
-		metrics:       metrics,
-		readerMetrics: readerMetrics,
-		walDir:        path.Join(walDir, "wal"),
-		name:          name,
-		quit:          make(chan struct{}),
-		done:          make(chan struct{}),
+		logger:         logger,
+		writer:         writer,
+		metrics:        metrics,
+		readerMetrics:  readerMetrics,
+		walDir:         path.Join(walDir, "wal"),
+		name:           name,
+		currentSegment: atomic.NewInt64(-1),
+		quit:           make(chan struct{}),
+		done:           make(chan struct{}),
 
 		MaxSegment: -1,
 	}
@@ -244,6 +250,7 @@ func (w *Watcher) Run() error {
 	level.Debug(w.logger).Log("msg", "Tailing WAL", "lastCheckpoint", lastCheckpoint, "checkpointIndex", checkpointIndex, "currentSegment", currentSegment, "lastSegment", lastSegment)
 	for !isClosed(w.quit) {
 		w.currentSegmentMetric.Set(float64(currentSegment))
+		w.currentSegment.Store(int64(currentSegment))
 		level.Debug(w.logger).Log("msg", "Processing segment", "currentSegment", currentSegment)
 
 		// On start, after reading the existing WAL for series records, we have a pointer to what is the latest segment.
@@ -263,6 +270,30 @@ func (w *Watcher) Run() error {
 	return nil
 }
 
+// Backlog returns the approximate number of WAL bytes the watcher has not
+// read yet, i.e. the combined size of all segments at or after the one
+// currently being read.
+func (w *Watcher) Backlog() int64 {
+	current := int(w.currentSegment.Load())
+	if current < 0 {
+		return 0
+	}
+	segs, err := w.segments(w.walDir)
+	if err != nil {
+		return 0
+	}
+	var size int64
+	for _, i := range segs {
+		if i < current {
+			continue
+		}
+		if fi, err := os.Stat(SegmentName(w.walDir, i)); err == nil {
+			size += fi.Size()
+		}
+	}
+	return size
+}
+
 // findSegmentForIndex finds the first segment greater than or equal to index.
 func (w *Watcher) findSegmentForIndex(index int) (int, error) {
 	refs, err := w.segments(w.walDir)
@@ -570,3 +570,69 @@ func TestCheckpointSeriesReset(t *testing.T) {
 		})
 	}
 }
+
+func TestWatcherBacklog(t *testing.T) {
+	pageSize := 32 * 1024
+	const seriesCount = 10
+	const samplesCount = 250
+
+	dir, err := ioutil.TempDir("", "watcherBacklog")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	wdir := path.Join(dir, "wal")
+	err = os.Mkdir(wdir, 0777)
+	require.NoError(t, err)
+
+	// Use a small segment size so the data rolls over several segments.
+	w, err := NewSize(nil, nil, wdir, pageSize, false)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, w.Close())
+	}()
+
+	enc := record.Encoder{}
+	for i := 0; i < seriesCount; i++ {
+		series := enc.Series([]record.RefSeries{
+			{
+				Ref:    uint64(i),
+				Labels: labels.Labels{labels.Label{Name: "__name__", Value: fmt.Sprintf("metric_%d", i)}},
+			},
+		}, nil)
+		require.NoError(t, w.Log(series))
+		for j := 0; j < samplesCount; j++ {
+			sample := enc.Samples([]record.RefSample{
+				{
+					Ref: uint64(i),
+					T:   int64(j),
+					V:   float64(i),
+				},
+			}, nil)
+			require.NoError(t, w.Log(sample))
+		}
+	}
+
+	first, last, err := Segments(w.Dir())
+	require.NoError(t, err)
+	require.Greater(t, last, first)
+
+	wt := newWriteToMock()
+	watcher := NewWatcher(wMetrics, nil, nil, "", wt, dir)
+
+	// Before the first Run there is no position to compute a backlog from.
+	require.Equal(t, int64(0), watcher.Backlog())
+
+	// From the first segment the whole WAL is backlog.
+	watcher.currentSegment.Store(int64(first))
+	all := watcher.Backlog()
+	require.Greater(t, all, int64(0))
+
+	// Moving forward shrinks the backlog to the remaining segments.
+	watcher.currentSegment.Store(int64(last))
+	require.Less(t, watcher.Backlog(), all)
+
+	// Past the head there is nothing left to read.
+	watcher.currentSegment.Store(int64(last + 1))
+	require.Equal(t, int64(0), watcher.Backlog())
+}
@@ -27,6 +27,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -37,10 +38,14 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/route"
+	"gopkg.in/yaml.v3"
 
 	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/discovery"
 	"github.com/prometheus/prometheus/pkg/gate"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/relabel"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
 	"github.com/prometheus/prometheus/pkg/textparse"
 	"github.com/prometheus/prometheus/pkg/timestamp"
 	"github.com/prometheus/prometheus/prompb"
@@ -79,6 +84,7 @@ const (
 	errorInternal    errorType = "internal"
 	errorUnavailable errorType = "unavailable"
 	errorNotFound    errorType = "not_found"
+	errorLimited     errorType = "limited"
 )
 
 var (
@@ -89,8 +95,59 @@ var (
 		Name:      "remote_read_queries",
 		Help:      "The current number of remote read queries being executed or waiting.",
 	})
+	queryOriginQueries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "origin_queries_total",
+		Help:      "Total number of query API requests by the origin given in the X-Query-Origin header.",
+	}, []string{"origin", "endpoint"})
+	queryOriginDuration = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace:  namespace,
+		Subsystem:  subsystem,
+		Name:       "origin_query_duration_seconds",
+		Help:       "Time spent serving query API requests by the origin given in the X-Query-Origin header.",
+		Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+	}, []string{"origin", "endpoint"})
 )
 
+// queryOriginHeader names the request header carrying the caller's identity,
+// e.g. a dashboard UID, for per-origin attribution of query load.
+const queryOriginHeader = "X-Query-Origin"
+
+// maxQueryOrigins bounds the number of distinct origin label values so a
+// misbehaving caller cannot blow up the metric cardinality. Further origins
+// are reported as "overflow".
+const maxQueryOrigins = 512
+
+var (
+	queryOriginsMtx sync.Mutex
+	queryOrigins    = map[string]struct{}{}
+)
+
+func originLabel(origin string) string {
+	if origin == "" {
+		return "unknown"
+	}
+	queryOriginsMtx.Lock()
+	defer queryOriginsMtx.Unlock()
+	if _, ok := queryOrigins[origin]; ok {
+		return origin
+	}
+	if len(queryOrigins) >= maxQueryOrigins {
+		return "overflow"
+	}
+	queryOrigins[origin] = struct{}{}
+	return origin
+}
+
+// observeQueryOrigin records a finished query API request in the per-origin
+// attribution metrics. Meant to be deferred at the start of a handler.
+func observeQueryOrigin(r *http.Request, endpoint string, start time.Time) {
+	origin := originLabel(r.Header.Get(queryOriginHeader))
+	queryOriginQueries.WithLabelValues(origin, endpoint).Inc()
+	queryOriginDuration.WithLabelValues(origin, endpoint).Observe(time.Since(start).Seconds())
+}
+
 type apiError struct {
 	typ errorType
 	err error
@@ -118,6 +175,12 @@ type RulesRetriever interface {
 	AlertingRules() []*rules.AlertingRule
 }
 
+// SDStatusRetriever provides the current status of a set of service
+// discovery providers.
+type SDStatusRetriever interface {
+	ProviderStatuses() []discovery.ProviderStatus
+}
+
 // PrometheusVersion contains build information about Prometheus.
 type PrometheusVersion struct {
 	Version   string `json:"version"`
@@ -140,6 +203,7 @@ type RuntimeInfo struct {
 	GOGC                string    `json:"GOGC"`
 	GODEBUG             string    `json:"GODEBUG"`
 	StorageRetention    string    `json:"storageRetention"`
+	WALSize             int64     `json:"walSizeBytes"`
 }
 
 type response struct {
@@ -162,10 +226,13 @@ type apiFunc func(r *http.Request) apiFuncResult
 // TSDBAdminStats defines the tsdb interfaces used by the v1 API for admin operations as well as statistics.
 type TSDBAdminStats interface {
 	CleanTombstones() error
+	CompactHead() error
 	Delete(mint, maxt int64, ms ...*labels.Matcher) error
 	Snapshot(dir string, withHead bool) error
 
 	Stats(statsByLabelName string) (*tsdb.Stats, error)
+	WALReplayStatus() (tsdb.WALReplayStatus, error)
+	BlockMetas() ([]tsdb.BlockMeta, error)
 }
 
 // API can register a set of endpoints in a router and handle
@@ -177,6 +244,8 @@ type API struct {
 	targetRetriever       func(context.Context) TargetRetriever
 	alertmanagerRetriever func(context.Context) AlertmanagerRetriever
 	rulesRetriever        func(context.Context) RulesRetriever
+	sdScrape              SDStatusRetriever
+	sdNotify              SDStatusRetriever
 	now                   func() time.Time
 	config                func() config.Config
 	flagsMap              map[string]string
@@ -186,19 +255,29 @@ type API struct {
 	db                        TSDBAdminStats
 	dbDir                     string
 	enableAdmin               bool
+	managedRulesDir           string
+	reloadFunc                func() error
 	logger                    log.Logger
 	remoteReadSampleLimit     int
 	remoteReadMaxBytesInFrame int
+	maxSeriesPerQuery         int
+	rangeQuerySplitInterval   time.Duration
+	tenantLabel               string
+	tenantHeader              string
+	queryLimiter              *queryLimiter
 	remoteReadGate            *gate.Gate
 	CORSOrigin                *regexp.Regexp
 	buildInfo                 *PrometheusVersion
 	runtimeInfo               func() (RuntimeInfo, error)
 	gatherer                  prometheus.Gatherer
+
+	otlpWriteHandler   http.Handler
+	influxWriteHandler http.Handler
 }
 
 func init() {
 	jsoniter.RegisterTypeEncoderFunc("promql.Point", marshalPointJSON, marshalPointJSONIsEmpty)
-	prometheus.MustRegister(remoteReadQueries)
+	prometheus.MustRegister(remoteReadQueries, queryOriginQueries, queryOriginDuration)
 }
 
 // NewAPI returns an initialized API type.
@@ -219,12 +298,25 @@ func NewAPI(
 	remoteReadSampleLimit int,
 	remoteReadConcurrencyLimit int,
 	remoteReadMaxBytesInFrame int,
+	maxSeriesPerQuery int,
 	CORSOrigin *regexp.Regexp,
 	runtimeInfo func() (RuntimeInfo, error),
 	buildInfo *PrometheusVersion,
 	gatherer prometheus.Gatherer,
+	enableOTLPReceiver bool,
+	appendable storage.Appendable,
+	tenantLabel string,
+	tenantHeader string,
+	queryRateLimit float64,
+	queryMaxConcurrency int,
+	sdScrape SDStatusRetriever,
+	sdNotify SDStatusRetriever,
+	managedRulesDir string,
+	reloadFunc func() error,
+	enableInfluxReceiver bool,
+	rangeQuerySplitInterval time.Duration,
 ) *API {
-	return &API{
+	a := &API{
 		QueryEngine:           qe,
 		Queryable:             q,
 		targetRetriever:       tr,
@@ -238,16 +330,32 @@ func NewAPI(
 		db:                        db,
 		dbDir:                     dbDir,
 		enableAdmin:               enableAdmin,
+		managedRulesDir:           managedRulesDir,
+		reloadFunc:                reloadFunc,
 		rulesRetriever:            rr,
+		sdScrape:                  sdScrape,
+		sdNotify:                  sdNotify,
 		remoteReadSampleLimit:     remoteReadSampleLimit,
 		remoteReadGate:            gate.New(remoteReadConcurrencyLimit),
 		remoteReadMaxBytesInFrame: remoteReadMaxBytesInFrame,
+		maxSeriesPerQuery:         maxSeriesPerQuery,
+		rangeQuerySplitInterval:   rangeQuerySplitInterval,
+		tenantLabel:               tenantLabel,
+		tenantHeader:              tenantHeader,
+		queryLimiter:              newQueryLimiter(queryRateLimit, queryMaxConcurrency),
 		logger:                    logger,
 		CORSOrigin:                CORSOrigin,
 		runtimeInfo:               runtimeInfo,
 		buildInfo:                 buildInfo,
 		gatherer:                  gatherer,
 	}
+	if enableOTLPReceiver {
+		a.otlpWriteHandler = remote.NewOTLPWriteHandler(logger, appendable, configFunc, tenantLabel, tenantHeader)
+	}
+	if enableInfluxReceiver {
+		a.influxWriteHandler = remote.NewInfluxWriteHandler(logger, appendable, configFunc, tenantLabel, tenantHeader)
+	}
+	return a
 }
 
 func setUnavailStatusOnTSDBNotReady(r apiFuncResult) apiFuncResult {
@@ -288,6 +396,10 @@ func (api *API) Register(r *route.Router) {
 	r.Post("/query", wrap(api.query))
 	r.Get("/query_range", wrap(api.queryRange))
 	r.Post("/query_range", wrap(api.queryRange))
+	r.Get("/format_query", wrap(api.formatQuery))
+	r.Post("/format_query", wrap(api.formatQuery))
+	r.Get("/parse_query", wrap(api.parseQuery))
+	r.Post("/parse_query", wrap(api.parseQuery))
 
 	r.Get("/labels", wrap(api.labelNames))
 	r.Post("/labels", wrap(api.labelNames))
@@ -299,7 +411,9 @@ func (api *API) Register(r *route.Router) {
 
 	r.Get("/targets", wrap(api.targets))
 	r.Get("/targets/metadata", wrap(api.targetMetadata))
+	r.Get("/targets/relabel", wrap(api.targetRelabel))
 	r.Get("/alertmanagers", wrap(api.alertmanagers))
+	r.Get("/sd", wrap(api.serveSDStatus))
 
 	r.Get("/metadata", wrap(api.metricMetadata))
 
@@ -308,20 +422,37 @@ func (api *API) Register(r *route.Router) {
 	r.Get("/status/buildinfo", wrap(api.serveBuildInfo))
 	r.Get("/status/flags", wrap(api.serveFlags))
 	r.Get("/status/tsdb", wrap(api.serveTSDBStatus))
+	// The WAL replay status is served ungated so that progress can be
+	// followed while the server is still starting up.
+	r.Get("/status/walreplay", api.serveWALReplayStatus)
 	r.Post("/read", api.ready(http.HandlerFunc(api.remoteRead)))
+	r.Get("/export", api.ready(http.HandlerFunc(api.export)))
+	if api.otlpWriteHandler != nil {
+		r.Post("/otlp/v1/metrics", api.ready(api.otlpWriteHandler.ServeHTTP))
+	}
+	if api.influxWriteHandler != nil {
+		r.Post("/influx/write", api.ready(api.influxWriteHandler.ServeHTTP))
+	}
 
 	r.Get("/alerts", wrap(api.alerts))
 	r.Get("/rules", wrap(api.rules))
+	r.Post("/rules/preview", wrap(api.previewRule))
 
 	// Admin APIs
 	r.Post("/admin/tsdb/delete_series", wrap(api.deleteSeries))
 	r.Post("/admin/tsdb/clean_tombstones", wrap(api.cleanTombstones))
+	r.Post("/admin/tsdb/compact_head", wrap(api.compactHead))
 	r.Post("/admin/tsdb/snapshot", wrap(api.snapshot))
 
 	r.Put("/admin/tsdb/delete_series", wrap(api.deleteSeries))
 	r.Put("/admin/tsdb/clean_tombstones", wrap(api.cleanTombstones))
+	r.Put("/admin/tsdb/compact_head", wrap(api.compactHead))
 	r.Put("/admin/tsdb/snapshot", wrap(api.snapshot))
 
+	r.Get("/admin/rules", wrap(api.listManagedRuleFiles))
+	r.Put("/admin/rules/:name", wrap(api.setManagedRuleFile))
+	r.Del("/admin/rules/:name", wrap(api.deleteManagedRuleFile))
+
 }
 
 type queryData struct {
@@ -335,6 +466,14 @@ func (api *API) options(r *http.Request) apiFuncResult {
 }
 
 func (api *API) query(r *http.Request) (result apiFuncResult) {
+	defer observeQueryOrigin(r, "query", time.Now())
+
+	release, apiErr := api.admitQuery(r)
+	if apiErr != nil {
+		return apiFuncResult{nil, apiErr, nil, nil}
+	}
+	defer release()
+
 	ts, err := parseTimeParam(r, "time", api.now())
 	if err != nil {
 		return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
@@ -352,7 +491,16 @@ func (api *API) query(r *http.Request) (result apiFuncResult) {
 		defer cancel()
 	}
 
-	qry, err := api.QueryEngine.NewInstantQuery(api.Queryable, r.FormValue("query"), ts)
+	queryable, apiErr := api.limitedQueryable(r)
+	if apiErr != nil {
+		return apiFuncResult{nil, apiErr, nil, nil}
+	}
+
+	opts, err := extractQueryOpts(r)
+	if err != nil {
+		return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
+	}
+	qry, err := api.QueryEngine.NewInstantQuery(queryable, opts, r.FormValue("query"), ts)
 	if err != nil {
 		err = errors.Wrapf(err, "invalid parameter 'query'")
 		return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
@@ -386,7 +534,117 @@ func (api *API) query(r *http.Request) (result apiFuncResult) {
 	}, nil, res.Warnings, qry.Close}
 }
 
+// limitedQueryable returns the queryable to evaluate the given request
+// against, bounded by the per-step series limit. The server-wide limit set
+// with --query.max-series-per-step applies by default; a request may lower it
+// with the max_series parameter, but only admins may raise or disable it.
+func (api *API) limitedQueryable(r *http.Request) (storage.Queryable, *apiError) {
+	limit := api.maxSeriesPerQuery
+	if s := r.FormValue("max_series"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			return nil, &apiError{errorBadData, errors.Errorf("invalid parameter 'max_series': %q", s)}
+		}
+		if !api.enableAdmin && limit > 0 && (v == 0 || v > limit) {
+			return nil, &apiError{errorBadData, errors.Errorf("'max_series' may not exceed the server-wide limit of %d", limit)}
+		}
+		limit = v
+	}
+	q := storage.NewSeriesLimitQueryable(api.Queryable, limit)
+	if m := api.tenantMatcher(r); m != nil {
+		q = storage.NewTenantQueryable(q, m.Name, m.Value)
+	}
+	return q, nil
+}
+
+// tenantMatcher returns the matcher restricting the request to the tenant
+// named in the tenant header, or nil if tenancy is not configured or the
+// request does not carry the header. Requests without the header see all
+// tenants; restricting who may omit it is left to the proxy in front.
+func (api *API) tenantMatcher(r *http.Request) *labels.Matcher {
+	if api.tenantLabel == "" {
+		return nil
+	}
+	tenant := r.Header.Get(api.tenantHeader)
+	if tenant == "" {
+		return nil
+	}
+	return labels.MustNewMatcher(labels.MatchEqual, api.tenantLabel, tenant)
+}
+
+// restrictToTenant appends the request's tenant matcher to every matcher set.
+// If no sets were given, a set containing just the tenant matcher is
+// returned, so metadata endpoints only see series of the tenant.
+func (api *API) restrictToTenant(r *http.Request, matcherSets [][]*labels.Matcher) [][]*labels.Matcher {
+	m := api.tenantMatcher(r)
+	if m == nil {
+		return matcherSets
+	}
+	if len(matcherSets) == 0 {
+		return [][]*labels.Matcher{{m}}
+	}
+	for i := range matcherSets {
+		matcherSets[i] = append(matcherSets[i], m)
+	}
+	return matcherSets
+}
+
+// admitQuery enforces the per-client rate and concurrency limits on the
+// expression query endpoints, if configured. The returned release function
+// must be called once the query finished.
+func (api *API) admitQuery(r *http.Request) (func(), *apiError) {
+	if api.queryLimiter == nil {
+		return func() {}, nil
+	}
+	release, err := api.queryLimiter.admit(r)
+	if err != nil {
+		return nil, &apiError{errorLimited, err}
+	}
+	return release, nil
+}
+
+// extractQueryOpts retrieves the per-query tunables from the request, if any.
+func extractQueryOpts(r *http.Request) (*promql.QueryOpts, error) {
+	var opts *promql.QueryOpts
+	if ld := r.FormValue("lookback_delta"); ld != "" {
+		duration, err := parseDuration(ld)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid parameter 'lookback_delta'")
+		}
+		opts = &promql.QueryOpts{LookbackDelta: duration}
+	}
+	return opts, nil
+}
+
+func (api *API) formatQuery(r *http.Request) (result apiFuncResult) {
+	expr, err := parser.ParseExpr(r.FormValue("query"))
+	if err != nil {
+		err = errors.Wrapf(err, "invalid parameter 'query'")
+		return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
+	}
+
+	return apiFuncResult{expr.String(), nil, nil, nil}
+}
+
+func (api *API) parseQuery(r *http.Request) apiFuncResult {
+	expr, err := parser.ParseExpr(r.FormValue("query"))
+	if err != nil {
+		err = errors.Wrapf(err, "invalid parameter 'query'")
+		return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
+	}
+
+	return apiFuncResult{translateAST(expr), nil, nil, nil}
+}
+
 func (api *API) queryRange(r *http.Request) (result apiFuncResult) {
+	defer observeQueryOrigin(r, "query_range", time.Now())
+
+	release, apiErr := api.admitQuery(r)
+	if apiErr != nil {
+		return apiFuncResult{nil, apiErr, nil, nil}
+	}
+	defer release()
+
 	start, err := parseTime(r.FormValue("start"))
 	if err != nil {
 		err = errors.Wrapf(err, "invalid parameter 'start'")
@@ -433,7 +691,23 @@ func (api *API) queryRange(r *http.Request) (result apiFuncResult) {
 		defer cancel()
 	}
 
-	qry, err := api.QueryEngine.NewRangeQuery(api.Queryable, r.FormValue("query"), start, end, step)
+	queryable, apiErr := api.limitedQueryable(r)
+	if apiErr != nil {
+		return apiFuncResult{nil, apiErr, nil, nil}
+	}
+
+	opts, err := extractQueryOpts(r)
+	if err != nil {
+		return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
+	}
+
+	ctx = httputil.ContextFromRequest(ctx, r)
+
+	if api.rangeQuerySplitInterval > 0 && end.Sub(start) > api.rangeQuerySplitInterval {
+		return api.splitRangeQuery(ctx, r, queryable, opts, start, end, step)
+	}
+
+	qry, err := api.QueryEngine.NewRangeQuery(queryable, opts, r.FormValue("query"), start, end, step)
 	if err != nil {
 		return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
 	}
@@ -446,8 +720,6 @@ func (api *API) queryRange(r *http.Request) (result apiFuncResult) {
 		}
 	}()
 
-	ctx = httputil.ContextFromRequest(ctx, r)
-
 	res := qry.Exec(ctx)
 	if res.Err != nil {
 		return apiFuncResult{nil, returnAPIError(res.Err), res.Warnings, qry.Close}
@@ -466,6 +738,78 @@ func (api *API) queryRange(r *http.Request) (result apiFuncResult) {
 	}, nil, res.Warnings, qry.Close}
 }
 
+// splitRangeQuery evaluates a range query as a sequence of sub-range queries
+// of at most rangeQuerySplitInterval each and merges their results. Evaluating
+// the sub-ranges one after another bounds the amount of memory a very long
+// range query can hold at once.
+func (api *API) splitRangeQuery(ctx context.Context, r *http.Request, queryable storage.Queryable, opts *promql.QueryOpts, start, end time.Time, step time.Duration) apiFuncResult {
+	pointsPerChunk := int64(api.rangeQuerySplitInterval / step)
+	if pointsPerChunk < 1 {
+		pointsPerChunk = 1
+	}
+
+	var (
+		warnings storage.Warnings
+		closers  []func()
+		qs       *stats.QueryStats
+		merged   = promql.Matrix{}
+		index    = map[string]int{}
+	)
+	finalizer := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+
+	for t := start; !t.After(end); t = t.Add(time.Duration(pointsPerChunk) * step) {
+		subEnd := t.Add(time.Duration(pointsPerChunk-1) * step)
+		if subEnd.After(end) {
+			subEnd = end
+		}
+
+		qry, err := api.QueryEngine.NewRangeQuery(queryable, opts, r.FormValue("query"), t, subEnd, step)
+		if err != nil {
+			finalizer()
+			return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
+		}
+		closers = append(closers, qry.Close)
+
+		res := qry.Exec(ctx)
+		if res.Err != nil {
+			return apiFuncResult{nil, returnAPIError(res.Err), append(warnings, res.Warnings...), finalizer}
+		}
+		warnings = append(warnings, res.Warnings...)
+
+		// Range queries always evaluate to a matrix.
+		mat, ok := res.Value.(promql.Matrix)
+		if !ok {
+			return apiFuncResult{nil, &apiError{errorInternal, errors.Errorf("unexpected result type %q for range query", res.Value.Type())}, warnings, finalizer}
+		}
+		for _, s := range mat {
+			key := s.Metric.String()
+			if i, ok := index[key]; ok {
+				merged[i].Points = append(merged[i].Points, s.Points...)
+			} else {
+				index[key] = len(merged)
+				merged = append(merged, s)
+			}
+		}
+
+		// Optional stats field in response if parameter "stats" is not empty.
+		// Only the stats of the last sub-query are reported.
+		if r.FormValue("stats") != "" {
+			qs = stats.NewQueryStats(qry.Stats())
+		}
+	}
+	sort.Sort(merged)
+
+	return apiFuncResult{&queryData{
+		ResultType: merged.Type(),
+		Result:     merged,
+		Stats:      qs,
+	}, nil, warnings, finalizer}
+}
+
 func returnAPIError(err error) *apiError {
 	if err == nil {
 		return nil
@@ -484,6 +828,9 @@ func returnAPIError(err error) *apiError {
 }
 
 func (api *API) labelNames(r *http.Request) apiFuncResult {
+	if err := r.ParseForm(); err != nil {
+		return apiFuncResult{nil, &apiError{errorBadData, errors.Wrapf(err, "error parsing form values")}, nil, nil}
+	}
 	start, err := parseTimeParam(r, "start", minTime)
 	if err != nil {
 		return apiFuncResult{nil, &apiError{errorBadData, errors.Wrap(err, "invalid parameter 'start'")}, nil, nil}
@@ -493,16 +840,57 @@ func (api *API) labelNames(r *http.Request) apiFuncResult {
 		return apiFuncResult{nil, &apiError{errorBadData, errors.Wrap(err, "invalid parameter 'end'")}, nil, nil}
 	}
 
+	matcherSets, err := parseMatchersParam(r.Form["match[]"])
+	if err != nil {
+		return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
+	}
+	matcherSets = api.restrictToTenant(r, matcherSets)
+
 	q, err := api.Queryable.Querier(r.Context(), timestamp.FromTime(start), timestamp.FromTime(end))
 	if err != nil {
 		return apiFuncResult{nil, &apiError{errorExec, err}, nil, nil}
 	}
 	defer q.Close()
 
-	names, warnings, err := q.LabelNames()
-	if err != nil {
-		return apiFuncResult{nil, &apiError{errorExec, err}, warnings, nil}
+	var (
+		names    []string
+		warnings storage.Warnings
+	)
+	if len(matcherSets) > 0 {
+		hints := &storage.SelectHints{
+			Start: timestamp.FromTime(start),
+			End:   timestamp.FromTime(end),
+			Func:  "series", // There is no series function, this token is used for lookups that don't need samples.
+		}
+
+		labelNamesSet := make(map[string]struct{})
+		// Get all series which match matchers. The series are resolved from
+		// the index only, no chunk data is touched.
+		for _, mset := range matcherSets {
+			s := q.Select(false, hints, mset...)
+			for s.Next() {
+				for _, lb := range s.At().Labels() {
+					labelNamesSet[lb.Name] = struct{}{}
+				}
+			}
+			warnings = append(warnings, s.Warnings()...)
+			if err := s.Err(); err != nil {
+				return apiFuncResult{nil, &apiError{errorExec, err}, warnings, nil}
+			}
+		}
+
+		names = make([]string, 0, len(labelNamesSet))
+		for key := range labelNamesSet {
+			names = append(names, key)
+		}
+		sort.Strings(names)
+	} else {
+		names, warnings, err = q.LabelNames()
+		if err != nil {
+			return apiFuncResult{nil, &apiError{errorExec, err}, warnings, nil}
+		}
 	}
+
 	if names == nil {
 		names = []string{}
 	}
@@ -517,6 +905,10 @@ func (api *API) labelValues(r *http.Request) (result apiFuncResult) {
 		return apiFuncResult{nil, &apiError{errorBadData, errors.Errorf("invalid label name: %q", name)}, nil, nil}
 	}
 
+	if err := r.ParseForm(); err != nil {
+		return apiFuncResult{nil, &apiError{errorBadData, errors.Wrapf(err, "error parsing form values")}, nil, nil}
+	}
+
 	start, err := parseTimeParam(r, "start", minTime)
 	if err != nil {
 		return apiFuncResult{nil, &apiError{errorBadData, errors.Wrap(err, "invalid parameter 'start'")}, nil, nil}
@@ -526,6 +918,12 @@ func (api *API) labelValues(r *http.Request) (result apiFuncResult) {
 		return apiFuncResult{nil, &apiError{errorBadData, errors.Wrap(err, "invalid parameter 'end'")}, nil, nil}
 	}
 
+	matcherSets, err := parseMatchersParam(r.Form["match[]"])
+	if err != nil {
+		return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
+	}
+	matcherSets = api.restrictToTenant(r, matcherSets)
+
 	q, err := api.Queryable.Querier(r.Context(), timestamp.FromTime(start), timestamp.FromTime(end))
 	if err != nil {
 		return apiFuncResult{nil, &apiError{errorExec, err}, nil, nil}
@@ -542,10 +940,45 @@ func (api *API) labelValues(r *http.Request) (result apiFuncResult) {
 		q.Close()
 	}
 
-	vals, warnings, err := q.LabelValues(name)
-	if err != nil {
-		return apiFuncResult{nil, &apiError{errorExec, err}, warnings, closer}
+	var (
+		vals     []string
+		warnings storage.Warnings
+	)
+	if len(matcherSets) > 0 {
+		hints := &storage.SelectHints{
+			Start: timestamp.FromTime(start),
+			End:   timestamp.FromTime(end),
+			Func:  "series", // There is no series function, this token is used for lookups that don't need samples.
+		}
+
+		labelValuesSet := make(map[string]struct{})
+		// Get all series which match matchers. The series are resolved from
+		// the index only, no chunk data is touched.
+		for _, mset := range matcherSets {
+			s := q.Select(false, hints, mset...)
+			for s.Next() {
+				if v := s.At().Labels().Get(name); v != "" {
+					labelValuesSet[v] = struct{}{}
+				}
+			}
+			warnings = append(warnings, s.Warnings()...)
+			if err := s.Err(); err != nil {
+				return apiFuncResult{nil, &apiError{errorExec, err}, warnings, closer}
+			}
+		}
+
+		vals = make([]string, 0, len(labelValuesSet))
+		for val := range labelValuesSet {
+			vals = append(vals, val)
+		}
+		sort.Strings(vals)
+	} else {
+		vals, warnings, err = q.LabelValues(name)
+		if err != nil {
+			return apiFuncResult{nil, &apiError{errorExec, err}, warnings, closer}
+		}
 	}
+
 	if vals == nil {
 		vals = []string{}
 	}
@@ -578,14 +1011,11 @@ func (api *API) series(r *http.Request) (result apiFuncResult) {
 		return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
 	}
 
-	var matcherSets [][]*labels.Matcher
-	for _, s := range r.Form["match[]"] {
-		matchers, err := parser.ParseMetricSelector(s)
-		if err != nil {
-			return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
-		}
-		matcherSets = append(matcherSets, matchers)
+	matcherSets, err := parseMatchersParam(r.Form["match[]"])
+	if err != nil {
+		return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
 	}
+	matcherSets = api.restrictToTenant(r, matcherSets)
 
 	q, err := api.Queryable.Querier(r.Context(), timestamp.FromTime(start), timestamp.FromTime(end))
 	if err != nil {
@@ -645,10 +1075,24 @@ type Target struct {
 	ScrapeURL  string `json:"scrapeUrl"`
 	GlobalURL  string `json:"globalUrl"`
 
-	LastError          string              `json:"lastError"`
+	LastError string `json:"lastError"`
+	// LastErrorReason is a coarse categorization of LastError (e.g. "dns",
+	// "timeout", "http_5xx") suitable for fleet-wide aggregation.
+	LastErrorReason    string              `json:"lastErrorReason"`
 	LastScrape         time.Time           `json:"lastScrape"`
 	LastScrapeDuration float64             `json:"lastScrapeDuration"`
 	Health             scrape.TargetHealth `json:"health"`
+
+	// ScrapeHistory holds the outcomes of the most recent scrapes, oldest
+	// first. It is only populated when requested with include_history=true.
+	ScrapeHistory []ScrapeHistoryEntry `json:"scrapeHistory,omitempty"`
+}
+
+// ScrapeHistoryEntry is the outcome of a single past scrape of a target.
+type ScrapeHistoryEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Duration  float64   `json:"duration"`
+	Error     string    `json:"error,omitempty"`
 }
 
 // DroppedTarget has the information for one target that was dropped during relabelling.
@@ -735,6 +1179,39 @@ func (api *API) targets(r *http.Request) apiFuncResult {
 	state := strings.ToLower(r.URL.Query().Get("state"))
 	showActive := state == "" || state == "any" || state == "active"
 	showDropped := state == "" || state == "any" || state == "dropped"
+
+	scrapePool := r.URL.Query().Get("scrapePool")
+	health := strings.ToLower(r.URL.Query().Get("health"))
+	includeHistory := r.URL.Query().Get("include_history") == "true"
+
+	var matcherSets [][]*labels.Matcher
+	for _, s := range r.URL.Query()["match[]"] {
+		matchers, err := parser.ParseMetricSelector(s)
+		if err != nil {
+			return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
+		}
+		matcherSets = append(matcherSets, matchers)
+	}
+
+	matches := func(lbls labels.Labels) bool {
+		if len(matcherSets) == 0 {
+			return true
+		}
+		for _, matchers := range matcherSets {
+			ok := true
+			for _, m := range matchers {
+				if !m.Matches(lbls.Get(m.Name)) {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				return true
+			}
+		}
+		return false
+	}
+
 	res := &TargetDiscovery{}
 
 	if showActive {
@@ -743,7 +1220,16 @@ func (api *API) targets(r *http.Request) apiFuncResult {
 		res.ActiveTargets = make([]*Target, 0, numTargets)
 
 		for _, key := range activeKeys {
+			if scrapePool != "" && key != scrapePool {
+				continue
+			}
 			for _, target := range targetsActive[key] {
+				if health != "" && health != strings.ToLower(string(target.Health())) {
+					continue
+				}
+				if !matches(target.Labels()) {
+					continue
+				}
 				lastErrStr := ""
 				lastErr := target.LastError()
 				if lastErr != nil {
@@ -752,6 +1238,22 @@ func (api *API) targets(r *http.Request) apiFuncResult {
 
 				globalURL, err := getGlobalURL(target.URL(), api.globalURLOptions)
 
+				var history []ScrapeHistoryEntry
+				if includeHistory {
+					outcomes := target.ScrapeHistory()
+					history = make([]ScrapeHistoryEntry, 0, len(outcomes))
+					for _, o := range outcomes {
+						entry := ScrapeHistoryEntry{
+							Timestamp: o.Start,
+							Duration:  o.Duration.Seconds(),
+						}
+						if o.Err != nil {
+							entry.Error = o.Err.Error()
+						}
+						history = append(history, entry)
+					}
+				}
+
 				res.ActiveTargets = append(res.ActiveTargets, &Target{
 					DiscoveredLabels: target.DiscoveredLabels().Map(),
 					Labels:           target.Labels().Map(),
@@ -766,9 +1268,11 @@ func (api *API) targets(r *http.Request) apiFuncResult {
 						}
 						return lastErrStr
 					}(),
+					LastErrorReason:    scrape.ErrorReason(lastErr),
 					LastScrape:         target.LastScrape(),
 					LastScrapeDuration: target.LastScrapeDuration().Seconds(),
 					Health:             target.Health(),
+					ScrapeHistory:      history,
 				})
 			}
 		}
@@ -779,6 +1283,9 @@ func (api *API) targets(r *http.Request) apiFuncResult {
 		tDropped := flatten(api.targetRetriever(r.Context()).TargetsDropped())
 		res.DroppedTargets = make([]*DroppedTarget, 0, len(tDropped))
 		for _, t := range tDropped {
+			if scrapePool != "" && t.DiscoveredLabels().Get(model.JobLabel) != scrapePool {
+				continue
+			}
 			res.DroppedTargets = append(res.DroppedTargets, &DroppedTarget{
 				DiscoveredLabels: t.DiscoveredLabels().Map(),
 			})
@@ -786,9 +1293,51 @@ func (api *API) targets(r *http.Request) apiFuncResult {
 	} else {
 		res.DroppedTargets = []*DroppedTarget{}
 	}
+
+	if err := paginateTargets(res, r); err != nil {
+		return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
+	}
 	return apiFuncResult{res, nil, nil, nil}
 }
 
+// paginateTargets applies the optional limit and page query parameters to the
+// active and dropped target lists. Page numbering starts at 1.
+func paginateTargets(res *TargetDiscovery, r *http.Request) error {
+	limitStr := r.URL.Query().Get("limit")
+	if limitStr == "" {
+		return nil
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 {
+		return errors.Errorf("limit must be a positive number: %q", limitStr)
+	}
+	page := 1
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		page, err = strconv.Atoi(pageStr)
+		if err != nil || page <= 0 {
+			return errors.Errorf("page must be a positive number: %q", pageStr)
+		}
+	}
+
+	paged := func(n int) (int, int) {
+		start := (page - 1) * limit
+		if start > n {
+			start = n
+		}
+		end := start + limit
+		if end > n {
+			end = n
+		}
+		return start, end
+	}
+
+	start, end := paged(len(res.ActiveTargets))
+	res.ActiveTargets = res.ActiveTargets[start:end]
+	start, end = paged(len(res.DroppedTargets))
+	res.DroppedTargets = res.DroppedTargets[start:end]
+	return nil
+}
+
 func matchLabels(lset labels.Labels, matchers []*labels.Matcher) bool {
 	for _, m := range matchers {
 		if !m.Matches(lset.Get(m.Name)) {
@@ -868,6 +1417,99 @@ type metricMetadata struct {
 	Unit   string               `json:"unit"`
 }
 
+// TargetRelabelDebug explains how the labels of one target were derived from
+// its discovered labels.
+type TargetRelabelDebug struct {
+	ScrapePool       string            `json:"scrapePool"`
+	DiscoveredLabels map[string]string `json:"discoveredLabels"`
+	// Steps holds the relabel rules of the scrape config in order, each with
+	// the label set it produced. After a rule drops the target no further
+	// rules are evaluated.
+	Steps []RelabelStep `json:"steps"`
+	// Labels are the final labels of the target, absent if it was dropped.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Dropped is true if the target was dropped during relabelling.
+	Dropped bool `json:"dropped"`
+}
+
+// RelabelStep is the outcome of applying a single relabel rule.
+type RelabelStep struct {
+	// Rule is the relabel configuration rendered as YAML.
+	Rule string `json:"rule"`
+	// Labels is the label set after applying the rule, absent if it dropped
+	// the target.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Dropped is true if this rule dropped the target.
+	Dropped bool `json:"dropped,omitempty"`
+}
+
+// targetRelabel answers which relabel rules were applied to the target with
+// the given address and what each of them did, serving as a server-side
+// relabel debugger.
+func (api *API) targetRelabel(r *http.Request) apiFuncResult {
+	address := r.FormValue("address")
+	if address == "" {
+		return apiFuncResult{nil, &apiError{errorBadData, errors.New("no address parameter provided")}, nil, nil}
+	}
+
+	scrapeConfigs := make(map[string]*config.ScrapeConfig)
+	for _, scfg := range api.config().ScrapeConfigs {
+		scrapeConfigs[scfg.JobName] = scfg
+	}
+
+	res := []*TargetRelabelDebug{}
+	tr := api.targetRetriever(r.Context())
+	for pool, targets := range tr.TargetsActive() {
+		for _, t := range targets {
+			if t.DiscoveredLabels().Get(model.AddressLabel) != address && t.Labels().Get(model.InstanceLabel) != address {
+				continue
+			}
+			res = append(res, relabelDebug(pool, t, scrapeConfigs[pool]))
+		}
+	}
+	for pool, targets := range tr.TargetsDropped() {
+		for _, t := range targets {
+			if t.DiscoveredLabels().Get(model.AddressLabel) != address {
+				continue
+			}
+			res = append(res, relabelDebug(pool, t, scrapeConfigs[pool]))
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ScrapePool < res[j].ScrapePool })
+	return apiFuncResult{res, nil, nil, nil}
+}
+
+func relabelDebug(pool string, t *scrape.Target, cfg *config.ScrapeConfig) *TargetRelabelDebug {
+	d := &TargetRelabelDebug{
+		ScrapePool:       pool,
+		DiscoveredLabels: t.DiscoveredLabels().Map(),
+		Steps:            []RelabelStep{},
+		Dropped:          len(t.Labels()) == 0,
+	}
+	if !d.Dropped {
+		d.Labels = t.Labels().Map()
+	}
+	if cfg == nil {
+		// The pool is gone from the configuration, e.g. because it changed
+		// between discovery and this request. The steps cannot be replayed.
+		return d
+	}
+	lset := t.DiscoveredLabels()
+	for _, rc := range cfg.RelabelConfigs {
+		rule, _ := yaml.Marshal(rc)
+		step := RelabelStep{Rule: strings.TrimSpace(string(rule))}
+		lset = relabel.Process(lset, rc)
+		if lset == nil {
+			step.Dropped = true
+			d.Steps = append(d.Steps, step)
+			break
+		}
+		step.Labels = lset.Map()
+		d.Steps = append(d.Steps, step)
+	}
+	return d
+}
+
 // AlertmanagerDiscovery has all the active Alertmanagers.
 type AlertmanagerDiscovery struct {
 	ActiveAlertmanagers  []*AlertmanagerTarget `json:"activeAlertmanagers"`
@@ -892,6 +1534,56 @@ func (api *API) alertmanagers(r *http.Request) apiFuncResult {
 	return apiFuncResult{ams, nil, nil, nil}
 }
 
+// SDDiscovery groups the SD provider statuses by the discovery manager they
+// belong to.
+type SDDiscovery struct {
+	Scrape []SDProviderStatus `json:"scrape"`
+	Notify []SDProviderStatus `json:"notify"`
+}
+
+// SDProviderStatus has the status of one SD provider.
+type SDProviderStatus struct {
+	Name    string   `json:"name"`
+	Configs []string `json:"configs"`
+	Targets int      `json:"targets"`
+	// The refresh fields are only set for providers that poll their source
+	// periodically, and only once their first refresh has completed.
+	LastRefresh         *time.Time `json:"lastRefresh,omitempty"`
+	LastRefreshDuration float64    `json:"lastRefreshDuration,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+}
+
+func (api *API) serveSDStatus(r *http.Request) apiFuncResult {
+	return apiFuncResult{&SDDiscovery{
+		Scrape: sdProviderStatuses(api.sdScrape),
+		Notify: sdProviderStatuses(api.sdNotify),
+	}, nil, nil, nil}
+}
+
+func sdProviderStatuses(sd SDStatusRetriever) []SDProviderStatus {
+	res := []SDProviderStatus{}
+	if sd == nil {
+		return res
+	}
+	for _, p := range sd.ProviderStatuses() {
+		s := SDProviderStatus{
+			Name:    p.Name,
+			Configs: p.Configs,
+			Targets: p.Targets,
+		}
+		if p.Refresh != nil && !p.Refresh.LastRefresh.IsZero() {
+			lastRefresh := p.Refresh.LastRefresh
+			s.LastRefresh = &lastRefresh
+			s.LastRefreshDuration = p.Refresh.LastDuration.Seconds()
+			if p.Refresh.LastError != nil {
+				s.LastError = p.Refresh.LastError.Error()
+			}
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
 // AlertDiscovery has info for all active alerts.
 type AlertDiscovery struct {
 	Alerts []*Alert `json:"alerts"`
@@ -899,11 +1591,12 @@ type AlertDiscovery struct {
 
 // Alert has info for an alert.
 type Alert struct {
-	Labels      labels.Labels `json:"labels"`
-	Annotations labels.Labels `json:"annotations"`
-	State       string        `json:"state"`
-	ActiveAt    *time.Time    `json:"activeAt,omitempty"`
-	Value       string        `json:"value"`
+	Labels          labels.Labels `json:"labels"`
+	Annotations     labels.Labels `json:"annotations"`
+	State           string        `json:"state"`
+	ActiveAt        *time.Time    `json:"activeAt,omitempty"`
+	KeepFiringSince *time.Time    `json:"keepFiringSince,omitempty"`
+	Value           string        `json:"value"`
 }
 
 func (api *API) alerts(r *http.Request) apiFuncResult {
@@ -932,6 +1625,9 @@ func rulesAlertsToAPIAlerts(rulesAlerts []*rules.Alert) []*Alert {
 			ActiveAt:    &ruleAlert.ActiveAt,
 			Value:       strconv.FormatFloat(ruleAlert.Value, 'e', -1, 64),
 		}
+		if !ruleAlert.KeepFiringSince.IsZero() {
+			apiAlerts[i].KeepFiringSince = &ruleAlert.KeepFiringSince
+		}
 	}
 
 	return apiAlerts
@@ -1029,7 +1725,9 @@ type alertingRule struct {
 	State          string           `json:"state"`
 	Name           string           `json:"name"`
 	Query          string           `json:"query"`
+	ClearQuery     string           `json:"clearQuery,omitempty"`
 	Duration       float64          `json:"duration"`
+	KeepFiringFor  float64          `json:"keepFiringFor"`
 	Labels         labels.Labels    `json:"labels"`
 	Annotations    labels.Labels    `json:"annotations"`
 	Alerts         []*Alert         `json:"alerts"`
@@ -1087,11 +1785,17 @@ func (api *API) rules(r *http.Request) apiFuncResult {
 				if !returnAlerts {
 					break
 				}
+				clearQuery := ""
+				if ce := rule.ClearExpr(); ce != nil {
+					clearQuery = ce.String()
+				}
 				enrichedRule = alertingRule{
 					State:          rule.State().String(),
 					Name:           rule.Name(),
 					Query:          rule.Query().String(),
+					ClearQuery:     clearQuery,
 					Duration:       rule.HoldDuration().Seconds(),
+					KeepFiringFor:  rule.KeepFiringFor().Seconds(),
 					Labels:         rule.Labels(),
 					Annotations:    rule.Annotations(),
 					Alerts:         rulesAlertsToAPIAlerts(rule.ActiveAlerts()),
@@ -1128,6 +1832,83 @@ func (api *API) rules(r *http.Request) apiFuncResult {
 	return apiFuncResult{res, nil, nil, nil}
 }
 
+// RulePreview is the result of a single ad-hoc evaluation of a rule
+// definition. Nothing is persisted; for alerting rules the would-be
+// active alerts are included.
+type RulePreview struct {
+	Series promql.Vector `json:"series"`
+	Alerts []*Alert      `json:"alerts,omitempty"`
+}
+
+func (api *API) previewRule(r *http.Request) apiFuncResult {
+	if err := r.ParseForm(); err != nil {
+		return apiFuncResult{nil, &apiError{errorBadData, errors.Wrapf(err, "error parsing form values")}, nil, nil}
+	}
+
+	ts, err := parseTimeParam(r, "time", api.now())
+	if err != nil {
+		return apiFuncResult{nil, &apiError{errorBadData, errors.Wrapf(err, "invalid parameter 'time'")}, nil, nil}
+	}
+
+	ruleStr := r.FormValue("rule")
+	if ruleStr == "" {
+		return apiFuncResult{nil, &apiError{errorBadData, errors.New("parameter 'rule' is required")}, nil, nil}
+	}
+
+	var rn rulefmt.RuleNode
+	if err := yaml.Unmarshal([]byte(ruleStr), &rn); err != nil {
+		return apiFuncResult{nil, &apiError{errorBadData, errors.Wrap(err, "invalid parameter 'rule'")}, nil, nil}
+	}
+	if errs := rn.Validate(); len(errs) > 0 {
+		return apiFuncResult{nil, &apiError{errorBadData, errors.Wrap(&errs[0], "invalid parameter 'rule'")}, nil, nil}
+	}
+
+	expr, err := parser.ParseExpr(rn.Expr.Value)
+	if err != nil {
+		return apiFuncResult{nil, &apiError{errorBadData, errors.Wrap(err, "invalid parameter 'rule'")}, nil, nil}
+	}
+
+	query := rules.EngineQueryFunc(api.QueryEngine, api.Queryable)
+
+	res := &RulePreview{}
+	if rn.Alert.Value != "" {
+		rule := rules.NewAlertingRule(
+			rn.Alert.Value,
+			expr,
+			time.Duration(rn.For),
+			time.Duration(rn.KeepFiringFor),
+			labels.FromMap(rn.Labels),
+			labels.FromMap(rn.Annotations),
+			nil,
+			true,
+			log.With(api.logger, "alert", rn.Alert.Value),
+		)
+		if rn.ClearExpr.Value != "" {
+			clearExpr, err := parser.ParseExpr(rn.ClearExpr.Value)
+			if err != nil {
+				return apiFuncResult{nil, &apiError{errorBadData, errors.Wrap(err, "invalid parameter 'rule'")}, nil, nil}
+			}
+			rule.SetClearExpr(clearExpr)
+		}
+		externalURL := &url.URL{Scheme: api.globalURLOptions.Scheme, Host: api.globalURLOptions.Host}
+		vec, err := rule.Eval(r.Context(), ts, query, externalURL)
+		if err != nil {
+			return apiFuncResult{nil, returnAPIError(err), nil, nil}
+		}
+		res.Series = vec
+		res.Alerts = rulesAlertsToAPIAlerts(rule.ActiveAlerts())
+	} else {
+		rule := rules.NewRecordingRule(rn.Record.Value, expr, labels.FromMap(rn.Labels))
+		vec, err := rule.Eval(r.Context(), ts, query, nil)
+		if err != nil {
+			return apiFuncResult{nil, returnAPIError(err), nil, nil}
+		}
+		res.Series = vec
+	}
+
+	return apiFuncResult{res, nil, nil, nil}
+}
+
 type prometheusConfig struct {
 	YAML string `json:"yaml"`
 }
@@ -1171,11 +1952,12 @@ type HeadStats struct {
 
 // tsdbStatus has information of cardinality statistics from postings.
 type tsdbStatus struct {
-	HeadStats                   HeadStats `json:"headStats"`
-	SeriesCountByMetricName     []stat    `json:"seriesCountByMetricName"`
-	LabelValueCountByLabelName  []stat    `json:"labelValueCountByLabelName"`
-	MemoryInBytesByLabelName    []stat    `json:"memoryInBytesByLabelName"`
-	SeriesCountByLabelValuePair []stat    `json:"seriesCountByLabelValuePair"`
+	HeadStats                   HeadStats        `json:"headStats"`
+	SeriesCountByMetricName     []stat           `json:"seriesCountByMetricName"`
+	LabelValueCountByLabelName  []stat           `json:"labelValueCountByLabelName"`
+	MemoryInBytesByLabelName    []stat           `json:"memoryInBytesByLabelName"`
+	SeriesCountByLabelValuePair []stat           `json:"seriesCountByLabelValuePair"`
+	Blocks                      []tsdb.BlockMeta `json:"blocks"`
 }
 
 func convertStats(stats []index.Stat) []stat {
@@ -1187,6 +1969,27 @@ func convertStats(stats []index.Stat) []stat {
 	return result
 }
 
+// walReplayStatus is the response format of /api/v1/status/walreplay.
+type walReplayStatus struct {
+	Min     int `json:"min"`
+	Max     int `json:"max"`
+	Current int `json:"current"`
+}
+
+func (api *API) serveWALReplayStatus(w http.ResponseWriter, r *http.Request) {
+	httputil.SetCORS(w, api.CORSOrigin, r)
+	status, err := api.db.WALReplayStatus()
+	if err != nil {
+		api.respondError(w, &apiError{errorInternal, err}, nil)
+		return
+	}
+	api.respond(w, walReplayStatus{
+		Min:     status.Min,
+		Max:     status.Max,
+		Current: status.Current,
+	}, nil)
+}
+
 func (api *API) serveTSDBStatus(*http.Request) apiFuncResult {
 	s, err := api.db.Stats("__name__")
 	if err != nil {
@@ -1206,6 +2009,10 @@ func (api *API) serveTSDBStatus(*http.Request) apiFuncResult {
 			}
 		}
 	}
+	blocks, err := api.db.BlockMetas()
+	if err != nil {
+		return apiFuncResult{nil, &apiError{errorInternal, err}, nil, nil}
+	}
 	return apiFuncResult{tsdbStatus{
 		HeadStats: HeadStats{
 			NumSeries:  s.NumSeries,
@@ -1217,6 +2024,7 @@ func (api *API) serveTSDBStatus(*http.Request) apiFuncResult {
 		LabelValueCountByLabelName:  convertStats(s.IndexPostingStats.CardinalityLabelStats),
 		MemoryInBytesByLabelName:    convertStats(s.IndexPostingStats.LabelValueStats),
 		SeriesCountByLabelValuePair: convertStats(s.IndexPostingStats.LabelValuePairsStats),
+		Blocks:                      blocks,
 	}, nil, nil, nil}
 }
 
@@ -1428,7 +2236,44 @@ func filterExtLabelsFromMatchers(pbMatchers []*prompb.LabelMatcher, externalLabe
 	return filteredMatchers, nil
 }
 
-func (api *API) deleteSeries(r *http.Request) apiFuncResult {
+// AuditLog writes a structured audit entry for an admin or lifecycle API
+// call, recording who called what from where and whether it succeeded.
+func AuditLog(logger log.Logger, r *http.Request, action string, err error, details ...interface{}) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	user, _, _ := r.BasicAuth()
+	kv := []interface{}{
+		"msg", "Audit log",
+		"action", action,
+		"remote_addr", r.RemoteAddr,
+		"user", user,
+	}
+	kv = append(kv, details...)
+	if err != nil {
+		kv = append(kv, "result", "error", "err", err)
+		level.Warn(logger).Log(kv...)
+		return
+	}
+	kv = append(kv, "result", "success")
+	level.Info(logger).Log(kv...)
+}
+
+// audit records the outcome of an admin API call in the audit log.
+func (api *API) audit(r *http.Request, action string, res apiFuncResult, details ...interface{}) {
+	var err error
+	if res.err != nil {
+		err = res.err.err
+	}
+	AuditLog(api.logger, r, action, err, details...)
+}
+
+func (api *API) deleteSeries(r *http.Request) (res apiFuncResult) {
+	defer func() {
+		api.audit(r, "delete_series", res,
+			"match", fmt.Sprintf("%v", r.Form["match[]"]), "start", r.FormValue("start"), "end", r.FormValue("end"))
+	}()
+
 	if !api.enableAdmin {
 		return apiFuncResult{nil, &apiError{errorUnavailable, errors.New("admin APIs disabled")}, nil, nil}
 	}
@@ -1461,7 +2306,9 @@ func (api *API) deleteSeries(r *http.Request) apiFuncResult {
 	return apiFuncResult{nil, nil, nil, nil}
 }
 
-func (api *API) snapshot(r *http.Request) apiFuncResult {
+func (api *API) snapshot(r *http.Request) (res apiFuncResult) {
+	defer func() { api.audit(r, "snapshot", res, "skip_head", r.FormValue("skip_head")) }()
+
 	if !api.enableAdmin {
 		return apiFuncResult{nil, &apiError{errorUnavailable, errors.New("admin APIs disabled")}, nil, nil}
 	}
@@ -1495,7 +2342,9 @@ func (api *API) snapshot(r *http.Request) apiFuncResult {
 	}{name}, nil, nil, nil}
 }
 
-func (api *API) cleanTombstones(r *http.Request) apiFuncResult {
+func (api *API) cleanTombstones(r *http.Request) (res apiFuncResult) {
+	defer func() { api.audit(r, "clean_tombstones", res) }()
+
 	if !api.enableAdmin {
 		return apiFuncResult{nil, &apiError{errorUnavailable, errors.New("admin APIs disabled")}, nil, nil}
 	}
@@ -1506,6 +2355,21 @@ func (api *API) cleanTombstones(r *http.Request) apiFuncResult {
 	return apiFuncResult{nil, nil, nil, nil}
 }
 
+// compactHead persists the current head block to disk immediately, e.g. so
+// all ingested data is in an uploadable block before a planned shutdown.
+func (api *API) compactHead(r *http.Request) (res apiFuncResult) {
+	defer func() { api.audit(r, "compact_head", res) }()
+
+	if !api.enableAdmin {
+		return apiFuncResult{nil, &apiError{errorUnavailable, errors.New("admin APIs disabled")}, nil, nil}
+	}
+	if err := api.db.CompactHead(); err != nil {
+		return apiFuncResult{nil, &apiError{errorInternal, errors.Wrap(err, "compact head")}, nil, nil}
+	}
+
+	return apiFuncResult{nil, nil, nil, nil}
+}
+
 func (api *API) respond(w http.ResponseWriter, data interface{}, warnings storage.Warnings) {
 	statusMessage := statusSuccess
 	var warningStrings []string
@@ -1558,6 +2422,8 @@ func (api *API) respondError(w http.ResponseWriter, apiErr *apiError, data inter
 		code = http.StatusInternalServerError
 	case errorNotFound:
 		code = http.StatusNotFound
+	case errorLimited:
+		code = http.StatusTooManyRequests
 	default:
 		code = http.StatusInternalServerError
 	}
@@ -1569,6 +2435,28 @@ func (api *API) respondError(w http.ResponseWriter, apiErr *apiError, data inter
 	}
 }
 
+func parseMatchersParam(matchers []string) ([][]*labels.Matcher, error) {
+	var matcherSets [][]*labels.Matcher
+	for _, s := range matchers {
+		matchers, err := parser.ParseMetricSelector(s)
+		if err != nil {
+			return nil, err
+		}
+		matcherSets = append(matcherSets, matchers)
+	}
+
+OUTER:
+	for _, ms := range matcherSets {
+		for _, lm := range ms {
+			if lm != nil && !lm.Matches("") {
+				continue OUTER
+			}
+		}
+		return nil, errors.New("match[] must contain at least one non-empty matcher")
+	}
+	return matcherSets, nil
+}
+
 func parseTimeParam(r *http.Request, paramName string, defaultValue time.Time) (time.Time, error) {
 	val := r.FormValue(paramName)
 	if val == "" {
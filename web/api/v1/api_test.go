@@ -37,11 +37,13 @@ import (
 	"github.com/golang/snappy"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	config_util "github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/common/route"
 	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
 
 	"github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/pkg/gate"
@@ -213,6 +215,7 @@ func (m rulesRetrieverMock) AlertingRules() []*rules.AlertingRule {
 		"test_metric3",
 		expr1,
 		time.Second,
+		0,
 		labels.Labels{},
 		labels.Labels{},
 		labels.Labels{},
@@ -223,6 +226,7 @@ func (m rulesRetrieverMock) AlertingRules() []*rules.AlertingRule {
 		"test_metric4",
 		expr2,
 		time.Second,
+		0,
 		labels.Labels{},
 		labels.Labels{},
 		labels.Labels{},
@@ -425,22 +429,252 @@ func TestLabelNames(t *testing.T) {
 	api := &API{
 		Queryable: suite.Storage(),
 	}
-	request := func(m string) (*http.Request, error) {
-		if m == http.MethodPost {
-			r, err := http.NewRequest(m, "http://example.com", nil)
+	request := func(method string, matchers ...string) (*http.Request, error) {
+		q := url.Values{}
+		for _, matcher := range matchers {
+			q.Add("match[]", matcher)
+		}
+		if method == http.MethodPost {
+			r, err := http.NewRequest(method, "http://example.com", strings.NewReader(q.Encode()))
 			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 			return r, err
 		}
-		return http.NewRequest(m, "http://example.com", nil)
+		return http.NewRequest(method, "http://example.com?"+q.Encode(), nil)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		matchers []string
+		expected []string
+	}{
+		{
+			name:     "no matchers",
+			expected: []string{"__name__", "baz", "foo", "foo1", "foo2", "xyz"},
+		},
+		{
+			name:     "matcher",
+			matchers: []string{`test_metric2`},
+			expected: []string{"__name__", "foo", "xyz"},
+		},
+		{
+			name:     "matcher with label",
+			matchers: []string{`test_metric1{foo2="boo"}`},
+			expected: []string{"__name__", "foo2"},
+		},
+		{
+			name:     "two matchers",
+			matchers: []string{`test_metric1`, `test_metric2`},
+			expected: []string{"__name__", "baz", "foo", "foo1", "foo2", "xyz"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, method := range []string{http.MethodGet, http.MethodPost} {
+				ctx := context.Background()
+				req, err := request(method, tc.matchers...)
+				require.NoError(t, err)
+				res := api.labelNames(req.WithContext(ctx))
+				assertAPIError(t, res.err, "")
+				assertAPIResponse(t, res.data, tc.expected)
+			}
+		})
+	}
+}
+
+func TestQueryRangeSeriesLimit(t *testing.T) {
+	suite, err := promql.NewTest(t, `
+		load 1m
+			test_metric1{foo="bar"} 0+100x100
+			test_metric1{foo="boo"} 1+0x100
+			test_metric2{foo="boo"} 1+0x100
+	`)
+	require.NoError(t, err)
+	defer suite.Close()
+	require.NoError(t, suite.Run())
+
+	api := &API{
+		Queryable:         suite.Storage(),
+		QueryEngine:       suite.QueryEngine(),
+		maxSeriesPerQuery: 2,
+	}
+	queryRange := func(query, maxSeries string) *apiError {
+		q := url.Values{
+			"query": []string{query},
+			"start": []string{"0"},
+			"end":   []string{"120"},
+			"step":  []string{"60"},
+		}
+		if maxSeries != "" {
+			q.Set("max_series", maxSeries)
+		}
+		req, err := http.NewRequest(http.MethodGet, "http://example.com?"+q.Encode(), nil)
+		require.NoError(t, err)
+		res := api.queryRange(req.WithContext(context.Background()))
+		if res.finalizer != nil {
+			res.finalizer()
+		}
+		return res.err
+	}
+
+	// Three series exceed the server-wide limit of two.
+	require.Error(t, queryRange(`{__name__=~"test_metric.*"}`, ""))
+
+	// A narrower query stays under the limit.
+	require.Nil(t, queryRange(`test_metric2`, ""))
+
+	// The limit can be lowered per request.
+	require.Error(t, queryRange(`test_metric1`, "1"))
+
+	// Raising or disabling the server-wide limit requires the admin APIs.
+	require.Error(t, queryRange(`{__name__=~"test_metric.*"}`, "5"))
+	require.Error(t, queryRange(`{__name__=~"test_metric.*"}`, "0"))
+	api.enableAdmin = true
+	require.Nil(t, queryRange(`{__name__=~"test_metric.*"}`, "5"))
+}
+
+func TestQueryRangeSplit(t *testing.T) {
+	suite, err := promql.NewTest(t, `
+		load 1m
+			test_metric1{foo="bar"} 0+100x100
+			test_metric1{foo="boo"} 1+0x100
+			test_metric2{foo="boo"} 1+0x100
+	`)
+	require.NoError(t, err)
+	defer suite.Close()
+	require.NoError(t, suite.Run())
+
+	api := &API{
+		Queryable:   suite.Storage(),
+		QueryEngine: suite.QueryEngine(),
+	}
+	queryRange := func(t *testing.T, query string) interface{} {
+		q := url.Values{
+			"query": []string{query},
+			"start": []string{"0"},
+			"end":   []string{"3600"},
+			"step":  []string{"60"},
+		}
+		req, err := http.NewRequest(http.MethodGet, "http://example.com?"+q.Encode(), nil)
+		require.NoError(t, err)
+		res := api.queryRange(req.WithContext(context.Background()))
+		assertAPIError(t, res.err, "")
+		if res.finalizer != nil {
+			// Closing a query returns its samples to a pool, so only
+			// release the results once the test is done with them.
+			t.Cleanup(res.finalizer)
+		}
+		return res.data
+	}
+
+	for _, query := range []string{
+		`test_metric1`,
+		`rate(test_metric1[5m])`,
+		`sum({__name__=~"test_metric.*"})`,
+	} {
+		t.Run(query, func(t *testing.T) {
+			want := queryRange(t, query)
+
+			api.rangeQuerySplitInterval = 10 * time.Minute
+			got := queryRange(t, query)
+			api.rangeQuerySplitInterval = 0
+
+			require.Equal(t, want, got)
+		})
+	}
+}
+
+func TestQueryOriginMetrics(t *testing.T) {
+	suite, err := promql.NewTest(t, `
+		load 1m
+			test_metric1{foo="bar"} 0+100x100
+	`)
+	require.NoError(t, err)
+	defer suite.Close()
+	require.NoError(t, suite.Run())
+
+	api := &API{
+		Queryable:   suite.Storage(),
+		QueryEngine: suite.QueryEngine(),
+		now:         func() time.Time { return time.Unix(120, 0) },
 	}
-	for _, method := range []string{http.MethodGet, http.MethodPost} {
-		ctx := context.Background()
-		req, err := request(method)
+
+	count := func(origin, endpoint string) float64 {
+		m := &dto.Metric{}
+		require.NoError(t, queryOriginQueries.WithLabelValues(origin, endpoint).Write(m))
+		return m.GetCounter().GetValue()
+	}
+
+	query := func(origin string) {
+		q := url.Values{"query": []string{"test_metric1"}, "time": []string{"120"}}
+		req, err := http.NewRequest(http.MethodGet, "http://example.com?"+q.Encode(), nil)
 		require.NoError(t, err)
-		res := api.labelNames(req.WithContext(ctx))
+		if origin != "" {
+			req.Header.Set(queryOriginHeader, origin)
+		}
+		res := api.query(req.WithContext(context.Background()))
 		assertAPIError(t, res.err, "")
-		assertAPIResponse(t, res.data, []string{"__name__", "baz", "foo", "foo1", "foo2", "xyz"})
+		if res.finalizer != nil {
+			t.Cleanup(res.finalizer)
+		}
 	}
+
+	before := count("dashboard-1", "query")
+	query("dashboard-1")
+	query("dashboard-1")
+	require.Equal(t, before+2, count("dashboard-1", "query"))
+
+	// Requests without the header are attributed to "unknown".
+	before = count("unknown", "query")
+	query("")
+	require.Equal(t, before+1, count("unknown", "query"))
+}
+
+func TestPreviewRule(t *testing.T) {
+	suite, err := promql.NewTest(t, `
+		load 1m
+			test_metric1{foo="bar"} 0+100x100
+			test_metric1{foo="boo"} 1+0x100
+	`)
+	require.NoError(t, err)
+	defer suite.Close()
+	require.NoError(t, suite.Run())
+
+	api := &API{
+		Queryable:   suite.Storage(),
+		QueryEngine: suite.QueryEngine(),
+		now:         func() time.Time { return time.Unix(120, 0) },
+		logger:      log.NewNopLogger(),
+	}
+
+	preview := func(rule, ts string) apiFuncResult {
+		q := url.Values{"rule": []string{rule}}
+		if ts != "" {
+			q.Set("time", ts)
+		}
+		req, err := http.NewRequest(http.MethodPost, "http://example.com", strings.NewReader(q.Encode()))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return api.previewRule(req.WithContext(context.Background()))
+	}
+
+	// A recording rule preview returns the would-be series.
+	res := preview("record: job:test:sum\nexpr: sum(test_metric1)\nlabels:\n  abc: def", "120")
+	require.Nil(t, res.err)
+	vec := res.data.(*RulePreview).Series
+	require.Len(t, vec, 1)
+	require.Equal(t, labels.FromStrings(model.MetricNameLabel, "job:test:sum", "abc", "def"), vec[0].Metric)
+	require.Equal(t, float64(201), vec[0].V)
+
+	// An alerting rule preview reports the would-be pending alerts.
+	res = preview("alert: TestAlert\nexpr: test_metric1 > 50\nfor: 5m", "120")
+	require.Nil(t, res.err)
+	pv := res.data.(*RulePreview)
+	require.Len(t, pv.Alerts, 1)
+	require.Equal(t, "pending", pv.Alerts[0].State)
+
+	// Invalid rule definitions are rejected.
+	require.NotNil(t, preview("", "").err)
+	require.NotNil(t, preview("alert: A\nrecord: b\nexpr: vector(1)", "").err)
+	require.NotNil(t, preview("record: a\nexpr: rate(", "").err)
 }
 
 func setupTestTargetRetriever(t *testing.T) *testTargetRetriever {
@@ -616,6 +850,43 @@ func testEndpoints(t *testing.T, api *API, tr *testTargetRetriever, testLabelAPI
 				},
 			},
 		},
+		{
+			endpoint: api.formatQuery,
+			query: url.Values{
+				"query": []string{"foo+bar"},
+			},
+			response: "foo + bar",
+		},
+		{
+			endpoint: api.formatQuery,
+			query: url.Values{
+				"query": []string{"invalid_expression/"},
+			},
+			errType: errorBadData,
+		},
+		{
+			endpoint: api.parseQuery,
+			query: url.Values{
+				"query": []string{"foo{bar=\"baz\"}[5m]"},
+			},
+			response: map[string]interface{}{
+				"type":   "matrixSelector",
+				"name":   "foo",
+				"range":  int64(5 * 60 * 1000),
+				"offset": int64(0),
+				"matchers": []map[string]interface{}{
+					{"name": "bar", "value": "baz", "type": "="},
+					{"name": "__name__", "value": "foo", "type": "="},
+				},
+			},
+		},
+		{
+			endpoint: api.parseQuery,
+			query: url.Values{
+				"query": []string{"invalid_expression/"},
+			},
+			errType: errorBadData,
+		},
 		{
 			endpoint: api.queryRange,
 			query: url.Values{
@@ -857,6 +1128,7 @@ func testEndpoints(t *testing.T, api *API, tr *testTargetRetriever, testLabelAPI
 						GlobalURL:          "http://localhost:9115/probe?target=example.com",
 						Health:             "down",
 						LastError:          "failed: missing port in address",
+						LastErrorReason:    "other",
 						LastScrape:         scrapeStart,
 						LastScrapeDuration: 0.1,
 					},
@@ -903,6 +1175,7 @@ func testEndpoints(t *testing.T, api *API, tr *testTargetRetriever, testLabelAPI
 						GlobalURL:          "http://localhost:9115/probe?target=example.com",
 						Health:             "down",
 						LastError:          "failed: missing port in address",
+						LastErrorReason:    "other",
 						LastScrape:         scrapeStart,
 						LastScrapeDuration: 0.1,
 					},
@@ -949,6 +1222,7 @@ func testEndpoints(t *testing.T, api *API, tr *testTargetRetriever, testLabelAPI
 						GlobalURL:          "http://localhost:9115/probe?target=example.com",
 						Health:             "down",
 						LastError:          "failed: missing port in address",
+						LastErrorReason:    "other",
 						LastScrape:         scrapeStart,
 						LastScrapeDuration: 0.1,
 					},
@@ -988,6 +1262,131 @@ func testEndpoints(t *testing.T, api *API, tr *testTargetRetriever, testLabelAPI
 				},
 			},
 		},
+		// Filter by scrape pool.
+		{
+			endpoint: api.targets,
+			query: url.Values{
+				"scrapePool": []string{"test"},
+			},
+			response: &TargetDiscovery{
+				ActiveTargets: []*Target{
+					{
+						DiscoveredLabels: map[string]string{},
+						Labels: map[string]string{
+							"job": "test",
+						},
+						ScrapePool:         "test",
+						ScrapeURL:          "http://example.com:8080/metrics",
+						GlobalURL:          "http://example.com:8080/metrics",
+						Health:             "up",
+						LastError:          "",
+						LastScrape:         scrapeStart,
+						LastScrapeDuration: 0.07,
+					},
+				},
+				DroppedTargets: []*DroppedTarget{},
+			},
+		},
+		// Filter by health and label matchers.
+		{
+			endpoint: api.targets,
+			query: url.Values{
+				"state":   []string{"active"},
+				"health":  []string{"down"},
+				"match[]": []string{`{job="blackbox"}`},
+			},
+			response: &TargetDiscovery{
+				ActiveTargets: []*Target{
+					{
+						DiscoveredLabels: map[string]string{},
+						Labels: map[string]string{
+							"job": "blackbox",
+						},
+						ScrapePool:         "blackbox",
+						ScrapeURL:          "http://localhost:9115/probe?target=example.com",
+						GlobalURL:          "http://localhost:9115/probe?target=example.com",
+						Health:             "down",
+						LastError:          "failed: missing port in address",
+						LastErrorReason:    "other",
+						LastScrape:         scrapeStart,
+						LastScrapeDuration: 0.1,
+					},
+				},
+				DroppedTargets: []*DroppedTarget{},
+			},
+		},
+		// Pagination.
+		{
+			endpoint: api.targets,
+			query: url.Values{
+				"state": []string{"active"},
+				"limit": []string{"1"},
+				"page":  []string{"2"},
+			},
+			response: &TargetDiscovery{
+				ActiveTargets: []*Target{
+					{
+						DiscoveredLabels: map[string]string{},
+						Labels: map[string]string{
+							"job": "test",
+						},
+						ScrapePool:         "test",
+						ScrapeURL:          "http://example.com:8080/metrics",
+						GlobalURL:          "http://example.com:8080/metrics",
+						Health:             "up",
+						LastError:          "",
+						LastScrape:         scrapeStart,
+						LastScrapeDuration: 0.07,
+					},
+				},
+				DroppedTargets: []*DroppedTarget{},
+			},
+		},
+		// Include scrape history.
+		{
+			endpoint: api.targets,
+			query: url.Values{
+				"scrapePool":      []string{"test"},
+				"include_history": []string{"true"},
+			},
+			response: &TargetDiscovery{
+				ActiveTargets: []*Target{
+					{
+						DiscoveredLabels: map[string]string{},
+						Labels: map[string]string{
+							"job": "test",
+						},
+						ScrapePool:         "test",
+						ScrapeURL:          "http://example.com:8080/metrics",
+						GlobalURL:          "http://example.com:8080/metrics",
+						Health:             "up",
+						LastError:          "",
+						LastScrape:         scrapeStart,
+						LastScrapeDuration: 0.07,
+						ScrapeHistory: []ScrapeHistoryEntry{
+							{Timestamp: scrapeStart, Duration: 0.07},
+						},
+					},
+				},
+				DroppedTargets: []*DroppedTarget{},
+			},
+		},
+		// Invalid limit.
+		{
+			endpoint: api.targets,
+			query: url.Values{
+				"limit": []string{"-1"},
+			},
+			errType: errorBadData,
+		},
+		// Invalid label matcher.
+		{
+			endpoint: api.targets,
+			query: url.Values{
+				"match[]": []string{`{job=`},
+			},
+			errType: errorBadData,
+		},
 		// With a matching metric.
 		{
 			endpoint: api.targetMetadata,
@@ -1491,6 +1890,44 @@ func testEndpoints(t *testing.T, api *API, tr *testTargetRetriever, testLabelAPI
 				},
 				errType: errorBadData,
 			},
+			// Label values restricted by a matcher.
+			{
+				endpoint: api.labelValues,
+				params: map[string]string{
+					"name": "foo",
+				},
+				query: url.Values{
+					"match[]": []string{`test_metric2`},
+				},
+				response: []string{
+					"boo",
+				},
+			},
+			// Label values restricted by two matchers.
+			{
+				endpoint: api.labelValues,
+				params: map[string]string{
+					"name": "__name__",
+				},
+				query: url.Values{
+					"match[]": []string{`test_metric1`, `test_metric2`},
+				},
+				response: []string{
+					"test_metric1",
+					"test_metric2",
+				},
+			},
+			// Matcher matching everything is rejected.
+			{
+				endpoint: api.labelValues,
+				params: map[string]string{
+					"name": "foo",
+				},
+				query: url.Values{
+					"match[]": []string{`{foo=~".*"}`},
+				},
+				errType: errorBadData,
+			},
 			// Start and end before LabelValues starts.
 			{
 				endpoint: api.labelValues,
@@ -2116,8 +2553,13 @@ type fakeDB struct {
 }
 
 func (f *fakeDB) CleanTombstones() error                               { return f.err }
+func (f *fakeDB) CompactHead() error                                   { return f.err }
 func (f *fakeDB) Delete(mint, maxt int64, ms ...*labels.Matcher) error { return f.err }
 func (f *fakeDB) Snapshot(dir string, withHead bool) error             { return f.err }
+func (f *fakeDB) WALReplayStatus() (tsdb.WALReplayStatus, error) {
+	return tsdb.WALReplayStatus{}, nil
+}
+func (f *fakeDB) BlockMetas() ([]tsdb.BlockMeta, error) { return nil, f.err }
 func (f *fakeDB) Stats(statsByLabelName string) (_ *tsdb.Stats, retErr error) {
 	dbDir, err := ioutil.TempDir("", "tsdb-api-ready")
 	if err != nil {
@@ -2129,7 +2571,7 @@ func (f *fakeDB) Stats(statsByLabelName string) (_ *tsdb.Stats, retErr error) {
 			retErr = err
 		}
 	}()
-	h, _ := tsdb.NewHead(nil, nil, nil, 1000, "", nil, chunks.DefaultWriteBufferSize, tsdb.DefaultStripeSize, nil)
+	h, _ := tsdb.NewHead(nil, nil, nil, 1000, "", nil, chunks.DefaultWriteBufferSize, chunks.DefaultWriteQueueSize, tsdb.DefaultStripeSize, nil)
 	return h.Stats(statsByLabelName), nil
 }
 
@@ -2788,3 +3230,46 @@ func BenchmarkRespond(b *testing.B) {
 		api.respond(&testResponseWriter, response, nil)
 	}
 }
+
+func TestTargetRelabelDebug(t *testing.T) {
+	var cfg config.ScrapeConfig
+	require.NoError(t, yaml.Unmarshal([]byte(`
+job_name: test
+relabel_configs:
+- source_labels: [__meta_ecs_tag_env]
+  regex: prod
+  action: keep
+- source_labels: [__meta_ecs_instance_name]
+  target_label: name
+`), &cfg))
+
+	target := scrape.NewTarget(
+		labels.FromStrings("instance", "1.2.3.4:9100", "job", "test", "name", "web-1"),
+		labels.FromStrings("__address__", "1.2.3.4:9100", "__meta_ecs_tag_env", "prod", "__meta_ecs_instance_name", "web-1"),
+		nil,
+	)
+	d := relabelDebug("test", target, &cfg)
+	require.Equal(t, "test", d.ScrapePool)
+	require.False(t, d.Dropped)
+	require.Equal(t, map[string]string{"instance": "1.2.3.4:9100", "job": "test", "name": "web-1"}, d.Labels)
+	require.Equal(t, 2, len(d.Steps))
+	require.False(t, d.Steps[0].Dropped)
+	require.Contains(t, d.Steps[0].Rule, "action: keep")
+	require.Equal(t, "web-1", d.Steps[1].Labels["name"])
+
+	// A target dropped by the first rule reports no further steps.
+	dropped := scrape.NewTarget(
+		nil,
+		labels.FromStrings("__address__", "1.2.3.5:9100", "__meta_ecs_tag_env", "dev"),
+		nil,
+	)
+	d = relabelDebug("test", dropped, &cfg)
+	require.True(t, d.Dropped)
+	require.Nil(t, d.Labels)
+	require.Equal(t, 1, len(d.Steps))
+	require.True(t, d.Steps[0].Dropped)
+
+	// Without the scrape config the steps cannot be replayed.
+	d = relabelDebug("test", target, nil)
+	require.Equal(t, 0, len(d.Steps))
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// export streams the raw samples matching a set of selectors and a time range
+// in a tabular format. Rows are written as they are read from storage, so
+// arbitrarily large ranges can be pulled without buffering them in memory.
+// Currently only CSV is implemented; the format parameter exists so further
+// formats can be added without breaking clients.
+func (api *API) export(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		api.respondError(w, &apiError{errorBadData, errors.Wrapf(err, "error parsing form values")}, nil)
+		return
+	}
+	if len(r.Form["match[]"]) == 0 {
+		api.respondError(w, &apiError{errorBadData, errors.New("no match[] parameter provided")}, nil)
+		return
+	}
+	format := r.Form.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" {
+		api.respondError(w, &apiError{errorBadData, errors.Errorf("unsupported export format %q, only \"csv\" is supported", format)}, nil)
+		return
+	}
+
+	start, err := parseTimeParam(r, "start", minTime)
+	if err != nil {
+		api.respondError(w, &apiError{errorBadData, err}, nil)
+		return
+	}
+	end, err := parseTimeParam(r, "end", maxTime)
+	if err != nil {
+		api.respondError(w, &apiError{errorBadData, err}, nil)
+		return
+	}
+
+	matcherSets, err := parseMatchersParam(r.Form["match[]"])
+	if err != nil {
+		api.respondError(w, &apiError{errorBadData, err}, nil)
+		return
+	}
+	matcherSets = api.restrictToTenant(r, matcherSets)
+
+	q, err := api.Queryable.Querier(r.Context(), timestamp.FromTime(start), timestamp.FromTime(end))
+	if err != nil {
+		api.respondError(w, &apiError{errorExec, err}, nil)
+		return
+	}
+	defer q.Close()
+
+	hints := &storage.SelectHints{
+		Start: timestamp.FromTime(start),
+		End:   timestamp.FromTime(end),
+	}
+
+	var sets []storage.SeriesSet
+	for _, mset := range matcherSets {
+		// Sorted selects so the merge can deduplicate the series sets.
+		sets = append(sets, q.Select(true, hints, mset...))
+	}
+	set := storage.NewMergeSeriesSet(sets, storage.ChainedSeriesMerge)
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="export.csv"`)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"name", "labels", "timestamp", "value"}); err != nil {
+		return
+	}
+	for set.Next() {
+		series := set.At()
+		lbls := series.Labels()
+		name := lbls.Get(labels.MetricName)
+		rest := labels.NewBuilder(lbls).Del(labels.MetricName).Labels().String()
+
+		it := series.Iterator()
+		for it.Next() {
+			t, v := it.At()
+			if err := cw.Write([]string{
+				name,
+				rest,
+				strconv.FormatInt(t, 10),
+				strconv.FormatFloat(v, 'f', -1, 64),
+			}); err != nil {
+				// The client is gone; there is no way to signal an error on a
+				// started stream.
+				return
+			}
+		}
+		if it.Err() != nil {
+			level.Error(api.logger).Log("msg", "error streaming export samples", "err", it.Err())
+			return
+		}
+	}
+	if set.Err() != nil {
+		level.Error(api.logger).Log("msg", "error streaming export series", "err", set.Err())
+		return
+	}
+	cw.Flush()
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/prometheus/promql"
+)
+
+func TestExportCSV(t *testing.T) {
+	suite, err := promql.NewTest(t, `
+		load 1m
+			test_metric1{foo="bar"} 0+100x5
+			test_metric1{foo="boo"} 1+0x5
+			test_metric2{foo="boo"} 1+0x5
+	`)
+	require.NoError(t, err)
+	defer suite.Close()
+	require.NoError(t, suite.Run())
+
+	api := &API{
+		Queryable: suite.Storage(),
+		logger:    log.NewNopLogger(),
+	}
+
+	query := url.Values{
+		"match[]": []string{`test_metric1{foo="bar"}`},
+		"start":   []string{"0"},
+		"end":     []string{"600"},
+	}
+	req := httptest.NewRequest("GET", "/export?"+query.Encode(), nil)
+	rec := httptest.NewRecorder()
+	api.export(rec, req)
+
+	res := rec.Result()
+	require.Equal(t, 200, res.StatusCode)
+	require.Equal(t, "text/csv; charset=utf-8", res.Header.Get("Content-Type"))
+
+	rows, err := csv.NewReader(res.Body).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, []string{"name", "labels", "timestamp", "value"}, rows[0])
+	// 6 samples for the selected series plus the header row.
+	require.Equal(t, 7, len(rows))
+	require.Equal(t, []string{"test_metric1", `{foo="bar"}`, "60000", "100"}, rows[2])
+
+	// Unknown formats are rejected before anything is streamed.
+	req = httptest.NewRequest("GET", "/export?"+query.Encode()+"&format=parquet", nil)
+	rec = httptest.NewRecorder()
+	api.export(rec, req)
+	require.Equal(t, 400, rec.Result().StatusCode)
+
+	// A selector is required.
+	req = httptest.NewRequest("GET", "/export", nil)
+	rec = httptest.NewRecorder()
+	api.export(rec, req)
+	require.Equal(t, 400, rec.Result().StatusCode)
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// queryLimiter bounds how fast and how concurrently a single client may use
+// the expression query endpoints, so that a misbehaving dashboard cannot
+// starve rule evaluation. Clients are identified by their basic auth user
+// name, or by their remote address if the request is unauthenticated.
+type queryLimiter struct {
+	qps           rate.Limit
+	burst         int
+	maxConcurrent int
+
+	mtx     sync.Mutex
+	clients map[string]*clientLimits
+}
+
+type clientLimits struct {
+	limiter  *rate.Limiter
+	inflight int
+}
+
+// newQueryLimiter returns a limiter that allows each client qps queries per
+// second and maxConcurrent queries in flight. A value of 0 disables the
+// respective limit; nil is returned when both are disabled.
+func newQueryLimiter(qps float64, maxConcurrent int) *queryLimiter {
+	if qps <= 0 && maxConcurrent <= 0 {
+		return nil
+	}
+	burst := int(qps)
+	if burst < 1 {
+		burst = 1
+	}
+	return &queryLimiter{
+		qps:           rate.Limit(qps),
+		burst:         burst,
+		maxConcurrent: maxConcurrent,
+		clients:       map[string]*clientLimits{},
+	}
+}
+
+// admit checks the request against the limits of its client. On success it
+// returns a release function that must be called once the query finished.
+func (l *queryLimiter) admit(r *http.Request) (func(), error) {
+	client := clientIdentity(r)
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	c, ok := l.clients[client]
+	if !ok {
+		c = &clientLimits{}
+		if l.qps > 0 {
+			c.limiter = rate.NewLimiter(l.qps, l.burst)
+		}
+		l.clients[client] = c
+	}
+	if l.maxConcurrent > 0 && c.inflight >= l.maxConcurrent {
+		return nil, errors.Errorf("client %q exceeds the limit of %d concurrent queries", client, l.maxConcurrent)
+	}
+	if c.limiter != nil && !c.limiter.Allow() {
+		return nil, errors.Errorf("client %q exceeds the limit of %g queries per second", client, float64(l.qps))
+	}
+	c.inflight++
+	return func() {
+		l.mtx.Lock()
+		defer l.mtx.Unlock()
+		c.inflight--
+		// Without a rate limiter there is no token bucket state to keep, so
+		// idle clients can be dropped from the map right away.
+		if c.inflight == 0 && c.limiter == nil {
+			delete(l.clients, client)
+		}
+	}, nil
+}
+
+// clientIdentity returns the identity limits are keyed by: the basic auth
+// user name if the request carries one, the remote host otherwise.
+func clientIdentity(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		return user
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
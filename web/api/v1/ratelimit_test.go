@@ -0,0 +1,71 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryLimiterDisabled(t *testing.T) {
+	require.Nil(t, newQueryLimiter(0, 0))
+}
+
+func TestQueryLimiterConcurrency(t *testing.T) {
+	l := newQueryLimiter(0, 1)
+
+	r := httptest.NewRequest("GET", "/api/v1/query", nil)
+	release, err := l.admit(r)
+	require.NoError(t, err)
+
+	// A second in-flight query of the same client is rejected, another
+	// client is unaffected.
+	_, err = l.admit(r)
+	require.Error(t, err)
+
+	other := httptest.NewRequest("GET", "/api/v1/query", nil)
+	other.RemoteAddr = "10.0.0.1:1234"
+	otherRelease, err := l.admit(other)
+	require.NoError(t, err)
+	otherRelease()
+
+	release()
+	release, err = l.admit(r)
+	require.NoError(t, err)
+	release()
+}
+
+func TestQueryLimiterRate(t *testing.T) {
+	l := newQueryLimiter(1, 0)
+
+	r := httptest.NewRequest("GET", "/api/v1/query", nil)
+	release, err := l.admit(r)
+	require.NoError(t, err)
+	release()
+
+	// The burst of one is used up, the next query within the same second
+	// is rejected.
+	_, err = l.admit(r)
+	require.Error(t, err)
+
+	// Clients are keyed by basic auth user when present, so an
+	// authenticated request from the same address is independent.
+	auth := httptest.NewRequest("GET", "/api/v1/query", nil)
+	auth.SetBasicAuth("grafana", "")
+	release, err = l.admit(auth)
+	require.NoError(t, err)
+	release()
+}
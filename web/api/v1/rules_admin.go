@@ -0,0 +1,138 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/route"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+)
+
+// managedRuleFileSuffix is appended to the rule file names handled through
+// the admin API. The managed directory is picked up by the rule manager on
+// every configuration reload.
+const managedRuleFileSuffix = ".yaml"
+
+// managedRulesError returns the reason the managed rules endpoints cannot be
+// served, nil if they are available.
+func (api *API) managedRulesError() *apiError {
+	if !api.enableAdmin {
+		return &apiError{errorUnavailable, errors.New("admin APIs disabled")}
+	}
+	if api.managedRulesDir == "" {
+		return &apiError{errorUnavailable, errors.New("no managed rules directory configured")}
+	}
+	return nil
+}
+
+// managedRuleFileName validates the name route parameter and returns the
+// file name it maps to within the managed rules directory.
+func managedRuleFileName(r *http.Request) (string, error) {
+	name := route.Param(r.Context(), "name")
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", errors.Errorf("invalid rule file name %q", name)
+	}
+	return name + managedRuleFileSuffix, nil
+}
+
+func (api *API) listManagedRuleFiles(r *http.Request) apiFuncResult {
+	if apiErr := api.managedRulesError(); apiErr != nil {
+		return apiFuncResult{nil, apiErr, nil, nil}
+	}
+	infos, err := ioutil.ReadDir(api.managedRulesDir)
+	if err != nil {
+		return apiFuncResult{nil, &apiError{errorInternal, err}, nil, nil}
+	}
+	names := []string{}
+	for _, fi := range infos {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), managedRuleFileSuffix) {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(fi.Name(), managedRuleFileSuffix))
+	}
+	return apiFuncResult{names, nil, nil, nil}
+}
+
+func (api *API) setManagedRuleFile(r *http.Request) apiFuncResult {
+	if apiErr := api.managedRulesError(); apiErr != nil {
+		return apiFuncResult{nil, apiErr, nil, nil}
+	}
+	fn, err := managedRuleFileName(r)
+	if err != nil {
+		return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
+	}
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return apiFuncResult{nil, &apiError{errorBadData, errors.Wrap(err, "error reading request body")}, nil, nil}
+	}
+	rgs, errs := rulefmt.Parse(content)
+	if len(errs) > 0 {
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return apiFuncResult{nil, &apiError{errorBadData, errors.Errorf("invalid rule file: %s", strings.Join(msgs, "; "))}, nil, nil}
+	}
+	if len(rgs.Groups) == 0 {
+		return apiFuncResult{nil, &apiError{errorBadData, errors.New("rule file has no groups")}, nil, nil}
+	}
+
+	// Write to a temporary file first so a reload never sees a partially
+	// written rule file.
+	path := filepath.Join(api.managedRulesDir, fn)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return apiFuncResult{nil, &apiError{errorInternal, errors.Wrap(err, "error writing rule file")}, nil, nil}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return apiFuncResult{nil, &apiError{errorInternal, errors.Wrap(err, "error writing rule file")}, nil, nil}
+	}
+	return api.reloadManagedRules()
+}
+
+func (api *API) deleteManagedRuleFile(r *http.Request) apiFuncResult {
+	if apiErr := api.managedRulesError(); apiErr != nil {
+		return apiFuncResult{nil, apiErr, nil, nil}
+	}
+	fn, err := managedRuleFileName(r)
+	if err != nil {
+		return apiFuncResult{nil, &apiError{errorBadData, err}, nil, nil}
+	}
+	if err := os.Remove(filepath.Join(api.managedRulesDir, fn)); err != nil {
+		if os.IsNotExist(err) {
+			return apiFuncResult{nil, &apiError{errorNotFound, errors.Errorf("rule file %q does not exist", strings.TrimSuffix(fn, managedRuleFileSuffix))}, nil, nil}
+		}
+		return apiFuncResult{nil, &apiError{errorInternal, errors.Wrap(err, "error deleting rule file")}, nil, nil}
+	}
+	return api.reloadManagedRules()
+}
+
+// reloadManagedRules triggers a configuration reload so the rule manager
+// picks up the changed managed rules directory.
+func (api *API) reloadManagedRules() apiFuncResult {
+	if api.reloadFunc != nil {
+		if err := api.reloadFunc(); err != nil {
+			return apiFuncResult{nil, &apiError{errorInternal, errors.Wrap(err, "rule file stored but reload failed")}, nil, nil}
+		}
+	}
+	return apiFuncResult{nil, nil, nil, nil}
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/route"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagedRuleFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "managed_rules")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	reloads := 0
+	api := &API{
+		enableAdmin:     true,
+		managedRulesDir: dir,
+		reloadFunc:      func() error { reloads++; return nil },
+	}
+
+	request := func(method, name, body string) apiFuncResult {
+		req := httptest.NewRequest(method, "/admin/rules/"+name, strings.NewReader(body))
+		req = req.WithContext(route.WithParam(req.Context(), "name", name))
+		switch method {
+		case "PUT":
+			return api.setManagedRuleFile(req)
+		case "DELETE":
+			return api.deleteManagedRuleFile(req)
+		}
+		return api.listManagedRuleFiles(req)
+	}
+
+	const content = `
+groups:
+  - name: managed
+    rules:
+      - record: managed_metric
+        expr: vector(1)
+`
+
+	// Create a valid rule file.
+	res := request("PUT", "team1", content)
+	require.Nil(t, res.err)
+	require.Equal(t, 1, reloads)
+	b, err := ioutil.ReadFile(filepath.Join(dir, "team1.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, content, string(b))
+
+	res = request("GET", "", "")
+	require.Nil(t, res.err)
+	require.Equal(t, []string{"team1"}, res.data)
+
+	// Invalid rule files and names are rejected without touching the directory.
+	res = request("PUT", "team2", "groups:\n  - rules:\n      - expr: vector(1)\n")
+	require.NotNil(t, res.err)
+	require.Equal(t, errorBadData, res.err.typ)
+
+	res = request("PUT", "../evil", content)
+	require.NotNil(t, res.err)
+	require.Equal(t, errorBadData, res.err.typ)
+
+	res = request("GET", "", "")
+	require.Equal(t, []string{"team1"}, res.data)
+
+	// Delete the file, a second delete reports it missing.
+	res = request("DELETE", "team1", "")
+	require.Nil(t, res.err)
+	require.Equal(t, 2, reloads)
+	_, err = os.Stat(filepath.Join(dir, "team1.yaml"))
+	require.True(t, os.IsNotExist(err))
+
+	res = request("DELETE", "team1", "")
+	require.NotNil(t, res.err)
+	require.Equal(t, errorNotFound, res.err.typ)
+
+	// All endpoints require the admin API to be enabled.
+	api.enableAdmin = false
+	res = request("PUT", "team1", content)
+	require.NotNil(t, res.err)
+	require.Equal(t, errorUnavailable, res.err.typ)
+}
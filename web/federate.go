@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
 
 	"github.com/go-kit/kit/log/level"
 	"github.com/gogo/protobuf/proto"
@@ -69,6 +70,24 @@ func (h *Handler) federation(w http.ResponseWriter, req *http.Request) {
 		matcherSets = append(matcherSets, matchers)
 	}
 
+	attachExternalLabels := true
+	if v := req.Form.Get("external_labels"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid parameter 'external_labels': %v", err), http.StatusBadRequest)
+			return
+		}
+		attachExternalLabels = b
+	}
+	stripLabels := map[string]struct{}{}
+	for _, ln := range req.Form["strip_labels[]"] {
+		if !model.LabelName(ln).IsValid() || ln == model.MetricNameLabel {
+			http.Error(w, fmt.Sprintf("invalid label name in parameter 'strip_labels[]': %q", ln), http.StatusBadRequest)
+			return
+		}
+		stripLabels[ln] = struct{}{}
+	}
+
 	var (
 		mint   = timestamp.FromTime(h.now().Time().Add(-h.lookbackDelta))
 		maxt   = timestamp.FromTime(h.now().Time())
@@ -145,10 +164,16 @@ func (h *Handler) federation(w http.ResponseWriter, req *http.Request) {
 
 	sort.Sort(byName(vec))
 
-	externalLabels := h.config.GlobalConfig.ExternalLabels.Map()
+	externalLabels := map[string]string{}
+	if attachExternalLabels {
+		externalLabels = h.config.GlobalConfig.ExternalLabels.Map()
+	}
 	if _, ok := externalLabels[model.InstanceLabel]; !ok {
 		externalLabels[model.InstanceLabel] = ""
 	}
+	for ln := range stripLabels {
+		delete(externalLabels, ln)
+	}
 	externalLabelNames := make([]string, 0, len(externalLabels))
 	for ln := range externalLabels {
 		externalLabelNames = append(externalLabelNames, ln)
@@ -172,6 +197,9 @@ func (h *Handler) federation(w http.ResponseWriter, req *http.Request) {
 				// This is also important to protect against nameless metrics.
 				continue
 			}
+			if _, ok := stripLabels[l.Name]; ok {
+				continue
+			}
 			if l.Name == labels.MetricName {
 				nameSeen = true
 				if l.Value == lastMetricName {
@@ -165,6 +165,62 @@ test_metric2{foo="boo",instance="i",zone="ie"} 1 6000000
 test_metric_old{foo="baz",instance="",zone="ie"} 981 5880000
 # TYPE test_metric_without_labels untyped
 test_metric_without_labels{foo="baz",instance="",zone="ie"} 1001 6000000
+`,
+	},
+	"external labels can be disabled": {
+		params:         "match[]={__name__=~'.%2b'}&external_labels=false", // '%2b' is an URL-encoded '+'.
+		externalLabels: labels.Labels{{Name: "zone", Value: "ie"}, {Name: "foo", Value: "baz"}},
+		code:           200,
+		body: `# TYPE test_metric1 untyped
+test_metric1{foo="bar",instance="i"} 10000 6000000
+test_metric1{foo="boo",instance="i"} 1 6000000
+# TYPE test_metric2 untyped
+test_metric2{foo="boo",instance="i"} 1 6000000
+# TYPE test_metric_old untyped
+test_metric_old{instance=""} 981 5880000
+# TYPE test_metric_without_labels untyped
+test_metric_without_labels{instance=""} 1001 6000000
+`,
+	},
+	"external labels can be stripped individually": {
+		params:         "match[]={__name__=~'.%2b'}&strip_labels[]=zone", // '%2b' is an URL-encoded '+'.
+		externalLabels: labels.Labels{{Name: "zone", Value: "ie"}, {Name: "foo", Value: "baz"}},
+		code:           200,
+		body: `# TYPE test_metric1 untyped
+test_metric1{foo="bar",instance="i"} 10000 6000000
+test_metric1{foo="boo",instance="i"} 1 6000000
+# TYPE test_metric2 untyped
+test_metric2{foo="boo",instance="i"} 1 6000000
+# TYPE test_metric_old untyped
+test_metric_old{foo="baz",instance=""} 981 5880000
+# TYPE test_metric_without_labels untyped
+test_metric_without_labels{foo="baz",instance=""} 1001 6000000
+`,
+	},
+	"series labels can be stripped": {
+		params: "match[]={__name__=~'.%2b'}&strip_labels[]=instance", // '%2b' is an URL-encoded '+'.
+		code:   200,
+		body: `# TYPE test_metric1 untyped
+test_metric1{foo="bar"} 10000 6000000
+test_metric1{foo="boo"} 1 6000000
+# TYPE test_metric2 untyped
+test_metric2{foo="boo"} 1 6000000
+# TYPE test_metric_old untyped
+test_metric_old 981 5880000
+# TYPE test_metric_without_labels untyped
+test_metric_without_labels 1001 6000000
+`,
+	},
+	"invalid strip_labels": {
+		params: "match[]=test_metric1&strip_labels[]=-not-valid",
+		code:   400,
+		body: `invalid label name in parameter 'strip_labels[]': "-not-valid"
+`,
+	},
+	"invalid external_labels": {
+		params: "match[]=test_metric1&external_labels=nope",
+		code:   400,
+		body: `invalid parameter 'external_labels': strconv.ParseBool: parsing "nope": invalid syntax
 `,
 	},
 	"instance is an external label": {
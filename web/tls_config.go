@@ -0,0 +1,165 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// webConfig configures the HTTP server itself. It is loaded from the file
+// passed via --web.config.file.
+type webConfig struct {
+	TLSConfig      tlsServerConfig   `yaml:"tls_server_config"`
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+}
+
+type tlsServerConfig struct {
+	CertFile       string `yaml:"cert_file"`
+	KeyFile        string `yaml:"key_file"`
+	ClientCAFile   string `yaml:"client_ca_file"`
+	ClientAuthType string `yaml:"client_auth_type"`
+}
+
+func loadWebConfig(path string) (*webConfig, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading web config file")
+	}
+	cfg := &webConfig{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, errors.Wrap(err, "parsing web config file")
+	}
+	if (cfg.TLSConfig.CertFile == "") != (cfg.TLSConfig.KeyFile == "") {
+		return nil, errors.New("both cert_file and key_file must be set to enable TLS")
+	}
+	return cfg, nil
+}
+
+// tlsConfig builds a TLS configuration from the web config, or returns nil if
+// TLS is not configured. The key pair is re-read on every handshake so that
+// certificates can be rotated without restarting the server.
+func (c *webConfig) tlsConfig() (*tls.Config, error) {
+	tc := c.TLSConfig
+	if tc.CertFile == "" {
+		return nil, nil
+	}
+	// Validate the initial key pair up front for a clear startup error.
+	if _, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile); err != nil {
+		return nil, errors.Wrap(err, "loading TLS key pair")
+	}
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+			return &cert, nil
+		},
+	}
+
+	switch tc.ClientAuthType {
+	case "", "NoClientCert":
+		cfg.ClientAuth = tls.NoClientCert
+	case "RequestClientCert":
+		cfg.ClientAuth = tls.RequestClientCert
+	case "RequireAnyClientCert":
+		cfg.ClientAuth = tls.RequireAnyClientCert
+	case "VerifyClientCertIfGiven":
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case "RequireAndVerifyClientCert":
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, errors.Errorf("invalid client_auth_type %q", tc.ClientAuthType)
+	}
+
+	if tc.ClientCAFile != "" {
+		ca, err := ioutil.ReadFile(tc.ClientCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading client CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("no certificates parsed from client CA file")
+		}
+		cfg.ClientCAs = pool
+		if tc.ClientAuthType == "" {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return cfg, nil
+}
+
+// dummyBcryptHash is compared against when an unknown user is supplied, so
+// that authentication takes roughly the same time for existing and
+// non-existing users.
+const dummyBcryptHash = "$2y$10$QOauhQNbBCuQDKes6eFzPeMqBSjb7Mr5DUmpZ/VcEd00UAV/LDeSi"
+
+// withBasicAuth enforces HTTP basic authentication for every request if any
+// users are configured. Passwords are stored as bcrypt hashes.
+func (c *webConfig) withBasicAuth(next http.Handler) http.Handler {
+	if len(c.BasicAuthUsers) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if ok {
+			hash, exists := c.BasicAuthUsers[user]
+			if !exists {
+				hash = dummyBcryptHash
+			}
+			if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)); err == nil && exists {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="Prometheus"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// serveWithConfig serves srv on the listener, applying the TLS and basic
+// authentication settings from the web config file if one is given.
+func serveWithConfig(srv *http.Server, listener net.Listener, configPath string, logger log.Logger) error {
+	if configPath == "" {
+		return srv.Serve(listener)
+	}
+	cfg, err := loadWebConfig(configPath)
+	if err != nil {
+		return err
+	}
+	srv.Handler = cfg.withBasicAuth(srv.Handler)
+
+	tlsCfg, err := cfg.tlsConfig()
+	if err != nil {
+		return err
+	}
+	if tlsCfg == nil {
+		level.Info(logger).Log("msg", "TLS is disabled for the web server.")
+		return srv.Serve(listener)
+	}
+	level.Info(logger).Log("msg", "TLS is enabled for the web server.")
+	srv.TLSConfig = tlsCfg
+	return srv.ServeTLS(listener, "", "")
+}
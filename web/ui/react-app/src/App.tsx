@@ -1,4 +1,4 @@
-import React, { FC } from 'react';
+import React, { FC, useEffect } from 'react';
 import Navigation from './Navbar';
 import { Container } from 'reactstrap';
 
@@ -6,12 +6,20 @@ import './App.css';
 import { Router, Redirect } from '@reach/router';
 import { Alerts, Config, Flags, Rules, ServiceDiscovery, Status, Targets, TSDBStatus, PanelList } from './pages';
 import { PathPrefixContext } from './contexts/PathPrefixContext';
+import { Theme, ThemeContext } from './contexts/ThemeContext';
+import { useLocalStorage } from './hooks/useLocalStorage';
 
 interface AppProps {
   consolesLink: string | null;
 }
 
 const App: FC<AppProps> = ({ consolesLink }) => {
+  const [theme, setTheme] = useLocalStorage<Theme>('theme', 'light');
+
+  useEffect(() => {
+    document.body.classList.toggle('theme-dark', theme === 'dark');
+  }, [theme]);
+
   // This dynamically/generically determines the pathPrefix by stripping the first known
   // endpoint suffix from the window location path. It works out of the box for both direct
   // hosting and reverse proxy deployments with no additional configurations required.
@@ -40,27 +48,29 @@ const App: FC<AppProps> = ({ consolesLink }) => {
   }
 
   return (
-    <PathPrefixContext.Provider value={basePath}>
-      <Navigation consolesLink={consolesLink} />
-      <Container fluid style={{ paddingTop: 70 }}>
-        <Router basepath={`${basePath}`}>
-          <Redirect from="/" to={`graph`} noThrow />
-          {/*
+    <ThemeContext.Provider value={{ theme, toggleTheme: () => setTheme(theme === 'light' ? 'dark' : 'light') }}>
+      <PathPrefixContext.Provider value={basePath}>
+        <Navigation consolesLink={consolesLink} />
+        <Container fluid style={{ paddingTop: 70 }}>
+          <Router basepath={`${basePath}`}>
+            <Redirect from="/" to={`graph`} noThrow />
+            {/*
               NOTE: Any route added here needs to also be added to the list of
               React-handled router paths ("reactRouterPaths") in /web/web.go.
             */}
-          <PanelList path="/graph" />
-          <Alerts path="/alerts" />
-          <Config path="/config" />
-          <Flags path="/flags" />
-          <Rules path="/rules" />
-          <ServiceDiscovery path="/service-discovery" />
-          <Status path="/status" />
-          <TSDBStatus path="/tsdb-status" />
-          <Targets path="/targets" />
-        </Router>
-      </Container>
-    </PathPrefixContext.Provider>
+            <PanelList path="/graph" />
+            <Alerts path="/alerts" />
+            <Config path="/config" />
+            <Flags path="/flags" />
+            <Rules path="/rules" />
+            <ServiceDiscovery path="/service-discovery" />
+            <Status path="/status" />
+            <TSDBStatus path="/tsdb-status" />
+            <Targets path="/targets" />
+          </Router>
+        </Container>
+      </PathPrefixContext.Provider>
+    </ThemeContext.Provider>
   );
 };
 
@@ -12,7 +12,10 @@ import {
   DropdownMenu,
   DropdownItem,
 } from 'reactstrap';
+import { FontAwesomeIcon } from '@fortawesome/react-fontawesome';
+import { faMoon, faSun } from '@fortawesome/free-solid-svg-icons';
 import { usePathPrefix } from './contexts/PathPrefixContext';
+import { useTheme } from './contexts/ThemeContext';
 
 interface NavbarProps {
   consolesLink: string | null;
@@ -22,6 +25,7 @@ const Navigation: FC<NavbarProps> = ({ consolesLink }) => {
   const [isOpen, setIsOpen] = useState(false);
   const toggle = () => setIsOpen(!isOpen);
   const pathPrefix = usePathPrefix();
+  const { theme, toggleTheme } = useTheme();
   return (
     <Navbar className="mb-3" dark color="dark" expand="md" fixed="top">
       <NavbarToggler onClick={toggle} />
@@ -79,6 +83,15 @@ const Navigation: FC<NavbarProps> = ({ consolesLink }) => {
           <NavItem>
             <NavLink href={`${pathPrefix}/classic/graph${window.location.search}`}>Classic UI</NavLink>
           </NavItem>
+          <NavItem>
+            <NavLink
+              className="theme-toggle"
+              onClick={toggleTheme}
+              title={theme === 'dark' ? 'Switch to the light theme' : 'Switch to the dark theme'}
+            >
+              <FontAwesomeIcon icon={theme === 'dark' ? faSun : faMoon} />
+            </NavLink>
+          </NavItem>
         </Nav>
       </Collapse>
     </Navbar>
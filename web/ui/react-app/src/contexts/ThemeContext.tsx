@@ -0,0 +1,21 @@
+import React from 'react';
+
+export type Theme = 'light' | 'dark';
+
+interface ThemeContextProps {
+  theme: Theme;
+  toggleTheme: () => void;
+}
+
+const ThemeContext = React.createContext<ThemeContextProps>({
+  theme: 'light',
+  toggleTheme: () => {
+    // Nothing to toggle without a provider.
+  },
+});
+
+function useTheme() {
+  return React.useContext(ThemeContext);
+}
+
+export { useTheme, ThemeContext };
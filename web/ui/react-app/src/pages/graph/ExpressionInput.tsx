@@ -7,6 +7,7 @@ import sanitizeHTML from 'sanitize-html';
 
 import { FontAwesomeIcon } from '@fortawesome/react-fontawesome';
 import { faSearch, faSpinner } from '@fortawesome/free-solid-svg-icons';
+import { API_PATH } from '../../constants/constants';
 
 interface ExpressionInputProps {
   value: string;
@@ -15,19 +16,39 @@ interface ExpressionInputProps {
   executeQuery: () => void;
   loading: boolean;
   enableAutocomplete: boolean;
+  pathPrefix?: string;
+  labelNames?: string[];
 }
 
 interface ExpressionInputState {
   height: number | string;
+  labelValues: { [label: string]: string[] };
+}
+
+// A partially typed label value at the end of the expression, e.g. `foo{instance="local`.
+const labelValueContextRE = /^(.*[{,]\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*(?:=|!=|=~|!~)\s*")([^"]*)$/;
+// A partially typed label name at the end of the expression, e.g. `foo{inst`.
+const labelNameContextRE = /^(.*[{,]\s*)([a-zA-Z_][a-zA-Z0-9_]*)?$/;
+
+// An autocomplete section together with the strings to wrap around a selected
+// item to complete the expression.
+interface AutocompleteContext {
+  title: string;
+  items: string[];
+  match: string;
+  head: string;
+  tail: string;
 }
 
 class ExpressionInput extends Component<ExpressionInputProps, ExpressionInputState> {
   private exprInputRef = React.createRef<HTMLInputElement>();
+  private pendingLabelValues = new Set<string>();
 
   constructor(props: ExpressionInputProps) {
     super(props);
     this.state = {
       height: 'auto',
+      labelValues: {},
     };
   }
 
@@ -46,9 +67,33 @@ class ExpressionInput extends Component<ExpressionInputProps, ExpressionInputSta
   };
 
   setValue = (value: string) => {
-    const { onExpressionChange } = this.props;
+    const { onExpressionChange, enableAutocomplete } = this.props;
     onExpressionChange(value);
     this.setState({ height: 'auto' }, this.setHeight);
+
+    if (enableAutocomplete) {
+      const valueContext = labelValueContextRE.exec(value);
+      if (valueContext && this.state.labelValues[valueContext[2]] === undefined) {
+        this.fetchLabelValues(valueContext[2]);
+      }
+    }
+  };
+
+  fetchLabelValues = (label: string) => {
+    if (this.pendingLabelValues.has(label)) {
+      return;
+    }
+    this.pendingLabelValues.add(label);
+    const { pathPrefix = '' } = this.props;
+    fetch(`${pathPrefix}/${API_PATH}/label/${label}/values`, { cache: 'no-store', credentials: 'same-origin' })
+      .then(res => (res.ok ? res.json() : Promise.reject(res.statusText)))
+      .then(json => {
+        this.setState({ labelValues: { ...this.state.labelValues, [label]: json.data } });
+      })
+      .catch(() => {
+        // Leave the section empty; the dropdown simply has nothing to offer.
+        this.setState({ labelValues: { ...this.state.labelValues, [label]: [] } });
+      });
   };
 
   componentDidUpdate(prevProps: ExpressionInputProps) {
@@ -73,14 +118,41 @@ class ExpressionInput extends Component<ExpressionInputProps, ExpressionInputSta
     });
   };
 
+  // autocompleteContexts determines the suggestion sections that apply at the
+  // end of the given input. Inside a label matcher, label names and values are
+  // suggested; anywhere else the regular sections (query history and metric
+  // names) are matched against the whole input.
+  autocompleteContexts = (input: string): AutocompleteContext[] => {
+    const { autocompleteSections, labelNames = [] } = this.props;
+
+    const valueContext = labelValueContextRE.exec(input);
+    if (valueContext) {
+      const [, head, label, partial] = valueContext;
+      return [{ title: 'Label Values', items: this.state.labelValues[label] || [], match: partial, head, tail: '"' }];
+    }
+
+    const nameContext = labelNameContextRE.exec(input);
+    if (nameContext && nameContext[1].lastIndexOf('{') > nameContext[1].lastIndexOf('}')) {
+      const [, head, partial] = nameContext;
+      return [{ title: 'Label Names', items: labelNames, match: partial || '', head, tail: '' }];
+    }
+
+    return Object.entries(autocompleteSections).map(([title, items]) => ({
+      title,
+      items,
+      match: input,
+      head: '',
+      tail: '',
+    }));
+  };
+
   createAutocompleteSection = (downshift: ControllerStateAndHelpers<any>) => {
     const { inputValue = '', closeMenu, highlightedIndex } = downshift;
-    const { autocompleteSections } = this.props;
     let index = 0;
     const sections =
       inputValue!.length && this.props.enableAutocomplete
-        ? Object.entries(autocompleteSections).reduce((acc, [title, items]) => {
-            const matches = this.getSearchMatches(inputValue!, items);
+        ? this.autocompleteContexts(inputValue!).reduce((acc, { title, items, match, head, tail }) => {
+            const matches = this.getSearchMatches(match, items);
             return !matches.length
               ? acc
               : [
@@ -93,10 +165,10 @@ class ExpressionInput extends Component<ExpressionInputProps, ExpressionInputSta
                         const itemProps = downshift.getItemProps({
                           key: original,
                           index,
-                          item: original,
-                          style: {
-                            backgroundColor: highlightedIndex === index++ ? 'lightgray' : 'white',
-                          },
+                          // The item completes the whole expression, so
+                          // selecting it can simply replace the input.
+                          item: head + original + tail,
+                          className: `autosuggest-dropdown-item${highlightedIndex === index++ ? ' highlighted' : ''}`,
                         });
                         return (
                           <li
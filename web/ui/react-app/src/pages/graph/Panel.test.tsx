@@ -33,6 +33,7 @@ const defaultProps = {
     // Do nothing.
   },
   enableAutocomplete: true,
+  labelNames: [],
 };
 
 describe('Panel', () => {
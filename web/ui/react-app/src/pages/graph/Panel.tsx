@@ -19,6 +19,7 @@ interface PanelProps {
   useLocalTime: boolean;
   pastQueries: string[];
   metricNames: string[];
+  labelNames: string[];
   removePanel: () => void;
   onExecuteQuery: (query: string) => void;
   pathPrefix: string;
@@ -235,6 +236,8 @@ class Panel extends Component<PanelProps, PanelState> {
               executeQuery={this.executeQuery}
               loading={this.state.loading}
               enableAutocomplete={this.props.enableAutocomplete}
+              pathPrefix={this.props.pathPrefix}
+              labelNames={this.props.labelNames}
               autocompleteSections={{
                 'Query History': pastQueries,
                 'Metric Names': metricNames,
@@ -20,6 +20,7 @@ export const updateURL = (nextPanels: PanelMeta[]) => {
 interface PanelListProps extends RouteComponentProps {
   panels: PanelMeta[];
   metrics: string[];
+  labels: string[];
   useLocalTime: boolean;
   queryHistoryEnabled: boolean;
   enableAutocomplete: boolean;
@@ -27,6 +28,7 @@ interface PanelListProps extends RouteComponentProps {
 
 export const PanelListContent: FC<PanelListProps> = ({
   metrics = [],
+  labels = [],
   useLocalTime,
   queryHistoryEnabled,
   enableAutocomplete,
@@ -101,6 +103,7 @@ export const PanelListContent: FC<PanelListProps> = ({
           }
           useLocalTime={useLocalTime}
           metricNames={metrics}
+          labelNames={labels}
           pastQueries={queryHistoryEnabled ? historyItems : []}
           enableAutocomplete={enableAutocomplete}
         />
@@ -120,6 +123,7 @@ const PanelList: FC<RouteComponentProps> = () => {
 
   const pathPrefix = usePathPrefix();
   const { response: metricsRes, error: metricsErr } = useFetch<string[]>(`${pathPrefix}/${API_PATH}/label/__name__/values`);
+  const { response: labelsRes } = useFetch<string[]>(`${pathPrefix}/${API_PATH}/labels`);
 
   const browserTime = new Date().getTime() / 1000;
   const { response: timeRes, error: timeErr } = useFetch<{ result: number[] }>(
@@ -183,6 +187,7 @@ const PanelList: FC<RouteComponentProps> = () => {
         panels={decodePanelOptionsFromQueryString(window.location.search)}
         useLocalTime={useLocalTime}
         metrics={metricsRes.data}
+        labels={labelsRes.data}
         queryHistoryEnabled={enableQueryHistory}
         enableAutocomplete={enableAutocomplete}
       />
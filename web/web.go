@@ -16,6 +16,7 @@ package web
 import (
 	"bytes"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -54,7 +55,9 @@ import (
 	"golang.org/x/net/netutil"
 
 	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/discovery"
 	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/pkg/logging"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/rules"
 	"github.com/prometheus/prometheus/scrape"
@@ -223,10 +226,13 @@ type Options struct {
 	ScrapeManager         *scrape.Manager
 	RuleManager           *rules.Manager
 	Notifier              *notifier.Manager
+	SDManagerScrape       *discovery.Manager
+	SDManagerNotify       *discovery.Manager
 	Version               *PrometheusVersion
 	Flags                 map[string]string
 
 	ListenAddress              string
+	WebConfigFile              string
 	CORSOrigin                 *regexp.Regexp
 	ReadTimeout                time.Duration
 	MaxConnections             int
@@ -237,11 +243,22 @@ type Options struct {
 	ConsoleTemplatesPath       string
 	ConsoleLibrariesPath       string
 	EnableLifecycle            bool
+	LifecycleToken             string
 	EnableAdminAPI             bool
+	EnableOTLPReceiver         bool
+	EnableInfluxReceiver       bool
+	RangeQuerySplitInterval    time.Duration
+	ManagedRulesDir            string
+	DynamicLogLevel            *logging.DynamicLevel
 	PageTitle                  string
 	RemoteReadSampleLimit      int
 	RemoteReadConcurrencyLimit int
 	RemoteReadBytesInFrame     int
+	MaxSeriesPerQuery          int
+	TenantLabel                string
+	TenantHeader               string
+	QueryClientRateLimit       float64
+	QueryClientMaxConcurrency  int
 
 	Gatherer   prometheus.Gatherer
 	Registerer prometheus.Registerer
@@ -295,6 +312,16 @@ func New(logger log.Logger, o *Options) *Handler {
 	factoryAr := func(_ context.Context) api_v1.AlertmanagerRetriever { return h.notifier }
 	FactoryRr := func(_ context.Context) api_v1.RulesRetriever { return h.ruleManager }
 
+	// Assigning a nil *discovery.Manager directly would yield a non-nil
+	// interface value.
+	var sdScrape, sdNotify api_v1.SDStatusRetriever
+	if o.SDManagerScrape != nil {
+		sdScrape = o.SDManagerScrape
+	}
+	if o.SDManagerNotify != nil {
+		sdNotify = o.SDManagerNotify
+	}
+
 	h.apiV1 = api_v1.NewAPI(h.queryEngine, h.storage, factoryTr, factoryAr,
 		func() config.Config {
 			h.mtx.RLock()
@@ -316,10 +343,27 @@ func New(logger log.Logger, o *Options) *Handler {
 		h.options.RemoteReadSampleLimit,
 		h.options.RemoteReadConcurrencyLimit,
 		h.options.RemoteReadBytesInFrame,
+		h.options.MaxSeriesPerQuery,
 		h.options.CORSOrigin,
 		h.runtimeInfo,
 		h.versionInfo,
 		o.Gatherer,
+		o.EnableOTLPReceiver,
+		h.storage,
+		o.TenantLabel,
+		o.TenantHeader,
+		o.QueryClientRateLimit,
+		o.QueryClientMaxConcurrency,
+		sdScrape,
+		sdNotify,
+		o.ManagedRulesDir,
+		func() error {
+			rc := make(chan error)
+			h.reloadCh <- rc
+			return <-rc
+		},
+		o.EnableInfluxReceiver,
+		o.RangeQuerySplitInterval,
 	)
 
 	if o.RoutePrefix != "/" {
@@ -423,10 +467,27 @@ func New(logger log.Logger, o *Options) *Handler {
 	}
 
 	if o.EnableLifecycle {
-		router.Post("/-/quit", h.quit)
-		router.Put("/-/quit", h.quit)
-		router.Post("/-/reload", h.reload)
-		router.Put("/-/reload", h.reload)
+		// Lifecycle endpoints may be gated behind a bearer token, separately
+		// from any web authentication, so that local automation can be given
+		// access without exposing the endpoints broadly.
+		authLifecycle := func(next http.HandlerFunc) http.HandlerFunc {
+			if o.LifecycleToken == "" {
+				return next
+			}
+			return func(w http.ResponseWriter, r *http.Request) {
+				token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+				if subtle.ConstantTimeCompare([]byte(token), []byte(o.LifecycleToken)) != 1 {
+					w.WriteHeader(http.StatusUnauthorized)
+					w.Write([]byte("Invalid lifecycle token."))
+					return
+				}
+				next(w, r)
+			}
+		}
+		router.Post("/-/quit", authLifecycle(h.quit))
+		router.Put("/-/quit", authLifecycle(h.quit))
+		router.Post("/-/reload", authLifecycle(h.reload))
+		router.Put("/-/reload", authLifecycle(h.reload))
 	} else {
 		forbiddenAPINotEnabled := func(w http.ResponseWriter, _ *http.Request) {
 			w.WriteHeader(http.StatusForbidden)
@@ -437,6 +498,19 @@ func New(logger log.Logger, o *Options) *Handler {
 		router.Post("/-/reload", forbiddenAPINotEnabled)
 		router.Put("/-/reload", forbiddenAPINotEnabled)
 	}
+	router.Get("/-/loglevel", h.logLevel)
+	if o.EnableAdminAPI {
+		router.Post("/-/loglevel", h.setLogLevel)
+		router.Put("/-/loglevel", h.setLogLevel)
+	} else {
+		forbiddenLogLevel := func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Admin APIs are not enabled."))
+		}
+		router.Post("/-/loglevel", forbiddenLogLevel)
+		router.Put("/-/loglevel", forbiddenLogLevel)
+	}
+
 	router.Get("/-/quit", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		w.Write([]byte("Only POST or PUT requests allowed"))
@@ -453,10 +527,22 @@ func New(logger log.Logger, o *Options) *Handler {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "Prometheus is Healthy.\n")
 	})
-	router.Get("/-/ready", readyf(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "Prometheus is Ready.\n")
-	}))
+	router.Get("/-/ready", func(w http.ResponseWriter, r *http.Request) {
+		if h.isReady() {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, "Prometheus is Ready.\n")
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "Service Unavailable")
+		// Give load balancers a hint why we are not ready yet.
+		if h.options.LocalStorage != nil {
+			if status, err := h.options.LocalStorage.WALReplayStatus(); err == nil && status.Max > 0 {
+				fmt.Fprintf(w, ": replaying WAL (segment %d/%d)", status.Current, status.Max)
+			}
+		}
+		fmt.Fprintf(w, "\n")
+	})
 
 	return h
 }
@@ -566,7 +652,7 @@ func (h *Handler) Run(ctx context.Context) error {
 
 	errCh := make(chan error)
 	go func() {
-		errCh <- httpSrv.Serve(listener)
+		errCh <- serveWithConfig(httpSrv, listener, h.options.WebConfigFile, h.logger)
 	}()
 
 	select {
@@ -802,6 +888,13 @@ func (h *Handler) runtimeInfo() (api_v1.RuntimeInfo, error) {
 		}
 		status.StorageRetention = status.StorageRetention + h.options.TSDBMaxBytes.String()
 	}
+	if h.options.TSDBDir != "" {
+		// Failure to stat the WAL, e.g. because it does not exist yet,
+		// just leaves the size at zero.
+		if size, err := dirSize(filepath.Join(h.options.TSDBDir, "wal")); err == nil {
+			status.WALSize = size
+		}
+	}
 
 	metrics, err := h.gatherer.Gather()
 	if err != nil {
@@ -820,6 +913,21 @@ func (h *Handler) runtimeInfo() (api_v1.RuntimeInfo, error) {
 	return status, nil
 }
 
+// dirSize returns the total size of the regular files below dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
 func toFloat64(f *io_prometheus_client.MetricFamily) float64 {
 	m := *f.Metric[0]
 	if m.Gauge != nil {
@@ -918,6 +1026,7 @@ func (h *Handler) version(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) quit(w http.ResponseWriter, r *http.Request) {
+	api_v1.AuditLog(h.logger, r, "quit", nil)
 	select {
 	case <-h.quitCh:
 		fmt.Fprintf(w, "Termination already in progress.")
@@ -930,11 +1039,35 @@ func (h *Handler) quit(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) reload(w http.ResponseWriter, r *http.Request) {
 	rc := make(chan error)
 	h.reloadCh <- rc
-	if err := <-rc; err != nil {
+	err := <-rc
+	api_v1.AuditLog(h.logger, r, "reload", err)
+	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
 	}
 }
 
+func (h *Handler) logLevel(w http.ResponseWriter, r *http.Request) {
+	if h.options.DynamicLogLevel == nil {
+		http.Error(w, "Runtime log level adjustment is not available.", http.StatusNotFound)
+		return
+	}
+	fmt.Fprintf(w, "Current log level is %q\n", h.options.DynamicLogLevel.Level())
+}
+
+func (h *Handler) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	if h.options.DynamicLogLevel == nil {
+		http.Error(w, "Runtime log level adjustment is not available.", http.StatusNotFound)
+		return
+	}
+	lvl := r.FormValue("level")
+	if err := h.options.DynamicLogLevel.SetLevel(lvl); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	level.Info(h.logger).Log("msg", "Log level changed via API", "level", lvl)
+	fmt.Fprintf(w, "Log level set to %q\n", lvl)
+}
+
 func (h *Handler) consolesPath() string {
 	if _, err := os.Stat(h.options.ConsoleTemplatesPath + "/index.html"); !os.IsNotExist(err) {
 		return h.options.ExternalURL.Path + "/consoles/index.html"
@@ -104,6 +104,24 @@ func (a *dbAdapter) Stats(statsByLabelName string) (*tsdb.Stats, error) {
 	return a.Head().Stats(statsByLabelName), nil
 }
 
+func (a *dbAdapter) WALReplayStatus() (tsdb.WALReplayStatus, error) {
+	return a.Head().WALReplayStatus(), nil
+}
+
+func (a *dbAdapter) CompactHead() error {
+	head := a.Head()
+	return a.DB.CompactHead(tsdb.NewRangeHead(head, head.MinTime(), head.MaxTime()))
+}
+
+func (a *dbAdapter) BlockMetas() ([]tsdb.BlockMeta, error) {
+	blocks := a.Blocks()
+	metas := make([]tsdb.BlockMeta, 0, len(blocks))
+	for _, b := range blocks {
+		metas = append(metas, b.Meta())
+	}
+	return metas, nil
+}
+
 func TestReadyAndHealthy(t *testing.T) {
 	t.Parallel()
 
@@ -506,6 +524,65 @@ func TestHandleMultipleQuitRequests(t *testing.T) {
 	}
 }
 
+func TestLifecycleTokenAuth(t *testing.T) {
+	opts := &Options{
+		ListenAddress:   "localhost:9392",
+		MaxConnections:  512,
+		EnableLifecycle: true,
+		LifecycleToken:  "secret-token",
+		RoutePrefix:     "/",
+		ExternalURL: &url.URL{
+			Scheme: "http",
+			Host:   "localhost:9392",
+			Path:   "/",
+		},
+	}
+	webHandler := New(nil, opts)
+	webHandler.config = &config.Config{}
+	webHandler.notifier = &notifier.Manager{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		err := webHandler.Run(ctx)
+		if err != nil {
+			panic(fmt.Sprintf("Can't start web handler:%s", err))
+		}
+	}()
+	go func() {
+		for rc := range webHandler.Reload() {
+			rc <- nil
+		}
+	}()
+
+	// Give some time for the web goroutine to run since we need the server
+	// to be up before starting tests.
+	time.Sleep(5 * time.Second)
+
+	// Without a token.
+	resp, err := http.Post("http://localhost:9392/-/reload", "", strings.NewReader(""))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	cleanupTestResponse(t, resp)
+
+	// With a wrong token.
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:9392/-/reload", strings.NewReader(""))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer wrong-token")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	cleanupTestResponse(t, resp)
+
+	// With the configured token.
+	req, err = http.NewRequest(http.MethodPost, "http://localhost:9392/-/reload", strings.NewReader(""))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	cleanupTestResponse(t, resp)
+}
+
 func cleanupTestResponse(t *testing.T, resp *http.Response) {
 	_, err := io.Copy(ioutil.Discard, resp.Body)
 	require.NoError(t, err)